@@ -0,0 +1,153 @@
+// Resumable image uploads for the gallery edit page, using the tus
+// protocol served at /galleries/:galleryId/uploads. Files are sent in
+// chunks, and an upload that is interrupted picks up from the last byte
+// the server received, even after the page is reloaded.
+(function () {
+	var TUS_VERSION = "1.0.0";
+	var CHUNK_SIZE = 5 * 1024 * 1024;
+	var RETRY_DELAYS = [1000, 3000, 5000, 10000, 20000];
+
+	function sleep(ms) {
+		return new Promise(function (resolve) {
+			setTimeout(resolve, ms);
+		});
+	}
+
+	// Requests that fail with one of these may succeed if tried again.
+	function retryable(status) {
+		return status === 0 || status === 409 || status === 423 || status >= 500;
+	}
+
+	function request(method, url, csrf, headers, body) {
+		headers = Object.assign({ "Tus-Resumable": TUS_VERSION, "X-CSRF-Token": csrf }, headers);
+		return fetch(url, {
+			method: method,
+			headers: headers,
+			body: body,
+			credentials: "same-origin",
+		}).catch(function () {
+			// Network failures look the same as a server that went away.
+			return { ok: false, status: 0, headers: new Headers(), text: function () { return Promise.resolve(""); } };
+		});
+	}
+
+	async function failure(res) {
+		var msg = (await res.text()).trim();
+		var err = new Error(msg || "Upload failed.");
+		err.status = res.status;
+		return err;
+	}
+
+	// The upload URL is remembered per file so that it can be resumed.
+	function storageKey(endpoint, file) {
+		return ["tus", endpoint, file.name, file.size, file.lastModified].join(":");
+	}
+
+	function encodeBase64(value) {
+		return btoa(unescape(encodeURIComponent(value)));
+	}
+
+	// encodeMetadata describes the file along with any extra metadata, such
+	// as what to do with duplicates, in an Upload-Metadata header.
+	function encodeMetadata(file, extra) {
+		var pairs = [
+			"filename " + encodeBase64(file.name),
+			"filetype " + encodeBase64(file.type || "application/octet-stream"),
+		];
+		Object.keys(extra || {}).forEach(function (key) {
+			pairs.push(key + " " + encodeBase64(extra[key]));
+		});
+		return pairs.join(",");
+	}
+
+	async function start(endpoint, file, csrf, metadata) {
+		var key = storageKey(endpoint, file);
+		var url = localStorage.getItem(key);
+		if (url) {
+			var res = await request("HEAD", url, csrf);
+			if (res.ok) {
+				return { url: url, offset: parseInt(res.headers.get("Upload-Offset"), 10) };
+			}
+			localStorage.removeItem(key);
+		}
+		var created = await request("POST", endpoint, csrf, {
+			"Upload-Length": String(file.size),
+			"Upload-Metadata": encodeMetadata(file, metadata),
+		});
+		if (created.status !== 201) {
+			throw await failure(created);
+		}
+		url = created.headers.get("Location");
+		localStorage.setItem(key, url);
+		return { url: url, offset: 0 };
+	}
+
+	async function send(endpoint, file, csrf, metadata, onProgress) {
+		var upload = await start(endpoint, file, csrf, metadata);
+		while (true) {
+			var end = Math.min(upload.offset + CHUNK_SIZE, file.size);
+			var res = await request(
+				"PATCH",
+				upload.url,
+				csrf,
+				{ "Content-Type": "application/offset+octet-stream", "Upload-Offset": String(upload.offset) },
+				file.slice(upload.offset, end)
+			);
+			if (!res.ok) {
+				throw await failure(res);
+			}
+			upload.offset = parseInt(res.headers.get("Upload-Offset"), 10);
+			onProgress(upload.offset);
+			if (upload.offset >= file.size) {
+				return;
+			}
+		}
+	}
+
+	// resumableUpload uploads a single file, retrying with a delay when the
+	// connection drops. Each retry starts by asking the server how much of
+	// the file it already has.
+	async function resumableUpload(endpoint, file, csrf, metadata, onProgress) {
+		var key = storageKey(endpoint, file);
+		for (var attempt = 0; ; attempt++) {
+			try {
+				await send(endpoint, file, csrf, metadata, onProgress);
+				localStorage.removeItem(key);
+				return;
+			} catch (err) {
+				if (!retryable(err.status) || attempt >= RETRY_DELAYS.length) {
+					localStorage.removeItem(key);
+					throw err;
+				}
+				await sleep(RETRY_DELAYS[attempt]);
+			}
+		}
+	}
+
+	// uploadFiles uploads each file in turn, reporting overall progress as
+	// a fraction, and resolves with the error messages of any that failed.
+	// metadata is sent along with every file.
+	async function uploadFiles(endpoint, files, csrf, metadata, onProgress) {
+		var total = 0;
+		var done = 0;
+		var errors = [];
+		for (var i = 0; i < files.length; i++) {
+			total += files[i].size;
+		}
+		for (var i = 0; i < files.length; i++) {
+			var file = files[i];
+			try {
+				await resumableUpload(endpoint, file, csrf, metadata, function (offset) {
+					onProgress((done + offset) / total);
+				});
+			} catch (err) {
+				errors.push(err.message.indexOf(file.name) === 0 ? err.message : file.name + ": " + err.message);
+			}
+			done += file.size;
+			onProgress(done / total);
+		}
+		return errors;
+	}
+
+	window.resumableUploads = { upload: uploadFiles };
+})();
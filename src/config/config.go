@@ -4,6 +4,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"os/exec"
+
+	"lenslocked/imaging"
+	"lenslocked/storage"
 )
 
 type PostgresConfig struct {
@@ -45,12 +49,126 @@ func DefaultHashKeyConfig() string {
 	return "default-hmac-key"
 }
 
+// StorageConfig selects where uploaded images are kept. Backend is either
+// "local", which keeps files beneath Path, or "s3". Use s3 when running
+// more than one instance of the app so they don't need a shared disk.
+type StorageConfig struct {
+	Backend string           `json:"backend"`
+	Path    string           `json:"path"`
+	S3      storage.S3Config `json:"s3"`
+}
+
+func DefaultStorageConfig() StorageConfig {
+	return StorageConfig{
+		Backend: "local",
+		Path:    "images",
+	}
+}
+
+// NewStorage creates the storage backend described by the config. An
+// empty config falls back to the default local storage.
+func (sc StorageConfig) NewStorage() (storage.Storage, error) {
+	switch sc.Backend {
+	case "", "local":
+		if sc.Path == "" {
+			sc.Path = DefaultStorageConfig().Path
+		}
+		return storage.NewLocal(sc.Path, "/images"), nil
+	case "s3":
+		return storage.NewS3(sc.S3), nil
+	default:
+		return nil, fmt.Errorf("config: unknown storage backend %q", sc.Backend)
+	}
+}
+
+// LimitsConfig caps how much each user can upload, in megabytes. A limit
+// of zero means there is no limit.
+type LimitsConfig struct {
+	MaxFileMB    int64 `json:"max_file_mb"`
+	MaxAccountMB int64 `json:"max_account_mb"`
+}
+
+func DefaultLimitsConfig() LimitsConfig {
+	return LimitsConfig{
+		MaxFileMB:    25,
+		MaxAccountMB: 1024,
+	}
+}
+
+// EncodersConfig points at the programs used to encode WebP and AVIF
+// derivatives. An empty path looks the program up on the PATH, and a
+// format is only served if its program can be found. Browsers are sent
+// JPEGs for any format that isn't.
+type EncodersConfig struct {
+	CWebP   string `json:"cwebp"`
+	AvifEnc string `json:"avifenc"`
+}
+
+// Register makes the formats whose programs can be found available to
+// derivatives, and returns the formats that were registered.
+func (ec EncodersConfig) Register() []imaging.Format {
+	var registered []imaging.Format
+	if path, err := lookPath(ec.CWebP, "cwebp"); err == nil {
+		imaging.RegisterEncoder(imaging.FormatWebP, imaging.CWebP(path))
+		registered = append(registered, imaging.FormatWebP)
+	}
+	if path, err := lookPath(ec.AvifEnc, "avifenc"); err == nil {
+		imaging.RegisterEncoder(imaging.FormatAVIF, imaging.AvifEnc(path))
+		registered = append(registered, imaging.FormatAVIF)
+	}
+	return registered
+}
+
+// DecodersConfig points at the programs used to decode uploaded images in
+// formats the standard library can't read. An empty path looks the program
+// up on the PATH. Uploads in a format whose program can't be found are
+// rejected, except for RAW files, which are decoded from their preview.
+type DecodersConfig struct {
+	DWebP   string `json:"dwebp"`
+	HeifDec string `json:"heif_dec"`
+	Magick  string `json:"magick"`
+}
+
+// Register makes the formats whose programs can be found available to
+// uploads, and returns the formats that were registered.
+func (dc DecodersConfig) Register() []string {
+	decoders := []struct {
+		format, configured, def string
+		decoder                 func(string) imaging.CommandDecoder
+	}{
+		{"webp", dc.DWebP, "dwebp", imaging.DWebP},
+		{"heic", dc.HeifDec, "heif-dec", imaging.HeifDec},
+		{"tiff", dc.Magick, "magick", imaging.Magick},
+	}
+	var registered []string
+	for _, d := range decoders {
+		if path, err := lookPath(d.configured, d.def); err == nil {
+			imaging.RegisterDecoder(d.format, d.decoder(path))
+			registered = append(registered, d.format)
+		}
+	}
+	return registered
+}
+
+// lookPath finds the configured program, or the one named def if none was
+// configured.
+func lookPath(configured, def string) (string, error) {
+	if configured == "" {
+		configured = def
+	}
+	return exec.LookPath(configured)
+}
+
 type AppConfig struct {
 	Port         int            `json:"port"`
 	Env          string         `json:"env"`
 	HmacKey      string         `json:"hmac_key"`
 	Database     PostgresConfig `json:"database"`
 	TestDatabase PostgresConfig `json:"test_database"`
+	Storage      StorageConfig  `json:"storage"`
+	Limits       LimitsConfig   `json:"limits"`
+	Encoders     EncodersConfig `json:"encoders"`
+	Decoders     DecodersConfig `json:"decoders"`
 }
 
 func DefaultConfig() AppConfig {
@@ -59,6 +177,8 @@ func DefaultConfig() AppConfig {
 		Env:      "dev",
 		HmacKey:  DefaultHashKeyConfig(),
 		Database: DefaultPostgresConfig(),
+		Storage:  DefaultStorageConfig(),
+		Limits:   DefaultLimitsConfig(),
 	}
 }
 
@@ -2,12 +2,14 @@ package context
 
 import (
 	"context"
+	"log"
 
 	"lenslocked/models/usersModel"
 )
 
 const (
-	userKey privateKey = "user"
+	userKey            privateKey = "user"
+	pendingCommentsKey privateKey = "pendingComments"
 )
 
 type privateKey string
@@ -26,3 +28,25 @@ func User(ctx context.Context) *usersModel.User {
 	}
 	return nil
 }
+
+// WithPendingComments stores a function that counts the comments waiting
+// for the user's approval. It is only called once a page is rendered, so
+// requests for images and other files don't pay for the query.
+func WithPendingComments(ctx context.Context, count func() (int, error)) context.Context {
+	return context.WithValue(ctx, pendingCommentsKey, count)
+}
+
+// PendingComments counts the comments waiting for the user's approval, or
+// returns zero if they can't be counted.
+func PendingComments(ctx context.Context) int {
+	count, ok := ctx.Value(pendingCommentsKey).(func() (int, error))
+	if !ok {
+		return 0
+	}
+	n, err := count()
+	if err != nil {
+		log.Println(err)
+		return 0
+	}
+	return n
+}
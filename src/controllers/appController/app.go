@@ -4,14 +4,20 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"lenslocked/config"
 	"lenslocked/controllers/galleriesController"
+	"lenslocked/controllers/imagesController"
 	"lenslocked/controllers/staticController"
+	"lenslocked/controllers/uploadsController"
 	"lenslocked/controllers/usersController"
+	"lenslocked/imaging"
 	mw "lenslocked/middleware"
 	"lenslocked/models/errorsModel"
+	"lenslocked/models/imagesModel"
 	"lenslocked/models/servicesModel"
+	"lenslocked/models/uploadsModel"
 	"lenslocked/routers"
 
 	"github.com/labstack/echo/v4"
@@ -23,7 +29,6 @@ type App struct {
 	Controllers *AppController
 	Services    *servicesModel.Services
 	AppRouter   *routers.AppRouter
-	ImageServer http.Handler
 	AssetServer http.Handler
 }
 
@@ -31,24 +36,40 @@ type AppController struct {
 	Static    *staticController.Static
 	Users     *usersController.UsersController
 	Galleries *galleriesController.GalleriesController
+	Images    *imagesController.ImagesController
+	Uploads   *uploadsController.UploadsController
 }
 
 func NewApp(configRequired bool) *App {
 	cfg := config.LoadConfig(configRequired, "config.json")
 	dbCfg := config.DefaultPostgresConfig()
+	store, err := cfg.Storage.NewStorage()
+	errorsModel.Must(err, "Could not initialize storage.")
+	log.Println("Image formats:", append([]imaging.Format{imaging.FormatJPEG}, cfg.Encoders.Register()...))
+	log.Println("Extra upload formats:", cfg.Decoders.Register())
 
 	// Create Services
 	services, err := servicesModel.NewServices(
 		servicesModel.WithGorm(dbCfg.Dialect(), dbCfg.ConnectionInfo()),
 		servicesModel.WithUser(config.DefaultHashKeyConfig()),
 		servicesModel.WithGallery(),
-		servicesModel.WithImages(),
+		servicesModel.WithStorage(store),
+		servicesModel.WithImages(cfg.HmacKey, imageLimits(cfg.Limits)),
+		servicesModel.WithUploads(),
+		servicesModel.WithProofing(),
+		servicesModel.WithComments(cfg.HmacKey),
 		servicesModel.WithLogMode(cfg.IsDev()),
 	)
 	errorsModel.Must(err, "Could not initialize services.")
 
 	// Run migrations
 	services.AutoMigrate()
+	if err := services.Image.ImportLegacy(); err != nil {
+		log.Println("Could not import images stored before the database:", err)
+	}
+	if err := services.Image.BackfillUsage(); err != nil {
+		log.Println("Could not backfill storage usage:", err)
+	}
 
 	// Destructive Reset if AutoMigrate won't work.
 	// services.DestructiveReset()
@@ -58,7 +79,6 @@ func NewApp(configRequired bool) *App {
 		Config:      cfg,
 		Services:    services,
 		Controllers: appC,
-		ImageServer: http.FileServer(http.Dir("./images/galleries/")),
 		AssetServer: http.FileServer(http.Dir("./assets/")),
 	}
 	app.AppRouter = app.NewAppRouter()
@@ -66,14 +86,27 @@ func NewApp(configRequired bool) *App {
 	return app
 }
 
+// imageLimits converts the configured limits, in megabytes, to the byte
+// limits used by the ImageService.
+func imageLimits(lc config.LimitsConfig) imagesModel.Limits {
+	return imagesModel.Limits{
+		MaxFileSize:    lc.MaxFileMB << 20,
+		MaxAccountSize: lc.MaxAccountMB << 20,
+	}
+}
+
 func NewAppController(s *servicesModel.Services) *AppController {
 	staticC := staticController.NewStatic()
 	usersC := usersController.NewUsersController(s.User)
-	galleriesC := galleriesController.NewGalleriesController(s.Gallery, s.Image)
+	galleriesC := galleriesController.NewGalleriesController(s.Gallery, s.Image, s.Proofing, s.Comment)
+	imagesC := imagesController.NewImagesController(s.Image, s.Gallery, s.Storage)
+	uploadsC := uploadsController.NewUploadsController(s.Gallery, s.Image, s.Upload)
 	return &AppController{
 		Static:    staticC,
 		Users:     usersC,
 		Galleries: galleriesC,
+		Images:    imagesC,
+		Uploads:   uploadsC,
 	}
 }
 
@@ -81,6 +114,7 @@ func (app *App) NewAppRouter() *routers.AppRouter {
 	userMw := mw.User{
 		UserService:    app.Services.User,
 		GalleryService: app.Services.Gallery,
+		CommentService: app.Services.Comment,
 	}
 	requireUser := mw.RequireUser{
 		User: userMw,
@@ -108,10 +142,29 @@ func (app *App) Run() {
 	} else {
 		addr = fmt.Sprintf("localhost:%d", app.Config.Port)
 	}
+	go app.expireUploads()
 	log.Println("Listening on:", addr)
 	log.Fatal(http.ListenAndServe(addr, app.AppRouter.Router))
 }
 
+// expireUploads removes resumable uploads that have stopped receiving
+// data, checking every uploadsModel.EXPIRY_INTERVAL for as long as the
+// app is running.
+func (app *App) expireUploads() {
+	ticker := time.NewTicker(uploadsModel.EXPIRY_INTERVAL)
+	defer ticker.Stop()
+	for {
+		removed, err := app.Services.Upload.RemoveExpired()
+		if err != nil {
+			log.Println("Could not remove expired uploads:", err)
+		}
+		if removed > 0 {
+			log.Println("Removed expired uploads:", removed)
+		}
+		<-ticker.C
+	}
+}
+
 func (app *App) appMiddleware(ar *routers.AppRouter) {
 	r := ar.Router
 	r.Use(middleware.RequestID())
@@ -119,11 +172,31 @@ func (app *App) appMiddleware(ar *routers.AppRouter) {
 	r.Use(middleware.Recover())
 	r.Use(echo.WrapMiddleware(ar.Middleware.UserMW.Invoke))
 	r.Pre(middleware.RemoveTrailingSlash())
+	// Forms send the token as a field. Routes that stream uploaded files
+	// only accept it as a header, since looking for a field would read the
+	// whole body before the handler can enforce upload limits.
+	streamed := func(c echo.Context) bool {
+		return streamedUploadRoutes[c.Path()]
+	}
 	r.Use(middleware.CSRFWithConfig(middleware.CSRFConfig{
-		TokenLookup: "form:csrf",
+		TokenLookup: "header:" + echo.HeaderXCSRFToken + ",form:csrf",
+		Skipper:     streamed,
+	}))
+	r.Use(middleware.CSRFWithConfig(middleware.CSRFConfig{
+		TokenLookup: "header:" + echo.HeaderXCSRFToken,
+		Skipper:     func(c echo.Context) bool { return !streamed(c) },
 	}))
 }
 
+// streamedUploadRoutes are the routes whose handlers read uploaded files
+// straight from the request body.
+var streamedUploadRoutes = map[string]bool{
+	"/galleries/:galleryId/images":            true,
+	"/galleries/:galleryId/import":            true,
+	"/galleries/:galleryId/uploads":           true,
+	"/galleries/:galleryId/uploads/:uploadId": true,
+}
+
 func (app *App) AddRoutes(ar *routers.AppRouter) {
 	app.AddRoute(ar, app.appMiddleware)
 	app.AddRoute(ar, app.defaultRoute)
@@ -138,6 +211,7 @@ func (app *App) defaultRoute(ar *routers.AppRouter) {
 	app.AddRoute(ar, app.loginRoutes)
 	app.AddRoute(ar, app.logoutRoutes)
 	app.AddRoute(ar, app.galleriesRoutes)
+	app.AddRoute(ar, app.publicGalleriesRoutes)
 	app.AddRoute(ar, app.imagesRoutes)
 	app.AddRoute(ar, app.assetsRoutes)
 }
@@ -175,17 +249,58 @@ func (app *App) galleriesRoutes(ar *routers.AppRouter) {
 	galleries.GET("", app.Controllers.Galleries.Index)
 	galleries.POST("", app.Controllers.Galleries.Create)
 	galleries.GET("/new", app.Controllers.Galleries.New)
-	galleries.GET("/:galleryId", app.Controllers.Galleries.Show)
+	galleries.GET("/colours", app.Controllers.Galleries.Colours)
+	galleries.GET("/comments", app.Controllers.Galleries.Comments)
+	galleries.POST("/comments/:commentId/approve", app.Controllers.Galleries.CommentApprove)
+	galleries.POST("/comments/:commentId/delete", app.Controllers.Galleries.CommentDelete)
+	galleries.POST("/comments/:commentId/block", app.Controllers.Galleries.CommentBlock)
+	galleries.POST("/comments/blocks/:blockId/delete", app.Controllers.Galleries.BlockDelete)
 	galleries.GET("/:galleryId/edit", app.Controllers.Galleries.Edit)
 	galleries.POST("/:galleryId/update", app.Controllers.Galleries.Update)
 	galleries.POST("/:galleryId/delete", app.Controllers.Galleries.Delete)
 	galleries.POST("/:galleryId/images", app.Controllers.Galleries.ImageUpload)
-	galleries.POST("/:galleryId/images/:filename/delete", app.Controllers.Galleries.ImageDelete)
+	galleries.POST("/:galleryId/import", app.Controllers.Galleries.ImageImport)
+	galleries.POST("/:galleryId/watermark", app.Controllers.Galleries.WatermarkUpdate)
+	galleries.POST("/:galleryId/images/order", app.Controllers.Galleries.ImagesOrder)
+	galleries.POST("/:galleryId/images/batch", app.Controllers.Galleries.ImagesBatch)
+	galleries.GET("/:galleryId/images/:imageId/edit", app.Controllers.Galleries.ImageEdit)
+	galleries.POST("/:galleryId/images/:imageId/transform", app.Controllers.Galleries.ImageTransform)
+	galleries.POST("/:galleryId/images/:imageId/delete", app.Controllers.Galleries.ImageDelete)
+	galleries.POST("/:galleryId/images/:imageId/update", app.Controllers.Galleries.ImageUpdate)
+	galleries.POST("/:galleryId/images/:imageId/cover", app.Controllers.Galleries.ImageCover)
+	galleries.GET("/:galleryId/images/:imageId/link", app.Controllers.Galleries.ImageLink)
+	galleries.POST("/:galleryId/transfer", app.Controllers.Galleries.TransferSubmit)
+	galleries.GET("/:galleryId/similar", app.Controllers.Galleries.Similar)
+	galleries.GET("/:galleryId/proofing", app.Controllers.Galleries.Proofing)
+	galleries.GET("/:galleryId/proofing/:clientId/export", app.Controllers.Galleries.ProofingExport)
+	galleries.POST("/:galleryId/similar/delete", app.Controllers.Galleries.SimilarDelete)
+	galleries.OPTIONS("/:galleryId/uploads", app.Controllers.Uploads.Options)
+	galleries.POST("/:galleryId/uploads", app.Controllers.Uploads.Create)
+	galleries.HEAD("/:galleryId/uploads/:uploadId", app.Controllers.Uploads.Head)
+	galleries.PATCH("/:galleryId/uploads/:uploadId", app.Controllers.Uploads.Patch)
+	galleries.DELETE("/:galleryId/uploads/:uploadId", app.Controllers.Uploads.Delete)
+}
+
+// publicGalleriesRoutes are the gallery pages that visitors who aren't
+// logged in can see if the gallery is public.
+func (app *App) publicGalleriesRoutes(ar *routers.AppRouter) {
+	r := ar.Router
+	galleries := r.Group("/galleries")
+	galleries.GET("/:galleryId", app.Controllers.Galleries.Show)
+	galleries.GET("/:galleryId/download", app.Controllers.Galleries.Download)
+	galleries.GET("/:galleryId/images/:imageId", app.Controllers.Galleries.Image)
+	galleries.POST("/:galleryId/images/:imageId/pick", app.Controllers.Galleries.ImagePick)
+	galleries.POST("/:galleryId/proofing/join", app.Controllers.Galleries.ProofingJoin)
+	galleries.POST("/:galleryId/proofing/submit", app.Controllers.Galleries.ProofingSubmit)
+	galleries.POST("/:galleryId/comments", app.Controllers.Galleries.CommentCreate)
+	galleries.POST("/:galleryId/images/:imageId/comments", app.Controllers.Galleries.CommentCreate)
 }
 
 func (app *App) imagesRoutes(ar *routers.AppRouter) {
 	r := ar.Router
-	r.Static("/images", "images")
+	images := r.Group("/images")
+	images.GET("/galleries/:galleryId/:name", app.Controllers.Images.Show)
+	images.HEAD("/galleries/:galleryId/:name", app.Controllers.Images.Show)
 }
 
 func (app *App) assetsRoutes(ar *routers.AppRouter) {
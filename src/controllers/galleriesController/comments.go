@@ -0,0 +1,314 @@
+package galleriesController
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+
+	"lenslocked/context"
+	"lenslocked/models/commentsModel"
+	"lenslocked/models/errorsModel"
+	"lenslocked/models/galleriesModel"
+	"lenslocked/views"
+
+	"github.com/labstack/echo/v4"
+)
+
+// commentSection is what the comments on a gallery or image page are
+// rendered with. ImageID is zero for comments on the gallery itself, and
+// UserID is the viewer's, or zero for visitors who aren't logged in.
+// Comments are in thread order, each followed by its replies.
+type commentSection struct {
+	GalleryID uint
+	ImageID   uint
+	UserID    uint
+	Owner     bool
+	Comments  []commentsModel.Comment
+}
+
+// Path is the page the comments are shown on.
+func (cs commentSection) Path() string {
+	return commentPath(cs.GalleryID, cs.ImageID)
+}
+
+// Reply is what the form for replying to the comment with parentID is
+// rendered with, or for starting a new thread if parentID is zero.
+func (cs commentSection) Reply(parentID uint) commentForm {
+	return commentForm{Section: cs, ParentID: parentID}
+}
+
+// commentForm is what a form for posting a comment is rendered with.
+type commentForm struct {
+	Section  commentSection
+	ParentID uint
+}
+
+// commentQueue is what the owner's moderation queue is rendered with.
+type commentQueue struct {
+	Comments []queuedComment
+	Blocks   []commentsModel.Block
+}
+
+// queuedComment is a comment waiting for approval and the gallery it was
+// left on.
+type queuedComment struct {
+	commentsModel.Comment
+	Gallery *galleriesModel.Gallery
+}
+
+// Path is the page the comment is shown on.
+func (qc queuedComment) Path() string {
+	return commentPath(qc.GalleryID, qc.ImageID)
+}
+
+// Used by everyone who can see a gallery to comment on it or one of its
+// images, or to reply to another comment. Comments wait for the owner to
+// approve them unless the owner wrote them.
+//
+// POST /galleries/:galleryId/comments
+// POST /galleries/:galleryId/images/:imageId/comments
+func (gc *GalleriesController) CommentCreate(c echo.Context) error {
+	r := c.Request()
+	w := c.Response().Writer
+	gallery, err := gc.galleryById(c)
+	if err != nil {
+		return err
+	}
+	userID := viewerID(r)
+	if !gallery.VisibleTo(userID) {
+		var vd views.Data
+		vd.SetAlert(errorsModel.ErrGalleryNotFound)
+		gc.ShowView.Render(w, r, vd)
+		return nil
+	}
+	var imageID uint
+	if param := c.Param("imageId"); param != "" {
+		id, _ := strconv.ParseUint(param, 10, 64)
+		imageID = uint(id)
+		found := false
+		for _, image := range gallery.Images {
+			found = found || image.ID == imageID
+		}
+		if !found {
+			return redirectError(w, r, commentPath(gallery.ID, 0), errorsModel.ErrImageNotFound)
+		}
+	}
+	rdrPath := commentPath(gallery.ID, imageID)
+	var form CommentForm
+	if err := form.Bind(r); err != nil {
+		return redirectError(w, r, rdrPath+"#comments", err)
+	}
+	comment := &commentsModel.Comment{
+		GalleryID: gallery.ID,
+		ImageID:   imageID,
+		ParentID:  form.ParentID,
+		UserID:    userID,
+		Name:      form.Name,
+		Body:      form.Body,
+		Commenter: gc.commentService.Commenter(userID, remoteIP(r)),
+	}
+	if user := context.User(r.Context()); user != nil {
+		comment.Name = user.Name
+	}
+	if err := gc.commentService.Post(comment, gallery.UserID); err != nil {
+		return redirectError(w, r, rdrPath+"#comments", err)
+	}
+	alert := views.Alert{
+		Level:   views.AlertLevelSuccess,
+		Message: "Thanks for your comment. It will be shown once the owner of the gallery has approved it.",
+	}
+	if comment.Approved() {
+		alert.Message = "Your comment has been posted."
+	}
+	views.RedirectAlert(w, r, fmt.Sprintf("%s#comment-%d", rdrPath, comment.ID), http.StatusFound, alert)
+	return nil
+}
+
+// Shows the owner the comments on their galleries that are waiting for
+// approval, and the commenters they have blocked.
+//
+// GET /galleries/comments
+func (gc *GalleriesController) Comments(c echo.Context) error {
+	r := c.Request()
+	w := c.Response().Writer
+	user := context.User(r.Context())
+	pending, err := gc.commentService.Pending(user.ID)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+		return err
+	}
+	galleries, err := gc.galleryService.ByUserID(user.ID)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+		return err
+	}
+	blocks, err := gc.commentService.Blocks(user.ID)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+		return err
+	}
+	byID := make(map[uint]*galleriesModel.Gallery, len(galleries))
+	for i := range galleries {
+		byID[galleries[i].ID] = &galleries[i]
+	}
+	var page commentQueue
+	for _, comment := range pending {
+		page.Comments = append(page.Comments, queuedComment{Comment: comment, Gallery: byID[comment.GalleryID]})
+	}
+	page.Blocks = blocks
+	var vd views.Data
+	vd.Payload = page
+	gc.CommentsView.Render(w, r, vd)
+	return nil
+}
+
+// Used by the owner of a gallery to show a comment to everyone.
+//
+// POST /galleries/comments/:commentId/approve
+func (gc *GalleriesController) CommentApprove(c echo.Context) error {
+	r := c.Request()
+	w := c.Response().Writer
+	comment, rdrPath := gc.ownedComment(c)
+	if comment == nil {
+		return redirectError(w, r, rdrPath, errorsModel.ErrCommentNotFound)
+	}
+	if err := gc.commentService.Approve(comment); err != nil {
+		return redirectError(w, r, rdrPath, err)
+	}
+	views.RedirectAlert(w, r, rdrPath, http.StatusFound, views.Alert{
+		Level:   views.AlertLevelSuccess,
+		Message: fmt.Sprintf("The comment from %s is now shown to everyone.", comment.Name),
+	})
+	return nil
+}
+
+// Used by the owner of a gallery to delete a comment and the replies to
+// it.
+//
+// POST /galleries/comments/:commentId/delete
+func (gc *GalleriesController) CommentDelete(c echo.Context) error {
+	r := c.Request()
+	w := c.Response().Writer
+	comment, rdrPath := gc.ownedComment(c)
+	if comment == nil {
+		return redirectError(w, r, rdrPath, errorsModel.ErrCommentNotFound)
+	}
+	if err := gc.commentService.Remove(comment); err != nil {
+		return redirectError(w, r, rdrPath, err)
+	}
+	views.RedirectAlert(w, r, rdrPath, http.StatusFound, views.Alert{
+		Level:   views.AlertLevelSuccess,
+		Message: fmt.Sprintf("The comment from %s was deleted.", comment.Name),
+	})
+	return nil
+}
+
+// Used by the owner of a gallery to stop whoever wrote a comment from
+// commenting on any of their galleries. The comments they have left that
+// are still waiting for approval are deleted.
+//
+// POST /galleries/comments/:commentId/block
+func (gc *GalleriesController) CommentBlock(c echo.Context) error {
+	r := c.Request()
+	w := c.Response().Writer
+	user := context.User(r.Context())
+	comment, rdrPath := gc.ownedComment(c)
+	if comment == nil {
+		return redirectError(w, r, rdrPath, errorsModel.ErrCommentNotFound)
+	}
+	if err := gc.commentService.Block(user.ID, comment); err != nil {
+		return redirectError(w, r, rdrPath, err)
+	}
+	views.RedirectAlert(w, r, rdrPath, http.StatusFound, views.Alert{
+		Level:   views.AlertLevelSuccess,
+		Message: fmt.Sprintf("%s can no longer comment on your galleries.", comment.Name),
+	})
+	return nil
+}
+
+// Used by the owner to let a commenter they blocked comment again.
+//
+// POST /galleries/comments/blocks/:blockId/delete
+func (gc *GalleriesController) BlockDelete(c echo.Context) error {
+	r := c.Request()
+	w := c.Response().Writer
+	user := context.User(r.Context())
+	blockID, _ := strconv.ParseUint(c.Param("blockId"), 10, 64)
+	if err := gc.commentService.DeleteBlock(user.ID, uint(blockID)); err != nil {
+		return redirectError(w, r, "/galleries/comments", err)
+	}
+	views.RedirectAlert(w, r, "/galleries/comments", http.StatusFound, views.Alert{
+		Level:   views.AlertLevelSuccess,
+		Message: "The commenter can comment on your galleries again.",
+	})
+	return nil
+}
+
+// ownedComment looks up the comment in the URL for the owner of the
+// gallery it was left on, and where to send them back to afterwards. The
+// comment is nil if it can't be found or is on someone else's gallery.
+func (gc *GalleriesController) ownedComment(c echo.Context) (*commentsModel.Comment, string) {
+	r := c.Request()
+	user := context.User(r.Context())
+	rdrPath := "/galleries/comments"
+	id, err := strconv.ParseUint(c.Param("commentId"), 10, 64)
+	if err != nil {
+		return nil, rdrPath
+	}
+	comment, err := gc.commentService.ByID(uint(id))
+	if err != nil {
+		return nil, rdrPath
+	}
+	gallery, err := gc.galleryService.ByID(comment.GalleryID)
+	if err != nil || gallery.UserID != user.ID {
+		return nil, rdrPath
+	}
+	// Actions taken from the page the comment is on go back there.
+	if r.PostFormValue("return") == "page" {
+		rdrPath = commentPath(comment.GalleryID, comment.ImageID) + "#comments"
+	}
+	return comment, rdrPath
+}
+
+// commentSection reads the comments on the gallery, or on one of its
+// images, that the viewer can see.
+func (gc *GalleriesController) commentSection(r *http.Request, gallery *galleriesModel.Gallery, imageID uint, owner bool) (commentSection, error) {
+	userID := viewerID(r)
+	commenter := gc.commentService.Commenter(userID, remoteIP(r))
+	comments, err := gc.commentService.Thread(gallery.ID, imageID, owner, commenter)
+	if err != nil {
+		return commentSection{}, err
+	}
+	return commentSection{
+		GalleryID: gallery.ID,
+		ImageID:   imageID,
+		UserID:    userID,
+		Owner:     owner,
+		Comments:  comments,
+	}, nil
+}
+
+// commentPath is the page comments on the gallery, or on one of its images
+// if imageID isn't zero, are shown on.
+func commentPath(galleryID, imageID uint) string {
+	if imageID != 0 {
+		return fmt.Sprintf("/galleries/%d/images/%d", galleryID, imageID)
+	}
+	return fmt.Sprintf("/galleries/%d", galleryID)
+}
+
+// remoteIP is the address the request came from. Headers like
+// X-Forwarded-For are ignored because anyone can set them, which would
+// let visitors get around rate limits and blocks.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -1,16 +1,208 @@
 package galleriesController
 
 import (
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
+
+	"lenslocked/models/errorsModel"
+	"lenslocked/models/imagesModel"
 )
 
 // The contents of the gallery form which may be null
 type GalleryForm struct {
-	Title string
+	Title          string
+	Visibility     string
+	Proofing       bool
+	SelectionLimit int
 }
 
 // The bind method checks to ensure that both email and password were provided in the form.
+// An empty selection limit means there is no limit.
 func (gf *GalleryForm) Bind(r *http.Request) error {
 	gf.Title = r.PostFormValue("title")
+	gf.Visibility = r.PostFormValue("visibility")
+	gf.Proofing = r.PostFormValue("proofing") != ""
+	gf.SelectionLimit = 0
+	if limit := r.PostFormValue("selectionLimit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			return errorsModel.ErrSelectionLimitInvalid
+		}
+		gf.SelectionLimit = n
+	}
+	return nil
+}
+
+// The name a visitor gives when they start picking images.
+type ClientForm struct {
+	Name string
+}
+
+// The bind method reads the name. It is checked when the client is created.
+func (cf *ClientForm) Bind(r *http.Request) error {
+	cf.Name = r.PostFormValue("name")
+	return nil
+}
+
+// A comment left on a gallery or image. ParentID is the comment being
+// replied to, or zero for a new thread.
+type CommentForm struct {
+	Name     string
+	Body     string
+	ParentID uint
+}
+
+// The bind method reads the comment. Visitors who are logged in don't
+// send a name, and a parent that isn't a number starts a new thread.
+func (cf *CommentForm) Bind(r *http.Request) error {
+	cf.Name = r.PostFormValue("name")
+	cf.Body = r.PostFormValue("body")
+	parentID, _ := strconv.ParseUint(r.PostFormValue("parent"), 10, 64)
+	cf.ParentID = uint(parentID)
+	return nil
+}
+
+// The details the owner can edit for an image.
+type ImageForm struct {
+	Caption string
+	AltText string
+}
+
+// The bind method reads the caption and alt text. Both are optional.
+func (imf *ImageForm) Bind(r *http.Request) error {
+	imf.Caption = r.PostFormValue("caption")
+	imf.AltText = r.PostFormValue("alt")
+	return nil
+}
+
+// The images selected with the checkboxes on a page listing images, or
+// listed in their new order when reordering.
+type ImagesForm struct {
+	ImageIDs []uint
+}
+
+// The bind method reads the IDs of the selected images from the query
+// string or the form. IDs that aren't numbers can't belong to an image,
+// so they are left out.
+func (imf *ImagesForm) Bind(r *http.Request) error {
+	if err := r.ParseForm(); err != nil {
+		return err
+	}
+	imf.ImageIDs = nil
+	for _, value := range r.Form["images"] {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		imf.ImageIDs = append(imf.ImageIDs, uint(id))
+	}
+	return nil
+}
+
+// The images to move or copy and where to.
+type TransferForm struct {
+	ImagesForm
+	ToGalleryID uint
+	Mode        string
+}
+
+// The bind method reads the selected images, the destination gallery and
+// whether to move or copy the images.
+func (tf *TransferForm) Bind(r *http.Request) error {
+	if err := tf.ImagesForm.Bind(r); err != nil {
+		return err
+	}
+	id, err := strconv.ParseUint(r.PostFormValue("to"), 10, 64)
+	if err != nil {
+		return errorsModel.ErrGalleryNotFound
+	}
+	tf.ToGalleryID = uint(id)
+	tf.Mode = r.PostFormValue("mode")
+	return nil
+}
+
+// The action to take on the images selected on the edit page.
+type BatchForm struct {
+	ImagesForm
+	Action  string
+	Caption string
+}
+
+// The bind method reads the selected images, which button was pressed and
+// the caption to give the images if that is the action.
+func (bf *BatchForm) Bind(r *http.Request) error {
+	if err := bf.ImagesForm.Bind(r); err != nil {
+		return err
+	}
+	bf.Action = r.PostFormValue("action")
+	bf.Caption = r.PostFormValue("caption")
+	return nil
+}
+
+// An edit to make to an image from its detail page. Crops are sent as
+// percentages of the image's width and height.
+type TransformForm struct {
+	Op        string
+	Transform imagesModel.Transform
+}
+
+// The bind method reads which edit to make. Values that aren't numbers
+// are read as 0, which fails validation unless the edit isn't a crop.
+func (tf *TransformForm) Bind(r *http.Request) error {
+	tf.Op = r.PostFormValue("op")
+	tf.Transform = imagesModel.Transform{Op: imagesModel.TransformOp(tf.Op)}
+	if tf.Transform.Op != imagesModel.TransformCrop {
+		return nil
+	}
+	percent := func(name string) float64 {
+		f, _ := strconv.ParseFloat(r.PostFormValue(name), 64)
+		return f / 100
+	}
+	tf.Transform.X = percent("x")
+	tf.Transform.Y = percent("y")
+	tf.Transform.W = percent("w")
+	tf.Transform.H = percent("h")
+	return nil
+}
+
+// The watermark settings from the edit page. Mark is the PNG uploaded to
+// use as the watermark, if there is one.
+type WatermarkForm struct {
+	Text       string
+	Position   string
+	Opacity    int
+	Scale      int
+	RemoveMark bool
+	Mark       io.Reader
+}
+
+// The bind method reads the settings from the multipart form. Numbers
+// that can't be read are left as 0 for the gallery validator to reject or
+// replace with the default.
+func (wf *WatermarkForm) Bind(r *http.Request) error {
+	// Leave room for the rest of the form on top of the largest mark.
+	if err := r.ParseMultipartForm(imagesModel.MAX_WATERMARK_SIZE + 64<<10); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return errorsModel.ErrWatermarkImageTooLarge
+		}
+		return err
+	}
+	wf.Text = r.PostFormValue("text")
+	wf.Position = r.PostFormValue("position")
+	wf.Opacity, _ = strconv.Atoi(r.PostFormValue("opacity"))
+	wf.Scale, _ = strconv.Atoi(r.PostFormValue("scale"))
+	wf.RemoveMark = r.PostFormValue("remove") != ""
+	if f, header, err := r.FormFile("mark"); err == nil && header.Filename != "" {
+		// The CSRF check may have read the form before the body limit was
+		// set, so the mark's own size is checked as well.
+		if header.Size > imagesModel.MAX_WATERMARK_SIZE {
+			f.Close()
+			return errorsModel.ErrWatermarkImageTooLarge
+		}
+		wf.Mark = f
+	}
 	return nil
 }
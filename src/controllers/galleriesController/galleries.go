@@ -3,46 +3,167 @@ package galleriesController
 import (
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"lenslocked/context"
+	"lenslocked/models/commentsModel"
 	"lenslocked/models/errorsModel"
 	"lenslocked/models/galleriesModel"
 	"lenslocked/models/imagesModel"
+	"lenslocked/models/proofingModel"
 	"lenslocked/views"
 
 	"github.com/labstack/echo/v4"
 )
 
 const (
-	// The bit shift is to convert to MB. In the case below, we have
-	// 1 << 20 to represent 1 MB.
-	MAX_MULTIPART_MEMORY = 1 << 20
+	// DEFAULT_SHARE_LINK_TTL is used when no valid lifetime is chosen for
+	// a shared image link.
+	DEFAULT_SHARE_LINK_TTL = 24 * time.Hour
 )
 
+// shareLinkTTLs are the lifetimes an owner can choose from when creating
+// a link to share a single image.
+var shareLinkTTLs = map[string]time.Duration{
+	"1h":   time.Hour,
+	"24h":  24 * time.Hour,
+	"168h": 7 * 24 * time.Hour,
+	"720h": 30 * 24 * time.Hour,
+}
+
+// indexPage is what the galleries index view is rendered with.
+type indexPage struct {
+	Galleries       []galleriesModel.Gallery
+	Usage           *imagesModel.Usage
+	PendingComments int
+}
+
+// showPage is what the gallery view is rendered with. Owner is set when
+// the gallery is being viewed by its owner, and Colour when only the
+// images matching it are shown.
+//
+// CanPick is set when the viewer can pick images from the gallery, and
+// Client is who they are picking as once they have started. Comments are
+// the ones left on the gallery itself.
+type showPage struct {
+	*galleriesModel.Gallery
+	Owner    bool
+	Colour   string
+	CanPick  bool
+	Client   *proofingModel.Client
+	Comments commentSection
+}
+
+// colourPage is what the colour search view is rendered with. Colour is
+// empty until a colour has been searched for.
+type colourPage struct {
+	Colour  string
+	Results []colourResult
+}
+
+// colourResult is an image found by a colour search and its gallery.
+type colourResult struct {
+	Gallery *galleriesModel.Gallery
+	Image   imagesModel.Image
+}
+
+// transferPage is what the view for moving or copying images to another
+// gallery is rendered with.
+type transferPage struct {
+	Gallery   *galleriesModel.Gallery
+	Images    []imagesModel.Image
+	Galleries []galleriesModel.Gallery
+}
+
+// imagePage is what the view for editing a single image is rendered with.
+type imagePage struct {
+	Gallery *galleriesModel.Gallery
+	Image   *imagesModel.Image
+}
+
+// photoPage is what the page showing a single image to everyone who can
+// see its gallery is rendered with. Index is where the image is in the
+// gallery counting from one, and Prev and Next are the images either side
+// of it, if there are any. Slides are every image in the gallery for the
+// lightbox to move between without loading another page. Slideshow is set
+// when the images should start playing on their own. CanPick and Client
+// are as they are for showPage, and Comments are the ones left on Image.
+type photoPage struct {
+	Gallery   *galleriesModel.Gallery
+	Image     *imagesModel.Image
+	Index     int
+	Prev      *imagesModel.Image
+	Next      *imagesModel.Image
+	Owner     bool
+	Slides    []slide
+	Slideshow bool
+	CanPick   bool
+	Client    *proofingModel.Client
+	Comments  commentSection
+}
+
+// slide is what the lightbox needs to show an image in place of another.
+type slide struct {
+	ID      uint     `json:"id"`
+	URL     string   `json:"url"`
+	Alt     string   `json:"alt"`
+	Caption string   `json:"caption"`
+	Exif    []string `json:"exif"`
+	Picked  bool     `json:"picked"`
+}
+
+// similarPage is what the similar images view is rendered with.
+type similarPage struct {
+	Gallery *galleriesModel.Gallery
+	Groups  [][]imagesModel.Image
+}
+
 // The Galleries controller object.
 type GalleriesController struct {
-	NewView        *views.View
-	ShowView       *views.View
-	EditView       *views.View
-	IndexView      *views.View
-	galleryService galleriesModel.GalleryService
-	imageService   imagesModel.ImageService
+	NewView         *views.View
+	ShowView        *views.View
+	EditView        *views.View
+	IndexView       *views.View
+	SimilarView     *views.View
+	TransferView    *views.View
+	ImageView       *views.View
+	PhotoView       *views.View
+	ColoursView     *views.View
+	ProofingView    *views.View
+	CommentsView    *views.View
+	galleryService  galleriesModel.GalleryService
+	imageService    imagesModel.ImageService
+	proofingService proofingModel.ProofingService
+	commentService  commentsModel.CommentService
 }
 
 // Instantiates a new Galleries controller.
 // This will panic if templates are not parsed correctly.
 // Only used during initial startup.
-func NewGalleriesController(gs galleriesModel.GalleryService, is imagesModel.ImageService) *GalleriesController {
+func NewGalleriesController(gs galleriesModel.GalleryService, is imagesModel.ImageService, ps proofingModel.ProofingService, cs commentsModel.CommentService) *GalleriesController {
 	return &GalleriesController{
-		NewView:        views.NewView("bootstrap", "galleries/new"),
-		ShowView:       views.NewView("bootstrap", "galleries/show"),
-		EditView:       views.NewView("bootstrap", "galleries/edit"),
-		IndexView:      views.NewView("bootstrap", "galleries/index"),
-		galleryService: gs,
-		imageService:   is,
+		NewView:         views.NewView("bootstrap", "galleries/new"),
+		ShowView:        views.NewView("bootstrap", "galleries/show"),
+		EditView:        views.NewView("bootstrap", "galleries/edit"),
+		IndexView:       views.NewView("bootstrap", "galleries/index"),
+		SimilarView:     views.NewView("bootstrap", "galleries/similar"),
+		TransferView:    views.NewView("bootstrap", "galleries/transfer"),
+		ImageView:       views.NewView("bootstrap", "galleries/image"),
+		PhotoView:       views.NewView("bootstrap", "galleries/photo"),
+		ColoursView:     views.NewView("bootstrap", "galleries/colours"),
+		ProofingView:    views.NewView("bootstrap", "galleries/proofing"),
+		CommentsView:    views.NewView("bootstrap", "galleries/comments"),
+		galleryService:  gs,
+		imageService:    is,
+		proofingService: ps,
+		commentService:  cs,
 	}
 }
 
@@ -99,13 +220,35 @@ func (gc *GalleriesController) Index(c echo.Context) error {
 		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
 		return err
 	}
+	for i := range galleries {
+		if galleries[i].Cover != nil {
+			gc.imageService.SetURL(galleries[i].Cover)
+		}
+	}
+	usage, err := gc.imageService.Usage(user.ID)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+		return err
+	}
+	pending, err := gc.commentService.CountPending(user.ID)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+		return err
+	}
 	var vd views.Data
-	vd.Payload = galleries
+	vd.Payload = indexPage{
+		Galleries:       galleries,
+		Usage:           usage,
+		PendingComments: pending,
+	}
 	gc.IndexView.Render(w, r, vd)
 	return nil
 }
 
-// Get a specific gallery by the ID
+// Get a specific gallery by the ID. Public galleries can be seen without
+// logging in.
 //
 // GET /galleries/:id
 func (gc *GalleriesController) Show(c echo.Context) error {
@@ -114,21 +257,140 @@ func (gc *GalleriesController) Show(c echo.Context) error {
 	data := views.Data{}
 	gallery, err := gc.galleryById(c)
 	if err != nil {
-		data.SetAlert(errorsModel.ErrGalleryNotFound)
-		gc.ShowView.Render(w, r, data)
 		return err
 	}
-	user := context.User(r.Context())
-	if gallery.UserID != user.ID {
+	userID := viewerID(r)
+	if !gallery.VisibleTo(userID) {
 		data.SetAlert(errorsModel.ErrGalleryNotFound)
 		gc.ShowView.Render(w, r, data)
+		return nil
+	}
+	// Owners can preview their gallery as everyone else sees it.
+	owner := gallery.UserID == userID && c.QueryParam("preview") == ""
+	if !owner {
+		for i := range gallery.Images {
+			gc.imageService.SetWatermarkedURL(&gallery.Images[i], gallery.Watermark)
+		}
+	}
+	page := showPage{
+		Gallery: gallery,
+		Owner:   owner,
+	}
+	if gallery.ProofingFor(userID) {
+		client, err := gc.proofingClient(r, gallery)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+			return err
+		}
+		page.CanPick = true
+		page.Client = client
+	}
+	page.Comments, err = gc.commentSection(r, gallery, 0, owner)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
 		return err
 	}
-	data.Payload = gallery
+	if q := c.QueryParam("colour"); q != "" {
+		colour, ok := imagesModel.ParseColour(q)
+		if !ok {
+			data.SetAlert(errorsModel.ErrColourInvalid)
+		} else {
+			page.Colour = imagesModel.FormatColour(colour)
+			gallery.Images = imagesModel.FilterByColour(gallery.Images, colour)
+		}
+	}
+	data.Payload = page
 	gc.ShowView.Render(w, r, data)
 	return nil
 }
 
+// Searches all of the user's galleries for images with a colour close to
+// the one picked in their palette, the closest matches first.
+//
+// GET /galleries/colours
+func (gc *GalleriesController) Colours(c echo.Context) error {
+	r := c.Request()
+	w := c.Response().Writer
+	user := context.User(r.Context())
+	var vd views.Data
+	var page colourPage
+	vd.Payload = &page
+	q := c.QueryParam("colour")
+	if q == "" {
+		gc.ColoursView.Render(w, r, vd)
+		return nil
+	}
+	colour, ok := imagesModel.ParseColour(q)
+	if !ok {
+		vd.SetAlert(errorsModel.ErrColourInvalid)
+		gc.ColoursView.Render(w, r, vd)
+		return nil
+	}
+	page.Colour = imagesModel.FormatColour(colour)
+	galleries, err := gc.galleryService.ByUserID(user.ID)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+		return err
+	}
+	ids := make([]uint, len(galleries))
+	byID := make(map[uint]*galleriesModel.Gallery, len(galleries))
+	for i := range galleries {
+		ids[i] = galleries[i].ID
+		byID[galleries[i].ID] = &galleries[i]
+	}
+	images, err := gc.imageService.ByColour(ids, colour)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+		return err
+	}
+	for _, image := range images {
+		page.Results = append(page.Results, colourResult{Gallery: byID[image.GalleryID], Image: image})
+	}
+	gc.ColoursView.Render(w, r, vd)
+	return nil
+}
+
+// Sends every image in a gallery as a ZIP file, streamed as each image is
+// read. Public galleries can be downloaded without logging in. The size
+// query parameter picks between the originals and web sized copies.
+// Everyone but the owner gets the images with the gallery's watermark.
+//
+// GET /galleries/:galleryId/download
+func (gc *GalleriesController) Download(c echo.Context) error {
+	r := c.Request()
+	gallery, err := gc.galleryById(c)
+	if err != nil {
+		return err
+	}
+	userID := viewerID(r)
+	if !gallery.VisibleTo(userID) {
+		var vd views.Data
+		vd.SetAlert(errorsModel.ErrGalleryNotFound)
+		gc.ShowView.Render(c.Response().Writer, r, vd)
+		return nil
+	}
+	size, ok := imagesModel.ParseSize(c.QueryParam("size"))
+	if !ok {
+		size = imagesModel.SizeOriginal
+	}
+	return gc.sendArchive(c, gallery, size, func(archive *imagesModel.Archive) errorsModel.ImageErrors {
+		if gallery.UserID != userID {
+			archive.SetWatermark(gallery.Watermark)
+		}
+		var failed errorsModel.ImageErrors
+		for i := range gallery.Images {
+			if err := archive.Add(&gallery.Images[i]); err != nil {
+				failed = append(failed, errorsModel.ImageError{Filename: gallery.Images[i].Filename, Err: err})
+			}
+		}
+		return failed
+	})
+}
+
 // Edit a specific gallery by the ID
 //
 // GET /galleries/:id/edit
@@ -184,6 +446,9 @@ func (gc *GalleriesController) Update(c echo.Context) error {
 		return err
 	}
 	gallery.Title = formData.Title
+	gallery.Visibility = galleriesModel.Visibility(formData.Visibility)
+	gallery.Proofing = formData.Proofing
+	gallery.SelectionLimit = formData.SelectionLimit
 	if err := gc.galleryService.Update(gallery); err != nil {
 		vd.SetAlert(err)
 		gc.EditView.Render(w, r, vd)
@@ -220,76 +485,223 @@ func (gc *GalleriesController) Delete(c echo.Context) error {
 		return nil
 	}
 	vd.Payload = gallery
+	// The images go first so their files are removed and the space they
+	// used is given back to the owner.
+	for i := range gallery.Images {
+		if err := gc.imageService.Delete(&gallery.Images[i]); err != nil {
+			vd.SetAlert(err)
+			gc.EditView.Render(w, r, vd)
+			return err
+		}
+	}
+	if err := gc.proofingService.DeleteByGallery(gallery.ID); err != nil {
+		vd.SetAlert(err)
+		gc.EditView.Render(w, r, vd)
+		return err
+	}
+	if err := gc.commentService.DeleteByGallery(gallery.ID); err != nil {
+		vd.SetAlert(err)
+		gc.EditView.Render(w, r, vd)
+		return err
+	}
 	if err := gc.galleryService.Delete(gallery.ID); err != nil {
 		vd.SetAlert(err)
 		gc.EditView.Render(w, r, vd)
 		return err
 	}
+	// The gallery is gone, so failing to delete its watermark only leaves
+	// an unused file.
+	gc.imageService.ReplaceWatermark(gallery.ID, gallery.Watermark, imagesModel.Watermark{})
 	http.Redirect(w, r, "/galleries", http.StatusFound)
 	return nil
 }
 
-// Used to process the updated gallery image uploads
+// Used to change the watermark drawn over the gallery's images for
+// everyone but the owner. The owner can upload a PNG to use instead of
+// text, so the form is sent as multipart.
 //
-// POST /galleries/:id/images
-func (gc *GalleriesController) ImageUpload(c echo.Context) error {
+// POST /galleries/:galleryId/watermark
+func (gc *GalleriesController) WatermarkUpdate(c echo.Context) error {
 	r := c.Request()
 	w := c.Response().Writer
 	usr := context.User(r.Context())
-	if usr == nil {
-		http.Redirect(w, r, "/login", http.StatusFound)
-		return nil
-	}
 	var vd views.Data
 	gallery, err := gc.galleryById(c)
 	if err != nil {
-		vd.SetAlert(err)
-		gc.EditView.Render(w, r, vd)
 		return err
 	}
 	if gallery.UserID != usr.ID {
 		vd.SetAlert(errorsModel.ErrGalleryNotFound)
-		gc.EditView.Render(w, r, vd)
+		gc.ShowView.Render(w, r, vd)
 		return nil
 	}
 	vd.Payload = gallery
-	err = r.ParseMultipartForm(MAX_MULTIPART_MEMORY)
-	if err != nil {
+	r.Body = http.MaxBytesReader(w, r.Body, imagesModel.MAX_WATERMARK_SIZE+64<<10)
+	form := &WatermarkForm{}
+	if err := form.Bind(r); err != nil {
 		vd.SetAlert(err)
 		gc.EditView.Render(w, r, vd)
-		return err
+		return nil
 	}
-
-	files := r.MultipartForm.File["images"]
-	for _, f := range files {
-		file, err := f.Open()
+	old := gallery.Watermark
+	gallery.Watermark = imagesModel.Watermark{
+		Text:     form.Text,
+		MarkName: old.MarkName,
+		Position: form.Position,
+		Opacity:  form.Opacity,
+		Scale:    form.Scale,
+	}
+	if form.RemoveMark {
+		gallery.Watermark.MarkName = ""
+	}
+	if form.Mark != nil {
+		name, err := gc.imageService.SaveWatermark(gallery.ID, form.Mark)
 		if err != nil {
+			gallery.Watermark = old
 			vd.SetAlert(err)
 			gc.EditView.Render(w, r, vd)
-			return err
+			return nil
+		}
+		gallery.Watermark.MarkName = name
+	}
+	if err := gc.galleryService.Update(gallery); err != nil {
+		// Nothing uses the new mark, so it is thrown away along with the
+		// settings.
+		gc.imageService.ReplaceWatermark(gallery.ID, gallery.Watermark, old)
+		gallery.Watermark = old
+		vd.SetAlert(err)
+		gc.EditView.Render(w, r, vd)
+		return err
+	}
+	if err := gc.imageService.ReplaceWatermark(gallery.ID, old, gallery.Watermark); err != nil {
+		log.Println("Could not remove the old watermark:", err)
+	}
+	rdrPath := fmt.Sprintf("/galleries/%d/edit", gallery.ID)
+	http.Redirect(w, r, rdrPath, http.StatusFound)
+	return nil
+}
+
+// Used to process the updated gallery image uploads. The outcome is
+// always shown on the edit page after a redirect, since the page posts
+// the form with a script and then follows the redirect itself.
+//
+// POST /galleries/:id/images
+func (gc *GalleriesController) ImageUpload(c echo.Context) error {
+	r := c.Request()
+	w := c.Response().Writer
+	usr := context.User(r.Context())
+	if usr == nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return nil
+	}
+	gallery, err := gc.galleryById(c)
+	if err != nil || gallery.UserID != usr.ID {
+		return redirectError(w, r, "/galleries", errorsModel.ErrGalleryNotFound)
+	}
+	rdrPath := fmt.Sprintf("/galleries/%d/edit", gallery.ID)
+	// The form is read one file at a time straight from the request, so
+	// upload limits are enforced as each file arrives instead of after the
+	// whole batch has been written to disk.
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return redirectError(w, r, rdrPath, err)
+	}
+
+	// Files that fail validation are collected so the rest of the batch
+	// can still be uploaded, then reported back together. The duplicates
+	// field comes before the files in the form so it is read first.
+	var rejected errorsModel.ImageErrors
+	duplicates := imagesModel.DuplicateSkip
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
 		}
-		defer file.Close()
-		err = gc.imageService.Create(gallery.ID, file, f.Filename)
 		if err != nil {
-			vd.SetAlert(err)
-			gc.EditView.Render(w, r, vd)
-			return err
+			return redirectError(w, r, rdrPath, err)
+		}
+		if part.FormName() == "duplicates" {
+			value, _ := io.ReadAll(io.LimitReader(part, 16))
+			duplicates = imagesModel.ParseDuplicatePolicy(string(value))
+		}
+		if part.FormName() != "images" || part.FileName() == "" {
+			part.Close()
+			continue
+		}
+		err = gc.imageService.Create(gallery.ID, part, part.FileName(), duplicates)
+		if imgErr, ok := err.(errorsModel.ImageError); ok {
+			rejected = append(rejected, imgErr)
+			continue
+		}
+		if err != nil {
+			return redirectError(w, r, rdrPath, err)
 		}
 	}
-	rdrPath := fmt.Sprintf("/galleries/%d/edit", gallery.ID)
+	if len(rejected) > 0 {
+		return redirectError(w, r, rdrPath, rejected)
+	}
 	http.Redirect(w, r, rdrPath, http.StatusFound)
 	return nil
 }
 
+// Used to import the images in a ZIP archive into a gallery. Like image
+// uploads, the outcome is shown on the edit page after a redirect.
+//
+// POST /galleries/:galleryId/import
+func (gc *GalleriesController) ImageImport(c echo.Context) error {
+	r := c.Request()
+	w := c.Response().Writer
+	usr := context.User(r.Context())
+	gallery, err := gc.galleryById(c)
+	if err != nil || gallery.UserID != usr.ID {
+		return redirectError(w, r, "/galleries", errorsModel.ErrGalleryNotFound)
+	}
+	rdrPath := fmt.Sprintf("/galleries/%d/edit", gallery.ID)
+	// Like image uploads, the archive is read straight from the request.
+	// The duplicates field comes before the archive in the form.
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return redirectError(w, r, rdrPath, err)
+	}
+	var results imagesModel.BatchResults
+	duplicates := imagesModel.DuplicateSkip
+	imported := false
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return redirectError(w, r, rdrPath, err)
+		}
+		if part.FormName() == "duplicates" {
+			value, _ := io.ReadAll(io.LimitReader(part, 16))
+			duplicates = imagesModel.ParseDuplicatePolicy(string(value))
+		}
+		if part.FormName() != "archive" || part.FileName() == "" || imported {
+			part.Close()
+			continue
+		}
+		results, err = imagesModel.ImportArchive(gc.imageService, gallery.ID, part, duplicates)
+		if err != nil {
+			return redirectError(w, r, rdrPath, err)
+		}
+		imported = true
+	}
+	if !imported {
+		return redirectError(w, r, rdrPath, errorsModel.ErrArchiveInvalid)
+	}
+	views.RedirectAlert(w, r, rdrPath, http.StatusFound, *batchAlert("Imported", results))
+	return nil
+}
+
 // Used to delete an image from a gallery
 //
-// POST /galleries/:id/images
+// POST /galleries/:galleryId/images/:imageId/delete
 func (gc *GalleriesController) ImageDelete(c echo.Context) error {
 	r := c.Request()
 	w := c.Response().Writer
-	filename := c.Param("filename")
-	galleryIDStr := c.Param("galleryId")
-	galleryID, err := strconv.Atoi(galleryIDStr)
+	imageID, err := strconv.ParseUint(c.Param("imageId"), 10, 64)
 	if err != nil {
 		http.Error(w, "404 page not found", http.StatusNotFound)
 		return err
@@ -312,7 +724,14 @@ func (gc *GalleriesController) ImageDelete(c echo.Context) error {
 		gc.EditView.Render(w, r, vd)
 		return nil
 	}
-	err = gc.imageService.Delete(uint(galleryID), filename)
+	vd.Payload = gallery
+	image, err := gc.galleryImage(gallery, uint(imageID))
+	if err != nil {
+		vd.SetAlert(err)
+		gc.EditView.Render(w, r, vd)
+		return err
+	}
+	err = gc.imageService.Delete(image)
 	if err != nil {
 		vd.SetAlert(err)
 		gc.EditView.Render(w, r, vd)
@@ -323,6 +742,658 @@ func (gc *GalleriesController) ImageDelete(c echo.Context) error {
 	return nil
 }
 
+// Used to save an image's caption and alt text
+//
+// POST /galleries/:galleryId/images/:imageId/update
+func (gc *GalleriesController) ImageUpdate(c echo.Context) error {
+	r := c.Request()
+	w := c.Response().Writer
+	imageID, err := strconv.ParseUint(c.Param("imageId"), 10, 64)
+	if err != nil {
+		http.Error(w, "404 page not found", http.StatusNotFound)
+		return err
+	}
+	usr := context.User(r.Context())
+	var vd views.Data
+	gallery, err := gc.galleryById(c)
+	if err != nil {
+		return err
+	}
+	if gallery.UserID != usr.ID {
+		vd.SetAlert(errorsModel.ErrGalleryNotFound)
+		gc.EditView.Render(w, r, vd)
+		return nil
+	}
+	vd.Payload = gallery
+	image, err := gc.galleryImage(gallery, uint(imageID))
+	if err != nil {
+		vd.SetAlert(err)
+		gc.EditView.Render(w, r, vd)
+		return err
+	}
+	form := &ImageForm{}
+	if err := form.Bind(r); err != nil {
+		vd.SetAlert(err)
+		gc.EditView.Render(w, r, vd)
+		return err
+	}
+	image.Caption = form.Caption
+	image.AltText = form.AltText
+	if err := gc.imageService.Update(image); err != nil {
+		vd.SetAlert(err)
+		gc.EditView.Render(w, r, vd)
+		return err
+	}
+	rdrPath := fmt.Sprintf("/galleries/%d/edit#image-%d", gallery.ID, image.ID)
+	http.Redirect(w, r, rdrPath, http.StatusFound)
+	return nil
+}
+
+// Used to show a single image to everyone who can see its gallery, with
+// its caption, what the camera recorded about it and links to the images
+// either side. The page also works as a lightbox and slideshow, and the
+// slideshow query parameter starts it playing.
+//
+// GET /galleries/:galleryId/images/:imageId
+func (gc *GalleriesController) Image(c echo.Context) error {
+	r := c.Request()
+	w := c.Response().Writer
+	var vd views.Data
+	gallery, err := gc.galleryById(c)
+	if err != nil {
+		return err
+	}
+	userID := viewerID(r)
+	if !gallery.VisibleTo(userID) {
+		vd.SetAlert(errorsModel.ErrGalleryNotFound)
+		gc.ShowView.Render(w, r, vd)
+		return nil
+	}
+	owner := gallery.UserID == userID
+	index := -1
+	if imageID, err := strconv.ParseUint(c.Param("imageId"), 10, 64); err == nil {
+		for i := range gallery.Images {
+			if gallery.Images[i].ID == uint(imageID) {
+				index = i
+			}
+		}
+	}
+	if index < 0 {
+		vd.SetAlert(errorsModel.ErrImageNotFound)
+		vd.Payload = showPage{Gallery: gallery, Owner: owner}
+		gc.ShowView.Render(w, r, vd)
+		return nil
+	}
+	page := photoPage{
+		Gallery:   gallery,
+		Image:     &gallery.Images[index],
+		Index:     index + 1,
+		Owner:     owner,
+		Slideshow: c.QueryParam("slideshow") != "",
+	}
+	if gallery.ProofingFor(userID) {
+		client, err := gc.proofingClient(r, gallery)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+			return err
+		}
+		page.CanPick = true
+		page.Client = client
+	}
+	page.Comments, err = gc.commentSection(r, gallery, page.Image.ID, owner)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+		return err
+	}
+	if index > 0 {
+		page.Prev = &gallery.Images[index-1]
+	}
+	if index < len(gallery.Images)-1 {
+		page.Next = &gallery.Images[index+1]
+	}
+	for i := range gallery.Images {
+		image := &gallery.Images[i]
+		if !owner {
+			gc.imageService.SetWatermarkedURL(image, gallery.Watermark)
+		}
+		page.Slides = append(page.Slides, slide{
+			ID:      image.ID,
+			URL:     image.WebURL,
+			Alt:     image.Alt(),
+			Caption: image.Caption,
+			Exif:    image.Exif.Summary(),
+			Picked:  page.Client != nil && page.Client.Picked(image.ID),
+		})
+	}
+	vd.Payload = page
+	gc.PhotoView.Render(w, r, vd)
+	return nil
+}
+
+// Used to show a single image to the owner of its gallery, along with the
+// tools for editing it
+//
+// GET /galleries/:galleryId/images/:imageId/edit
+func (gc *GalleriesController) ImageEdit(c echo.Context) error {
+	r := c.Request()
+	w := c.Response().Writer
+	imageID, err := strconv.ParseUint(c.Param("imageId"), 10, 64)
+	if err != nil {
+		http.Error(w, "404 page not found", http.StatusNotFound)
+		return err
+	}
+	usr := context.User(r.Context())
+	var vd views.Data
+	gallery, err := gc.galleryById(c)
+	if err != nil {
+		return err
+	}
+	if gallery.UserID != usr.ID {
+		vd.SetAlert(errorsModel.ErrGalleryNotFound)
+		gc.ShowView.Render(w, r, vd)
+		return nil
+	}
+	image, err := gc.galleryImage(gallery, uint(imageID))
+	if err != nil {
+		vd.SetAlert(err)
+		vd.Payload = gallery
+		gc.EditView.Render(w, r, vd)
+		return err
+	}
+	vd.Payload = imagePage{Gallery: gallery, Image: image}
+	gc.ImageView.Render(w, r, vd)
+	return nil
+}
+
+// Used to rotate, flip or crop an image, undo the last of those edits or
+// reset the image to how it was uploaded. The stored file is never
+// changed, so the original can always be got back.
+//
+// POST /galleries/:galleryId/images/:imageId/transform
+func (gc *GalleriesController) ImageTransform(c echo.Context) error {
+	r := c.Request()
+	w := c.Response().Writer
+	imageID, err := strconv.ParseUint(c.Param("imageId"), 10, 64)
+	if err != nil {
+		http.Error(w, "404 page not found", http.StatusNotFound)
+		return err
+	}
+	usr := context.User(r.Context())
+	var vd views.Data
+	gallery, err := gc.galleryById(c)
+	if err != nil {
+		return err
+	}
+	if gallery.UserID != usr.ID {
+		vd.SetAlert(errorsModel.ErrGalleryNotFound)
+		gc.ShowView.Render(w, r, vd)
+		return nil
+	}
+	image, err := gc.galleryImage(gallery, uint(imageID))
+	if err != nil {
+		vd.SetAlert(err)
+		vd.Payload = gallery
+		gc.EditView.Render(w, r, vd)
+		return err
+	}
+	vd.Payload = imagePage{Gallery: gallery, Image: image}
+	form := &TransformForm{}
+	if err := form.Bind(r); err != nil {
+		vd.SetAlert(err)
+		gc.ImageView.Render(w, r, vd)
+		return err
+	}
+	transforms, err := imagesModel.ParseTransforms(image.Transforms)
+	if err != nil {
+		vd.SetAlert(err)
+		gc.ImageView.Render(w, r, vd)
+		return err
+	}
+	switch form.Op {
+	case "undo":
+		if len(transforms) > 0 {
+			transforms = transforms[:len(transforms)-1]
+		}
+	case "reset":
+		transforms = nil
+	default:
+		transforms = append(transforms, form.Transform)
+	}
+	if err := gc.imageService.Transform(image, transforms); err != nil {
+		vd.SetAlert(err)
+		gc.ImageView.Render(w, r, vd)
+		return nil
+	}
+	rdrPath := fmt.Sprintf("/galleries/%d/images/%d/edit", gallery.ID, image.ID)
+	http.Redirect(w, r, rdrPath, http.StatusFound)
+	return nil
+}
+
+// Used to save the order of the images after the owner drags them around
+// on the edit page. This is sent in the background, so it answers with a
+// status code instead of a page.
+//
+// POST /galleries/:galleryId/images/order
+func (gc *GalleriesController) ImagesOrder(c echo.Context) error {
+	r := c.Request()
+	usr := context.User(r.Context())
+	id, err := strconv.ParseUint(c.Param("galleryId"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusNotFound, errorsModel.ErrGalleryNotFound.Public())
+	}
+	gallery, err := gc.galleryService.ByID(uint(id))
+	if err != nil || gallery.UserID != usr.ID {
+		return c.String(http.StatusNotFound, errorsModel.ErrGalleryNotFound.Public())
+	}
+	form := &ImagesForm{}
+	if err := form.Bind(r); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	err = gc.imageService.Reorder(gallery.ID, form.ImageIDs)
+	if err == errorsModel.ErrImageNotFound {
+		return c.String(http.StatusUnprocessableEntity, errorsModel.ErrImageNotFound.Public())
+	}
+	if err != nil {
+		log.Println(err)
+		return c.String(http.StatusInternalServerError, "Something went wrong.")
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Used to make an image the gallery's cover
+//
+// POST /galleries/:galleryId/images/:imageId/cover
+func (gc *GalleriesController) ImageCover(c echo.Context) error {
+	r := c.Request()
+	w := c.Response().Writer
+	imageID, err := strconv.ParseUint(c.Param("imageId"), 10, 64)
+	if err != nil {
+		http.Error(w, "404 page not found", http.StatusNotFound)
+		return err
+	}
+	usr := context.User(r.Context())
+	var vd views.Data
+	gallery, err := gc.galleryById(c)
+	if err != nil {
+		return err
+	}
+	if gallery.UserID != usr.ID {
+		vd.SetAlert(errorsModel.ErrGalleryNotFound)
+		gc.EditView.Render(w, r, vd)
+		return nil
+	}
+	vd.Payload = gallery
+	image, err := gc.galleryImage(gallery, uint(imageID))
+	if err != nil {
+		vd.SetAlert(err)
+		gc.EditView.Render(w, r, vd)
+		return err
+	}
+	gallery.CoverImageID = image.ID
+	if err := gc.galleryService.Update(gallery); err != nil {
+		vd.SetAlert(err)
+		gc.EditView.Render(w, r, vd)
+		return err
+	}
+	rdrPath := fmt.Sprintf("/galleries/%d/edit#image-%d", gallery.ID, image.ID)
+	http.Redirect(w, r, rdrPath, http.StatusFound)
+	return nil
+}
+
+// Creates a link to a single image that keeps working without a session
+// until the chosen lifetime has passed, so it can be emailed to a client.
+//
+// GET /galleries/:galleryId/images/:imageId/link
+func (gc *GalleriesController) ImageLink(c echo.Context) error {
+	r := c.Request()
+	w := c.Response().Writer
+	imageID, err := strconv.ParseUint(c.Param("imageId"), 10, 64)
+	if err != nil {
+		http.Error(w, "404 page not found", http.StatusNotFound)
+		return err
+	}
+	usr := context.User(r.Context())
+	var vd views.Data
+	gallery, err := gc.galleryById(c)
+	if err != nil {
+		vd.SetAlert(err)
+		gc.EditView.Render(w, r, vd)
+		return err
+	}
+	if gallery.UserID != usr.ID {
+		vd.SetAlert(errorsModel.ErrGalleryNotFound)
+		gc.EditView.Render(w, r, vd)
+		return nil
+	}
+	vd.Payload = gallery
+	image, err := gc.galleryImage(gallery, uint(imageID))
+	if err != nil {
+		vd.SetAlert(err)
+		gc.EditView.Render(w, r, vd)
+		return err
+	}
+	ttl, ok := shareLinkTTLs[c.QueryParam("ttl")]
+	if !ok {
+		ttl = DEFAULT_SHARE_LINK_TTL
+	}
+	link := c.Scheme() + "://" + r.Host + gc.imageService.SignedURL(image, ttl)
+	vd.Alert = &views.Alert{
+		Level: views.AlertLevelInfo,
+		Message: fmt.Sprintf("Link to %s, valid until %s: %s",
+			image.Filename, time.Now().Add(ttl).Format("Jan 2, 2006 3:04 PM MST"), link),
+	}
+	gc.EditView.Render(w, r, vd)
+	return nil
+}
+
+// Shows the images in a gallery that look nearly identical, grouped
+// together so the owner can pick which shots to keep.
+//
+// GET /galleries/:galleryId/similar
+func (gc *GalleriesController) Similar(c echo.Context) error {
+	r := c.Request()
+	w := c.Response().Writer
+	usr := context.User(r.Context())
+	var vd views.Data
+	gallery, err := gc.galleryById(c)
+	if err != nil {
+		return err
+	}
+	if gallery.UserID != usr.ID {
+		vd.SetAlert(errorsModel.ErrGalleryNotFound)
+		gc.ShowView.Render(w, r, vd)
+		return nil
+	}
+	return gc.renderSimilar(w, r, gallery, nil)
+}
+
+// Deletes the images picked on the similar images page and goes back to
+// it, so the owner can carry on culling.
+//
+// POST /galleries/:galleryId/similar/delete
+func (gc *GalleriesController) SimilarDelete(c echo.Context) error {
+	r := c.Request()
+	w := c.Response().Writer
+	usr := context.User(r.Context())
+	var vd views.Data
+	gallery, err := gc.galleryById(c)
+	if err != nil {
+		return err
+	}
+	if gallery.UserID != usr.ID {
+		vd.SetAlert(errorsModel.ErrGalleryNotFound)
+		gc.ShowView.Render(w, r, vd)
+		return nil
+	}
+	form := &ImagesForm{}
+	if err := form.Bind(r); err != nil {
+		return gc.renderSimilar(w, r, gallery, err)
+	}
+	if len(form.ImageIDs) == 0 {
+		return gc.renderSimilar(w, r, gallery, errorsModel.ErrNoImagesSelected)
+	}
+	for _, id := range form.ImageIDs {
+		image, err := gc.galleryImage(gallery, id)
+		if err != nil {
+			return gc.renderSimilar(w, r, gallery, err)
+		}
+		if err := gc.imageService.Delete(image); err != nil {
+			return gc.renderSimilar(w, r, gallery, err)
+		}
+	}
+	rdrPath := fmt.Sprintf("/galleries/%d/similar", gallery.ID)
+	http.Redirect(w, r, rdrPath, http.StatusFound)
+	return nil
+}
+
+// renderSimilar shows the similar images page, with an alert for the
+// error that stopped the last action if there was one.
+func (gc *GalleriesController) renderSimilar(w http.ResponseWriter, r *http.Request, gallery *galleriesModel.Gallery, err error) error {
+	var vd views.Data
+	groups, groupErr := gc.imageService.Similar(gallery.ID)
+	if groupErr != nil {
+		log.Println(groupErr)
+		err = groupErr
+	}
+	if err != nil {
+		vd.SetAlert(err)
+	}
+	vd.Payload = similarPage{
+		Gallery: gallery,
+		Groups:  groups,
+	}
+	gc.SimilarView.Render(w, r, vd)
+	return err
+}
+
+// Moves or copies the selected images to another of the owner's galleries
+// and goes to that gallery's edit page.
+//
+// POST /galleries/:galleryId/transfer
+func (gc *GalleriesController) TransferSubmit(c echo.Context) error {
+	r := c.Request()
+	w := c.Response().Writer
+	usr := context.User(r.Context())
+	var vd views.Data
+	gallery, err := gc.galleryById(c)
+	if err != nil {
+		return err
+	}
+	if gallery.UserID != usr.ID {
+		vd.SetAlert(errorsModel.ErrGalleryNotFound)
+		gc.ShowView.Render(w, r, vd)
+		return nil
+	}
+	form := &TransferForm{}
+	if err := form.Bind(r); err != nil {
+		return gc.renderTransfer(w, r, gallery, form.ImageIDs, err)
+	}
+	mode, ok := imagesModel.ParseTransferMode(form.Mode)
+	if !ok {
+		return gc.renderTransfer(w, r, gallery, form.ImageIDs, errorsModel.ErrTransferModeInvalid)
+	}
+	// Both galleries have to belong to the user.
+	to, err := gc.galleryService.ByID(form.ToGalleryID)
+	if err != nil || to.UserID != usr.ID {
+		return gc.renderTransfer(w, r, gallery, form.ImageIDs, errorsModel.ErrGalleryNotFound)
+	}
+	if err := gc.imageService.Transfer(gallery.ID, to.ID, form.ImageIDs, mode); err != nil {
+		log.Println(err)
+		return gc.renderTransfer(w, r, gallery, form.ImageIDs, err)
+	}
+	rdrPath := fmt.Sprintf("/galleries/%d/edit", to.ID)
+	http.Redirect(w, r, rdrPath, http.StatusFound)
+	return nil
+}
+
+// renderTransfer shows the transfer page for the selected images, with an
+// alert for the error that stopped the last attempt if there was one.
+func (gc *GalleriesController) renderTransfer(w http.ResponseWriter, r *http.Request, gallery *galleriesModel.Gallery, imageIDs []uint, err error) error {
+	var vd views.Data
+	selected := make(map[uint]bool, len(imageIDs))
+	for _, id := range imageIDs {
+		selected[id] = true
+	}
+	page := transferPage{Gallery: gallery}
+	for _, image := range gallery.Images {
+		if selected[image.ID] {
+			page.Images = append(page.Images, image)
+		}
+	}
+	galleries, galleriesErr := gc.galleryService.ByUserID(gallery.UserID)
+	if galleriesErr != nil {
+		log.Println(galleriesErr)
+		err = galleriesErr
+	}
+	for _, other := range galleries {
+		if other.ID != gallery.ID {
+			page.Galleries = append(page.Galleries, other)
+		}
+	}
+	if err != nil {
+		vd.SetAlert(err)
+	}
+	vd.Payload = page
+	gc.TransferView.Render(w, r, vd)
+	return err
+}
+
+// Runs the action chosen on the edit page on all of the selected images
+// at once. Deleting and captioning report which images it worked for on
+// the edit page, downloading sends the images as a ZIP file and moving or
+// copying goes on to the page to choose a destination.
+//
+// POST /galleries/:galleryId/images/batch
+func (gc *GalleriesController) ImagesBatch(c echo.Context) error {
+	r := c.Request()
+	w := c.Response().Writer
+	usr := context.User(r.Context())
+	var vd views.Data
+	gallery, err := gc.galleryById(c)
+	if err != nil {
+		return err
+	}
+	if gallery.UserID != usr.ID {
+		vd.SetAlert(errorsModel.ErrGalleryNotFound)
+		gc.ShowView.Render(w, r, vd)
+		return nil
+	}
+	vd.Payload = gallery
+	form := &BatchForm{}
+	if err := form.Bind(r); err != nil {
+		vd.SetAlert(err)
+		gc.EditView.Render(w, r, vd)
+		return err
+	}
+	if len(form.ImageIDs) == 0 {
+		vd.SetAlert(errorsModel.ErrNoImagesSelected)
+		gc.EditView.Render(w, r, vd)
+		return nil
+	}
+
+	var results imagesModel.BatchResults
+	var done string
+	switch form.Action {
+	case "transfer":
+		return gc.renderTransfer(w, r, gallery, form.ImageIDs, nil)
+	case "download":
+		return gc.sendArchive(c, gallery, imagesModel.SizeOriginal, func(archive *imagesModel.Archive) errorsModel.ImageErrors {
+			return gc.imageService.Batch(gallery.ID, form.ImageIDs, archive.Add).Failed()
+		})
+	case "delete":
+		results = gc.imageService.Batch(gallery.ID, form.ImageIDs, gc.imageService.Delete)
+		done = "Deleted"
+	case "caption":
+		results = gc.imageService.Batch(gallery.ID, form.ImageIDs, func(image *imagesModel.Image) error {
+			image.Caption = form.Caption
+			return gc.imageService.Update(image)
+		})
+		done = "Updated the caption of"
+	default:
+		http.Error(w, "Unknown action", http.StatusBadRequest)
+		return nil
+	}
+
+	gallery.Images, err = gc.imageService.ByGalleryID(gallery.ID)
+	if err != nil {
+		vd.SetAlert(err)
+		gc.EditView.Render(w, r, vd)
+		return err
+	}
+	gallery.PickCover()
+	vd.Alert = batchAlert(done, results)
+	gc.EditView.Render(w, r, vd)
+	return nil
+}
+
+// sendArchive sends a ZIP file of the gallery's images at the provided
+// size. fill adds the images to the archive as it is streamed out and
+// returns the ones that couldn't be added.
+func (gc *GalleriesController) sendArchive(c echo.Context, gallery *galleriesModel.Gallery, size imagesModel.Size, fill func(archive *imagesModel.Archive) errorsModel.ImageErrors) error {
+	w := c.Response()
+	w.Header().Set(echo.HeaderContentType, "application/zip")
+	w.Header().Set(echo.HeaderContentDisposition,
+		fmt.Sprintf("attachment; filename=%q", archiveName(gallery.Title)))
+	w.WriteHeader(http.StatusOK)
+	archive := imagesModel.NewArchive(w, gc.imageService, size)
+	return archive.Close(fill(archive))
+}
+
+// batchAlert describes the results of a batch action. done says what
+// happened to the images it worked for, such as "Deleted".
+func batchAlert(done string, results imagesModel.BatchResults) *views.Alert {
+	succeeded := len(results.Succeeded())
+	failed := results.Failed()
+	alert := &views.Alert{Level: views.AlertLevelSuccess}
+	switch {
+	case len(failed) == 0:
+	case succeeded == 0:
+		alert.Level = views.AlertLevelError
+	default:
+		alert.Level = views.AlertLevelWarning
+	}
+	noun := "images"
+	if succeeded == 1 {
+		noun = "image"
+	}
+	alert.Message = fmt.Sprintf("%s %d %s.", done, succeeded, noun)
+	if len(failed) > 0 {
+		alert.Message += " " + failed.Public()
+	}
+	return alert
+}
+
+// archiveName is the file name to download a gallery's images as. Only
+// letters, digits and a few separators are kept from the title so that
+// it can be quoted in a header.
+func archiveName(title string) string {
+	return safeName(title, "gallery") + ".zip"
+}
+
+// safeName keeps only the letters, digits and separators of s so that it
+// can be used in a file name, or returns fallback if that leaves nothing.
+func safeName(s, fallback string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			return r
+		case r == ' ' || r == '-' || r == '_':
+			return '-'
+		default:
+			return -1
+		}
+	}, s)
+	name = strings.Trim(name, "-")
+	if name == "" {
+		name = fallback
+	}
+	return name
+}
+
+// viewerID returns the ID of the logged in user, or zero for visitors who
+// aren't logged in.
+func viewerID(r *http.Request) uint {
+	if user := context.User(r.Context()); user != nil {
+		return user.ID
+	}
+	return 0
+}
+
+// galleryImage looks up an image by its ID and makes sure that it belongs
+// to the provided gallery.
+func (gc *GalleriesController) galleryImage(gallery *galleriesModel.Gallery, imageID uint) (*imagesModel.Image, error) {
+	image, err := gc.imageService.ByID(imageID)
+	if err != nil {
+		return nil, err
+	}
+	if image.GalleryID != gallery.ID {
+		return nil, errorsModel.ErrImageNotFound
+	}
+	return image, nil
+}
+
 // galleryById gets a gallery by the id passed in the URL params if one exists.
 // It then returns that gallery and an error if one occurs. This helper function
 // is used for the Show and Edit methods.
@@ -350,5 +1421,6 @@ func (gc *GalleriesController) galleryById(c echo.Context) (*galleriesModel.Gall
 		return nil, err
 	}
 	gallery.Images = images
+	gallery.PickCover()
 	return gallery, nil
 }
@@ -0,0 +1,284 @@
+package galleriesController
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"lenslocked/context"
+	"lenslocked/models/errorsModel"
+	"lenslocked/models/galleriesModel"
+	"lenslocked/models/proofingModel"
+	"lenslocked/views"
+
+	"github.com/labstack/echo/v4"
+)
+
+// PROOFING_COOKIE_TTL is how long a visitor's browser remembers who they
+// are picking images as.
+const PROOFING_COOKIE_TTL = 365 * 24 * time.Hour
+
+// proofingPage is what the owner's view of their clients' picks is
+// rendered with.
+type proofingPage struct {
+	Gallery *galleriesModel.Gallery
+	Clients []proofingModel.Client
+}
+
+// Used by visitors who aren't logged in to say who they are before they
+// start picking images. Their browser is given a cookie to remember them
+// by.
+//
+// POST /galleries/:galleryId/proofing/join
+func (gc *GalleriesController) ProofingJoin(c echo.Context) error {
+	r := c.Request()
+	w := c.Response().Writer
+	gallery, err := gc.proofingGallery(c)
+	if gallery == nil {
+		return err
+	}
+	rdrPath := fmt.Sprintf("/galleries/%d", gallery.ID)
+	form := &ClientForm{}
+	if err := form.Bind(r); err != nil {
+		return redirectError(w, r, rdrPath, err)
+	}
+	client := &proofingModel.Client{
+		GalleryID: gallery.ID,
+		UserID:    viewerID(r),
+		Name:      form.Name,
+	}
+	if err := gc.proofingService.CreateClient(client); err != nil {
+		return redirectError(w, r, rdrPath, err)
+	}
+	if client.UserID == 0 {
+		http.SetCookie(w, proofingCookie(gallery.ID, client.Token))
+	}
+	views.RedirectAlert(w, r, rdrPath, http.StatusFound, views.Alert{
+		Level:   views.AlertLevelSuccess,
+		Message: fmt.Sprintf("Welcome, %s. Tap the heart on the photos you'd like to pick.", client.Name),
+	})
+	return nil
+}
+
+// Used by clients to add an image to their selection, or take it out if
+// it is already there. Visitors who are logged in start picking as
+// themselves, but everyone else has to give their name first.
+//
+// POST /galleries/:galleryId/images/:imageId/pick
+func (gc *GalleriesController) ImagePick(c echo.Context) error {
+	r := c.Request()
+	w := c.Response().Writer
+	gallery, err := gc.proofingGallery(c)
+	if gallery == nil {
+		return err
+	}
+	imageID, _ := strconv.ParseUint(c.Param("imageId"), 10, 64)
+	// Clients go back to wherever they picked the image from.
+	rdrPath := fmt.Sprintf("/galleries/%d#image-%d", gallery.ID, imageID)
+	if r.PostFormValue("return") == "image" {
+		rdrPath = fmt.Sprintf("/galleries/%d/images/%d", gallery.ID, imageID)
+	}
+	client, err := gc.proofingClient(r, gallery)
+	if err != nil {
+		return redirectError(w, r, rdrPath, err)
+	}
+	if client == nil {
+		user := context.User(r.Context())
+		if user == nil {
+			return redirectError(w, r, rdrPath, errorsModel.ErrClientNameRequired)
+		}
+		client = &proofingModel.Client{GalleryID: gallery.ID, UserID: user.ID, Name: user.Name}
+		if client.Name == "" {
+			client.Name = user.Email
+		}
+		if err := gc.proofingService.CreateClient(client); err != nil {
+			return redirectError(w, r, rdrPath, err)
+		}
+	}
+	image, err := gc.galleryImage(gallery, uint(imageID))
+	if err != nil {
+		return redirectError(w, r, rdrPath, err)
+	}
+	if err := gc.proofingService.Toggle(client, image, gallery.SelectionLimit); err != nil {
+		return redirectError(w, r, rdrPath, err)
+	}
+	http.Redirect(w, r, rdrPath, http.StatusFound)
+	return nil
+}
+
+// Used by clients to send their final selection to the owner. It can't be
+// changed afterwards.
+//
+// POST /galleries/:galleryId/proofing/submit
+func (gc *GalleriesController) ProofingSubmit(c echo.Context) error {
+	r := c.Request()
+	w := c.Response().Writer
+	gallery, err := gc.proofingGallery(c)
+	if gallery == nil {
+		return err
+	}
+	rdrPath := fmt.Sprintf("/galleries/%d", gallery.ID)
+	client, err := gc.proofingClient(r, gallery)
+	if err != nil {
+		return redirectError(w, r, rdrPath, err)
+	}
+	if client == nil {
+		return redirectError(w, r, rdrPath, errorsModel.ErrSelectionEmpty)
+	}
+	if err := gc.proofingService.Submit(client); err != nil {
+		return redirectError(w, r, rdrPath, err)
+	}
+	views.RedirectAlert(w, r, rdrPath, http.StatusFound, views.Alert{
+		Level:   views.AlertLevelSuccess,
+		Message: fmt.Sprintf("Thank you, %s. Your selection of %d photos has been sent.", client.Name, len(client.Images)),
+	})
+	return nil
+}
+
+// Used to show the owner of a gallery the images each of their clients
+// picked.
+//
+// GET /galleries/:galleryId/proofing
+func (gc *GalleriesController) Proofing(c echo.Context) error {
+	r := c.Request()
+	w := c.Response().Writer
+	gallery, clients, err := gc.galleryClients(c)
+	if gallery == nil {
+		return err
+	}
+	var vd views.Data
+	vd.Payload = proofingPage{Gallery: gallery, Clients: clients}
+	gc.ProofingView.Render(w, r, vd)
+	return nil
+}
+
+// Sends the owner the file names of the images a client picked, one to a
+// line, to search for on their own computer or paste into their editing
+// software.
+//
+// GET /galleries/:galleryId/proofing/:clientId/export
+func (gc *GalleriesController) ProofingExport(c echo.Context) error {
+	gallery, clients, err := gc.galleryClients(c)
+	if gallery == nil {
+		return err
+	}
+	clientID, _ := strconv.ParseUint(c.Param("clientId"), 10, 64)
+	for _, client := range clients {
+		if client.ID != uint(clientID) {
+			continue
+		}
+		name := fmt.Sprintf("%s-%s.txt", safeName(gallery.Title, "gallery"), safeName(client.Name, "client"))
+		w := c.Response()
+		w.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", name))
+		var body strings.Builder
+		for _, filename := range client.Filenames() {
+			body.WriteString(filename + "\r\n")
+		}
+		return c.String(http.StatusOK, body.String())
+	}
+	return c.String(http.StatusNotFound, errorsModel.ErrClientNotFound.Public())
+}
+
+// proofingClient returns who the viewer is picking images from the gallery
+// as, with their selection filled in, or nil if they haven't started.
+func (gc *GalleriesController) proofingClient(r *http.Request, gallery *galleriesModel.Gallery) (*proofingModel.Client, error) {
+	var client *proofingModel.Client
+	var err error
+	if user := context.User(r.Context()); user != nil {
+		client, err = gc.proofingService.ClientByUser(gallery.ID, user.ID)
+	} else if cookie, cookieErr := r.Cookie(proofingCookieName(gallery.ID)); cookieErr == nil {
+		client, err = gc.proofingService.ClientByToken(cookie.Value)
+		if err == nil && client.GalleryID != gallery.ID {
+			err = errorsModel.ErrClientNotFound
+		}
+	} else {
+		return nil, nil
+	}
+	if err == errorsModel.ErrClientNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := gc.proofingService.Selection(client, gallery.Images); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// proofingGallery looks up the gallery in the URL for a visitor picking
+// images from it. Nothing is returned if they can't, and the response has
+// already been written.
+func (gc *GalleriesController) proofingGallery(c echo.Context) (*galleriesModel.Gallery, error) {
+	r := c.Request()
+	gallery, err := gc.galleryById(c)
+	if err != nil {
+		return nil, err
+	}
+	if !gallery.ProofingFor(viewerID(r)) {
+		var vd views.Data
+		vd.SetAlert(errorsModel.ErrGalleryNotFound)
+		gc.ShowView.Render(c.Response().Writer, r, vd)
+		return nil, nil
+	}
+	return gallery, nil
+}
+
+// galleryClients looks up the gallery in the URL and its clients with
+// their selections for the gallery's owner. Nothing is returned for anyone
+// else, and the response has already been written.
+func (gc *GalleriesController) galleryClients(c echo.Context) (*galleriesModel.Gallery, []proofingModel.Client, error) {
+	r := c.Request()
+	w := c.Response().Writer
+	usr := context.User(r.Context())
+	gallery, err := gc.galleryById(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	if gallery.UserID != usr.ID {
+		var vd views.Data
+		vd.SetAlert(errorsModel.ErrGalleryNotFound)
+		gc.ShowView.Render(w, r, vd)
+		return nil, nil, nil
+	}
+	clients, err := gc.proofingService.Clients(gallery.ID, gallery.Images)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+		return nil, nil, err
+	}
+	return gallery, clients, nil
+}
+
+// proofingCookieName is the cookie a visitor's client token for the
+// gallery is kept in. Each gallery has its own, so one browser can pick
+// from several galleries.
+func proofingCookieName(galleryID uint) string {
+	return fmt.Sprintf("proofing_%d", galleryID)
+}
+
+// proofingCookie remembers the client for the gallery. Links to galleries
+// are usually sent by email, so the cookie is sent when one is followed,
+// unlike the session cookie.
+func proofingCookie(galleryID uint, token string) *http.Cookie {
+	return &http.Cookie{
+		Name:     proofingCookieName(galleryID),
+		Value:    token,
+		Path:     fmt.Sprintf("/galleries/%d", galleryID),
+		Expires:  time.Now().Add(PROOFING_COOKIE_TTL),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// redirectError sends the visitor back to path with the error shown.
+func redirectError(w http.ResponseWriter, r *http.Request, path string, err error) error {
+	var vd views.Data
+	vd.SetAlert(err)
+	views.RedirectAlert(w, r, path, http.StatusFound, *vd.Alert)
+	return nil
+}
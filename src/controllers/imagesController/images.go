@@ -0,0 +1,185 @@
+package imagesController
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"lenslocked/imaging"
+	"lenslocked/models/errorsModel"
+	"lenslocked/models/galleriesModel"
+	"lenslocked/models/imagesModel"
+	"lenslocked/storage"
+
+	"github.com/labstack/echo/v4"
+)
+
+// MAX_CACHE_AGE is the longest we ever let a browser or CDN cache an image.
+const MAX_CACHE_AGE = 365 * 24 * time.Hour
+
+// The Images controller object. It serves image files out of whichever
+// storage backend the app is configured with.
+type ImagesController struct {
+	imageService   imagesModel.ImageService
+	galleryService galleriesModel.GalleryService
+	storage        storage.Storage
+	// now returns the current time and is replaced in tests.
+	now func() time.Time
+}
+
+// Instantiates a new Images controller.
+func NewImagesController(is imagesModel.ImageService, gs galleriesModel.GalleryService, store storage.Storage) *ImagesController {
+	return &ImagesController{
+		imageService:   is,
+		galleryService: gs,
+		storage:        store,
+		now:            time.Now,
+	}
+}
+
+// Show serves an image file from storage. Image URLs are signed and
+// expire, so access is granted by a valid signature rather than by the
+// visitor's session. That lets links work from a CDN or in an email.
+//
+// Responses carry a strong ETag made from the image version and support
+// conditional and byte range requests. URLs that include the image version
+// are content-addressed and are cached as immutable until they expire.
+//
+// GET /images/galleries/:galleryId/:name
+func (ic *ImagesController) Show(c echo.Context) error {
+	r := c.Request()
+	w := c.Response().Writer
+	// Why a signature was rejected is only logged, so the response gives
+	// nothing away to someone trying to forge one.
+	if err := ic.imageService.VerifyURL(r.URL); err != nil {
+		log.Println(err)
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return nil
+	}
+	image, err := ic.imageService.ByStoredName(c.Param("name"))
+	if err == nil && fmt.Sprint(image.GalleryID) != c.Param("galleryId") {
+		err = errorsModel.ErrImageNotFound
+	}
+	if err == errorsModel.ErrImageNotFound {
+		http.Error(w, "404 page not found", http.StatusNotFound)
+		return nil
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+		return err
+	}
+	// Watermarked URLs are only ever handed out for galleries with a
+	// watermark, and the signature stops it being taken out of the URL.
+	var wm *imagesModel.Watermark
+	if r.URL.Query().Has("wm") {
+		gallery, err := ic.galleryService.ByID(image.GalleryID)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "404 page not found", http.StatusNotFound)
+			return nil
+		}
+		wm = &gallery.Watermark
+	}
+	// Anything but an unedited original that browsers can show is a
+	// derivative made for the page, so it is sent in the best format the
+	// browser accepts.
+	v := variant{size: imagesModel.SizeOriginal, wm: wm}
+	if name := r.URL.Query().Get("size"); name != "" {
+		var ok bool
+		if v.size, ok = imagesModel.ParseSize(name); !ok {
+			http.Error(w, "404 page not found", http.StatusNotFound)
+			return nil
+		}
+	}
+	if v.size != imagesModel.SizeOriginal || image.Edited() || !image.Viewable() || wm != nil {
+		if v.size == imagesModel.SizeOriginal {
+			v.size = imagesModel.SizeFull
+		}
+		v.format = imaging.Negotiate(r.Header.Get("Accept"))
+	}
+	file, err := ic.open(image, v)
+	if err == storage.ErrNotFound {
+		http.Error(w, "404 page not found", http.StatusNotFound)
+		return nil
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Something went wrong.", http.StatusInternalServerError)
+		return err
+	}
+	defer file.Close()
+	ic.setCacheHeaders(w, r, image, v)
+	// ServeContent answers If-None-Match, If-Modified-Since and Range
+	// requests using the headers set above.
+	http.ServeContent(w, r, image.StoredName, image.CreatedAt, file)
+	return nil
+}
+
+// variant is the version of an image a request asks for. The zero format
+// means the stored file is sent as it is.
+type variant struct {
+	size   imagesModel.Size
+	format imaging.Format
+	wm     *imagesModel.Watermark
+}
+
+// derivative reports whether the variant has to be made from the stored
+// file rather than being the file itself.
+func (v variant) derivative() bool {
+	return v.format != ""
+}
+
+// open returns the file to send for a variant of an image.
+func (ic *ImagesController) open(image *imagesModel.Image, v variant) (io.ReadSeekCloser, error) {
+	if v.derivative() {
+		return ic.imageService.OpenAs(image, v.size, v.format, v.wm)
+	}
+	return ic.storage.Get(path.Join("galleries", fmt.Sprint(image.GalleryID), image.StoredName))
+}
+
+// setCacheHeaders sets the content type, validators and cache lifetime
+// for a variant of an image.
+func (ic *ImagesController) setCacheHeaders(w http.ResponseWriter, r *http.Request, image *imagesModel.Image, v variant) {
+	query := r.URL.Query()
+	contentType := mime.TypeByExtension(path.Ext(image.StoredName))
+	etag := image.Checksum
+	current := true
+	if v.derivative() {
+		contentType = v.format.ContentType()
+		etag = image.Version()
+		if v.wm != nil {
+			etag += "-wm" + v.wm.Version()
+			// The URL was signed for a watermark that has since been changed.
+			current = query.Get("wm") == v.wm.Version()
+		}
+		etag += "-" + v.size.Name + "." + v.format.Extension()
+		// The same URL is sent in a different format depending on what
+		// the browser accepts.
+		w.Header().Set("Vary", "Accept")
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if etag != "" {
+		w.Header().Set("ETag", `"`+etag+`"`)
+	}
+	if v := query.Get("v"); v == "" || v != image.Version() || !current {
+		// Without a version the same URL could point at different bytes in
+		// the future, so caches have to check back using the ETag.
+		w.Header().Set("Cache-Control", "public, no-cache")
+		return
+	}
+	// The URL names these exact bytes, so they can be cached for as long
+	// as the signature is valid. The signature has already been verified.
+	expires, _ := strconv.ParseInt(query.Get("expires"), 10, 64)
+	maxAge := time.Unix(expires, 0).Sub(ic.now())
+	if maxAge > MAX_CACHE_AGE {
+		maxAge = MAX_CACHE_AGE
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", int64(maxAge.Seconds())))
+}
@@ -0,0 +1,374 @@
+package imagesController
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"lenslocked/imaging"
+	"lenslocked/models/errorsModel"
+	"lenslocked/models/galleriesModel"
+	"lenslocked/models/imagesModel"
+	"lenslocked/storage"
+
+	"github.com/labstack/echo/v4"
+)
+
+// fakeImageService serves a single image and checks signatures with a
+// real URLSigner. Methods the controller doesn't use are left nil.
+type fakeImageService struct {
+	imagesModel.ImageService
+	image  *imagesModel.Image
+	signer imagesModel.URLSigner
+	now    time.Time
+}
+
+func (fs *fakeImageService) ByStoredName(name string) (*imagesModel.Image, error) {
+	if name != fs.image.StoredName {
+		return nil, errorsModel.ErrImageNotFound
+	}
+	return fs.image, nil
+}
+
+func (fs *fakeImageService) VerifyURL(u *url.URL) error {
+	return fs.signer.Verify(u, fs.now)
+}
+
+// OpenAs serves a derivative as a description of it rather than the stored
+// file, so tests can tell which one was sent.
+func (fs *fakeImageService) OpenAs(image *imagesModel.Image, size imagesModel.Size, format imaging.Format, wm *imagesModel.Watermark) (io.ReadSeekCloser, error) {
+	desc := fmt.Sprintf("%s %s", size.Name, format)
+	if wm != nil {
+		desc = "watermarked " + wm.Text + " " + desc
+	}
+	return nopCloser{strings.NewReader(desc)}, nil
+}
+
+// fakeGalleryService has a single gallery with a watermark.
+type fakeGalleryService struct {
+	galleriesModel.GalleryService
+	gallery *galleriesModel.Gallery
+}
+
+func (fs *fakeGalleryService) ByID(id uint) (*galleriesModel.Gallery, error) {
+	if id != fs.gallery.ID {
+		return nil, errorsModel.ErrGalleryNotFound
+	}
+	return fs.gallery, nil
+}
+
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error { return nil }
+
+// testController stores size bytes of random data as an image and returns
+// a controller serving it along with a signed, versioned path to it.
+func testController(tb testing.TB, size int) (*ImagesController, *imagesModel.Image, string) {
+	tb.Helper()
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		tb.Fatal(err)
+	}
+	store := storage.NewLocal(tb.TempDir(), "/images")
+	if err := store.Put("galleries/3/abc.jpg", bytes.NewReader(data)); err != nil {
+		tb.Fatal(err)
+	}
+	now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	image := &imagesModel.Image{
+		GalleryID:  3,
+		Filename:   "holiday.jpg",
+		StoredName: "abc.jpg",
+		Checksum:   fmt.Sprintf("%x", sha256.Sum256(data)),
+	}
+	image.CreatedAt = now.Add(-time.Hour)
+	fs := &fakeImageService{image: image, signer: imagesModel.NewURLSigner("test-key"), now: now}
+	ic := NewImagesController(fs, nil, store)
+	ic.now = func() time.Time { return now }
+	return ic, image, image.SignedPath(fs.signer, now.Add(time.Hour))
+}
+
+// serve sends a request for target through the Show handler.
+func serve(ic *ImagesController, target string, header http.Header) *httptest.ResponseRecorder {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	parts := strings.Split(strings.SplitN(target, "?", 2)[0], "/")
+	c.SetParamNames("galleryId", "name")
+	c.SetParamValues(parts[3], parts[4])
+	ic.Show(c)
+	return rec
+}
+
+func TestShowCacheHeaders(t *testing.T) {
+	ic, image, target := testController(t, 1024)
+	rec := serve(ic, target, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Wrong status. Have: %d, Want: %d", rec.Code, http.StatusOK)
+	}
+	if rec.Body.Len() != 1024 {
+		t.Errorf("Wrong body length. Have: %d, Want: 1024", rec.Body.Len())
+	}
+	want := map[string]string{
+		"ETag":          `"` + image.Checksum + `"`,
+		"Cache-Control": "public, max-age=3600, immutable",
+		"Content-Type":  "image/jpeg",
+		"Accept-Ranges": "bytes",
+		"Last-Modified": image.CreatedAt.Format(http.TimeFormat),
+	}
+	for name, value := range want {
+		if have := rec.Header().Get(name); have != value {
+			t.Errorf("Wrong %s header. Have: %q, Want: %q", name, have, value)
+		}
+	}
+}
+
+func TestShowEdited(t *testing.T) {
+	ic, image, _ := testController(t, 1024)
+	image.Transforms = "cw"
+	target := image.SignedPath(ic.imageService.(*fakeImageService).signer, ic.now().Add(time.Hour))
+	rec := serve(ic, target, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Wrong status. Have: %d, Want: %d", rec.Code, http.StatusOK)
+	}
+	if have := rec.Body.String(); have != "full jpeg" {
+		t.Errorf("Expected the edited image. Have: %q, Want: %q", have, "full jpeg")
+	}
+	want := map[string]string{
+		"ETag":          `"` + image.Version() + `-full.jpg"`,
+		"Cache-Control": "public, max-age=3600, immutable",
+		"Content-Type":  "image/jpeg",
+	}
+	for name, value := range want {
+		if have := rec.Header().Get(name); have != value {
+			t.Errorf("Wrong %s header. Have: %q, Want: %q", name, have, value)
+		}
+	}
+}
+
+func TestShowNotViewable(t *testing.T) {
+	ic, image, _ := testController(t, 1024)
+	image.StoredName = "abc.heic"
+	target := image.SignedPath(ic.imageService.(*fakeImageService).signer, ic.now().Add(time.Hour))
+	rec := serve(ic, target, nil)
+	if have := rec.Body.String(); have != "full jpeg" {
+		t.Errorf("Expected a derivative browsers can show. Have: %q, Want: %q", have, "full jpeg")
+	}
+	if have := rec.Header().Get("Content-Type"); have != "image/jpeg" {
+		t.Errorf("Wrong Content-Type header. Have: %q, Want: %q", have, "image/jpeg")
+	}
+}
+
+func TestShowWatermarked(t *testing.T) {
+	ic, image, _ := testController(t, 1024)
+	gallery := &galleriesModel.Gallery{Watermark: imagesModel.Watermark{Text: "Proof", Position: "tile", Opacity: 50, Scale: 25}}
+	gallery.ID = image.GalleryID
+	ic.galleryService = &fakeGalleryService{gallery: gallery}
+	signer := ic.imageService.(*fakeImageService).signer
+	sign := func(wm imagesModel.Watermark) string {
+		params := url.Values{"v": {image.Version()}, "wm": {wm.Version()}}
+		return signer.Sign(image.Path(), params, ic.now().Add(time.Hour))
+	}
+
+	rec := serve(ic, sign(gallery.Watermark), nil)
+	if have := rec.Body.String(); have != "watermarked Proof full jpeg" {
+		t.Errorf("Expected the watermarked image. Have: %q", have)
+	}
+	want := map[string]string{
+		"ETag":          `"` + image.Version() + "-wm" + gallery.Watermark.Version() + `-full.jpg"`,
+		"Cache-Control": "public, max-age=3600, immutable",
+		"Content-Type":  "image/jpeg",
+	}
+	for name, value := range want {
+		if have := rec.Header().Get(name); have != value {
+			t.Errorf("Wrong %s header. Have: %q, Want: %q", name, have, value)
+		}
+	}
+
+	// A URL signed before the watermark changed gets the new watermark,
+	// but only until it has been checked again.
+	rec = serve(ic, sign(imagesModel.Watermark{Text: "Old"}), nil)
+	if have := rec.Body.String(); have != "watermarked Proof full jpeg" {
+		t.Errorf("Expected the current watermark. Have: %q", have)
+	}
+	if have := rec.Header().Get("Cache-Control"); have != "public, no-cache" {
+		t.Errorf("Wrong Cache-Control header. Have: %q, Want: %q", have, "public, no-cache")
+	}
+}
+
+func TestShowNegotiatesFormat(t *testing.T) {
+	imaging.RegisterEncoder(imaging.FormatWebP, imaging.EncoderFunc(func(img image.Image, quality int) ([]byte, error) {
+		return nil, nil
+	}))
+	t.Cleanup(func() { imaging.UnregisterEncoder(imaging.FormatWebP) })
+	ic, image, _ := testController(t, 1024)
+	params := url.Values{"v": {image.Version()}, "size": {imagesModel.SizeThumb.Name}}
+	target := ic.imageService.(*fakeImageService).signer.Sign(image.Path(), params, ic.now().Add(time.Hour))
+
+	tests := []struct {
+		accept      string
+		body        string
+		contentType string
+		etag        string
+	}{
+		{"image/avif,image/webp,*/*", "thumb webp", "image/webp", image.Version() + "-thumb.webp"},
+		{"image/*,*/*;q=0.8", "thumb jpeg", "image/jpeg", image.Version() + "-thumb.jpg"},
+		{"", "thumb jpeg", "image/jpeg", image.Version() + "-thumb.jpg"},
+	}
+	for _, test := range tests {
+		rec := serve(ic, target, http.Header{"Accept": {test.accept}})
+		if have := rec.Body.String(); have != test.body {
+			t.Errorf("Wrong image for %q. Have: %q, Want: %q", test.accept, have, test.body)
+		}
+		want := map[string]string{
+			"Content-Type": test.contentType,
+			"ETag":         `"` + test.etag + `"`,
+			"Vary":         "Accept",
+		}
+		for name, value := range want {
+			if have := rec.Header().Get(name); have != value {
+				t.Errorf("Wrong %s header for %q. Have: %q, Want: %q", name, test.accept, have, value)
+			}
+		}
+	}
+
+	// Unknown sizes are refused even though the signature is valid.
+	params.Set("size", "huge")
+	target = ic.imageService.(*fakeImageService).signer.Sign(image.Path(), params, ic.now().Add(time.Hour))
+	if rec := serve(ic, target, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Wrong status for an unknown size. Have: %d, Want: %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestShowUnversionedRevalidates(t *testing.T) {
+	ic, image, _ := testController(t, 1024)
+	unversioned := &imagesModel.Image{GalleryID: image.GalleryID, StoredName: image.StoredName}
+	target := unversioned.SignedPath(ic.imageService.(*fakeImageService).signer, ic.now().Add(time.Hour))
+	rec := serve(ic, target, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Wrong status. Have: %d, Want: %d", rec.Code, http.StatusOK)
+	}
+	if have := rec.Header().Get("Cache-Control"); have != "public, no-cache" {
+		t.Errorf("Wrong Cache-Control header. Have: %q, Want: %q", have, "public, no-cache")
+	}
+	if have := rec.Header().Get("ETag"); have == "" {
+		t.Errorf("Expected an ETag so the image can be revalidated")
+	}
+}
+
+func TestShowConditionalGet(t *testing.T) {
+	ic, image, target := testController(t, 1024)
+	tests := map[string]struct {
+		header http.Header
+		status int
+	}{
+		"matching etag":     {http.Header{"If-None-Match": {`"` + image.Checksum + `"`}}, http.StatusNotModified},
+		"any etag":          {http.Header{"If-None-Match": {"*"}}, http.StatusNotModified},
+		"stale etag":        {http.Header{"If-None-Match": {`"stale"`}}, http.StatusOK},
+		"not modified":      {http.Header{"If-Modified-Since": {image.CreatedAt.Format(http.TimeFormat)}}, http.StatusNotModified},
+		"modified since":    {http.Header{"If-Modified-Since": {image.CreatedAt.Add(-time.Hour).Format(http.TimeFormat)}}, http.StatusOK},
+		"weak etag matches": {http.Header{"If-None-Match": {`W/"` + image.Checksum + `"`}}, http.StatusNotModified},
+	}
+	for name, test := range tests {
+		rec := serve(ic, target, test.header)
+		if rec.Code != test.status {
+			t.Errorf("%s: Wrong status. Have: %d, Want: %d", name, rec.Code, test.status)
+		}
+		if rec.Code == http.StatusNotModified && rec.Body.Len() != 0 {
+			t.Errorf("%s: Expected an empty body, Got: %d bytes", name, rec.Body.Len())
+		}
+	}
+}
+
+func TestShowRange(t *testing.T) {
+	ic, image, target := testController(t, 1024)
+	data, err := io.ReadAll(mustGet(t, ic, image))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := serve(ic, target, http.Header{"Range": {"bytes=100-199"}})
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("Wrong status. Have: %d, Want: %d", rec.Code, http.StatusPartialContent)
+	}
+	if !bytes.Equal(rec.Body.Bytes(), data[100:200]) {
+		t.Errorf("Wrong range returned")
+	}
+	if have := rec.Header().Get("Content-Range"); have != "bytes 100-199/1024" {
+		t.Errorf("Wrong Content-Range. Have: %q, Want: %q", have, "bytes 100-199/1024")
+	}
+
+	// A range conditional on an old version gets the whole new file.
+	rec = serve(ic, target, http.Header{"Range": {"bytes=100-199"}, "If-Range": {`"stale"`}})
+	if rec.Code != http.StatusOK || rec.Body.Len() != 1024 {
+		t.Errorf("Wrong If-Range response. Have: %d with %d bytes, Want: 200 with 1024 bytes", rec.Code, rec.Body.Len())
+	}
+}
+
+func TestShowRejects(t *testing.T) {
+	ic, _, target := testController(t, 16)
+	tests := map[string]struct {
+		target string
+		status int
+	}{
+		"unsigned":      {"/images/galleries/3/abc.jpg", http.StatusForbidden},
+		"tampered":      {strings.Replace(target, "v=", "v=0", 1), http.StatusForbidden},
+		"wrong gallery": {ic.imageService.(*fakeImageService).signer.Sign("/images/galleries/4/abc.jpg", nil, ic.now().Add(time.Hour)), http.StatusNotFound},
+		"unknown image": {ic.imageService.(*fakeImageService).signer.Sign("/images/galleries/3/xyz.jpg", nil, ic.now().Add(time.Hour)), http.StatusNotFound},
+	}
+	for name, test := range tests {
+		rec := serve(ic, test.target, nil)
+		if rec.Code != test.status {
+			t.Errorf("%s: Wrong status. Have: %d, Want: %d", name, rec.Code, test.status)
+		}
+		if want := http.StatusText(http.StatusForbidden); test.status == http.StatusForbidden && strings.TrimSpace(rec.Body.String()) != want {
+			t.Errorf("%s: Wrong body. Have: %q, Want: %q", name, rec.Body.String(), want)
+		}
+	}
+}
+
+func mustGet(t *testing.T, ic *ImagesController, image *imagesModel.Image) io.Reader {
+	t.Helper()
+	f, err := ic.storage.Get(fmt.Sprintf("galleries/%d/%s", image.GalleryID, image.StoredName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+// BenchmarkShow compares what goes over the wire when a 1 MiB image is
+// fetched in full, revalidated by a browser that already has it, and
+// resumed partway through. Compare the bytes/op metric between them.
+func BenchmarkShow(b *testing.B) {
+	const size = 1 << 20
+	ic, image, target := testController(b, size)
+	benchmarks := map[string]http.Header{
+		"full":             nil,
+		"if-none-match":    {"If-None-Match": {`"` + image.Checksum + `"`}},
+		"range-last-64KiB": {"Range": {fmt.Sprintf("bytes=%d-", size-64<<10)}},
+	}
+	for name, header := range benchmarks {
+		b.Run(name, func(b *testing.B) {
+			var sent int
+			for i := 0; i < b.N; i++ {
+				sent += serve(ic, target, header).Body.Len()
+			}
+			b.ReportMetric(float64(sent)/float64(b.N), "bytes/op")
+			b.ReportMetric(100*(1-float64(sent)/float64(b.N)/size), "%saved")
+		})
+	}
+}
@@ -0,0 +1,307 @@
+// Package uploadsController implements the tus resumable upload protocol
+// (https://tus.io/protocols/resumable-upload) for adding images to a
+// gallery. A file is sent in as many PATCH requests as it takes, and a
+// client whose connection drops can ask how much arrived and carry on
+// from there instead of starting over.
+package uploadsController
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"lenslocked/context"
+	"lenslocked/models/errorsModel"
+	"lenslocked/models/galleriesModel"
+	"lenslocked/models/imagesModel"
+	"lenslocked/models/uploadsModel"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// TUS_VERSION is the only version of the protocol we speak.
+	TUS_VERSION = "1.0.0"
+
+	// TUS_EXTENSIONS are the optional parts of the protocol we support.
+	TUS_EXTENSIONS = "creation,termination,expiration"
+
+	// OFFSET_CONTENT_TYPE is the content type required on PATCH requests.
+	OFFSET_CONTENT_TYPE = "application/offset+octet-stream"
+)
+
+// The Uploads controller object.
+type UploadsController struct {
+	galleryService galleriesModel.GalleryService
+	imageService   imagesModel.ImageService
+	uploadService  uploadsModel.UploadService
+}
+
+// Instantiates a new Uploads controller.
+func NewUploadsController(gs galleriesModel.GalleryService, is imagesModel.ImageService, us uploadsModel.UploadService) *UploadsController {
+	return &UploadsController{
+		galleryService: gs,
+		imageService:   is,
+		uploadService:  us,
+	}
+}
+
+// Options tells a client which version and extensions of the protocol
+// we support and how large a file may be.
+//
+// OPTIONS /galleries/:galleryId/uploads
+func (uc *UploadsController) Options(c echo.Context) error {
+	h := c.Response().Header()
+	h.Set("Tus-Resumable", TUS_VERSION)
+	h.Set("Tus-Version", TUS_VERSION)
+	h.Set("Tus-Extension", TUS_EXTENSIONS)
+	h.Set("Tus-Max-Size", strconv.Itoa(uploadsModel.MAX_UPLOAD_SIZE))
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Create starts a new upload. The size of the file is required up front
+// and its name is sent in the Upload-Metadata header, along with an
+// optional imagesModel.DuplicatePolicy under "duplicates".
+//
+// POST /galleries/:galleryId/uploads
+func (uc *UploadsController) Create(c echo.Context) error {
+	if !uc.resumable(c) {
+		return nil
+	}
+	gallery, ok := uc.ownedGallery(c)
+	if !ok {
+		return nil
+	}
+	r := c.Request()
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil {
+		return uc.error(c, http.StatusBadRequest, errorsModel.ErrUploadLengthInvalid)
+	}
+	metadata, err := parseMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		return uc.error(c, http.StatusBadRequest, err)
+	}
+	upload := &uploadsModel.Upload{
+		UserID:     gallery.UserID,
+		GalleryID:  gallery.ID,
+		Filename:   metadata["filename"],
+		Duplicates: string(imagesModel.ParseDuplicatePolicy(metadata["duplicates"])),
+		Length:     length,
+	}
+	// Space for the whole file is held from the start, so files that
+	// won't fit are turned away before any of the data is sent.
+	if err := uc.uploadService.Create(upload); err != nil {
+		switch err {
+		case errorsModel.ErrUploadTooLarge, errorsModel.ErrFileTooLarge, errorsModel.ErrStorageQuotaExceeded:
+			return uc.error(c, http.StatusRequestEntityTooLarge, err)
+		case errorsModel.ErrUploadLengthInvalid, errorsModel.ErrFilenameRequired:
+			return uc.error(c, http.StatusBadRequest, err)
+		}
+		return uc.error(c, http.StatusInternalServerError, err)
+	}
+	h := c.Response().Header()
+	h.Set("Location", fmt.Sprintf("/galleries/%d/uploads/%s", gallery.ID, upload.Token))
+	h.Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	return c.NoContent(http.StatusCreated)
+}
+
+// Head reports how much of the file has been received, which is where a
+// client picks up from after an interruption.
+//
+// HEAD /galleries/:galleryId/uploads/:uploadId
+func (uc *UploadsController) Head(c echo.Context) error {
+	if !uc.resumable(c) {
+		return nil
+	}
+	upload, ok := uc.ownedUpload(c)
+	if !ok {
+		return nil
+	}
+	h := c.Response().Header()
+	h.Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	h.Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	h.Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	h.Set("Cache-Control", "no-store")
+	return c.NoContent(http.StatusOK)
+}
+
+// Patch adds the request body to the upload at the offset the client
+// says it is sending from. Once the last byte arrives the file is added
+// to the gallery like any other uploaded image.
+//
+// PATCH /galleries/:galleryId/uploads/:uploadId
+func (uc *UploadsController) Patch(c echo.Context) error {
+	if !uc.resumable(c) {
+		return nil
+	}
+	r := c.Request()
+	if r.Header.Get("Content-Type") != OFFSET_CONTENT_TYPE {
+		http.Error(c.Response().Writer, "Content-Type must be "+OFFSET_CONTENT_TYPE, http.StatusUnsupportedMediaType)
+		return nil
+	}
+	upload, ok := uc.ownedUpload(c)
+	if !ok {
+		return nil
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		http.Error(c.Response().Writer, "Upload-Offset is missing or invalid", http.StatusBadRequest)
+		return nil
+	}
+	if offset != upload.Offset {
+		http.Error(c.Response().Writer, "Upload-Offset does not match the upload", http.StatusConflict)
+		return nil
+	}
+	// A request with no body for a complete upload retries adding it to
+	// the gallery, in case that failed the first time.
+	if !upload.Complete() {
+		if _, err := uc.uploadService.Write(upload, r.Body); err != nil {
+			switch err {
+			case errorsModel.ErrUploadTooLarge:
+				return uc.error(c, http.StatusRequestEntityTooLarge, err)
+			case errorsModel.ErrUploadConflict:
+				return uc.error(c, http.StatusConflict, err)
+			}
+			// The client has most likely gone away, but whatever did arrive
+			// has been kept for when it comes back.
+			log.Println(err)
+			return uc.error(c, http.StatusInternalServerError, err)
+		}
+	}
+	h := c.Response().Header()
+	h.Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	h.Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	if upload.Complete() {
+		if err := uc.finish(upload); err != nil {
+			if _, ok := err.(errorsModel.ImageError); ok {
+				return uc.error(c, http.StatusUnprocessableEntity, err)
+			}
+			return uc.error(c, http.StatusInternalServerError, err)
+		}
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Delete abandons an upload and throws away whatever was received.
+//
+// DELETE /galleries/:galleryId/uploads/:uploadId
+func (uc *UploadsController) Delete(c echo.Context) error {
+	if !uc.resumable(c) {
+		return nil
+	}
+	upload, ok := uc.ownedUpload(c)
+	if !ok {
+		return nil
+	}
+	if err := uc.uploadService.Remove(upload); err != nil {
+		return uc.error(c, http.StatusInternalServerError, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// finish hands a complete upload to the ImageService. The upload is
+// removed whether or not the image is accepted, since sending the same
+// bytes again won't change the outcome. It is only kept when something
+// went wrong on our end, though without the space it held, since the
+// ImageService checks for room for the file again as it is stored.
+func (uc *UploadsController) finish(upload *uploadsModel.Upload) error {
+	if err := uc.uploadService.Release(upload); err != nil {
+		return err
+	}
+	file, err := uc.uploadService.Open(upload)
+	if err != nil {
+		return err
+	}
+	duplicates := imagesModel.ParseDuplicatePolicy(upload.Duplicates)
+	err = uc.imageService.Create(upload.GalleryID, file, upload.Filename, duplicates)
+	if _, ok := err.(errorsModel.ImageError); err != nil && !ok {
+		return err
+	}
+	if rmErr := uc.uploadService.Remove(upload); rmErr != nil {
+		log.Println(rmErr)
+	}
+	return err
+}
+
+// resumable sets the Tus-Resumable header on the response and checks that
+// the client speaks the same version of the protocol. It writes the
+// response and returns false if not.
+func (uc *UploadsController) resumable(c echo.Context) bool {
+	c.Response().Header().Set("Tus-Resumable", TUS_VERSION)
+	if c.Request().Header.Get("Tus-Resumable") != TUS_VERSION {
+		c.Response().Header().Set("Tus-Version", TUS_VERSION)
+		c.NoContent(http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+// ownedGallery looks up the gallery from the URL and makes sure it belongs
+// to the current user. It writes a 404 response and returns false if not.
+func (uc *UploadsController) ownedGallery(c echo.Context) (*galleriesModel.Gallery, bool) {
+	user := context.User(c.Request().Context())
+	id, err := strconv.ParseUint(c.Param("galleryId"), 10, 64)
+	if err != nil || user == nil {
+		uc.error(c, http.StatusNotFound, errorsModel.ErrGalleryNotFound)
+		return nil, false
+	}
+	gallery, err := uc.galleryService.ByID(uint(id))
+	if err != nil || gallery.UserID != user.ID {
+		uc.error(c, http.StatusNotFound, errorsModel.ErrGalleryNotFound)
+		return nil, false
+	}
+	return gallery, true
+}
+
+// ownedUpload looks up the upload from the URL and makes sure it belongs
+// to the current user and the gallery in the URL. It writes a 404
+// response and returns false if not.
+func (uc *UploadsController) ownedUpload(c echo.Context) (*uploadsModel.Upload, bool) {
+	user := context.User(c.Request().Context())
+	upload, err := uc.uploadService.ByToken(c.Param("uploadId"))
+	if err != nil || user == nil || upload.UserID != user.ID ||
+		strconv.FormatUint(uint64(upload.GalleryID), 10) != c.Param("galleryId") {
+		uc.error(c, http.StatusNotFound, errorsModel.ErrUploadNotFound)
+		return nil, false
+	}
+	return upload, true
+}
+
+// error writes a plain text error response. Public errors are shown to
+// the client as is, anything else is logged and replaced with a generic
+// message.
+func (uc *UploadsController) error(c echo.Context, status int, err error) error {
+	msg := "Something went wrong."
+	if pErr, ok := err.(interface{ Public() string }); ok {
+		msg = pErr.Public()
+	} else {
+		log.Println(err)
+	}
+	http.Error(c.Response().Writer, msg, status)
+	return nil
+}
+
+// parseMetadata decodes an Upload-Metadata header, which is a comma
+// separated list of keys, each followed by a space and a base64 encoded
+// value. Values are optional.
+func parseMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errorsModel.ErrUploadMetadataInvalid
+		}
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, errorsModel.ErrUploadMetadataInvalid
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
@@ -0,0 +1,290 @@
+package uploadsController
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"lenslocked/context"
+	"lenslocked/models/errorsModel"
+	"lenslocked/models/galleriesModel"
+	"lenslocked/models/imagesModel"
+	"lenslocked/models/uploadsModel"
+	"lenslocked/models/usersModel"
+
+	"github.com/labstack/echo/v4"
+)
+
+type fakeGalleryService struct {
+	galleriesModel.GalleryService
+}
+
+// ByID returns gallery 2 owned by user 1 and gallery 3 owned by user 9.
+func (fs *fakeGalleryService) ByID(id uint) (*galleriesModel.Gallery, error) {
+	owners := map[uint]uint{2: 1, 3: 9}
+	if _, ok := owners[id]; !ok {
+		return nil, errorsModel.ErrGalleryNotFound
+	}
+	gallery := &galleriesModel.Gallery{UserID: owners[id]}
+	gallery.ID = id
+	return gallery, nil
+}
+
+// fakeImageService records the files handed to it and rejects any whose
+// name starts with "bad".
+type fakeImageService struct {
+	imagesModel.ImageService
+	created map[string]string
+}
+
+func (fs *fakeImageService) Create(galleryID uint, r io.ReadCloser, filename string, duplicates imagesModel.DuplicatePolicy) error {
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(filename, "bad") {
+		return errorsModel.ImageError{Filename: filename, Err: errorsModel.ErrImageInvalid}
+	}
+	fs.created[filename] = string(data)
+	return nil
+}
+
+// fakeUploadService keeps uploads and their data in memory, and has room
+// for uploads of up to 1000 bytes.
+type fakeUploadService struct {
+	uploadsModel.UploadService
+	uploads map[string]*uploadsModel.Upload
+	data    map[string]*bytes.Buffer
+}
+
+func (fs *fakeUploadService) Create(upload *uploadsModel.Upload) error {
+	if upload.Length > uploadsModel.MAX_UPLOAD_SIZE {
+		return errorsModel.ErrUploadTooLarge
+	}
+	if upload.Length > 1000 {
+		return errorsModel.ErrStorageQuotaExceeded
+	}
+	upload.Reserved = true
+	upload.Token = "token" + strconv.Itoa(len(fs.uploads))
+	upload.ExpiresAt = time.Now().Add(uploadsModel.UPLOAD_TTL)
+	fs.uploads[upload.Token] = upload
+	fs.data[upload.Token] = &bytes.Buffer{}
+	return nil
+}
+
+func (fs *fakeUploadService) ByToken(token string) (*uploadsModel.Upload, error) {
+	upload, ok := fs.uploads[token]
+	if !ok {
+		return nil, errorsModel.ErrUploadNotFound
+	}
+	return upload, nil
+}
+
+func (fs *fakeUploadService) Write(upload *uploadsModel.Upload, r io.Reader) (int64, error) {
+	n, err := io.Copy(fs.data[upload.Token], r)
+	upload.Offset += n
+	return n, err
+}
+
+func (fs *fakeUploadService) Open(upload *uploadsModel.Upload) (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(fs.data[upload.Token].Bytes())), nil
+}
+
+func (fs *fakeUploadService) Release(upload *uploadsModel.Upload) error {
+	upload.Reserved = false
+	return nil
+}
+
+func (fs *fakeUploadService) Remove(upload *uploadsModel.Upload) error {
+	delete(fs.uploads, upload.Token)
+	delete(fs.data, upload.Token)
+	return nil
+}
+
+type testServer struct {
+	t       *testing.T
+	handler http.Handler
+	images  *fakeImageService
+	uploads *fakeUploadService
+}
+
+// newTestServer routes requests to an UploadsController the same way the
+// app does, with user 1 logged in.
+func newTestServer(t *testing.T) *testServer {
+	images := &fakeImageService{created: map[string]string{}}
+	uploads := &fakeUploadService{uploads: map[string]*uploadsModel.Upload{}, data: map[string]*bytes.Buffer{}}
+	uc := NewUploadsController(&fakeGalleryService{}, images, uploads)
+	e := echo.New()
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			user := &usersModel.User{}
+			user.ID = 1
+			r := c.Request()
+			c.SetRequest(r.WithContext(context.WithUser(r.Context(), user)))
+			return next(c)
+		}
+	})
+	e.OPTIONS("/galleries/:galleryId/uploads", uc.Options)
+	e.POST("/galleries/:galleryId/uploads", uc.Create)
+	e.HEAD("/galleries/:galleryId/uploads/:uploadId", uc.Head)
+	e.PATCH("/galleries/:galleryId/uploads/:uploadId", uc.Patch)
+	e.DELETE("/galleries/:galleryId/uploads/:uploadId", uc.Delete)
+	return &testServer{t: t, handler: e, images: images, uploads: uploads}
+}
+
+// do sends a tus request, adding the Tus-Resumable header.
+func (ts *testServer) do(method, target string, header map[string]string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Tus-Resumable", TUS_VERSION)
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	ts.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// create starts an upload and returns its location.
+func (ts *testServer) create(filename string, length int) string {
+	ts.t.Helper()
+	rec := ts.do(http.MethodPost, "/galleries/2/uploads", map[string]string{
+		"Upload-Length":   strconv.Itoa(length),
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte(filename)) + ",filetype aW1hZ2UvanBlZw==,is_confidential",
+	}, "")
+	if rec.Code != http.StatusCreated {
+		ts.t.Fatalf("Wrong status creating upload. Have: %d, Want: %d", rec.Code, http.StatusCreated)
+	}
+	return rec.Header().Get("Location")
+}
+
+// patch sends a chunk of data starting at offset.
+func (ts *testServer) patch(location string, offset int, chunk string) *httptest.ResponseRecorder {
+	return ts.do(http.MethodPatch, location, map[string]string{
+		"Content-Type":  OFFSET_CONTENT_TYPE,
+		"Upload-Offset": strconv.Itoa(offset),
+	}, chunk)
+}
+
+func TestUploadOptions(t *testing.T) {
+	ts := newTestServer(t)
+	req := httptest.NewRequest(http.MethodOptions, "/galleries/2/uploads", nil)
+	rec := httptest.NewRecorder()
+	ts.handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("Wrong status. Have: %d, Want: %d", rec.Code, http.StatusNoContent)
+	}
+	want := map[string]string{
+		"Tus-Version":   TUS_VERSION,
+		"Tus-Extension": TUS_EXTENSIONS,
+		"Tus-Max-Size":  strconv.Itoa(uploadsModel.MAX_UPLOAD_SIZE),
+	}
+	for name, value := range want {
+		if have := rec.Header().Get(name); have != value {
+			t.Errorf("Wrong %s header. Have: %q, Want: %q", name, have, value)
+		}
+	}
+}
+
+func TestUploadResumes(t *testing.T) {
+	ts := newTestServer(t)
+	location := ts.create("holiday.jpg", 11)
+	if !strings.HasPrefix(location, "/galleries/2/uploads/") {
+		t.Fatalf("Wrong location: %q", location)
+	}
+
+	if rec := ts.patch(location, 0, "hello"); rec.Code != http.StatusNoContent || rec.Header().Get("Upload-Offset") != "5" {
+		t.Fatalf("Wrong first chunk response. Have: %d at offset %q, Want: 204 at offset 5", rec.Code, rec.Header().Get("Upload-Offset"))
+	}
+	// The client lost track of what arrived and tries to resend it.
+	if rec := ts.patch(location, 0, "hello"); rec.Code != http.StatusConflict {
+		t.Errorf("Wrong status for mismatched offset. Have: %d, Want: %d", rec.Code, http.StatusConflict)
+	}
+	rec := ts.do(http.MethodHead, location, nil, "")
+	if rec.Code != http.StatusOK || rec.Header().Get("Upload-Offset") != "5" || rec.Header().Get("Upload-Length") != "11" {
+		t.Errorf("Wrong HEAD response. Have: %d with offset %q of %q", rec.Code, rec.Header().Get("Upload-Offset"), rec.Header().Get("Upload-Length"))
+	}
+	if have := rec.Header().Get("Cache-Control"); have != "no-store" {
+		t.Errorf("Wrong Cache-Control header. Have: %q, Want: %q", have, "no-store")
+	}
+	if len(ts.images.created) != 0 {
+		t.Errorf("Expected no image before the upload is complete")
+	}
+
+	if rec := ts.patch(location, 5, " world"); rec.Code != http.StatusNoContent {
+		t.Fatalf("Wrong status for last chunk. Have: %d, Want: %d", rec.Code, http.StatusNoContent)
+	}
+	if have := ts.images.created["holiday.jpg"]; have != "hello world" {
+		t.Errorf("Wrong image created. Have: %q, Want: %q", have, "hello world")
+	}
+	if len(ts.uploads.uploads) != 0 {
+		t.Errorf("Expected the finished upload to be removed")
+	}
+}
+
+func TestUploadRejectedImage(t *testing.T) {
+	ts := newTestServer(t)
+	location := ts.create("bad.jpg", 3)
+	rec := ts.patch(location, 0, "abc")
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Wrong status. Have: %d, Want: %d", rec.Code, http.StatusUnprocessableEntity)
+	}
+	want := errorsModel.ImageError{Filename: "bad.jpg", Err: errorsModel.ErrImageInvalid}.Public()
+	if have := strings.TrimSpace(rec.Body.String()); have != want {
+		t.Errorf("Wrong message. Have: %q, Want: %q", have, want)
+	}
+	if len(ts.uploads.uploads) != 0 {
+		t.Errorf("Expected the rejected upload to be removed")
+	}
+}
+
+func TestUploadRequests(t *testing.T) {
+	ts := newTestServer(t)
+	location := ts.create("holiday.jpg", 10)
+	tests := map[string]struct {
+		method string
+		target string
+		header map[string]string
+		status int
+	}{
+		"other user's gallery": {http.MethodPost, "/galleries/3/uploads", map[string]string{"Upload-Length": "10"}, http.StatusNotFound},
+		"missing length":       {http.MethodPost, "/galleries/2/uploads", nil, http.StatusBadRequest},
+		"over quota":           {http.MethodPost, "/galleries/2/uploads", map[string]string{"Upload-Length": "1001", "Upload-Metadata": "filename YS5qcGc="}, http.StatusRequestEntityTooLarge},
+		"bad metadata":         {http.MethodPost, "/galleries/2/uploads", map[string]string{"Upload-Length": "10", "Upload-Metadata": "filename !!!"}, http.StatusBadRequest},
+		"wrong version":        {http.MethodHead, location, map[string]string{"Tus-Resumable": "0.2.2"}, http.StatusPreconditionFailed},
+		"wrong content type":   {http.MethodPatch, location, map[string]string{"Upload-Offset": "0"}, http.StatusUnsupportedMediaType},
+		"unknown upload":       {http.MethodHead, "/galleries/2/uploads/nope", nil, http.StatusNotFound},
+		"wrong gallery":        {http.MethodHead, strings.Replace(location, "/2/", "/3/", 1), nil, http.StatusNotFound},
+	}
+	for name, test := range tests {
+		if rec := ts.do(test.method, test.target, test.header, ""); rec.Code != test.status {
+			t.Errorf("%s: Wrong status. Have: %d, Want: %d", name, rec.Code, test.status)
+		}
+	}
+
+	if rec := ts.do(http.MethodDelete, location, nil, ""); rec.Code != http.StatusNoContent {
+		t.Errorf("Wrong status for delete. Have: %d, Want: %d", rec.Code, http.StatusNoContent)
+	}
+	if rec := ts.do(http.MethodHead, location, nil, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Wrong status after delete. Have: %d, Want: %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestParseMetadata(t *testing.T) {
+	have, err := parseMetadata("filename bXkgcGhvdG8uanBn, filetype aW1hZ2UvanBlZw==,flag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"filename": "my photo.jpg", "filetype": "image/jpeg", "flag": ""}
+	for key, value := range want {
+		if have[key] != value {
+			t.Errorf("Wrong %s. Have: %q, Want: %q", key, have[key], value)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/sha512"
 	"encoding/base64"
 	"hash"
+	"sync"
 )
 
 // NewHMAC returns a new HMAC object.
@@ -12,13 +13,16 @@ func NewHMAC(key string) HMAC {
 	h := hmac.New(sha512.New, []byte(key))
 	return HMAC{
 		hmac: h,
+		mu:   &sync.Mutex{},
 	}
 }
 
 // HMAC is a wrapper around a shared hash object to make it easier to use
-// in our code.
+// in our code. The hash object is guarded by a mutex so one HMAC can be
+// shared by concurrent requests.
 type HMAC struct {
 	hmac hash.Hash
+	mu   *sync.Mutex
 }
 
 // Hash takes in a new string to hash and returns the hashed value.
@@ -26,6 +30,8 @@ type HMAC struct {
 // saving into the database. It is also used for user authentication
 // when the remember token is provided as part of logging in.
 func (h HMAC) Hash(input string) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
 	h.hmac.Reset()
 	h.hmac.Write([]byte(input))
 	b := h.hmac.Sum(nil)
@@ -0,0 +1,165 @@
+package imaging
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// COMMAND_TIMEOUT is the longest an external encoder or decoder can take
+// with a single image.
+const COMMAND_TIMEOUT = 2 * time.Minute
+
+// A CommandEncoder encodes images by running an external program, for
+// formats the standard library can't write. The image is handed to the
+// program as a PNG file and the encoded image read back from the file the
+// program writes.
+type CommandEncoder struct {
+	// Path is the program to run.
+	Path string
+	// Args returns the arguments that make the program encode the PNG at
+	// in into out at the provided quality.
+	Args func(quality int, in, out string) []string
+}
+
+// CWebP returns an encoder that uses the cwebp program from libwebp.
+func CWebP(path string) CommandEncoder {
+	return CommandEncoder{
+		Path: path,
+		Args: func(quality int, in, out string) []string {
+			return []string{"-quiet", "-q", fmt.Sprint(quality), in, "-o", out}
+		},
+	}
+}
+
+// AvifEnc returns an encoder that uses the avifenc program from libavif.
+// AVIF looks as good as JPEG at a much lower quality setting, so the
+// quality is lowered to match.
+func AvifEnc(path string) CommandEncoder {
+	return CommandEncoder{
+		Path: path,
+		Args: func(quality int, in, out string) []string {
+			q := quality - 20
+			if q < 1 {
+				q = 1
+			}
+			return []string{"--speed", "6", "-q", fmt.Sprint(q), in, out}
+		},
+	}
+}
+
+// Encode runs the program on the image and returns what it wrote.
+func (ce CommandEncoder) Encode(img image.Image, quality int) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "lenslocked-encode-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	in := filepath.Join(dir, "in.png")
+	out := filepath.Join(dir, "out")
+	// The file is only read once, so it is written as fast as possible.
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestSpeed}
+	if err := encoder.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(in, buf.Bytes(), 0600); err != nil {
+		return nil, err
+	}
+	if err := runCommand(ce.Path, ce.Args(quality, in, out)); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(out)
+}
+
+// A CommandDecoder decodes images by running an external program, for
+// formats the standard library can't read. The image is handed to the
+// program as a file and read back from the PNG the program writes.
+type CommandDecoder struct {
+	// Path is the program to run.
+	Path string
+	// Ext is the extension the program expects files in the format to
+	// have, without a dot.
+	Ext string
+	// Args returns the arguments that make the program write the image at
+	// in as a PNG at out.
+	Args func(in, out string) []string
+}
+
+// DWebP returns a decoder for WebP images that uses the dwebp program from
+// libwebp.
+func DWebP(path string) CommandDecoder {
+	return CommandDecoder{
+		Path: path,
+		Ext:  "webp",
+		Args: func(in, out string) []string {
+			return []string{"-quiet", in, "-png", "-o", out}
+		},
+	}
+}
+
+// HeifDec returns a decoder for HEIC images that uses the heif-dec program
+// from libheif, or heif-convert from older versions of it. It turns the
+// image the way the camera says it was held.
+func HeifDec(path string) CommandDecoder {
+	return CommandDecoder{
+		Path: path,
+		Ext:  "heic",
+		Args: func(in, out string) []string {
+			return []string{in, out}
+		},
+	}
+}
+
+// Magick returns a decoder for TIFF images that uses ImageMagick. Only the
+// first page of a TIFF with several is decoded.
+func Magick(path string) CommandDecoder {
+	return CommandDecoder{
+		Path: path,
+		Ext:  "tiff",
+		Args: func(in, out string) []string {
+			return []string{in + "[0]", "png:" + out}
+		},
+	}
+}
+
+// Decode runs the program on the image and decodes the PNG it wrote.
+func (cd CommandDecoder) Decode(data []byte) (image.Image, error) {
+	dir, err := os.MkdirTemp("", "lenslocked-decode-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	in := filepath.Join(dir, "in."+cd.Ext)
+	out := filepath.Join(dir, "out.png")
+	if err := os.WriteFile(in, data, 0600); err != nil {
+		return nil, err
+	}
+	if err := runCommand(cd.Path, cd.Args(in, out)); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(out)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return png.Decode(f)
+}
+
+// runCommand runs a program for at most COMMAND_TIMEOUT, returning what it
+// printed as part of the error if it fails.
+func runCommand(path string, args []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), COMMAND_TIMEOUT)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, path, args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("imaging: %s failed: %v: %s", filepath.Base(path), err, bytes.TrimSpace(output))
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"sync"
+
+	// Register the decoders for the formats the standard library can read.
+	_ "image/gif"
+	_ "image/png"
+)
+
+// ErrDecoderMissing is returned when decoding an image in a format that
+// needs a decoder registered for it and there isn't one.
+var ErrDecoderMissing = errors.New("imaging: no decoder for format")
+
+// A Decoder decodes images in a format the standard library can't read,
+// usually by handing them to an external program.
+type Decoder interface {
+	Decode(data []byte) (image.Image, error)
+}
+
+// DecoderFunc lets an ordinary function be used as a Decoder.
+type DecoderFunc func(data []byte) (image.Image, error)
+
+// Decode calls fn(data).
+func (fn DecoderFunc) Decode(data []byte) (image.Image, error) {
+	return fn(data)
+}
+
+var (
+	decodersMu sync.RWMutex
+	decoders   = map[string]Decoder{}
+)
+
+// RegisterDecoder makes images in the format decodable, replacing any
+// decoder that was registered for it before. The format is the name Sniff
+// reports for it, such as "webp", "heic" or "tiff".
+func RegisterDecoder(format string, d Decoder) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+	decoders[format] = d
+}
+
+// UnregisterDecoder stops images in the format from being decoded.
+func UnregisterDecoder(format string) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+	delete(decoders, format)
+}
+
+// decoder returns the decoder registered for the format.
+func decoder(format string) (Decoder, bool) {
+	decodersMu.RLock()
+	defer decodersMu.RUnlock()
+	d, ok := decoders[format]
+	return d, ok
+}
+
+// magics are the magic numbers that identify each format we accept, with
+// ? matching any byte. RAW files are either TIFF files, some with magic
+// numbers of their own, or Fujifilm's RAF format.
+var magics = []struct {
+	format string
+	magic  string
+}{
+	{"jpeg", "\xff\xd8"},
+	{"png", "\x89PNG\r\n\x1a\n"},
+	{"gif", "GIF87a"},
+	{"gif", "GIF89a"},
+	{"webp", "RIFF????WEBPVP8"},
+	{"heic", "????ftypheic"},
+	{"heic", "????ftypheix"},
+	{"heic", "????ftyphevc"},
+	{"heic", "????ftypheim"},
+	{"heic", "????ftypheis"},
+	{"heic", "????ftypmif1"},
+	{"tiff", "II*\x00"},
+	{"tiff", "MM\x00*"},
+	{"tiff", "IIRO"},
+	{"tiff", "IIRS"},
+	{"tiff", "MMOR"},
+	{"tiff", "IIU\x00"},
+	{"raf", "FUJIFILMCCD-RAW"},
+}
+
+func init() {
+	for _, m := range magics {
+		switch m.format {
+		case "webp":
+			image.RegisterFormat(m.format, m.magic, decodeWith("webp"), webpConfig)
+		case "heic":
+			image.RegisterFormat(m.format, m.magic, decodeWith("heic"), heicConfig)
+		case "tiff":
+			image.RegisterFormat(m.format, m.magic, readAll(decodeTIFF), readAllConfig(tiffConfig))
+		case "raf":
+			image.RegisterFormat(m.format, m.magic, readAll(decodeRAF), readAllConfig(rafConfig))
+		}
+	}
+}
+
+// Sniff returns the name of the format the data is in going by its magic
+// number alone, or "" if it isn't a format we accept. It matches the name
+// image.Decode reports for the format.
+func Sniff(data []byte) string {
+	for _, m := range magics {
+		if matchMagic(m.magic, data) {
+			return m.format
+		}
+	}
+	return ""
+}
+
+// matchMagic reports whether data starts with the magic number.
+func matchMagic(magic string, data []byte) bool {
+	if len(data) < len(magic) {
+		return false
+	}
+	for i, b := range data[:len(magic)] {
+		if magic[i] != b && magic[i] != '?' {
+			return false
+		}
+	}
+	return true
+}
+
+// CanDecode reports whether the image can be decoded with the decoders
+// that are registered. Images the standard library can read and RAW files
+// with a preview in them can always be decoded.
+func CanDecode(data []byte) bool {
+	format := Sniff(data)
+	switch format {
+	case "jpeg", "png", "gif", "raf":
+		return true
+	case "tiff":
+		if t, err := parseTIFF(data); err == nil && t.raw() {
+			return true
+		}
+		_, ok := decoder("tiff")
+		return ok
+	case "":
+		return false
+	default:
+		_, ok := decoder(format)
+		return ok
+	}
+}
+
+// decodeWith returns an image.Decode function that uses the decoder
+// registered for the format.
+func decodeWith(format string) func(io.Reader) (image.Image, error) {
+	return readAll(func(data []byte) (image.Image, error) {
+		d, ok := decoder(format)
+		if !ok {
+			return nil, ErrDecoderMissing
+		}
+		return d.Decode(data)
+	})
+}
+
+// readAll adapts a function that decodes a whole file to the signature
+// image.RegisterFormat wants.
+func readAll(fn func([]byte) (image.Image, error)) func(io.Reader) (image.Image, error) {
+	return func(r io.Reader) (image.Image, error) {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return fn(data)
+	}
+}
+
+// readAllConfig is readAll for image.DecodeConfig functions.
+func readAllConfig(fn func([]byte) (image.Config, error)) func(io.Reader) (image.Config, error) {
+	return func(r io.Reader) (image.Config, error) {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return image.Config{}, err
+		}
+		return fn(data)
+	}
+}
+
+// errHeader is returned when an image's header can't be read.
+var errHeader = errors.New("imaging: invalid image header")
+
+// webpConfig reads the dimensions of a WebP image from whichever of the
+// three kinds of header it has.
+func webpConfig(r io.Reader) (image.Config, error) {
+	header := make([]byte, 30)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return image.Config{}, errHeader
+	}
+	cfg := image.Config{ColorModel: color.NRGBAModel}
+	switch string(header[12:16]) {
+	case "VP8X":
+		// 24 bit canvas width and height, each less one.
+		cfg.Width = int(uint32(header[24])|uint32(header[25])<<8|uint32(header[26])<<16) + 1
+		cfg.Height = int(uint32(header[27])|uint32(header[28])<<8|uint32(header[29])<<16) + 1
+	case "VP8 ":
+		// A key frame starts with a 3 byte tag and then a start code.
+		if !bytes.Equal(header[23:26], []byte{0x9d, 0x01, 0x2a}) {
+			return image.Config{}, errHeader
+		}
+		cfg.Width = int(binary.LittleEndian.Uint16(header[26:]) & 0x3fff)
+		cfg.Height = int(binary.LittleEndian.Uint16(header[28:]) & 0x3fff)
+	case "VP8L":
+		if header[20] != 0x2f {
+			return image.Config{}, errHeader
+		}
+		bits := binary.LittleEndian.Uint32(header[21:])
+		cfg.Width = int(bits&0x3fff) + 1
+		cfg.Height = int(bits>>14&0x3fff) + 1
+	default:
+		return image.Config{}, errHeader
+	}
+	return cfg, nil
+}
+
+// heicConfig reads the dimensions of a HEIC image from the ispe boxes that
+// describe the size of each item in it. Photos are often stored as a grid
+// of tiles with a box each, so the largest is the size of the whole image.
+func heicConfig(r io.Reader) (image.Config, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	cfg := image.Config{ColorModel: color.NRGBAModel}
+	rest := data
+	for {
+		i := bytes.Index(rest, []byte("ispe"))
+		// The box type is followed by a version, flags, width and height.
+		if i < 0 || i+16 > len(rest) {
+			break
+		}
+		w := uint64(binary.BigEndian.Uint32(rest[i+8:]))
+		h := uint64(binary.BigEndian.Uint32(rest[i+12:]))
+		if w*h > uint64(cfg.Width)*uint64(cfg.Height) {
+			cfg.Width, cfg.Height = int(w), int(h)
+		}
+		rest = rest[i+4:]
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return image.Config{}, errHeader
+	}
+	return cfg, nil
+}
@@ -0,0 +1,232 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os/exec"
+	"testing"
+)
+
+func encodeTestJPEG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, w, h)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// tiffField is an entry to write into a test TIFF's IFD0.
+type tiffField struct {
+	tag   uint16
+	typ   uint16
+	value uint32
+}
+
+// buildTIFF returns a little endian TIFF file with a single directory
+// holding the fields, followed by extra. Offsets in the fields can point
+// at extra by adding tiffDataOffset(len(fields)) to them.
+func buildTIFF(magic string, fields []tiffField, extra []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(magic)
+	binary.Write(&buf, binary.LittleEndian, uint32(8))
+	binary.Write(&buf, binary.LittleEndian, uint16(len(fields)))
+	for _, f := range fields {
+		binary.Write(&buf, binary.LittleEndian, f.tag)
+		binary.Write(&buf, binary.LittleEndian, f.typ)
+		binary.Write(&buf, binary.LittleEndian, uint32(1))
+		binary.Write(&buf, binary.LittleEndian, f.value)
+	}
+	binary.Write(&buf, binary.LittleEndian, uint32(0))
+	buf.Write(extra)
+	return buf.Bytes()
+}
+
+// tiffDataOffset is where the extra data starts in a TIFF from buildTIFF.
+func tiffDataOffset(fields int) uint32 {
+	return uint32(8 + 2 + fields*12 + 4)
+}
+
+// testRAW returns a RAW file that keeps a w by h preview in IFD0 the way
+// Nikon cameras do, with the orientation set.
+func testRAW(t *testing.T, w, h int, orientation uint32) []byte {
+	t.Helper()
+	preview := encodeTestJPEG(t, w, h)
+	fields := []tiffField{
+		{tagNewSubfileType, 4, subfileReducedImage},
+		{tagOrientation, 3, orientation},
+		{tagJPEGOffset, 4, tiffDataOffset(4)},
+		{tagJPEGLength, 4, uint32(len(preview))},
+	}
+	return buildTIFF("II*\x00", fields, preview)
+}
+
+func TestSniff(t *testing.T) {
+	var gifData bytes.Buffer
+	if err := gif.Encode(&gifData, image.NewPaletted(image.Rect(0, 0, 1, 1), color.Palette{color.Black}), nil); err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string][]byte{
+		"jpeg": encodeTestJPEG(t, 1, 1),
+		"gif":  gifData.Bytes(),
+		"webp": []byte("RIFF\x00\x00\x00\x00WEBPVP8X"),
+		"heic": []byte("\x00\x00\x00\x18ftypheic"),
+		"tiff": []byte("MM\x00*\x00\x00\x00\x08"),
+		"raf":  []byte("FUJIFILMCCD-RAW 0201"),
+		"":     []byte("<html>"),
+	}
+	for want, data := range tests {
+		if have := Sniff(data); have != want {
+			t.Errorf("Have: %q, Want: %q", have, want)
+		}
+	}
+}
+
+func TestWebPConfig(t *testing.T) {
+	header := func(chunk string, rest ...byte) []byte {
+		data := append([]byte("RIFF\x00\x00\x00\x00WEBP"+chunk+"\x00\x00\x00\x00"), rest...)
+		return append(data, make([]byte, 30)...)
+	}
+	tests := []struct {
+		data []byte
+		w, h int
+	}{
+		// Canvas sizes less one, as 24 bit numbers.
+		{header("VP8X", 0, 0, 0, 0, 199, 0, 0, 99, 0, 0), 200, 100},
+		// A key frame tag, the start code and 14 bit sizes.
+		{header("VP8 ", 0, 0, 0, 0x9d, 0x01, 0x2a, 0x40, 0x01, 0xf0, 0x00), 320, 240},
+		// A signature and then 14 bit sizes less one, packed together.
+		{header("VP8L", 0x2f, 0x09, 0xc0, 0x02, 0x00), 10, 12},
+	}
+	for _, test := range tests {
+		cfg, format, err := image.DecodeConfig(bytes.NewReader(test.data))
+		if err != nil || format != "webp" {
+			t.Errorf("Expected a WebP header, Got: %s %v", format, err)
+			continue
+		}
+		if cfg.Width != test.w || cfg.Height != test.h {
+			t.Errorf("Have: %dx%d, Want: %dx%d", cfg.Width, cfg.Height, test.w, test.h)
+		}
+	}
+	if _, _, err := image.Decode(bytes.NewReader(tests[0].data)); err != ErrDecoderMissing {
+		t.Errorf("Have: %v, Want: %v", err, ErrDecoderMissing)
+	}
+}
+
+func TestHEICConfig(t *testing.T) {
+	ispe := func(w, h uint32) []byte {
+		box := []byte("\x00\x00\x00\x14ispe\x00\x00\x00\x00")
+		box = binary.BigEndian.AppendUint32(box, w)
+		return binary.BigEndian.AppendUint32(box, h)
+	}
+	data := []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic")
+	// A tile and then the grid it is part of.
+	data = append(data, ispe(512, 512)...)
+	data = append(data, ispe(4032, 3024)...)
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || format != "heic" {
+		t.Fatalf("Expected a HEIC header, Got: %s %v", format, err)
+	}
+	if cfg.Width != 4032 || cfg.Height != 3024 {
+		t.Errorf("Have: %dx%d, Want: 4032x3024", cfg.Width, cfg.Height)
+	}
+}
+
+func TestDecodeRAW(t *testing.T) {
+	data := testRAW(t, 40, 20, 6)
+	if !CanDecode(data) {
+		t.Errorf("Expected a RAW file with a preview to be decodable")
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || format != "tiff" || cfg.Width != 40 || cfg.Height != 20 {
+		t.Errorf("Wrong config. Have: %s %dx%d %v, Want: tiff 40x20", format, cfg.Width, cfg.Height, err)
+	}
+	// The camera was turned, so the preview is too.
+	img, _, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := img.Bounds().Size(); size != image.Pt(20, 40) {
+		t.Errorf("Have: %v, Want: %v", size, image.Pt(20, 40))
+	}
+
+	// Without the directory pointing at it, the preview is still found.
+	hidden := buildTIFF("IIRO", []tiffField{{tagImageWidth, 3, 4000}}, encodeTestJPEG(t, 30, 10))
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(hidden)); err != nil || cfg.Width != 30 {
+		t.Errorf("Expected the embedded preview, Got: %v %v", cfg, err)
+	}
+
+	noPreview := buildTIFF("IIU\x00", []tiffField{{tagImageWidth, 3, 4000}}, nil)
+	if _, _, err := Decode(noPreview); err != ErrNoPreview {
+		t.Errorf("Have: %v, Want: %v", err, ErrNoPreview)
+	}
+}
+
+func TestDecodeRAF(t *testing.T) {
+	preview := encodeTestJPEG(t, 16, 8)
+	header := make([]byte, 100)
+	copy(header, "FUJIFILMCCD-RAW 0201FF383501")
+	binary.BigEndian.PutUint32(header[84:], uint32(len(header)))
+	binary.BigEndian.PutUint32(header[88:], uint32(len(preview)))
+	img, format, err := Decode(append(header, preview...))
+	if err != nil || format != "raf" {
+		t.Fatalf("Expected the preview, Got: %s %v", format, err)
+	}
+	if size := img.Bounds().Size(); size != image.Pt(16, 8) {
+		t.Errorf("Have: %v, Want: %v", size, image.Pt(16, 8))
+	}
+}
+
+func TestDecodeTIFF(t *testing.T) {
+	data := buildTIFF("II*\x00", []tiffField{{tagImageWidth, 3, 30}, {tagImageLength, 3, 20}}, nil)
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || cfg.Width != 30 || cfg.Height != 20 {
+		t.Errorf("Wrong config. Have: %dx%d %v, Want: 30x20", cfg.Width, cfg.Height, err)
+	}
+	if CanDecode(data) {
+		t.Errorf("Expected a TIFF not to be decodable without a decoder")
+	}
+	if _, _, err := Decode(data); err != ErrDecoderMissing {
+		t.Errorf("Have: %v, Want: %v", err, ErrDecoderMissing)
+	}
+
+	RegisterDecoder("tiff", DecoderFunc(func(data []byte) (image.Image, error) {
+		return image.NewNRGBA(image.Rect(0, 0, 30, 20)), nil
+	}))
+	t.Cleanup(func() { UnregisterDecoder("tiff") })
+	if !CanDecode(data) {
+		t.Errorf("Expected a TIFF to be decodable with a decoder")
+	}
+	if img, _, err := Decode(data); err != nil || img.Bounds().Dx() != 30 {
+		t.Errorf("Expected the registered decoder to be used, Got: %v", err)
+	}
+}
+
+func TestCommandDecoder(t *testing.T) {
+	cp, err := exec.LookPath("cp")
+	if err != nil {
+		t.Skip("cp is needed to stand in for a decoder")
+	}
+	// Copying a PNG gives back what a real decoder would have written.
+	decoder := CommandDecoder{
+		Path: cp,
+		Ext:  "png",
+		Args: func(in, out string) []string { return []string{in, out} },
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 3, 2))); err != nil {
+		t.Fatal(err)
+	}
+	img, err := decoder.Decode(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := img.Bounds().Size(); size != image.Pt(3, 2) {
+		t.Errorf("Have: %v, Want: %v", size, image.Pt(3, 2))
+	}
+}
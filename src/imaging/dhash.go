@@ -0,0 +1,71 @@
+package imaging
+
+import (
+	"image"
+	"math/bits"
+)
+
+const (
+	// dHashWidth and dHashHeight are the size of the grid an image is
+	// shrunk to. Each row of 9 cells gives 8 left-to-right comparisons,
+	// and 8 rows give the 64 bits of the hash.
+	dHashWidth  = 9
+	dHashHeight = 8
+
+	// dHashSamples is how many pixels are sampled along each side of a
+	// grid cell. Sampling keeps hashing fast for very large photos while
+	// averaging out noise.
+	dHashSamples = 8
+)
+
+// DHash computes the difference hash of an image. The image is shrunk to
+// a 9x8 grid of brightness values and each bit records whether a cell is
+// brighter than the cell to its right. Resizing, recompressing and small
+// exposure changes barely change the hash, so photos that look alike
+// have hashes that differ in only a few bits. Compare hashes with
+// HashDistance.
+func DHash(img image.Image) uint64 {
+	var grid [dHashHeight][dHashWidth]float64
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w == 0 || h == 0 {
+		return 0
+	}
+	for gy := 0; gy < dHashHeight; gy++ {
+		for gx := 0; gx < dHashWidth; gx++ {
+			var sum float64
+			for sy := 0; sy < dHashSamples; sy++ {
+				for sx := 0; sx < dHashSamples; sx++ {
+					// Sample at the center of each sub-cell.
+					x := b.Min.X + ((gx*dHashSamples+sx)*2+1)*w/(2*dHashWidth*dHashSamples)
+					y := b.Min.Y + ((gy*dHashSamples+sy)*2+1)*h/(2*dHashHeight*dHashSamples)
+					sum += luminance(img, x, y)
+				}
+			}
+			grid[gy][gx] = sum
+		}
+	}
+	var hash uint64
+	for gy := 0; gy < dHashHeight; gy++ {
+		for gx := 0; gx < dHashWidth-1; gx++ {
+			hash <<= 1
+			if grid[gy][gx] > grid[gy][gx+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// HashDistance is the number of bits that differ between two hashes.
+// Zero means the images look the same; anything over about 10 of the 64
+// bits means they are different pictures.
+func HashDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// luminance returns the perceived brightness of a pixel.
+func luminance(img image.Image, x, y int) float64 {
+	r, g, b, _ := img.At(x, y).RGBA()
+	return 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+}
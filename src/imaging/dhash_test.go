@@ -0,0 +1,114 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math/rand"
+	"testing"
+)
+
+// scene draws a made up photo: a background gradient with a few randomly
+// placed blocks of color, laid out by seed.
+func scene(seed int64, w, h int) *image.NRGBA {
+	rng := rand.New(rand.NewSource(seed))
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{uint8(x * 255 / w), uint8(y * 255 / h), 128, 255})
+		}
+	}
+	for i := 0; i < 12; i++ {
+		c := color.NRGBA{uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), 255}
+		x0, y0 := rng.Intn(w), rng.Intn(h)
+		x1, y1 := x0+rng.Intn(w/3)+w/10, y0+rng.Intn(h/3)+h/10
+		for y := y0; y < y1 && y < h; y++ {
+			for x := x0; x < x1 && x < w; x++ {
+				img.Set(x, y, c)
+			}
+		}
+	}
+	return img
+}
+
+// shrink scales an image down by half, as a smaller export would.
+func shrink(img *image.NRGBA) *image.NRGBA {
+	b := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, b.Dx()/2, b.Dy()/2))
+	for y := 0; y < b.Dy()/2; y++ {
+		for x := 0; x < b.Dx()/2; x++ {
+			dst.Set(x, y, img.At(x*2, y*2))
+		}
+	}
+	return dst
+}
+
+// brighten adds a constant to every channel, like a small exposure change.
+func brighten(img *image.NRGBA, amount uint8) *image.NRGBA {
+	dst := image.NewNRGBA(img.Bounds())
+	for i, v := range img.Pix {
+		// Every fourth byte is alpha, which is left alone.
+		if i%4 != 3 {
+			if int(v)+int(amount) > 255 {
+				v = 255
+			} else {
+				v += amount
+			}
+		}
+		dst.Pix[i] = v
+	}
+	return dst
+}
+
+func recompress(t *testing.T, img image.Image) image.Image {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 60}); err != nil {
+		t.Fatal(err)
+	}
+	out, err := jpeg.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestDHashSimilarImages(t *testing.T) {
+	original := scene(1, 640, 480)
+	hash := DHash(original)
+	variants := map[string]image.Image{
+		"identical":    original,
+		"shrunk":       shrink(original),
+		"recompressed": recompress(t, original),
+		"brightened":   brighten(original, 20),
+	}
+	for name, img := range variants {
+		if d := HashDistance(hash, DHash(img)); d > 6 {
+			t.Errorf("%s: Expected a similar hash. Distance: %d", name, d)
+		}
+	}
+}
+
+func TestDHashDifferentImages(t *testing.T) {
+	for seed := int64(2); seed < 6; seed++ {
+		d := HashDistance(DHash(scene(1, 640, 480)), DHash(scene(seed, 640, 480)))
+		if d <= 10 {
+			t.Errorf("Seed %d: Expected a different hash. Distance: %d", seed, d)
+		}
+	}
+}
+
+func TestDHashHandlesOffsetBounds(t *testing.T) {
+	img := scene(1, 640, 480)
+	sub := img.SubImage(image.Rect(100, 100, 420, 340))
+	cropped := image.NewNRGBA(image.Rect(0, 0, 320, 240))
+	for y := 0; y < 240; y++ {
+		for x := 0; x < 320; x++ {
+			cropped.Set(x, y, img.At(x+100, y+100))
+		}
+	}
+	if d := HashDistance(DHash(sub), DHash(cropped)); d != 0 {
+		t.Errorf("Expected a sub image to hash like a copy of it. Distance: %d", d)
+	}
+}
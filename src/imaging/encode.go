@@ -0,0 +1,131 @@
+package imaging
+
+import (
+	"errors"
+	"image"
+	"mime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrFormatUnsupported is returned when asked to encode an image in a
+// format that has no encoder registered.
+var ErrFormatUnsupported = errors.New("imaging: no encoder for format")
+
+// Format is a file format that images can be encoded in.
+type Format string
+
+const (
+	FormatJPEG Format = "jpeg"
+	FormatWebP Format = "webp"
+	FormatAVIF Format = "avif"
+)
+
+// preferredFormats lists the formats in the order we would rather send
+// them in, smallest files first. JPEG comes last since every browser can
+// show it.
+var preferredFormats = []Format{FormatAVIF, FormatWebP, FormatJPEG}
+
+// ContentType is the MIME type of the format.
+func (f Format) ContentType() string {
+	return "image/" + string(f)
+}
+
+// Extension is the file extension used for the format, without a dot.
+func (f Format) Extension() string {
+	if f == FormatJPEG {
+		return "jpg"
+	}
+	return string(f)
+}
+
+// An Encoder encodes images in a single format. quality is on the same
+// scale as JPEG quality, from 1 to 100, and encoders for other formats
+// should map it to whatever gives a similar looking result.
+type Encoder interface {
+	Encode(img image.Image, quality int) ([]byte, error)
+}
+
+// EncoderFunc lets an ordinary function be used as an Encoder.
+type EncoderFunc func(img image.Image, quality int) ([]byte, error)
+
+func (fn EncoderFunc) Encode(img image.Image, quality int) ([]byte, error) {
+	return fn(img, quality)
+}
+
+var (
+	encodersMu sync.RWMutex
+	// encoders has every format we can encode in. The standard library
+	// only has a JPEG encoder, so the others have to be registered.
+	encoders = map[Format]Encoder{FormatJPEG: EncoderFunc(EncodeJPEG)}
+)
+
+// RegisterEncoder makes images encodable in the format, replacing any
+// encoder that was registered for it before.
+func RegisterEncoder(f Format, e Encoder) {
+	encodersMu.Lock()
+	defer encodersMu.Unlock()
+	encoders[f] = e
+}
+
+// UnregisterEncoder stops images from being encoded in the format.
+func UnregisterEncoder(f Format) {
+	encodersMu.Lock()
+	defer encodersMu.Unlock()
+	delete(encoders, f)
+}
+
+// Supported reports whether images can be encoded in the format.
+func Supported(f Format) bool {
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+	_, ok := encoders[f]
+	return ok
+}
+
+// Encode encodes an image in the format.
+func Encode(img image.Image, f Format, quality int) ([]byte, error) {
+	encodersMu.RLock()
+	e, ok := encoders[f]
+	encodersMu.RUnlock()
+	if !ok {
+		return nil, ErrFormatUnsupported
+	}
+	return e.Encode(img, quality)
+}
+
+// Negotiate picks the format to send an image in to a browser that sent
+// the provided Accept header. Browsers only get a format other than JPEG
+// if they name it in the header, since many send "*/*" without being able
+// to show every image format. Of the formats a browser names, the one it
+// prefers most is picked, and our own preference breaks ties.
+func Negotiate(accept string) Format {
+	best, bestQ := FormatJPEG, 0.0
+	for _, f := range preferredFormats {
+		if f == FormatJPEG || !Supported(f) {
+			continue
+		}
+		if q := acceptQuality(accept, f.ContentType()); q > bestQ {
+			best, bestQ = f, q
+		}
+	}
+	return best
+}
+
+// acceptQuality returns the q value the Accept header gives to a MIME type
+// listed in it by name, or 0 if it isn't listed.
+func acceptQuality(accept, contentType string) float64 {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || mediaType != contentType {
+			continue
+		}
+		q, err := strconv.ParseFloat(params["q"], 64)
+		if err != nil {
+			return 1
+		}
+		return q
+	}
+	return 0
+}
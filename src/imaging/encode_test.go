@@ -0,0 +1,82 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os/exec"
+	"testing"
+)
+
+// fakeEncoders registers encoders for WebP and AVIF that don't encode
+// anything, for as long as the test runs.
+func fakeEncoders(t *testing.T, formats ...Format) {
+	t.Helper()
+	for _, f := range formats {
+		f := f
+		RegisterEncoder(f, EncoderFunc(func(img image.Image, quality int) ([]byte, error) {
+			return []byte(f), nil
+		}))
+		t.Cleanup(func() { UnregisterEncoder(f) })
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	fakeEncoders(t, FormatWebP, FormatAVIF)
+	tests := []struct {
+		accept string
+		want   Format
+	}{
+		{"", FormatJPEG},
+		{"*/*", FormatJPEG},
+		{"image/*", FormatJPEG},
+		{"image/webp,*/*", FormatWebP},
+		{"image/avif,image/webp,image/apng,image/svg+xml,image/*,*/*;q=0.8", FormatAVIF},
+		{"image/avif;q=0.5, image/webp", FormatWebP},
+		{"image/avif;q=0, image/jpeg", FormatJPEG},
+		{"image/webp;q=0.9, image/avif;q=0.9", FormatAVIF},
+	}
+	for _, test := range tests {
+		if have := Negotiate(test.accept); have != test.want {
+			t.Errorf("%q: Have: %v, Want: %v", test.accept, have, test.want)
+		}
+	}
+}
+
+func TestNegotiateOnlyRegisteredFormats(t *testing.T) {
+	fakeEncoders(t, FormatWebP)
+	if have := Negotiate("image/avif,image/webp,*/*"); have != FormatWebP {
+		t.Errorf("Have: %v, Want: %v", have, FormatWebP)
+	}
+	if _, err := Encode(image.NewNRGBA(image.Rect(0, 0, 1, 1)), FormatAVIF, 80); err != ErrFormatUnsupported {
+		t.Errorf("Have: %v, Want: %v", err, ErrFormatUnsupported)
+	}
+}
+
+func TestCommandEncoder(t *testing.T) {
+	cp, err := exec.LookPath("cp")
+	if err != nil {
+		t.Skip("cp is needed to stand in for an encoder")
+	}
+	// Copying the input gives back the PNG the image was handed over as.
+	encoder := CommandEncoder{
+		Path: cp,
+		Args: func(quality int, in, out string) []string { return []string{in, out} },
+	}
+	data, err := encoder.Encode(image.NewNRGBA(image.Rect(0, 0, 3, 2)), 80)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := png.DecodeConfig(bytes.NewReader(data))
+	if err != nil || cfg.Width != 3 || cfg.Height != 2 {
+		t.Errorf("Expected the 3x2 image back, Got: %v %v", cfg, err)
+	}
+
+	failing := CommandEncoder{
+		Path: cp,
+		Args: func(quality int, in, out string) []string { return []string{"--no-such-flag"} },
+	}
+	if _, err := failing.Encode(image.NewNRGBA(image.Rect(0, 0, 1, 1)), 80); err == nil {
+		t.Errorf("Expected an error when the program fails")
+	}
+}
@@ -0,0 +1,215 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"time"
+)
+
+const (
+	// OrientationUpright is the EXIF orientation for an image whose pixel
+	// data is already stored the right way up.
+	OrientationUpright = 1
+
+	// exifOrientationTag is the IFD0 tag ID for the orientation value.
+	exifOrientationTag = 0x0112
+)
+
+// EXIF tags that are shown alongside a photo. Those in IFD0 say what took
+// it and the rest, in the EXIF directory, how.
+const (
+	tagMake             = 0x010f
+	tagModel            = 0x0110
+	tagExifIFD          = 0x8769
+	tagExposureTime     = 0x829a
+	tagFNumber          = 0x829d
+	tagISO              = 0x8827
+	tagDateTimeOriginal = 0x9003
+	tagFocalLength      = 0x920a
+	tagLensModel        = 0xa434
+)
+
+// exifTimeLayout is how EXIF writes dates, in the camera's local time.
+const exifTimeLayout = "2006:01:02 15:04:05"
+
+// Exif is the shooting information a camera records with a photo. Fields
+// the camera didn't record are left at their zero values. ExposureTime is
+// in seconds and FocalLength in millimetres. Location tags are never read,
+// so where a photo was taken can't end up on a page.
+type Exif struct {
+	Make         string
+	Model        string
+	Lens         string
+	FNumber      float64
+	ExposureTime float64
+	ISO          int
+	FocalLength  float64
+	Taken        time.Time
+}
+
+// Orientation reads the EXIF orientation tag (1 through 8) from JPEG data.
+// Anything that isn't a JPEG, has no EXIF block, or has a malformed EXIF
+// block is treated as upright, since that is how a browser would show it.
+func Orientation(data []byte) int {
+	block := jpegExif(data)
+	if block == nil {
+		return OrientationUpright
+	}
+	return exifOrientation(block)
+}
+
+// ReadExif reads the shooting information from a JPEG, WebP, TIFF or
+// camera RAW file. Files without any, or in other formats, give an empty
+// Exif.
+func ReadExif(data []byte) Exif {
+	var block []byte
+	switch Sniff(data) {
+	case "jpeg":
+		block = jpegExif(data)
+	case "webp":
+		block = webpExif(data)
+	case "tiff":
+		block = data
+	case "raf":
+		if preview, err := rafPreview(data); err == nil {
+			block = jpegExif(preview)
+		}
+	}
+	t, err := parseTIFF(block)
+	if err != nil {
+		return Exif{}
+	}
+	ifd0 := t.ifds[0]
+	exif := Exif{
+		Make:  t.string(ifd0, tagMake),
+		Model: t.string(ifd0, tagModel),
+	}
+	if offset := t.uint(ifd0, tagExifIFD); offset != 0 {
+		if ifd, _, err := t.readIFD(offset); err == nil {
+			exif.Lens = t.string(ifd, tagLensModel)
+			exif.FNumber = t.rational(ifd, tagFNumber)
+			exif.ExposureTime = t.rational(ifd, tagExposureTime)
+			exif.ISO = int(t.uint(ifd, tagISO))
+			exif.FocalLength = t.rational(ifd, tagFocalLength)
+			exif.Taken, _ = time.Parse(exifTimeLayout, t.string(ifd, tagDateTimeOriginal))
+		}
+	}
+	return exif
+}
+
+// jpegExif returns the TIFF structured EXIF block of a JPEG, or nil if it
+// doesn't have one.
+func jpegExif(data []byte) []byte {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil
+	}
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return nil
+		}
+		marker := data[pos+1]
+		// Start of scan means the metadata segments are over.
+		if marker == 0xDA || marker == 0xD9 {
+			return nil
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			return nil
+		}
+		segment := data[pos+4 : pos+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:]
+		}
+		pos += 2 + length
+	}
+	return nil
+}
+
+// webpExif returns the EXIF chunk of a WebP file, or nil if it doesn't have
+// one.
+func webpExif(data []byte) []byte {
+	pos := 12
+	for pos+8 <= len(data) {
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		if size < 0 || pos+8+size > len(data) {
+			return nil
+		}
+		if string(data[pos:pos+4]) == "EXIF" {
+			// Some writers keep the JPEG style header.
+			return bytes.TrimPrefix(data[pos+8:pos+8+size], []byte("Exif\x00\x00"))
+		}
+		// Chunks are padded to an even size.
+		pos += 8 + size + size%2
+	}
+	return nil
+}
+
+// exifOrientation walks IFD0 of a TIFF structured EXIF block looking for
+// the orientation tag.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return OrientationUpright
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return OrientationUpright
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return OrientationUpright
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return OrientationUpright
+		}
+		if order.Uint16(tiff[entry:]) != exifOrientationTag {
+			continue
+		}
+		// The orientation is a SHORT stored inline in the value field.
+		value := int(order.Uint16(tiff[entry+8:]))
+		if value < 1 || value > 8 {
+			return OrientationUpright
+		}
+		return value
+	}
+	return OrientationUpright
+}
+
+// string returns the value of an ASCII field, without the padding cameras
+// tend to leave around it.
+func (t *tiffFile) string(ifd tiffIFD, tag uint16) string {
+	e, ok := ifd[tag]
+	if !ok || e.typ != 2 {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(e.value), "\x00"))
+}
+
+// rational returns the first value of a field holding fractions, or 0 if
+// the directory doesn't have it.
+func (t *tiffFile) rational(ifd tiffIFD, tag uint16) float64 {
+	e, ok := ifd[tag]
+	if !ok || len(e.value) < 8 {
+		return 0
+	}
+	num, den := t.order.Uint32(e.value), t.order.Uint32(e.value[4:])
+	if e.typ == 10 {
+		if int32(den) == 0 {
+			return 0
+		}
+		return float64(int32(num)) / float64(int32(den))
+	}
+	if den == 0 {
+		return 0
+	}
+	return float64(num) / float64(den)
+}
@@ -0,0 +1,124 @@
+package imaging
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// exifField is an entry to write into a test EXIF block. Values longer
+// than four bytes are written after the directory they belong to.
+type exifField struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+func asciiField(tag uint16, s string) exifField {
+	return exifField{tag, 2, uint32(len(s) + 1), append([]byte(s), 0)}
+}
+
+func rationalField(tag uint16, num, den uint32) exifField {
+	value := binary.LittleEndian.AppendUint32(nil, num)
+	return exifField{tag, 5, 1, binary.LittleEndian.AppendUint32(value, den)}
+}
+
+func longField(tag uint16, typ uint16, v uint32) exifField {
+	return exifField{tag, typ, 1, binary.LittleEndian.AppendUint32(nil, v)}
+}
+
+// appendIFD writes a directory holding the fields to the end of block,
+// followed by the values that don't fit in it.
+func appendIFD(block []byte, fields []exifField) []byte {
+	start := len(block)
+	extra := uint32(start + 2 + len(fields)*12 + 4)
+	var values []byte
+	block = binary.LittleEndian.AppendUint16(block, uint16(len(fields)))
+	for _, f := range fields {
+		block = binary.LittleEndian.AppendUint16(block, f.tag)
+		block = binary.LittleEndian.AppendUint16(block, f.typ)
+		block = binary.LittleEndian.AppendUint32(block, f.count)
+		if len(f.value) <= 4 {
+			block = append(block, f.value...)
+			block = append(block, make([]byte, 4-len(f.value))...)
+			continue
+		}
+		block = binary.LittleEndian.AppendUint32(block, extra+uint32(len(values)))
+		values = append(values, f.value...)
+	}
+	block = binary.LittleEndian.AppendUint32(block, 0)
+	return append(block, values...)
+}
+
+// testExif returns an EXIF block like a camera would write, taken with a
+// 50mm lens at f/2.8, 1/250s and ISO 400.
+func testExif() []byte {
+	ifd0 := func(exifIFD uint32) []byte {
+		return appendIFD([]byte("II*\x00\x08\x00\x00\x00"), []exifField{
+			asciiField(tagMake, "Canon"),
+			asciiField(tagModel, "Canon EOS R5"),
+			longField(tagExifIFD, 4, exifIFD),
+		})
+	}
+	block := ifd0(0)
+	block = ifd0(uint32(len(block)))
+	return appendIFD(block, []exifField{
+		rationalField(tagExposureTime, 1, 250),
+		rationalField(tagFNumber, 28, 10),
+		{tagISO, 3, 1, binary.LittleEndian.AppendUint16(nil, 400)},
+		asciiField(tagDateTimeOriginal, "2024:06:01 14:30:00"),
+		rationalField(tagFocalLength, 50, 1),
+		asciiField(tagLensModel, "RF50mm F1.2 L USM "),
+	})
+}
+
+// withExif returns a JPEG with the EXIF block added after its SOI marker.
+func withExif(t *testing.T, block []byte) []byte {
+	t.Helper()
+	jpg := encodeTestJPEG(t, 4, 4)
+	segment := []byte{0xFF, 0xE1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(2+6+len(block)))
+	segment = append(segment, "Exif\x00\x00"...)
+	segment = append(segment, block...)
+	data := append([]byte{}, jpg[:2]...)
+	data = append(data, segment...)
+	return append(data, jpg[2:]...)
+}
+
+func TestReadExif(t *testing.T) {
+	want := Exif{
+		Make:         "Canon",
+		Model:        "Canon EOS R5",
+		Lens:         "RF50mm F1.2 L USM",
+		FNumber:      2.8,
+		ExposureTime: 1.0 / 250,
+		ISO:          400,
+		FocalLength:  50,
+		Taken:        time.Date(2024, 6, 1, 14, 30, 0, 0, time.UTC),
+	}
+	if have := ReadExif(withExif(t, testExif())); have != want {
+		t.Errorf("Have: %+v, Want: %+v", have, want)
+	}
+	// TIFF based files are an EXIF block themselves.
+	if have := ReadExif(testExif()); have != want {
+		t.Errorf("Have: %+v, Want: %+v", have, want)
+	}
+	// WebP files keep it in a chunk of its own.
+	block := testExif()
+	webp := []byte("RIFF\x00\x00\x00\x00WEBPVP8X\x0a\x00\x00\x00")
+	webp = append(webp, make([]byte, 10)...)
+	webp = append(webp, "EXIF"...)
+	webp = binary.LittleEndian.AppendUint32(webp, uint32(len(block)))
+	webp = append(webp, block...)
+	if have := ReadExif(webp); have != want {
+		t.Errorf("Have: %+v, Want: %+v", have, want)
+	}
+
+	if have := ReadExif(encodeTestJPEG(t, 4, 4)); have != (Exif{}) {
+		t.Errorf("Expected nothing from a JPEG without EXIF, Got: %+v", have)
+	}
+	if have := ReadExif(withExif(t, testExif()[:30])); have != (Exif{}) {
+		t.Errorf("Expected nothing from a truncated block, Got: %+v", have)
+	}
+}
@@ -0,0 +1,163 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"strings"
+)
+
+// GLYPH_WIDTH and GLYPH_HEIGHT are the size in pixels of each character
+// in the built-in font, before it is scaled up.
+const (
+	GLYPH_WIDTH  = 5
+	GLYPH_HEIGHT = 7
+)
+
+// glyphPatterns is a small bitmap font covering the characters people put
+// in watermarks. Each glyph is its rows from top to bottom, separated by
+// "|", with "#" for the pixels that are drawn. Lower case letters are
+// drawn as capitals and anything else missing as a question mark.
+var glyphPatterns = map[rune]string{
+	' ':  ".....|.....|.....|.....|.....|.....|.....",
+	'A':  ".###.|#...#|#...#|#####|#...#|#...#|#...#",
+	'B':  "####.|#...#|#...#|####.|#...#|#...#|####.",
+	'C':  ".###.|#...#|#....|#....|#....|#...#|.###.",
+	'D':  "####.|#...#|#...#|#...#|#...#|#...#|####.",
+	'E':  "#####|#....|#....|####.|#....|#....|#####",
+	'F':  "#####|#....|#....|####.|#....|#....|#....",
+	'G':  ".###.|#...#|#....|#.###|#...#|#...#|.####",
+	'H':  "#...#|#...#|#...#|#####|#...#|#...#|#...#",
+	'I':  ".###.|..#..|..#..|..#..|..#..|..#..|.###.",
+	'J':  "..###|...#.|...#.|...#.|...#.|#..#.|.##..",
+	'K':  "#...#|#..#.|#.#..|##...|#.#..|#..#.|#...#",
+	'L':  "#....|#....|#....|#....|#....|#....|#####",
+	'M':  "#...#|##.##|#.#.#|#.#.#|#...#|#...#|#...#",
+	'N':  "#...#|#...#|##..#|#.#.#|#..##|#...#|#...#",
+	'O':  ".###.|#...#|#...#|#...#|#...#|#...#|.###.",
+	'P':  "####.|#...#|#...#|####.|#....|#....|#....",
+	'Q':  ".###.|#...#|#...#|#...#|#.#.#|#..#.|.##.#",
+	'R':  "####.|#...#|#...#|####.|#.#..|#..#.|#...#",
+	'S':  ".####|#....|#....|.###.|....#|....#|####.",
+	'T':  "#####|..#..|..#..|..#..|..#..|..#..|..#..",
+	'U':  "#...#|#...#|#...#|#...#|#...#|#...#|.###.",
+	'V':  "#...#|#...#|#...#|#...#|#...#|.#.#.|..#..",
+	'W':  "#...#|#...#|#...#|#.#.#|#.#.#|#.#.#|.#.#.",
+	'X':  "#...#|#...#|.#.#.|..#..|.#.#.|#...#|#...#",
+	'Y':  "#...#|#...#|.#.#.|..#..|..#..|..#..|..#..",
+	'Z':  "#####|....#|...#.|..#..|.#...|#....|#####",
+	'0':  ".###.|#...#|#..##|#.#.#|##..#|#...#|.###.",
+	'1':  "..#..|.##..|..#..|..#..|..#..|..#..|.###.",
+	'2':  ".###.|#...#|....#|...#.|..#..|.#...|#####",
+	'3':  "#####|...#.|..#..|...#.|....#|#...#|.###.",
+	'4':  "...#.|..##.|.#.#.|#..#.|#####|...#.|...#.",
+	'5':  "#####|#....|####.|....#|....#|#...#|.###.",
+	'6':  "..##.|.#...|#....|####.|#...#|#...#|.###.",
+	'7':  "#####|....#|...#.|..#..|.#...|.#...|.#...",
+	'8':  ".###.|#...#|#...#|.###.|#...#|#...#|.###.",
+	'9':  ".###.|#...#|#...#|.####|....#|...#.|.##..",
+	'.':  ".....|.....|.....|.....|.....|.##..|.##..",
+	',':  ".....|.....|.....|.....|.##..|..#..|.#...",
+	':':  ".....|.##..|.##..|.....|.##..|.##..|.....",
+	';':  ".....|.##..|.##..|.....|.##..|..#..|.#...",
+	'!':  "..#..|..#..|..#..|..#..|..#..|.....|..#..",
+	'?':  ".###.|#...#|....#|...#.|..#..|.....|..#..",
+	'-':  ".....|.....|.....|#####|.....|.....|.....",
+	'_':  ".....|.....|.....|.....|.....|.....|#####",
+	'+':  ".....|..#..|..#..|#####|..#..|..#..|.....",
+	'=':  ".....|.....|#####|.....|#####|.....|.....",
+	'/':  ".....|....#|...#.|..#..|.#...|#....|.....",
+	'\'': "..#..|..#..|.#...|.....|.....|.....|.....",
+	'"':  ".#.#.|.#.#.|.#.#.|.....|.....|.....|.....",
+	'(':  "...#.|..#..|.#...|.#...|.#...|..#..|...#.",
+	')':  ".#...|..#..|...#.|...#.|...#.|..#..|.#...",
+	'&':  ".##..|#..#.|#.#..|.#...|#.#.#|#..#.|.##.#",
+	'@':  ".###.|#...#|....#|.##.#|#.#.#|#.#.#|.###.",
+	'#':  ".#.#.|.#.#.|#####|.#.#.|#####|.#.#.|.#.#.",
+	'|':  "..#..|..#..|..#..|..#..|..#..|..#..|..#..",
+	'©':  ".###.|#...#|#.###|#.#.#|#.###|#...#|.###.",
+}
+
+// glyphs is glyphPatterns parsed into rows of pixels.
+var glyphs = map[rune][GLYPH_HEIGHT][GLYPH_WIDTH]bool{}
+
+func init() {
+	for r, pattern := range glyphPatterns {
+		var glyph [GLYPH_HEIGHT][GLYPH_WIDTH]bool
+		for y, row := range strings.Split(pattern, "|") {
+			for x, c := range row {
+				glyph[y][x] = c == '#'
+			}
+		}
+		glyphs[r] = glyph
+	}
+}
+
+// glyph returns the pixels for a character in the built-in font.
+func glyph(r rune) [GLYPH_HEIGHT][GLYPH_WIDTH]bool {
+	if g, ok := glyphs[r]; ok {
+		return g
+	}
+	if g, ok := glyphs[[]rune(strings.ToUpper(string(r)))[0]]; ok {
+		return g
+	}
+	return glyphs['?']
+}
+
+// RenderText draws a single line of text in the built-in font, with each
+// pixel of the font drawn as a square of scale pixels. The text is white
+// with a dark outline so that it can be read on light and dark photos.
+// The image is transparent everywhere else.
+func RenderText(text string, scale int) *image.NRGBA {
+	if scale < 1 {
+		scale = 1
+	}
+	runes := []rune(text)
+	// Glyphs have a column of space between them, and the outline needs a
+	// pixel of room around the text.
+	w := len(runes)*(GLYPH_WIDTH+1) + 1
+	h := GLYPH_HEIGHT + 2
+	ink := make([][]bool, h)
+	for y := range ink {
+		ink[y] = make([]bool, w)
+	}
+	for i, r := range runes {
+		g := glyph(r)
+		for y := 0; y < GLYPH_HEIGHT; y++ {
+			for x := 0; x < GLYPH_WIDTH; x++ {
+				ink[y+1][i*(GLYPH_WIDTH+1)+x+1] = g[y][x]
+			}
+		}
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, w*scale, h*scale))
+	fill := func(x, y int, c color.NRGBA) {
+		for dy := 0; dy < scale; dy++ {
+			for dx := 0; dx < scale; dx++ {
+				img.SetNRGBA(x*scale+dx, y*scale+dy, c)
+			}
+		}
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			switch {
+			case ink[y][x]:
+				fill(x, y, color.NRGBA{255, 255, 255, 255})
+			case touchesInk(ink, x, y):
+				fill(x, y, color.NRGBA{0, 0, 0, 160})
+			}
+		}
+	}
+	return img
+}
+
+// touchesInk reports whether any of the pixels around x, y are drawn.
+func touchesInk(ink [][]bool, x, y int) bool {
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			ny, nx := y+dy, x+dx
+			if ny >= 0 && ny < len(ink) && nx >= 0 && nx < len(ink[ny]) && ink[ny][nx] {
+				return true
+			}
+		}
+	}
+	return false
+}
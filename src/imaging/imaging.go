@@ -0,0 +1,100 @@
+// Package imaging contains the pixel level helpers used when LensLocked
+// stores images and generates derivatives from them.
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/jpeg"
+)
+
+// JPEGQuality is the quality used whenever we have to re-encode a JPEG.
+const JPEGQuality = 95
+
+// Decode decodes an image and applies its EXIF orientation so that the
+// returned pixels are always the right way up. The format name reported
+// by the image package is returned alongside the image.
+func Decode(data []byte) (image.Image, string, error) {
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	return Orient(img, Orientation(data)), format, nil
+}
+
+// NormalizeOrientation bakes the EXIF orientation of a JPEG into its pixel
+// data. Images that are already upright are returned untouched so that we
+// don't re-encode (and lose quality on) the common case. The re-encoded
+// image carries no EXIF block, so browsers won't rotate it a second time.
+func NormalizeOrientation(data []byte) ([]byte, error) {
+	if Orientation(data) == OrientationUpright {
+		return data, nil
+	}
+	img, _, err := Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: JPEGQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Orient transforms an image stored with the given EXIF orientation into
+// an upright image. Orientations outside of 2 through 8 are returned as is.
+func Orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	src := toNRGBA(img)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := w, h
+	// Orientations 5 through 8 swap the width and the height.
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dx, dy := orientPoint(orientation, x, y, w, h)
+			si := src.PixOffset(x, y)
+			di := dst.PixOffset(dx, dy)
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+	return dst
+}
+
+// orientPoint maps a pixel in the stored image to its upright position.
+func orientPoint(orientation, x, y, w, h int) (int, int) {
+	switch orientation {
+	case 2: // mirrored horizontally
+		return w - 1 - x, y
+	case 3: // rotated 180°
+		return w - 1 - x, h - 1 - y
+	case 4: // mirrored vertically
+		return x, h - 1 - y
+	case 5: // transposed
+		return y, x
+	case 6: // needs a 90° clockwise rotation
+		return h - 1 - y, x
+	case 7: // transversed
+		return h - 1 - y, w - 1 - x
+	case 8: // needs a 90° counter-clockwise rotation
+		return y, w - 1 - x
+	}
+	return x, y
+}
+
+// toNRGBA returns the image as an *image.NRGBA whose bounds start at (0, 0).
+func toNRGBA(img image.Image) *image.NRGBA {
+	if n, ok := img.(*image.NRGBA); ok && n.Rect.Min == (image.Point{}) {
+		return n
+	}
+	b := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+	return dst
+}
@@ -0,0 +1,122 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"testing"
+)
+
+// loadFixture reads one of the orientation fixtures. Each fixture shows the
+// same 32x16 image once it is upright: red in the top left, green in the
+// top right, blue in the bottom left and white in the bottom right. The
+// stored pixels are transformed so that only the EXIF tag makes it upright.
+func loadFixture(t *testing.T, orientation int) []byte {
+	t.Helper()
+	data, err := os.ReadFile(fmt.Sprintf("testdata/orientation_%d.jpg", orientation))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// checkUpright makes sure the decoded image has the upright dimensions and
+// each corner contains the expected color.
+func checkUpright(t *testing.T, orientation int, img image.Image) {
+	t.Helper()
+	b := img.Bounds()
+	if b.Dx() != 32 || b.Dy() != 16 {
+		t.Fatalf("Orientation %d has the wrong size. Have: %dx%d, Want: 32x16", orientation, b.Dx(), b.Dy())
+	}
+	corners := []struct {
+		name string
+		x, y int
+		want color.NRGBA
+	}{
+		{"top left", 4, 4, color.NRGBA{255, 0, 0, 255}},
+		{"top right", 27, 4, color.NRGBA{0, 255, 0, 255}},
+		{"bottom left", 4, 11, color.NRGBA{0, 0, 255, 255}},
+		{"bottom right", 27, 11, color.NRGBA{255, 255, 255, 255}},
+	}
+	for _, c := range corners {
+		have := color.NRGBAModel.Convert(img.At(b.Min.X+c.x, b.Min.Y+c.y)).(color.NRGBA)
+		if !closeTo(have, c.want) {
+			t.Errorf("Orientation %d %s is wrong. Have: %v, Want: %v", orientation, c.name, have, c.want)
+		}
+	}
+}
+
+// closeTo allows for a little bit of JPEG compression noise.
+func closeTo(a, b color.NRGBA) bool {
+	diff := func(x, y uint8) bool {
+		if x > y {
+			return x-y > 40
+		}
+		return y-x > 40
+	}
+	return !diff(a.R, b.R) && !diff(a.G, b.G) && !diff(a.B, b.B)
+}
+
+func TestOrientation(t *testing.T) {
+	for o := 1; o <= 8; o++ {
+		if have := Orientation(loadFixture(t, o)); have != o {
+			t.Errorf("Wrong orientation read. Have: %d, Want: %d", have, o)
+		}
+	}
+}
+
+func TestOrientationWithoutExif(t *testing.T) {
+	var buf bytes.Buffer
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	inputs := map[string][]byte{
+		"jpeg without exif": buf.Bytes(),
+		"empty":             {},
+		"not a jpeg":        []byte("<html></html>"),
+		"truncated":         loadFixture(t, 6)[:20],
+	}
+	for name, data := range inputs {
+		if have := Orientation(data); have != OrientationUpright {
+			t.Errorf("Expected %s to be upright. Have: %d", name, have)
+		}
+	}
+}
+
+func TestDecodeAppliesOrientation(t *testing.T) {
+	for o := 1; o <= 8; o++ {
+		img, format, err := Decode(loadFixture(t, o))
+		if err != nil {
+			t.Fatalf("Orientation %d failed to decode: %s", o, err)
+		}
+		if format != "jpeg" {
+			t.Errorf("Wrong format. Have: %s, Want: jpeg", format)
+		}
+		checkUpright(t, o, img)
+	}
+}
+
+func TestNormalizeOrientation(t *testing.T) {
+	for o := 1; o <= 8; o++ {
+		data := loadFixture(t, o)
+		normalized, err := NormalizeOrientation(data)
+		if err != nil {
+			t.Fatalf("Orientation %d failed to normalize: %s", o, err)
+		}
+		if o == OrientationUpright && !bytes.Equal(data, normalized) {
+			t.Errorf("Expected an upright image to be returned untouched")
+		}
+		if have := Orientation(normalized); have != OrientationUpright {
+			t.Errorf("Expected the normalized image to be upright. Have: %d", have)
+		}
+		img, _, err := image.Decode(bytes.NewReader(normalized))
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkUpright(t, o, img)
+	}
+}
@@ -0,0 +1,148 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+)
+
+// PALETTE_SAMPLE_SIZE is how many pixels an image is shrunk to on its
+// longest side before its palette is worked out. Shrinking averages away
+// noise and keeps the work the same for every image.
+const PALETTE_SAMPLE_SIZE = 64
+
+// Palette returns up to n colours that the image is mostly made of, the
+// most common first. Fewer are returned for images with fewer colours.
+//
+// The colours are found by median cut: the pixels are split in two at the
+// median of whichever channel varies the most, and the group that covers
+// the most ground is split again until there are n groups. Each colour is
+// the average of a group. Transparent pixels are left out.
+func Palette(img image.Image, n int) []color.RGBA {
+	src := toNRGBA(Fit(img, PALETTE_SAMPLE_SIZE))
+	var pixels [][3]uint8
+	for i := 0; i < len(src.Pix); i += 4 {
+		if src.Pix[i+3] >= 0x80 {
+			pixels = append(pixels, [3]uint8{src.Pix[i], src.Pix[i+1], src.Pix[i+2]})
+		}
+	}
+	if len(pixels) == 0 || n <= 0 {
+		return nil
+	}
+	boxes := []colorBox{pixels}
+	for len(boxes) < n {
+		best, bestScore := -1, 0
+		for i, box := range boxes {
+			_, spread := box.widest()
+			if score := spread * len(box); spread > 0 && score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		if best < 0 {
+			break
+		}
+		a, b := boxes[best].split()
+		boxes[best] = a
+		boxes = append(boxes, b)
+	}
+	sort.SliceStable(boxes, func(i, j int) bool { return len(boxes[i]) > len(boxes[j]) })
+	palette := make([]color.RGBA, len(boxes))
+	for i, box := range boxes {
+		palette[i] = box.average()
+	}
+	return palette
+}
+
+// colorBox is a group of pixels in median cut.
+type colorBox [][3]uint8
+
+// widest returns the channel the pixels vary the most in, and how much.
+func (b colorBox) widest() (int, int) {
+	channel, spread := 0, 0
+	for c := 0; c < 3; c++ {
+		lo, hi := 255, 0
+		for _, p := range b {
+			v := int(p[c])
+			if v < lo {
+				lo = v
+			}
+			if v > hi {
+				hi = v
+			}
+		}
+		if hi-lo > spread {
+			channel, spread = c, hi-lo
+		}
+	}
+	return channel, spread
+}
+
+// split divides the pixels in two at the median of the widest channel.
+// The cut is moved to the nearest change in value so that pixels of the
+// same colour are never split up and averaged into their neighbours.
+func (b colorBox) split() (colorBox, colorBox) {
+	channel, _ := b.widest()
+	sort.Slice(b, func(i, j int) bool { return b[i][channel] < b[j][channel] })
+	mid := len(b) / 2
+	for lo, hi := mid, mid; lo > 0 || hi < len(b); lo, hi = lo-1, hi+1 {
+		if lo > 0 && b[lo-1][channel] != b[lo][channel] {
+			mid = lo
+			break
+		}
+		if hi < len(b) && hi > 0 && b[hi-1][channel] != b[hi][channel] {
+			mid = hi
+			break
+		}
+	}
+	return b[:mid:mid], b[mid:]
+}
+
+// average is the mean colour of the pixels.
+func (b colorBox) average() color.RGBA {
+	var sum [3]int
+	for _, p := range b {
+		for c := range sum {
+			sum[c] += int(p[c])
+		}
+	}
+	n := len(b)
+	return color.RGBA{
+		R: uint8((sum[0] + n/2) / n),
+		G: uint8((sum[1] + n/2) / n),
+		B: uint8((sum[2] + n/2) / n),
+		A: 0xff,
+	}
+}
+
+// ColorDistance is how different two colours look, as the distance
+// between them in CIELAB space. A distance of around 2 is just noticeable
+// and anything under about 20 looks like a shade of the same colour.
+func ColorDistance(a, b color.RGBA) float64 {
+	l1, a1, b1 := toLab(a)
+	l2, a2, b2 := toLab(b)
+	return math.Sqrt((l1-l2)*(l1-l2) + (a1-a2)*(a1-a2) + (b1-b2)*(b1-b2))
+}
+
+// toLab converts an sRGB colour to CIELAB under the D65 white point.
+func toLab(c color.RGBA) (float64, float64, float64) {
+	linear := func(v uint8) float64 {
+		f := float64(v) / 255
+		if f <= 0.04045 {
+			return f / 12.92
+		}
+		return math.Pow((f+0.055)/1.055, 2.4)
+	}
+	r, g, b := linear(c.R), linear(c.G), linear(c.B)
+	x := (0.4124*r + 0.3576*g + 0.1805*b) / 0.95047
+	y := 0.2126*r + 0.7152*g + 0.0722*b
+	z := (0.0193*r + 0.1192*g + 0.9505*b) / 1.08883
+	f := func(t float64) float64 {
+		if t > 0.008856 {
+			return math.Cbrt(t)
+		}
+		return 7.787*t + 16.0/116
+	}
+	fx, fy, fz := f(x), f(y), f(z)
+	return 116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)
+}
@@ -0,0 +1,51 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestPalette(t *testing.T) {
+	// Mostly red, with a smaller band of blue and a sliver of green.
+	red := color.RGBA{0xd0, 0x20, 0x20, 0xff}
+	blue := color.RGBA{0x20, 0x40, 0xc0, 0xff}
+	green := color.RGBA{0x20, 0xa0, 0x30, 0xff}
+	img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	draw.Draw(img, image.Rect(0, 0, 100, 60), &image.Uniform{red}, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, 60, 100, 90), &image.Uniform{blue}, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, 90, 100, 100), &image.Uniform{green}, image.Point{}, draw.Src)
+
+	palette := Palette(img, 5)
+	want := []color.RGBA{red, blue, green}
+	if len(palette) < len(want) {
+		t.Fatalf("Have: %v, Want: at least %v", palette, want)
+	}
+	for i, c := range want {
+		if d := ColorDistance(palette[i], c); d > 5 {
+			t.Errorf("Colour %d. Have: %v, Want: %v", i, palette[i], c)
+		}
+	}
+
+	transparent := Palette(image.NewNRGBA(image.Rect(0, 0, 10, 10)), 5)
+	if transparent != nil {
+		t.Errorf("Expected no colours for a transparent image, Got: %v", transparent)
+	}
+}
+
+func TestColorDistance(t *testing.T) {
+	black := color.RGBA{0, 0, 0, 0xff}
+	white := color.RGBA{0xff, 0xff, 0xff, 0xff}
+	if d := ColorDistance(black, white); d < 99 || d > 101 {
+		t.Errorf("Have: %v, Want: 100", d)
+	}
+	if d := ColorDistance(white, white); d != 0 {
+		t.Errorf("Have: %v, Want: 0", d)
+	}
+	shade := ColorDistance(color.RGBA{0x30, 0x60, 0xd0, 0xff}, color.RGBA{0x3a, 0x7b, 0xd5, 0xff})
+	other := ColorDistance(color.RGBA{0x30, 0x60, 0xd0, 0xff}, color.RGBA{0xd0, 0x60, 0x30, 0xff})
+	if shade >= other {
+		t.Errorf("Expected shades of blue to be closer than blue and orange, Got: %v and %v", shade, other)
+	}
+}
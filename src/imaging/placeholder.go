@@ -0,0 +1,23 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+)
+
+// PLACEHOLDER_SIZE is the most pixels a placeholder is on its longest
+// side. Stretched over the space the image will fill and blurred by the
+// browser, it is enough to show the image's colours and shapes.
+const PLACEHOLDER_SIZE = 16
+
+// Placeholder returns a PNG of the image shrunk to PLACEHOLDER_SIZE, small
+// enough to inline into a page and show until the image itself loads.
+func Placeholder(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := encoder.Encode(&buf, Fit(img, PLACEHOLDER_SIZE)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
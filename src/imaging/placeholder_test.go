@@ -0,0 +1,34 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func TestPlaceholder(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 600, 300))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	data, err := Placeholder(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Small enough to inline into a page for every image in a gallery.
+	if len(data) > 512 {
+		t.Errorf("Expected a tiny PNG, Got: %d bytes", len(data))
+	}
+	placeholder, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := placeholder.Bounds().Size(); size != image.Pt(PLACEHOLDER_SIZE, PLACEHOLDER_SIZE/2) {
+		t.Errorf("Have: %v, Want: %v", size, image.Pt(PLACEHOLDER_SIZE, PLACEHOLDER_SIZE/2))
+	}
+	if c := color.NRGBAModel.Convert(placeholder.At(3, 3)); c != (color.NRGBA{0xff, 0xff, 0xff, 0xff}) {
+		t.Errorf("Expected the image's colours to be kept, Got: %v", c)
+	}
+}
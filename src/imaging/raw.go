@@ -0,0 +1,383 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+)
+
+// ErrNoPreview is returned when decoding a RAW file that doesn't have a
+// JPEG preview we can find in it.
+var ErrNoPreview = errors.New("imaging: no preview in raw file")
+
+const (
+	// MAX_TIFF_IFDS is the most image file directories read from a TIFF
+	// file, which stops a file whose directories point at each other from
+	// being read forever.
+	MAX_TIFF_IFDS = 32
+
+	// MAX_TIFF_ENTRIES is the most entries read from a single directory.
+	MAX_TIFF_ENTRIES = 1000
+)
+
+// TIFF tags that are needed to find the preview in a RAW file.
+const (
+	tagJpgFromRaw       = 0x002e
+	tagNewSubfileType   = 0x00fe
+	tagImageWidth       = 0x0100
+	tagImageLength      = 0x0101
+	tagCompression      = 0x0103
+	tagStripOffsets     = 0x0111
+	tagOrientation      = 0x0112
+	tagStripByteCounts  = 0x0117
+	tagSubIFDs          = 0x014a
+	tagJPEGOffset       = 0x0201
+	tagJPEGLength       = 0x0202
+	tagDNGVersion       = 0xc612
+	compressionOldJPEG  = 6
+	compressionJPEG     = 7
+	subfileReducedImage = 1
+)
+
+// standardCompressions are the compression schemes of ordinary TIFF
+// images. RAW files with their sensor data in IFD0 use schemes of their
+// own.
+var standardCompressions = map[uint32]bool{
+	1: true, 2: true, 3: true, 4: true, 5: true, 6: true, 7: true, 8: true, 32773: true, 32946: true,
+}
+
+// tiffEntry is a field in a TIFF directory. value holds the field's raw
+// bytes, wherever in the file they are kept.
+type tiffEntry struct {
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// tiffIFD is a TIFF image file directory, with its entries by tag.
+type tiffIFD map[uint16]tiffEntry
+
+// tiffFile is the structure of a TIFF file, which most camera RAW formats
+// are built on. Only the directories are read, never the image data.
+type tiffFile struct {
+	data  []byte
+	order binary.ByteOrder
+	// ifds are every directory in the file, starting with IFD0.
+	ifds []tiffIFD
+	// cr2 is set for Canon's RAW format, which marks itself in the header.
+	cr2 bool
+}
+
+// parseTIFF reads the directories of a TIFF file, following both the
+// chain of directories from IFD0 and the SubIFDs that RAW files keep
+// their full size images in.
+func parseTIFF(data []byte) (*tiffFile, error) {
+	if len(data) < 8 {
+		return nil, errHeader
+	}
+	t := &tiffFile{data: data}
+	switch string(data[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return nil, errHeader
+	}
+	t.cr2 = len(data) >= 10 && string(data[8:10]) == "CR"
+	queue := []uint32{t.order.Uint32(data[4:])}
+	seen := map[uint32]bool{}
+	for len(queue) > 0 && len(t.ifds) < MAX_TIFF_IFDS {
+		offset := queue[0]
+		queue = queue[1:]
+		if offset == 0 || seen[offset] {
+			continue
+		}
+		seen[offset] = true
+		ifd, next, err := t.readIFD(offset)
+		if err != nil {
+			if len(t.ifds) == 0 {
+				return nil, err
+			}
+			continue
+		}
+		t.ifds = append(t.ifds, ifd)
+		queue = append(queue, t.uints(ifd[tagSubIFDs])...)
+		queue = append(queue, next)
+	}
+	return t, nil
+}
+
+// readIFD reads the directory at offset and returns it along with the
+// offset of the next directory in the chain.
+func (t *tiffFile) readIFD(offset uint32) (tiffIFD, uint32, error) {
+	data := t.data
+	if uint64(offset)+2 > uint64(len(data)) {
+		return nil, 0, errHeader
+	}
+	n := int(t.order.Uint16(data[offset:]))
+	end := uint64(offset) + 2 + uint64(n)*12
+	if n > MAX_TIFF_ENTRIES || end+4 > uint64(len(data)) {
+		return nil, 0, errHeader
+	}
+	ifd := tiffIFD{}
+	for i := 0; i < n; i++ {
+		field := data[int(offset)+2+i*12:]
+		typ := t.order.Uint16(field[2:])
+		count := t.order.Uint32(field[4:])
+		size := uint64(tiffTypeSize(typ)) * uint64(count)
+		var value []byte
+		switch {
+		case size == 0:
+			continue
+		case size <= 4:
+			value = field[8 : 8+size]
+		default:
+			at := uint64(t.order.Uint32(field[8:]))
+			if at+size > uint64(len(data)) {
+				continue
+			}
+			value = data[at : at+size]
+		}
+		ifd[t.order.Uint16(field)] = tiffEntry{typ: typ, count: count, value: value}
+	}
+	return ifd, t.order.Uint32(data[end:]), nil
+}
+
+// tiffTypeSize is the size in bytes of a single value of a TIFF field
+// type, or 0 for types we don't read.
+func tiffTypeSize(typ uint16) int {
+	switch typ {
+	case 1, 2, 6, 7: // bytes, ASCII and undefined
+		return 1
+	case 3, 8: // shorts
+		return 2
+	case 4, 9, 13: // longs and IFD offsets
+		return 4
+	case 5, 10: // fractions
+		return 8
+	}
+	return 0
+}
+
+// uints returns the values of a field holding shorts or longs.
+func (t *tiffFile) uints(e tiffEntry) []uint32 {
+	var values []uint32
+	switch tiffTypeSize(e.typ) {
+	case 2:
+		for i := 0; i+2 <= len(e.value); i += 2 {
+			values = append(values, uint32(t.order.Uint16(e.value[i:])))
+		}
+	case 4:
+		for i := 0; i+4 <= len(e.value); i += 4 {
+			values = append(values, t.order.Uint32(e.value[i:]))
+		}
+	}
+	return values
+}
+
+// uint returns the first value of a field, or 0 if the directory doesn't
+// have it.
+func (t *tiffFile) uint(ifd tiffIFD, tag uint16) uint32 {
+	values := t.uints(ifd[tag])
+	if len(values) == 0 {
+		return 0
+	}
+	return values[0]
+}
+
+// raw reports whether the file is a camera RAW file rather than an
+// ordinary TIFF image. RAW files either have a magic number of their own,
+// are marked as RAW, keep a thumbnail in IFD0 with the full image
+// elsewhere, or store IFD0 in a way no TIFF reader would understand.
+func (t *tiffFile) raw() bool {
+	if t.cr2 || string(t.data[2:4]) != string(t.header()[2:4]) {
+		return true
+	}
+	ifd0 := t.ifds[0]
+	if _, ok := ifd0[tagDNGVersion]; ok {
+		return true
+	}
+	if _, ok := ifd0[tagSubIFDs]; ok {
+		return true
+	}
+	if t.uint(ifd0, tagNewSubfileType)&subfileReducedImage != 0 {
+		return true
+	}
+	_, ok := ifd0[tagCompression]
+	return ok && !standardCompressions[t.uint(ifd0, tagCompression)]
+}
+
+// header is the standard header for a TIFF file in the file's byte order.
+func (t *tiffFile) header() []byte {
+	if t.order == binary.LittleEndian {
+		return []byte("II*\x00")
+	}
+	return []byte("MM\x00*")
+}
+
+// preview returns the largest JPEG kept in the file. Cameras keep their
+// previews in different places, so every place one could be is tried, and
+// then the whole file is searched for anything that looks like one.
+func (t *tiffFile) preview() ([]byte, image.Config, error) {
+	var candidates [][]byte
+	for _, ifd := range t.ifds {
+		if offset, length := t.uint(ifd, tagJPEGOffset), t.uint(ifd, tagJPEGLength); length > 0 {
+			candidates = append(candidates, t.slice(offset, length))
+		}
+		if e, ok := ifd[tagJpgFromRaw]; ok {
+			candidates = append(candidates, e.value)
+		}
+		switch t.uint(ifd, tagCompression) {
+		case compressionOldJPEG, compressionJPEG:
+			offsets, counts := t.uints(ifd[tagStripOffsets]), t.uints(ifd[tagStripByteCounts])
+			if len(offsets) == 1 && len(counts) == 1 {
+				candidates = append(candidates, t.slice(offsets[0], counts[0]))
+			}
+		}
+	}
+	data, cfg, err := largestJPEG(candidates)
+	if err == nil {
+		return data, cfg, nil
+	}
+	return largestJPEG(embeddedJPEGs(t.data))
+}
+
+// slice returns length bytes of the file from offset, or nil if they run
+// past its end.
+func (t *tiffFile) slice(offset, length uint32) []byte {
+	end := uint64(offset) + uint64(length)
+	if end > uint64(len(t.data)) {
+		return nil
+	}
+	return t.data[offset:end]
+}
+
+// largestJPEG returns whichever of the candidates is the JPEG with the most
+// pixels. Candidates that aren't JPEGs the standard library can decode,
+// such as the lossless JPEGs that sensor data is kept in, are skipped.
+func largestJPEG(candidates [][]byte) ([]byte, image.Config, error) {
+	var best []byte
+	var bestCfg image.Config
+	for _, c := range candidates {
+		if !bytes.HasPrefix(c, []byte{0xff, 0xd8}) {
+			continue
+		}
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(c))
+		if err != nil {
+			continue
+		}
+		if best == nil || cfg.Width*cfg.Height > bestCfg.Width*bestCfg.Height {
+			best, bestCfg = c, cfg
+		}
+	}
+	if best == nil {
+		return nil, image.Config{}, ErrNoPreview
+	}
+	return best, bestCfg, nil
+}
+
+// embeddedJPEGs returns the data from every place in the file that looks
+// like the start of a JPEG.
+func embeddedJPEGs(data []byte) [][]byte {
+	var candidates [][]byte
+	soi := []byte{0xff, 0xd8, 0xff}
+	for i := 0; ; {
+		j := bytes.Index(data[i:], soi)
+		if j < 0 {
+			return candidates
+		}
+		candidates = append(candidates, data[i+j:])
+		i += j + 1
+	}
+}
+
+// decodeTIFF decodes a TIFF file. RAW files are decoded from their
+// preview, turned the way the camera says it was held, and ordinary TIFF
+// images by the decoder registered for them.
+func decodeTIFF(data []byte) (image.Image, error) {
+	t, err := parseTIFF(data)
+	if err != nil {
+		return nil, err
+	}
+	if !t.raw() {
+		if d, ok := decoder("tiff"); ok {
+			return d.Decode(data)
+		}
+	}
+	preview, _, err := t.preview()
+	if err == ErrNoPreview && !t.raw() {
+		return nil, ErrDecoderMissing
+	}
+	if err != nil {
+		return nil, err
+	}
+	img, err := jpeg.Decode(bytes.NewReader(preview))
+	if err != nil {
+		return nil, err
+	}
+	orientation := int(t.uint(t.ifds[0], tagOrientation))
+	if orientation < 2 {
+		orientation = Orientation(preview)
+	}
+	return Orient(img, orientation), nil
+}
+
+// tiffConfig returns the dimensions of what decodeTIFF would decode.
+func tiffConfig(data []byte) (image.Config, error) {
+	t, err := parseTIFF(data)
+	if err != nil {
+		return image.Config{}, err
+	}
+	if t.raw() {
+		_, cfg, err := t.preview()
+		return cfg, err
+	}
+	ifd0 := t.ifds[0]
+	cfg := image.Config{
+		ColorModel: color.NRGBAModel,
+		Width:      int(t.uint(ifd0, tagImageWidth)),
+		Height:     int(t.uint(ifd0, tagImageLength)),
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return image.Config{}, errHeader
+	}
+	return cfg, nil
+}
+
+// rafPreview returns the JPEG preview from a Fujifilm RAF file, whose
+// header says where it is.
+func rafPreview(data []byte) ([]byte, error) {
+	if len(data) < 92 {
+		return nil, errHeader
+	}
+	offset := binary.BigEndian.Uint32(data[84:])
+	length := binary.BigEndian.Uint32(data[88:])
+	end := uint64(offset) + uint64(length)
+	if end > uint64(len(data)) {
+		return nil, ErrNoPreview
+	}
+	return data[offset:end], nil
+}
+
+// decodeRAF decodes the preview in a Fujifilm RAF file.
+func decodeRAF(data []byte) (image.Image, error) {
+	preview, err := rafPreview(data)
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := Decode(preview)
+	return img, err
+}
+
+// rafConfig returns the dimensions of the preview in a Fujifilm RAF file.
+func rafConfig(data []byte) (image.Config, error) {
+	preview, err := rafPreview(data)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return jpeg.DecodeConfig(bytes.NewReader(preview))
+}
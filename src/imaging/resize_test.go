@@ -0,0 +1,62 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		w, h, max    int
+		wantW, wantH int
+	}{
+		{4000, 3000, 2048, 2048, 1536},
+		{3000, 4000, 2048, 1536, 2048},
+		{2048, 100, 2048, 2048, 100},
+		{10000, 2, 100, 100, 1},
+		{640, 480, 2048, 640, 480},
+	}
+	for _, test := range tests {
+		img := image.NewNRGBA(image.Rect(0, 0, test.w, test.h))
+		b := Fit(img, test.max).Bounds()
+		if b.Dx() != test.wantW || b.Dy() != test.wantH {
+			t.Errorf("%dx%d in %d: Have: %dx%d, Want: %dx%d", test.w, test.h, test.max, b.Dx(), b.Dy(), test.wantW, test.wantH)
+		}
+	}
+}
+
+func TestFitAveragesPixels(t *testing.T) {
+	// Alternating black and white columns average out to grey.
+	img := image.NewGray(image.Rect(0, 0, 40, 20))
+	for x := 0; x < 40; x += 2 {
+		for y := 0; y < 20; y++ {
+			img.SetGray(x, y, color.Gray{255})
+		}
+	}
+	small := Fit(img, 10)
+	for x := 0; x < 10; x++ {
+		r, _, _, _ := small.At(x, 2).RGBA()
+		if grey := r >> 8; grey < 120 || grey > 135 {
+			t.Errorf("Pixel %d should be grey, Have: %d", x, grey)
+		}
+	}
+}
+
+func TestEncodeJPEGFillsTransparency(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	data, err := EncodeJPEG(img, JPEGQuality)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	have := color.NRGBAModel.Convert(decoded.At(4, 4)).(color.NRGBA)
+	if !closeTo(have, color.NRGBA{255, 255, 255, 255}) {
+		t.Errorf("Have: %v, Want: white", have)
+	}
+}
@@ -0,0 +1,40 @@
+package imaging
+
+import (
+	"image"
+	"image/draw"
+)
+
+// RotateClockwise turns an image 90° clockwise.
+func RotateClockwise(img image.Image) image.Image {
+	return Orient(img, 6)
+}
+
+// RotateCounterClockwise turns an image 90° counter-clockwise.
+func RotateCounterClockwise(img image.Image) image.Image {
+	return Orient(img, 8)
+}
+
+// FlipHorizontal mirrors an image from left to right.
+func FlipHorizontal(img image.Image) image.Image {
+	return Orient(img, 2)
+}
+
+// FlipVertical mirrors an image from top to bottom.
+func FlipVertical(img image.Image) image.Image {
+	return Orient(img, 4)
+}
+
+// Crop returns the part of an image inside r, where r is relative to the
+// top left corner of the image. The part of r outside the image is left
+// out. If none of r is inside the image, the top left pixel is returned.
+func Crop(img image.Image, r image.Rectangle) image.Image {
+	b := img.Bounds()
+	r = r.Add(b.Min).Intersect(b)
+	if r.Empty() {
+		r = image.Rectangle{Min: b.Min, Max: b.Min.Add(image.Pt(1, 1))}
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, r.Min, draw.Src)
+	return dst
+}
@@ -0,0 +1,69 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// marked returns a 3x2 image that is black apart from a white top left
+// pixel, so where that pixel ends up shows how the image was transformed.
+func marked() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	for x := 0; x < 3; x++ {
+		for y := 0; y < 2; y++ {
+			img.SetNRGBA(x, y, color.NRGBA{0, 0, 0, 255})
+		}
+	}
+	img.SetNRGBA(0, 0, color.NRGBA{255, 255, 255, 255})
+	return img
+}
+
+func TestTransforms(t *testing.T) {
+	tests := []struct {
+		name         string
+		transform    func(image.Image) image.Image
+		wantW, wantH int
+		markX, markY int
+	}{
+		{"clockwise", RotateClockwise, 2, 3, 1, 0},
+		{"counter-clockwise", RotateCounterClockwise, 2, 3, 0, 2},
+		{"horizontal", FlipHorizontal, 3, 2, 2, 0},
+		{"vertical", FlipVertical, 3, 2, 0, 1},
+	}
+	for _, test := range tests {
+		img := test.transform(marked())
+		b := img.Bounds()
+		if b.Dx() != test.wantW || b.Dy() != test.wantH {
+			t.Errorf("%s: Have: %dx%d, Want: %dx%d", test.name, b.Dx(), b.Dy(), test.wantW, test.wantH)
+			continue
+		}
+		if r, _, _, _ := img.At(test.markX, test.markY).RGBA(); r>>8 != 255 {
+			t.Errorf("%s: Expected the marked pixel at %d,%d", test.name, test.markX, test.markY)
+		}
+	}
+}
+
+func TestCrop(t *testing.T) {
+	tests := []struct {
+		rect         image.Rectangle
+		wantW, wantH int
+		marked       bool
+	}{
+		{image.Rect(0, 0, 2, 1), 2, 1, true},
+		{image.Rect(1, 1, 3, 2), 2, 1, false},
+		{image.Rect(2, 0, 10, 10), 1, 2, false},
+		{image.Rect(5, 5, 10, 10), 1, 1, true},
+	}
+	for _, test := range tests {
+		img := Crop(marked(), test.rect)
+		b := img.Bounds()
+		if b.Dx() != test.wantW || b.Dy() != test.wantH {
+			t.Errorf("%v: Have: %dx%d, Want: %dx%d", test.rect, b.Dx(), b.Dy(), test.wantW, test.wantH)
+		}
+		r, _, _, _ := img.At(b.Min.X, b.Min.Y).RGBA()
+		if marked := r>>8 == 255; marked != test.marked {
+			t.Errorf("%v: Have: %v, Want: %v", test.rect, marked, test.marked)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// Position is where a watermark is drawn on an image.
+type Position string
+
+const (
+	PositionTopLeft     Position = "top-left"
+	PositionTopRight    Position = "top-right"
+	PositionBottomLeft  Position = "bottom-left"
+	PositionBottomRight Position = "bottom-right"
+	PositionCenter      Position = "center"
+	// PositionTile repeats the watermark across the whole image, which
+	// makes it much harder to crop out.
+	PositionTile Position = "tile"
+)
+
+// Positions lists every position in the order they are offered to users.
+var Positions = []Position{
+	PositionBottomRight,
+	PositionBottomLeft,
+	PositionTopRight,
+	PositionTopLeft,
+	PositionCenter,
+	PositionTile,
+}
+
+// A Watermark is a line of text or an image drawn over photos to mark who
+// they belong to.
+type Watermark struct {
+	Text string
+	// Mark is drawn instead of the text if it is set.
+	Mark     image.Image
+	Position Position
+	// Opacity is from 0 for invisible to 1 for solid.
+	Opacity float64
+	// Scale is how wide the watermark is as a fraction of the width of
+	// the image it is drawn on.
+	Scale float64
+}
+
+// Apply returns a copy of the image with the watermark drawn over it.
+func (wm Watermark) Apply(img image.Image) image.Image {
+	b := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+	mark := wm.mark(dst.Rect.Dx())
+	if mark == nil {
+		return dst
+	}
+	alpha := uint8(math.Round(math.Min(math.Max(wm.Opacity, 0), 1) * 255))
+	mask := image.NewUniform(color.Alpha{A: alpha})
+	for _, pt := range wm.points(dst.Rect.Size(), mark.Bounds().Size()) {
+		r := image.Rectangle{Min: pt, Max: pt.Add(mark.Bounds().Size())}
+		draw.DrawMask(dst, r, mark, mark.Bounds().Min, mask, image.Point{}, draw.Over)
+	}
+	return dst
+}
+
+// mark returns the watermark scaled to be drawn on an image w pixels wide,
+// or nil if there is nothing to draw.
+func (wm Watermark) mark(w int) image.Image {
+	width := int(math.Round(wm.Scale * float64(w)))
+	if width < 1 {
+		width = 1
+	}
+	if wm.Mark != nil {
+		mb := wm.Mark.Bounds()
+		if mb.Empty() {
+			return nil
+		}
+		height := (mb.Dy()*width + mb.Dx()/2) / mb.Dx()
+		return scale(wm.Mark, width, height)
+	}
+	if wm.Text == "" {
+		return nil
+	}
+	// The font is made of blocks, so it is scaled by whole pixels to keep
+	// the edges sharp.
+	textWidth := RenderText(wm.Text, 1).Rect.Dx()
+	return RenderText(wm.Text, width/textWidth)
+}
+
+// points returns the top left corners to draw a mark of the provided size
+// at on an image of size img.
+func (wm Watermark) points(img, mark image.Point) []image.Point {
+	margin := img.X
+	if img.Y < margin {
+		margin = img.Y
+	}
+	margin /= 40
+	left, top := margin, margin
+	right, bottom := img.X-mark.X-margin, img.Y-mark.Y-margin
+	switch wm.Position {
+	case PositionTopLeft:
+		return []image.Point{{left, top}}
+	case PositionTopRight:
+		return []image.Point{{right, top}}
+	case PositionBottomLeft:
+		return []image.Point{{left, bottom}}
+	case PositionCenter:
+		return []image.Point{{(img.X - mark.X) / 2, (img.Y - mark.Y) / 2}}
+	case PositionTile:
+		// Rows are offset from each other like bricks, with a gap of half
+		// the mark's width between marks and its height between rows.
+		var points []image.Point
+		stepX, stepY := mark.X+mark.X/2, mark.Y*2
+		if stepX < 1 || stepY < 1 {
+			return nil
+		}
+		for row, y := 0, margin; y < img.Y; row, y = row+1, y+stepY {
+			for x := margin - (row%2)*stepX/2; x < img.X; x += stepX {
+				points = append(points, image.Point{x, y})
+			}
+		}
+		return points
+	default:
+		return []image.Point{{right, bottom}}
+	}
+}
+
+// scale resizes an image to w by h pixels. Shrinking averages pixels like
+// Fit does, and enlarging repeats them.
+func scale(img image.Image, w, h int) image.Image {
+	b := img.Bounds()
+	if w <= b.Dx() && h <= b.Dy() {
+		max := w
+		if h > w {
+			max = h
+		}
+		return Fit(img, max)
+	}
+	src := toNRGBA(img)
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		sy := y * src.Rect.Dy() / h
+		for x := 0; x < w; x++ {
+			sx := x * src.Rect.Dx() / w
+			si := src.PixOffset(sx, sy)
+			di := dst.PixOffset(x, y)
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+	return dst
+}
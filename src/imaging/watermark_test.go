@@ -0,0 +1,94 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"testing"
+)
+
+func TestGlyphPatterns(t *testing.T) {
+	for r, pattern := range glyphPatterns {
+		rows := strings.Split(pattern, "|")
+		if len(rows) != GLYPH_HEIGHT {
+			t.Errorf("%q: Have: %d rows, Want: %d", r, len(rows), GLYPH_HEIGHT)
+		}
+		for _, row := range rows {
+			if len(row) != GLYPH_WIDTH || strings.Trim(row, ".#") != "" {
+				t.Errorf("%q: Invalid row %q", r, row)
+			}
+		}
+	}
+}
+
+// solid returns a w by h image filled with c.
+func solid(w, h int, c color.Color) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+	return img
+}
+
+func grey(img image.Image, x, y int) uint32 {
+	r, _, _, _ := img.At(x, y).RGBA()
+	return r >> 8
+}
+
+func TestWatermarkPositions(t *testing.T) {
+	black := color.NRGBA{0, 0, 0, 255}
+	white := color.NRGBA{255, 255, 255, 255}
+	tests := []struct {
+		position Position
+		// marked is a pixel the mark should cover and clean one it
+		// shouldn't.
+		marked, clean image.Point
+	}{
+		{PositionTopLeft, image.Pt(10, 10), image.Pt(390, 190)},
+		{PositionTopRight, image.Pt(390, 10), image.Pt(10, 190)},
+		{PositionBottomLeft, image.Pt(10, 190), image.Pt(390, 10)},
+		{PositionBottomRight, image.Pt(390, 190), image.Pt(10, 10)},
+		{PositionCenter, image.Pt(200, 100), image.Pt(10, 10)},
+		{PositionTile, image.Pt(10, 10), image.Pt(390, 35)},
+	}
+	for _, test := range tests {
+		photo := solid(400, 200, black)
+		wm := Watermark{Mark: solid(4, 2, white), Position: test.position, Opacity: 1, Scale: 0.1}
+		img := wm.Apply(photo)
+		if have := grey(img, test.marked.X, test.marked.Y); have != 255 {
+			t.Errorf("%s: Expected %v to be marked, Have: %d", test.position, test.marked, have)
+		}
+		if have := grey(img, test.clean.X, test.clean.Y); have != 0 {
+			t.Errorf("%s: Expected %v to be clean, Have: %d", test.position, test.clean, have)
+		}
+		if grey(photo, test.marked.X, test.marked.Y) != 0 {
+			t.Errorf("%s: Expected the photo to be left as it was", test.position)
+		}
+	}
+}
+
+func TestWatermarkOpacity(t *testing.T) {
+	wm := Watermark{Mark: solid(1, 1, color.White), Position: PositionCenter, Opacity: 0.5, Scale: 0.5}
+	img := wm.Apply(solid(100, 100, color.Black))
+	if have := grey(img, 50, 50); have < 120 || have > 135 {
+		t.Errorf("Expected a half transparent mark, Have: %d", have)
+	}
+}
+
+func TestWatermarkText(t *testing.T) {
+	wm := Watermark{Text: "© Proof", Position: PositionCenter, Opacity: 1, Scale: 0.5}
+	mark := wm.mark(1000)
+	if w := mark.Bounds().Dx(); w > 500 || w < 400 {
+		t.Errorf("Wrong text width. Have: %d, Want: about 500", w)
+	}
+	img := wm.Apply(solid(1000, 500, color.Black))
+	drawn := false
+	for x := 0; x < 1000 && !drawn; x++ {
+		drawn = grey(img, x, 250) == 255
+	}
+	if !drawn {
+		t.Errorf("Expected the text to be drawn across the middle of the image")
+	}
+	if (Watermark{Opacity: 1, Scale: 0.5}).mark(1000) != nil {
+		t.Errorf("Expected nothing to be drawn without text or a mark")
+	}
+}
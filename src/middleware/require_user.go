@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"lenslocked/context"
+	"lenslocked/models/commentsModel"
 	"lenslocked/models/galleriesModel"
 	"lenslocked/models/usersModel"
 )
@@ -11,6 +12,9 @@ import (
 type User struct {
 	UserService    usersModel.UserService
 	GalleryService galleriesModel.GalleryService
+	// CommentService counts the comments waiting for the user's approval,
+	// which are shown in the navbar so new comments are noticed.
+	CommentService commentsModel.CommentService
 }
 
 type RequireUser struct {
@@ -37,6 +41,11 @@ func (mw *User) InvokeFn(next http.HandlerFunc) http.HandlerFunc {
 		}
 
 		ctx := context.WithUser(r.Context(), usr)
+		if mw.CommentService != nil {
+			ctx = context.WithPendingComments(ctx, func() (int, error) {
+				return mw.CommentService.CountPending(usr.ID)
+			})
+		}
 		r = r.WithContext(ctx)
 		next(w, r)
 	})
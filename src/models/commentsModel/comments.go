@@ -0,0 +1,302 @@
+// Package commentsModel stores the comments visitors leave on galleries
+// and their images. Comments from anyone but the owner of the gallery
+// wait for the owner to approve them before everyone can see them.
+package commentsModel
+
+import (
+	"fmt"
+	"time"
+
+	"lenslocked/hash"
+	"lenslocked/models/errorsModel"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	// MAX_COMMENT_LENGTH is the longest a comment can be, in characters.
+	MAX_COMMENT_LENGTH = 2000
+
+	// MAX_NAME_LENGTH is the longest name a visitor can comment under, in
+	// characters.
+	MAX_NAME_LENGTH = 100
+
+	// MAX_DEPTH is how deeply replies can be nested. Comments at this
+	// depth can't be replied to.
+	MAX_DEPTH = 4
+
+	// RATE_LIMIT is how many comments anyone but the owner of a gallery
+	// can post within RATE_WINDOW.
+	RATE_LIMIT  = 5
+	RATE_WINDOW = 10 * time.Minute
+)
+
+// Status is whether a comment can be seen by everyone yet.
+type Status string
+
+const (
+	// StatusPending comments are only shown to the owner of the gallery
+	// and the person who wrote them.
+	StatusPending Status = "pending"
+
+	// StatusApproved comments are shown to everyone who can see the
+	// gallery.
+	StatusApproved Status = "approved"
+)
+
+// A Comment is left on a gallery, or on one of its images when ImageID is
+// set. Replies have the ID of the comment they reply to as their ParentID
+// and are one deeper than it.
+//
+// Commenter is who wrote the comment, which is what rate limits and blocks
+// apply to. It is made by CommentService.Commenter from the user's ID, or
+// the visitor's IP address for people who aren't logged in. Name is what
+// the comment is shown as being from.
+type Comment struct {
+	gorm.Model
+	GalleryID uint   `gorm:"not null;index"`
+	ImageID   uint   `gorm:"not null;default:0;index"`
+	ParentID  uint   `gorm:"not null;default:0"`
+	Depth     int    `gorm:"not null;default:0"`
+	UserID    uint   `gorm:"not null;default:0"`
+	Name      string `gorm:"not null"`
+	Body      string `gorm:"type:text;not null"`
+	Commenter string `gorm:"not null;index"`
+	Status    Status `gorm:"not null;default:'pending';index"`
+}
+
+// Approved reports whether everyone can see the comment.
+func (c *Comment) Approved() bool {
+	return c.Status == StatusApproved
+}
+
+// CanReply reports whether the comment can be replied to.
+func (c *Comment) CanReply() bool {
+	return c.Approved() && c.Depth < MAX_DEPTH
+}
+
+// A Block stops a commenter from commenting on any of the galleries of the
+// user with UserID. Name is what the commenter was commenting as, so the
+// owner can tell who they blocked.
+type Block struct {
+	gorm.Model
+	UserID    uint   `gorm:"not null;unique_index:idx_blocks_user_commenter"`
+	Commenter string `gorm:"not null;unique_index:idx_blocks_user_commenter"`
+	Name      string `gorm:"not null"`
+}
+
+// CommentDB is used to interact with the comments database.
+//
+// For all single queries:
+// If the comment is found, error will be nil
+// If the comment is not found, the error will be set to ErrCommentNotFound
+type CommentDB interface {
+	ByID(id uint) (*Comment, error)
+	// ByPage returns every comment on the gallery, or on one of its images
+	// if imageID isn't zero, oldest first.
+	ByPage(galleryID, imageID uint) ([]Comment, error)
+	// Pending returns the comments waiting for approval on the galleries
+	// of the user with ownerID, newest first.
+	Pending(ownerID uint) ([]Comment, error)
+	CountPending(ownerID uint) (int, error)
+	// CountSince counts the comments the commenter has posted anywhere
+	// since the given time.
+	CountSince(commenter string, since time.Time) (int, error)
+	Create(comment *Comment) error
+	Update(comment *Comment) error
+	Delete(ids []uint) error
+	// DeletePending removes the comments from the commenter that are
+	// waiting for approval on the galleries of the user with ownerID.
+	DeletePending(ownerID uint, commenter string) error
+	// DeleteByGallery removes every comment on the gallery and its images.
+	DeleteByGallery(galleryID uint) error
+
+	Blocked(ownerID uint, commenter string) (bool, error)
+	// Blocks returns the commenters the user with ownerID has blocked,
+	// the most recent first.
+	Blocks(ownerID uint) ([]Block, error)
+	CreateBlock(block *Block) error
+	DeleteBlock(ownerID, id uint) error
+}
+
+// CommentService is a set of methods to manipulate and work with the
+// Comment and Block models.
+type CommentService interface {
+	CommentDB
+
+	// Commenter returns who a comment is from, for the logged in user with
+	// userID, or the visitor at ip if userID is zero.
+	Commenter(userID uint, ip string) string
+
+	// Thread returns the comments on a page that the viewer can see, with
+	// each followed by its replies. Owners see every comment, and other
+	// viewers see approved comments and the ones they wrote themselves.
+	Thread(galleryID, imageID uint, owner bool, commenter string) ([]Comment, error)
+
+	// Post checks that the comment can be posted on a gallery belonging to
+	// the user with ownerID and saves it. Comments from the owner are
+	// approved straight away.
+	Post(comment *Comment, ownerID uint) error
+
+	// Approve lets everyone see the comment.
+	Approve(comment *Comment) error
+
+	// Remove deletes the comment along with every reply to it.
+	Remove(comment *Comment) error
+
+	// Block stops whoever wrote the comment from commenting on any of the
+	// galleries of the user with ownerID, and removes their comments
+	// that are still waiting for approval there.
+	Block(ownerID uint, comment *Comment) error
+}
+
+// NewCommentService initializes a CommentService instance. Visitors' IP
+// addresses are hashed with hmacKey before they are stored.
+func NewCommentService(db *gorm.DB, hmacKey string) CommentService {
+	return &commentService{
+		CommentDB: newCommentValidator(&commentGorm{db}),
+		hmac:      hash.NewHMAC(hmacKey),
+		now:       time.Now,
+	}
+}
+
+// commentService implements the CommentService interface.
+type commentService struct {
+	CommentDB
+	hmac hash.HMAC
+	// now returns the current time and is replaced in tests.
+	now func() time.Time
+}
+
+func (cs *commentService) Commenter(userID uint, ip string) string {
+	if userID != 0 {
+		return fmt.Sprintf("user:%d", userID)
+	}
+	return "ip:" + cs.hmac.Hash(ip)
+}
+
+// Thread leaves out the replies to comments the viewer can't see.
+func (cs *commentService) Thread(galleryID, imageID uint, owner bool, commenter string) ([]Comment, error) {
+	comments, err := cs.ByPage(galleryID, imageID)
+	if err != nil {
+		return nil, err
+	}
+	visible := func(c *Comment) bool {
+		return owner || c.Approved() || (commenter != "" && c.Commenter == commenter)
+	}
+	return thread(comments, visible), nil
+}
+
+// Post doesn't rate limit the owner, or let them block themselves.
+func (cs *commentService) Post(comment *Comment, ownerID uint) error {
+	owner := comment.UserID != 0 && comment.UserID == ownerID
+	if !owner {
+		blocked, err := cs.Blocked(ownerID, comment.Commenter)
+		if err != nil {
+			return err
+		}
+		if blocked {
+			return errorsModel.ErrCommenterBlocked
+		}
+		count, err := cs.CountSince(comment.Commenter, cs.now().Add(-RATE_WINDOW))
+		if err != nil {
+			return err
+		}
+		if count >= RATE_LIMIT {
+			return errorsModel.ErrCommentRateLimited
+		}
+	}
+	comment.Depth = 0
+	if comment.ParentID != 0 {
+		parent, err := cs.ByID(comment.ParentID)
+		if err == errorsModel.ErrCommentNotFound {
+			return errorsModel.ErrCommentReplyInvalid
+		}
+		if err != nil {
+			return err
+		}
+		if parent.GalleryID != comment.GalleryID || parent.ImageID != comment.ImageID || !parent.CanReply() {
+			return errorsModel.ErrCommentReplyInvalid
+		}
+		comment.Depth = parent.Depth + 1
+	}
+	comment.Status = StatusPending
+	if owner {
+		comment.Status = StatusApproved
+	}
+	return cs.Create(comment)
+}
+
+func (cs *commentService) Approve(comment *Comment) error {
+	if comment.Approved() {
+		return nil
+	}
+	comment.Status = StatusApproved
+	if err := cs.Update(comment); err != nil {
+		comment.Status = StatusPending
+		return err
+	}
+	return nil
+}
+
+func (cs *commentService) Remove(comment *Comment) error {
+	comments, err := cs.ByPage(comment.GalleryID, comment.ImageID)
+	if err != nil {
+		return err
+	}
+	return cs.Delete(replies(comments, comment.ID))
+}
+
+func (cs *commentService) Block(ownerID uint, comment *Comment) error {
+	if comment.Commenter == cs.Commenter(ownerID, "") {
+		return errorsModel.ErrCommenterBlockSelf
+	}
+	blocked, err := cs.Blocked(ownerID, comment.Commenter)
+	if err != nil {
+		return err
+	}
+	if !blocked {
+		block := &Block{UserID: ownerID, Commenter: comment.Commenter, Name: comment.Name}
+		if err := cs.CreateBlock(block); err != nil {
+			return err
+		}
+	}
+	return cs.DeletePending(ownerID, comment.Commenter)
+}
+
+// thread orders comments so that each is followed by its replies, keeping
+// them oldest first. Comments that aren't visible are left out along with
+// all of their replies.
+func thread(comments []Comment, visible func(*Comment) bool) []Comment {
+	children := map[uint][]int{}
+	for i, c := range comments {
+		children[c.ParentID] = append(children[c.ParentID], i)
+	}
+	var ordered []Comment
+	var walk func(parentID uint)
+	walk = func(parentID uint) {
+		for _, i := range children[parentID] {
+			if !visible(&comments[i]) {
+				continue
+			}
+			ordered = append(ordered, comments[i])
+			walk(comments[i].ID)
+		}
+	}
+	walk(0)
+	return ordered
+}
+
+// replies returns the ID of the comment with id and of every reply to it,
+// however deeply nested.
+func replies(comments []Comment, id uint) []uint {
+	children := map[uint][]uint{}
+	for _, c := range comments {
+		children[c.ParentID] = append(children[c.ParentID], c.ID)
+	}
+	ids := []uint{id}
+	for i := 0; i < len(ids); i++ {
+		ids = append(ids, children[ids[i]]...)
+	}
+	return ids
+}
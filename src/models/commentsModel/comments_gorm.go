@@ -0,0 +1,132 @@
+package commentsModel
+
+import (
+	"time"
+
+	"lenslocked/models"
+	"lenslocked/models/errorsModel"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ownedGalleries is the condition for a comment being on one of the
+// galleries of the user passed in as its argument.
+const ownedGalleries = "gallery_id IN (SELECT id FROM galleries WHERE user_id = ? AND deleted_at IS NULL)"
+
+type commentGorm struct {
+	db *gorm.DB
+}
+
+var _ CommentDB = &commentGorm{}
+
+// ByID will look up a comment by the provided ID.
+// If the comment is not found, the error will be set to ErrCommentNotFound.
+func (cg *commentGorm) ByID(id uint) (*Comment, error) {
+	var comment Comment
+	db := cg.db.Where("id = ?", id)
+	err := models.First(db, &comment)
+	if err == gorm.ErrRecordNotFound {
+		err = errorsModel.ErrCommentNotFound
+	}
+	return &comment, err
+}
+
+// ByPage returns the comments on the gallery, or on one of its images,
+// in the order they were posted.
+func (cg *commentGorm) ByPage(galleryID, imageID uint) ([]Comment, error) {
+	var comments []Comment
+	err := cg.db.Where("gallery_id = ? AND image_id = ?", galleryID, imageID).
+		Order("created_at asc, id asc").Find(&comments).Error
+	if err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+// Pending returns the comments waiting for the owner to approve them,
+// the most recent first.
+func (cg *commentGorm) Pending(ownerID uint) ([]Comment, error) {
+	var comments []Comment
+	err := cg.db.Where("status = ?", StatusPending).Where(ownedGalleries, ownerID).
+		Order("created_at desc, id desc").Find(&comments).Error
+	if err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+// CountPending counts the comments waiting for the owner to approve them.
+func (cg *commentGorm) CountPending(ownerID uint) (int, error) {
+	var count int
+	err := cg.db.Model(&Comment{}).Where("status = ?", StatusPending).Where(ownedGalleries, ownerID).
+		Count(&count).Error
+	return count, err
+}
+
+// CountSince counts the comments the commenter has posted since the given
+// time, including ones that have been deleted, so that deleting a comment
+// doesn't let its author post another straight away.
+func (cg *commentGorm) CountSince(commenter string, since time.Time) (int, error) {
+	var count int
+	err := cg.db.Unscoped().Model(&Comment{}).Where("commenter = ? AND created_at > ?", commenter, since).
+		Count(&count).Error
+	return count, err
+}
+
+// Creates a new comment and backfills data like ID, CreatedAt, and UpdatedAt fields.
+func (cg *commentGorm) Create(comment *Comment) error {
+	return cg.db.Create(comment).Error
+}
+
+// Update will save the comment's changes.
+func (cg *commentGorm) Update(comment *Comment) error {
+	return cg.db.Save(comment).Error
+}
+
+// Delete will delete the comments with the provided IDs.
+func (cg *commentGorm) Delete(ids []uint) error {
+	return cg.db.Where("id IN (?)", ids).Delete(&Comment{}).Error
+}
+
+// DeletePending will delete the commenter's comments that the owner
+// hasn't approved yet.
+func (cg *commentGorm) DeletePending(ownerID uint, commenter string) error {
+	return cg.db.Where("commenter = ? AND status = ?", commenter, StatusPending).Where(ownedGalleries, ownerID).
+		Delete(&Comment{}).Error
+}
+
+// DeleteByGallery will permanently delete the comments on the gallery and
+// its images.
+func (cg *commentGorm) DeleteByGallery(galleryID uint) error {
+	return cg.db.Unscoped().Where("gallery_id = ?", galleryID).Delete(&Comment{}).Error
+}
+
+// Blocked reports whether the owner has blocked the commenter.
+func (cg *commentGorm) Blocked(ownerID uint, commenter string) (bool, error) {
+	var count int
+	err := cg.db.Model(&Block{}).Where("user_id = ? AND commenter = ?", ownerID, commenter).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// Blocks returns the commenters the owner has blocked, the most recent
+// first.
+func (cg *commentGorm) Blocks(ownerID uint) ([]Block, error) {
+	var blocks []Block
+	err := cg.db.Where("user_id = ?", ownerID).Order("created_at desc, id desc").Find(&blocks).Error
+	if err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+// Creates a new block and backfills data like ID, CreatedAt, and UpdatedAt fields.
+func (cg *commentGorm) CreateBlock(block *Block) error {
+	return cg.db.Create(block).Error
+}
+
+// DeleteBlock will permanently delete one of the owner's blocks, so the
+// commenter can be blocked again later without breaking the unique index.
+func (cg *commentGorm) DeleteBlock(ownerID, id uint) error {
+	return cg.db.Unscoped().Where("user_id = ? AND id = ?", ownerID, id).Delete(&Block{}).Error
+}
@@ -0,0 +1,396 @@
+package commentsModel
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"lenslocked/models/errorsModel"
+)
+
+// fakeCommentDB keeps comments and blocks in memory so the service can be
+// tested without a database. owners maps gallery IDs to the ID of the
+// user who owns the gallery.
+type fakeCommentDB struct {
+	comments []Comment
+	blocks   []Block
+	owners   map[uint]uint
+	nextID   uint
+}
+
+func (fdb *fakeCommentDB) ByID(id uint) (*Comment, error) {
+	for _, comment := range fdb.comments {
+		if comment.ID == id {
+			return &comment, nil
+		}
+	}
+	return nil, errorsModel.ErrCommentNotFound
+}
+
+func (fdb *fakeCommentDB) ByPage(galleryID, imageID uint) ([]Comment, error) {
+	var comments []Comment
+	for _, comment := range fdb.comments {
+		if comment.GalleryID == galleryID && comment.ImageID == imageID {
+			comments = append(comments, comment)
+		}
+	}
+	return comments, nil
+}
+
+func (fdb *fakeCommentDB) Pending(ownerID uint) ([]Comment, error) {
+	var comments []Comment
+	for i := len(fdb.comments) - 1; i >= 0; i-- {
+		comment := fdb.comments[i]
+		if !comment.Approved() && fdb.owners[comment.GalleryID] == ownerID {
+			comments = append(comments, comment)
+		}
+	}
+	return comments, nil
+}
+
+func (fdb *fakeCommentDB) CountPending(ownerID uint) (int, error) {
+	comments, err := fdb.Pending(ownerID)
+	return len(comments), err
+}
+
+func (fdb *fakeCommentDB) CountSince(commenter string, since time.Time) (int, error) {
+	count := 0
+	for _, comment := range fdb.comments {
+		if comment.Commenter == commenter && comment.CreatedAt.After(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (fdb *fakeCommentDB) Create(comment *Comment) error {
+	fdb.nextID++
+	comment.ID = fdb.nextID
+	comment.CreatedAt = time.Now()
+	fdb.comments = append(fdb.comments, *comment)
+	return nil
+}
+
+func (fdb *fakeCommentDB) Update(comment *Comment) error {
+	for i := range fdb.comments {
+		if fdb.comments[i].ID == comment.ID {
+			fdb.comments[i] = *comment
+		}
+	}
+	return nil
+}
+
+func (fdb *fakeCommentDB) Delete(ids []uint) error {
+	return fdb.deleteWhere(func(c Comment) bool {
+		for _, id := range ids {
+			if c.ID == id {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (fdb *fakeCommentDB) DeletePending(ownerID uint, commenter string) error {
+	return fdb.deleteWhere(func(c Comment) bool {
+		return c.Commenter == commenter && !c.Approved() && fdb.owners[c.GalleryID] == ownerID
+	})
+}
+
+func (fdb *fakeCommentDB) DeleteByGallery(galleryID uint) error {
+	return fdb.deleteWhere(func(c Comment) bool {
+		return c.GalleryID == galleryID
+	})
+}
+
+func (fdb *fakeCommentDB) deleteWhere(match func(Comment) bool) error {
+	kept := fdb.comments[:0]
+	for _, comment := range fdb.comments {
+		if !match(comment) {
+			kept = append(kept, comment)
+		}
+	}
+	fdb.comments = kept
+	return nil
+}
+
+func (fdb *fakeCommentDB) Blocked(ownerID uint, commenter string) (bool, error) {
+	for _, block := range fdb.blocks {
+		if block.UserID == ownerID && block.Commenter == commenter {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (fdb *fakeCommentDB) Blocks(ownerID uint) ([]Block, error) {
+	var blocks []Block
+	for _, block := range fdb.blocks {
+		if block.UserID == ownerID {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks, nil
+}
+
+func (fdb *fakeCommentDB) CreateBlock(block *Block) error {
+	fdb.nextID++
+	block.ID = fdb.nextID
+	fdb.blocks = append(fdb.blocks, *block)
+	return nil
+}
+
+func (fdb *fakeCommentDB) DeleteBlock(ownerID, id uint) error {
+	kept := fdb.blocks[:0]
+	for _, block := range fdb.blocks {
+		if block.UserID != ownerID || block.ID != id {
+			kept = append(kept, block)
+		}
+	}
+	fdb.blocks = kept
+	return nil
+}
+
+// testCommentService returns a commentService backed by fakeCommentDB, in
+// which gallery 1 belongs to user 1.
+func testCommentService(t *testing.T) (*commentService, *fakeCommentDB) {
+	t.Helper()
+	fdb := &fakeCommentDB{owners: map[uint]uint{1: 1}}
+	cs := NewCommentService(nil, "test-key").(*commentService)
+	cs.CommentDB = newCommentValidator(fdb)
+	return cs, fdb
+}
+
+// post posts a comment on gallery 1 from the visitor at ip.
+func post(t *testing.T, cs *commentService, ip string, parentID uint) *Comment {
+	t.Helper()
+	comment := &Comment{
+		GalleryID: 1,
+		ParentID:  parentID,
+		Name:      "Sam",
+		Body:      "Lovely",
+		Commenter: cs.Commenter(0, ip),
+	}
+	if err := cs.Post(comment, 1); err != nil {
+		t.Fatal(err)
+	}
+	return comment
+}
+
+func TestCreateCommentValidation(t *testing.T) {
+	cs, _ := testCommentService(t)
+	tests := map[string]struct {
+		comment Comment
+		want    error
+	}{
+		"no gallery":   {Comment{Commenter: "ip:a", Name: "Sam", Body: "Hi"}, errorsModel.ErrGalleryIdRequired},
+		"no commenter": {Comment{GalleryID: 1, Name: "Sam", Body: "Hi"}, errorsModel.ErrCommenterRequired},
+		"no name":      {Comment{GalleryID: 1, Commenter: "ip:a", Body: "Hi"}, errorsModel.ErrNameRequired},
+		"long name":    {Comment{GalleryID: 1, Commenter: "ip:a", Name: strings.Repeat("a", MAX_NAME_LENGTH+1), Body: "Hi"}, errorsModel.ErrCommentNameTooLong},
+		"no body":      {Comment{GalleryID: 1, Commenter: "ip:a", Name: "Sam", Body: " \r\n "}, errorsModel.ErrCommentRequired},
+		"long body":    {Comment{GalleryID: 1, Commenter: "ip:a", Name: "Sam", Body: strings.Repeat("é", MAX_COMMENT_LENGTH+1)}, errorsModel.ErrCommentTooLong},
+		"valid":        {Comment{GalleryID: 1, Commenter: "ip:a", Name: " Sam ", Body: " Hi\r\nthere \n", Status: "shown"}, nil},
+	}
+	for name, test := range tests {
+		comment := test.comment
+		if err := cs.Create(&comment); err != test.want {
+			t.Errorf("%s: Have: %v, Want: %v", name, err, test.want)
+		}
+		if test.want != nil {
+			continue
+		}
+		if comment.Name != "Sam" || comment.Body != "Hi\nthere" || comment.Status != StatusPending {
+			t.Errorf("%s: Have: %q %q %q, Want: %q %q %q", name, comment.Name, comment.Body, comment.Status, "Sam", "Hi\nthere", StatusPending)
+		}
+	}
+}
+
+func TestCommenter(t *testing.T) {
+	cs, _ := testCommentService(t)
+	if have := cs.Commenter(7, "10.0.0.1"); have != "user:7" {
+		t.Errorf("Have: %s, Want: user:7", have)
+	}
+	visitor := cs.Commenter(0, "10.0.0.1")
+	if !strings.HasPrefix(visitor, "ip:") || strings.Contains(visitor, "10.0.0.1") {
+		t.Errorf("Expected a hashed IP address, Got: %s", visitor)
+	}
+	if visitor == cs.Commenter(0, "10.0.0.2") {
+		t.Errorf("Expected different IP addresses to be different commenters")
+	}
+}
+
+func TestPost(t *testing.T) {
+	cs, _ := testCommentService(t)
+	first := post(t, cs, "10.0.0.1", 0)
+	if first.Approved() {
+		t.Errorf("Expected a visitor's comment to wait for approval")
+	}
+	// Replies have to wait until the comment is approved.
+	reply := &Comment{GalleryID: 1, ParentID: first.ID, Name: "Alex", Body: "Agreed", Commenter: cs.Commenter(0, "10.0.0.2")}
+	if err := cs.Post(reply, 1); err != errorsModel.ErrCommentReplyInvalid {
+		t.Errorf("Have: %v, Want: %v", err, errorsModel.ErrCommentReplyInvalid)
+	}
+	if err := cs.Approve(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.Post(reply, 1); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Depth != 1 {
+		t.Errorf("Have: %d, Want: 1", reply.Depth)
+	}
+	// Replies stay on the page they were made on.
+	elsewhere := &Comment{GalleryID: 1, ImageID: 3, ParentID: first.ID, Name: "Alex", Body: "Hi", Commenter: "ip:b"}
+	if err := cs.Post(elsewhere, 1); err != errorsModel.ErrCommentReplyInvalid {
+		t.Errorf("Have: %v, Want: %v", err, errorsModel.ErrCommentReplyInvalid)
+	}
+
+	owner := &Comment{GalleryID: 1, UserID: 1, Name: "Owner", Body: "Thanks", Commenter: cs.Commenter(1, "")}
+	if err := cs.Post(owner, 1); err != nil {
+		t.Fatal(err)
+	}
+	if !owner.Approved() {
+		t.Errorf("Expected the owner's comment to be approved")
+	}
+}
+
+func TestPostDepth(t *testing.T) {
+	cs, _ := testCommentService(t)
+	var parentID uint
+	for depth := 0; depth <= MAX_DEPTH; depth++ {
+		comment := post(t, cs, "10.0.0.1", parentID)
+		if err := cs.Approve(comment); err != nil {
+			t.Fatal(err)
+		}
+		parentID = comment.ID
+		// Keep clear of the rate limit.
+		cs.now = func() time.Time { return time.Now().Add(time.Duration(depth+1) * RATE_WINDOW) }
+	}
+	tooDeep := &Comment{GalleryID: 1, ParentID: parentID, Name: "Sam", Body: "Hi", Commenter: "ip:b"}
+	if err := cs.Post(tooDeep, 1); err != errorsModel.ErrCommentReplyInvalid {
+		t.Errorf("Have: %v, Want: %v", err, errorsModel.ErrCommentReplyInvalid)
+	}
+}
+
+func TestPostRateLimit(t *testing.T) {
+	cs, _ := testCommentService(t)
+	for i := 0; i < RATE_LIMIT; i++ {
+		post(t, cs, "10.0.0.1", 0)
+	}
+	comment := &Comment{GalleryID: 1, Name: "Sam", Body: "Hi", Commenter: cs.Commenter(0, "10.0.0.1")}
+	if err := cs.Post(comment, 1); err != errorsModel.ErrCommentRateLimited {
+		t.Errorf("Have: %v, Want: %v", err, errorsModel.ErrCommentRateLimited)
+	}
+	// Someone else can still comment.
+	post(t, cs, "10.0.0.2", 0)
+
+	cs.now = func() time.Time { return time.Now().Add(RATE_WINDOW) }
+	if err := cs.Post(comment, 1); err != nil {
+		t.Errorf("Expected to be able to comment again once the window has passed, Got: %v", err)
+	}
+}
+
+func TestThread(t *testing.T) {
+	cs, _ := testCommentService(t)
+	a := post(t, cs, "10.0.0.1", 0)
+	b := post(t, cs, "10.0.0.2", 0)
+	for _, c := range []*Comment{a, b} {
+		if err := cs.Approve(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	aReply := post(t, cs, "10.0.0.3", a.ID)
+	if err := cs.Approve(aReply); err != nil {
+		t.Fatal(err)
+	}
+	pending := post(t, cs, "10.0.0.4", a.ID)
+
+	ids := func(comments []Comment) []uint {
+		var ids []uint
+		for _, c := range comments {
+			ids = append(ids, c.ID)
+		}
+		return ids
+	}
+	tests := map[string]struct {
+		owner     bool
+		commenter string
+		want      []uint
+	}{
+		"visitor": {false, cs.Commenter(0, "10.0.0.9"), []uint{a.ID, aReply.ID, b.ID}},
+		"author":  {false, pending.Commenter, []uint{a.ID, aReply.ID, pending.ID, b.ID}},
+		"owner":   {true, cs.Commenter(1, ""), []uint{a.ID, aReply.ID, pending.ID, b.ID}},
+	}
+	for name, test := range tests {
+		comments, err := cs.Thread(1, 0, test.owner, test.commenter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have := ids(comments); fmt.Sprint(have) != fmt.Sprint(test.want) {
+			t.Errorf("%s: Have: %v, Want: %v", name, have, test.want)
+		}
+	}
+}
+
+func TestRemove(t *testing.T) {
+	cs, fdb := testCommentService(t)
+	a := post(t, cs, "10.0.0.1", 0)
+	if err := cs.Approve(a); err != nil {
+		t.Fatal(err)
+	}
+	reply := post(t, cs, "10.0.0.2", a.ID)
+	if err := cs.Approve(reply); err != nil {
+		t.Fatal(err)
+	}
+	post(t, cs, "10.0.0.3", reply.ID)
+	kept := post(t, cs, "10.0.0.4", 0)
+	if err := cs.Remove(a); err != nil {
+		t.Fatal(err)
+	}
+	if len(fdb.comments) != 1 || fdb.comments[0].ID != kept.ID {
+		t.Errorf("Expected the comment to be removed with its replies, Got: %v", fdb.comments)
+	}
+}
+
+func TestBlock(t *testing.T) {
+	cs, fdb := testCommentService(t)
+	fdb.owners[2] = 2
+	approved := post(t, cs, "10.0.0.1", 0)
+	if err := cs.Approve(approved); err != nil {
+		t.Fatal(err)
+	}
+	pending := post(t, cs, "10.0.0.1", 0)
+	// A comment on someone else's gallery.
+	other := &Comment{GalleryID: 2, Name: "Sam", Body: "Hi", Commenter: pending.Commenter}
+	if err := cs.Post(other, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.Block(1, pending); err != nil {
+		t.Fatal(err)
+	}
+	// Blocking twice is fine.
+	if err := cs.Block(1, approved); err != nil {
+		t.Fatal(err)
+	}
+	if len(fdb.blocks) != 1 {
+		t.Errorf("Have: %d blocks, Want: 1", len(fdb.blocks))
+	}
+	if _, err := cs.ByID(pending.ID); err != errorsModel.ErrCommentNotFound {
+		t.Errorf("Expected the pending comment to be removed, Got: %v", err)
+	}
+	for _, c := range []*Comment{approved, other} {
+		if _, err := cs.ByID(c.ID); err != nil {
+			t.Errorf("Expected comment %d to be kept, Got: %v", c.ID, err)
+		}
+	}
+
+	comment := &Comment{GalleryID: 1, Name: "Sam", Body: "Hi", Commenter: pending.Commenter}
+	if err := cs.Post(comment, 1); err != errorsModel.ErrCommenterBlocked {
+		t.Errorf("Have: %v, Want: %v", err, errorsModel.ErrCommenterBlocked)
+	}
+	own := &Comment{GalleryID: 1, UserID: 1, Commenter: cs.Commenter(1, "")}
+	if err := cs.Block(1, own); err != errorsModel.ErrCommenterBlockSelf {
+		t.Errorf("Have: %v, Want: %v", err, errorsModel.ErrCommenterBlockSelf)
+	}
+}
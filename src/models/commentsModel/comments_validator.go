@@ -0,0 +1,168 @@
+package commentsModel
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"lenslocked/models/errorsModel"
+)
+
+// commentValidator is a chained type that performs validation and
+// normalization of data before being passed to the final CommentDB implementation
+type commentValidator struct {
+	CommentDB
+}
+
+// commentValidationFunction is a function signature given to all comment
+// validation functions so that it is easier to iterate over all the
+// comment validation functions and call them in a loop.
+type commentValidationFunction func(*Comment) error
+
+// Creates a new instance of the commentValidator
+func newCommentValidator(cdb CommentDB) *commentValidator {
+	return &commentValidator{
+		CommentDB: cdb,
+	}
+}
+
+// Create ensures that the comment is on a gallery, says who it is from and
+// has something written in it.
+func (cv *commentValidator) Create(comment *Comment) error {
+	if err := cv.runCommentValidationFunctions(
+		comment,
+		cv.galleryIdRequirer,
+		cv.commenterRequirer,
+		cv.nameNormalizer,
+		cv.bodyNormalizer,
+		cv.statusNormalizer,
+	); err != nil {
+		return err
+	}
+	return cv.CommentDB.Create(comment)
+}
+
+// Update makes sure the comment still has something written in it.
+func (cv *commentValidator) Update(comment *Comment) error {
+	if err := cv.runCommentValidationFunctions(
+		comment,
+		cv.idGreaterThan(0),
+		cv.nameNormalizer,
+		cv.bodyNormalizer,
+		cv.statusNormalizer,
+	); err != nil {
+		return err
+	}
+	return cv.CommentDB.Update(comment)
+}
+
+// Delete requires at least one comment to delete.
+func (cv *commentValidator) Delete(ids []uint) error {
+	if len(ids) == 0 {
+		return errorsModel.ErrIdInvalid
+	}
+	for _, id := range ids {
+		if id <= 0 {
+			return errorsModel.ErrIdInvalid
+		}
+	}
+	return cv.CommentDB.Delete(ids)
+}
+
+// DeletePending requires a commenter, so that it can't delete every
+// pending comment at once.
+func (cv *commentValidator) DeletePending(ownerID uint, commenter string) error {
+	if ownerID <= 0 {
+		return errorsModel.ErrUserIdRequired
+	}
+	if commenter == "" {
+		return errorsModel.ErrCommenterRequired
+	}
+	return cv.CommentDB.DeletePending(ownerID, commenter)
+}
+
+// CreateBlock ensures that the block belongs to a user and says who is
+// blocked.
+func (cv *commentValidator) CreateBlock(block *Block) error {
+	if block.UserID <= 0 {
+		return errorsModel.ErrUserIdRequired
+	}
+	if block.Commenter == "" {
+		return errorsModel.ErrCommenterRequired
+	}
+	return cv.CommentDB.CreateBlock(block)
+}
+
+// runCommentValidationFunctions calls each of the validation functions on
+// the comment and returns the first error encountered.
+func (cv *commentValidator) runCommentValidationFunctions(comment *Comment, fns ...commentValidationFunction) error {
+	for _, fn := range fns {
+		if err := fn(comment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// idGreaterThan checks to see if the comment has an ID greater than n.
+func (cv *commentValidator) idGreaterThan(n uint) commentValidationFunction {
+	return func(comment *Comment) error {
+		if comment.ID <= n {
+			return errorsModel.ErrIdInvalid
+		}
+		return nil
+	}
+}
+
+// galleryIdRequirer requires the comment to be on a gallery.
+func (cv *commentValidator) galleryIdRequirer(comment *Comment) error {
+	if comment.GalleryID <= 0 {
+		return errorsModel.ErrGalleryIdRequired
+	}
+	return nil
+}
+
+// commenterRequirer requires the comment to say who wrote it, so that
+// rate limits and blocks can be applied.
+func (cv *commentValidator) commenterRequirer(comment *Comment) error {
+	if comment.Commenter == "" {
+		return errorsModel.ErrCommenterRequired
+	}
+	return nil
+}
+
+// nameNormalizer tidies up the spacing in the name the comment is shown
+// as being from and makes sure there is one.
+func (cv *commentValidator) nameNormalizer(comment *Comment) error {
+	comment.Name = strings.Join(strings.Fields(comment.Name), " ")
+	if comment.Name == "" {
+		return errorsModel.ErrNameRequired
+	}
+	if utf8.RuneCountInString(comment.Name) > MAX_NAME_LENGTH {
+		return errorsModel.ErrCommentNameTooLong
+	}
+	return nil
+}
+
+// bodyNormalizer trims the space around the comment and uses the same
+// line endings whichever browser it was written in. Line breaks within
+// the comment are kept.
+func (cv *commentValidator) bodyNormalizer(comment *Comment) error {
+	comment.Body = strings.ReplaceAll(comment.Body, "\r\n", "\n")
+	comment.Body = strings.TrimSpace(comment.Body)
+	if comment.Body == "" {
+		return errorsModel.ErrCommentRequired
+	}
+	if utf8.RuneCountInString(comment.Body) > MAX_COMMENT_LENGTH {
+		return errorsModel.ErrCommentTooLong
+	}
+	return nil
+}
+
+// statusNormalizer keeps comments waiting for approval unless they have
+// been approved.
+func (cv *commentValidator) statusNormalizer(comment *Comment) error {
+	if comment.Status != StatusApproved {
+		comment.Status = StatusPending
+	}
+	return nil
+}
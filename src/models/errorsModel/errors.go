@@ -46,6 +46,186 @@ const (
 	// ErrTitleRequired is returned when a gallery does not contain a title
 	ErrTitleRequired modelError = "gallery title is required"
 
+	// ErrImageNotFound is returned when an image cannot be found in the database.
+	ErrImageNotFound modelError = "image does not exist"
+
+	// ErrImageTypeUnsupported is returned when an uploaded file is not one
+	// of the image formats we accept, regardless of its file extension.
+	ErrImageTypeUnsupported modelError = "file is not a supported image type"
+
+	// ErrImageInvalid is returned when an uploaded file claims to be an
+	// image but its header cannot be decoded.
+	ErrImageInvalid modelError = "image file is corrupt or could not be read"
+
+	// ErrImageTooLarge is returned when an uploaded image decodes to more
+	// pixels than we are willing to process.
+	ErrImageTooLarge modelError = "image dimensions are too large"
+
+	// ErrImageDuplicate is returned when an uploaded image is identical to
+	// one already in the gallery and the owner chose to skip duplicates.
+	ErrImageDuplicate modelError = "image is already in this gallery"
+
+	// ErrFileTooLarge is returned when an uploaded file is larger than the
+	// per-file size limit.
+	ErrFileTooLarge modelError = "file is larger than the upload size limit"
+
+	// ErrStorageQuotaExceeded is returned when storing a file would take a
+	// user over the amount of storage their account is allowed.
+	ErrStorageQuotaExceeded modelError = "not enough storage space left in your account"
+
+	// ErrCaptionTooLong is returned when an image caption is longer than
+	// we allow.
+	ErrCaptionTooLong modelError = "caption must be at most 1000 characters long"
+
+	// ErrAltTextTooLong is returned when an image's alt text is longer than
+	// we allow.
+	ErrAltTextTooLong modelError = "alt text must be at most 250 characters long"
+
+	// ErrNoImagesSelected is returned when an action on a set of images
+	// is submitted without any images chosen.
+	ErrNoImagesSelected modelError = "no images were selected"
+
+	// ErrTransferSameGallery is returned when images are moved or copied
+	// to the gallery they are already in.
+	ErrTransferSameGallery modelError = "images are already in this gallery"
+
+	// ErrTransferModeInvalid is returned when images are transferred
+	// without choosing whether to move or copy them.
+	ErrTransferModeInvalid modelError = "choose whether to move or copy the images"
+
+	// ErrArchiveInvalid is returned when an imported file isn't a ZIP
+	// archive we can read.
+	ErrArchiveInvalid modelError = "file is not a valid zip archive"
+
+	// ErrArchiveTooManyEntries is returned when an imported archive has
+	// more files in it than we will import at once.
+	ErrArchiveTooManyEntries modelError = "zip archive has more than 1000 files in it"
+
+	// ErrArchiveTooLarge is returned when the files in an imported archive
+	// add up to more than we will import at once.
+	ErrArchiveTooLarge modelError = "zip archive contents are larger than 4 GB"
+
+	// ErrArchiveEntryUnsafe is returned for a file in an archive whose path
+	// tries to point outside of the archive.
+	ErrArchiveEntryUnsafe modelError = "file path in the zip archive is not allowed"
+
+	// ErrArchiveEntryTooDeep is returned for a file in an archive that is
+	// inside too many folders.
+	ErrArchiveEntryTooDeep modelError = "file is inside too many folders in the zip archive"
+
+	// ErrTransformInvalid is returned when an edit to an image isn't one
+	// we support or crops to outside the image.
+	ErrTransformInvalid modelError = "image edit is not valid"
+
+	// ErrTooManyTransforms is returned when an image already has as many
+	// edits as it can have.
+	ErrTooManyTransforms modelError = "image has too many edits, reset it to start again"
+
+	// ErrWatermarkTextTooLong is returned when a gallery's watermark text
+	// is longer than we allow.
+	ErrWatermarkTextTooLong modelError = "watermark text must be at most 100 characters long"
+
+	// ErrWatermarkOpacityInvalid is returned when a gallery's watermark
+	// would be drawn fully transparent.
+	ErrWatermarkOpacityInvalid modelError = "watermark opacity must be from 1 to 100"
+
+	// ErrWatermarkImageInvalid is returned when an uploaded watermark
+	// isn't a PNG image we can read.
+	ErrWatermarkImageInvalid modelError = "watermark must be a png image"
+
+	// ErrWatermarkImageTooLarge is returned when an uploaded watermark is
+	// larger than we allow.
+	ErrWatermarkImageTooLarge modelError = "watermark image must be at most 1 MB and 2000 pixels on each side"
+
+	// ErrColourInvalid is returned when searching for a colour that isn't
+	// written as a hex colour.
+	ErrColourInvalid modelError = "colour must be written as a hex colour such as #3a7bd5"
+
+	// ErrUploadNotFound is returned when a resumable upload cannot be
+	// found, usually because it finished or expired.
+	ErrUploadNotFound modelError = "upload does not exist"
+
+	// ErrUploadLengthInvalid is returned when a resumable upload is
+	// started without a valid size for the file.
+	ErrUploadLengthInvalid modelError = "upload length is missing or invalid"
+
+	// ErrUploadTooLarge is returned when a file is larger than we allow to
+	// be uploaded, or more data is sent than the upload said it would have.
+	ErrUploadTooLarge modelError = "file is too large to upload"
+
+	// ErrUploadMetadataInvalid is returned when the metadata sent with a
+	// resumable upload can't be decoded.
+	ErrUploadMetadataInvalid modelError = "upload metadata is not correctly formatted"
+
+	// ErrUploadConflict is returned when data is sent for a resumable
+	// upload from an offset that another request has already moved past.
+	ErrUploadConflict modelError = "upload offset has changed, check the offset and try again"
+
+	// ErrFilenameRequired is returned when a resumable upload is started
+	// without the name of the file being uploaded.
+	ErrFilenameRequired modelError = "filename is required"
+
+	// ErrClientNameRequired is returned when a visitor starts picking
+	// images without saying who they are.
+	ErrClientNameRequired modelError = "name is required to pick images"
+
+	// ErrClientNameTooLong is returned when a visitor's name is longer
+	// than we store.
+	ErrClientNameTooLong modelError = "name must be at most 100 characters"
+
+	// ErrClientNotFound is returned when the client someone is picking
+	// images as cannot be found.
+	ErrClientNotFound modelError = "client does not exist"
+
+	// ErrSelectionLimitReached is returned when a client tries to pick more
+	// images than the owner of the gallery allows.
+	ErrSelectionLimitReached modelError = "you have already picked as many images as you can, unpick one to choose another"
+
+	// ErrSelectionLimitInvalid is returned when the most images a client
+	// can pick isn't a whole number of zero or more.
+	ErrSelectionLimitInvalid modelError = "most images a client can pick must be a whole number of zero or more"
+
+	// ErrSelectionSubmitted is returned when a client tries to change a
+	// selection they have already sent.
+	ErrSelectionSubmitted modelError = "your selection has already been sent and can't be changed"
+
+	// ErrSelectionEmpty is returned when a client sends a selection without
+	// any images in it.
+	ErrSelectionEmpty modelError = "pick at least one image before sending your selection"
+
+	// ErrCommentRequired is returned when a comment is posted without
+	// anything written in it.
+	ErrCommentRequired modelError = "comment can't be empty"
+
+	// ErrCommentTooLong is returned when a comment is longer than we
+	// allow.
+	ErrCommentTooLong modelError = "comment must be at most 2000 characters long"
+
+	// ErrCommentNameTooLong is returned when the name a visitor comments
+	// under is longer than we store.
+	ErrCommentNameTooLong modelError = "name must be at most 100 characters"
+
+	// ErrCommentNotFound is returned when a comment cannot be found in the
+	// database.
+	ErrCommentNotFound modelError = "comment does not exist"
+
+	// ErrCommentReplyInvalid is returned when replying to a comment that
+	// isn't shown on the same page, is still waiting for approval or is
+	// already nested as deeply as replies go.
+	ErrCommentReplyInvalid modelError = "that comment can't be replied to"
+
+	// ErrCommentRateLimited is returned when someone posts more comments
+	// in a short time than we allow.
+	ErrCommentRateLimited modelError = "you are commenting too quickly, please wait a few minutes and try again"
+
+	// ErrCommenterBlocked is returned when someone the owner of a gallery
+	// has blocked tries to comment on it.
+	ErrCommenterBlocked modelError = "you can't comment on this gallery"
+
+	// ErrCommenterBlockSelf is returned when the owner of a gallery tries
+	// to block themselves from commenting on it.
+	ErrCommenterBlockSelf modelError = "you can't block yourself"
+
 	// ErrIdInvalid is returned when an invalid ID is provided to a method like Delete.
 	ErrIdInvalid privateError = "id provided was invalid"
 
@@ -59,9 +239,28 @@ const (
 	// ErrRememberTokenHashRequired is returned when a remember token hash is not generated.
 	ErrRememberHashRequired privateError = "remember token hash is required"
 
+	// ErrSignatureInvalid is returned when a signed image URL is missing
+	// its signature or the signature doesn't match.
+	ErrSignatureInvalid privateError = "url signature is invalid"
+
+	// ErrURLExpired is returned when a signed image URL is past its expiry.
+	ErrURLExpired privateError = "url has expired"
+
+	// ErrGalleryIdRequired is returned when an upload is missing the ID of
+	// the gallery it will be added to.
+	ErrGalleryIdRequired privateError = "gallery id is required for each upload"
+
+	// ErrUploadIncomplete is returned when the data for an upload doesn't
+	// line up with the offset recorded for it.
+	ErrUploadIncomplete privateError = "upload data is missing or incomplete"
+
 	// ErrUserIdRequired is returned when a gallery is missing a UserID for
 	// the user who owns the gallery
 	ErrUserIdRequired privateError = "user id is required for each gallery"
+
+	// ErrCommenterRequired is returned when a comment or block doesn't say
+	// who the commenter is.
+	ErrCommenterRequired privateError = "commenter is required for each comment"
 )
 
 // modelError is used for errors that are meant to be public to the user.
@@ -77,6 +276,48 @@ func (m modelError) Public() string {
 	return strings.Join(split, " ") + "."
 }
 
+// ImageError ties an image error to the name of the file that caused it
+// so each failed file in an upload or batch operation can be reported
+// back to the user.
+type ImageError struct {
+	Filename string
+	Err      error
+}
+
+func (e ImageError) Error() string {
+	return e.Err.Error() + ": " + e.Filename
+}
+
+func (e ImageError) Public() string {
+	if pErr, ok := e.Err.(modelError); ok {
+		return e.Filename + ": " + pErr.Public()
+	}
+	return e.Filename + ": Something went wrong."
+}
+
+func (e ImageError) Unwrap() error {
+	return e.Err
+}
+
+// ImageErrors collects the errors from a batch of files.
+type ImageErrors []ImageError
+
+func (e ImageErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e ImageErrors) Public() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Public()
+	}
+	return strings.Join(msgs, " ")
+}
+
 // privateError is used for errors that are more internal to the program
 // and wouldn't make a lot of sense to a user.
 type privateError string
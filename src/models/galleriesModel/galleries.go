@@ -1,19 +1,88 @@
 package galleriesModel
 
 import (
+	"time"
+
 	"lenslocked/models/imagesModel"
 
 	"github.com/jinzhu/gorm"
 )
 
+// Visibility decides who other than the owner can see a gallery.
+type Visibility string
+
+const (
+	// VisibilityPrivate galleries can only be seen by their owner.
+	VisibilityPrivate Visibility = "private"
+
+	// VisibilityPublic galleries can be seen by anyone with a link to
+	// them, whether or not they are logged in.
+	VisibilityPublic Visibility = "public"
+)
+
 // A Gallery contains image resources that are viewed by our visitors.
+//
+// CoverImageID is the image the owner picked to represent the gallery, or
+// zero to use the first image. Cover is the image actually used, which is
+// also the first image if the picked one has since been deleted.
+//
+// Watermark is drawn over the images shown to everyone but the owner.
+//
+// Proofing lets the people the gallery is shared with pick their favourite
+// images, and SelectionLimit is the most each of them can pick, or zero
+// for no limit.
+//
+// ImageCount and LastUpdated summarize the gallery's images and are only
+// filled in by ByUserID. LastUpdated is the later of when the gallery and
+// its most recently changed image were updated.
 type Gallery struct {
 	gorm.Model
-	UserID uint                `gorm:"not null;index"`
-	Title  string              `gorm:"not null"`
-	Images []imagesModel.Image `gorm:"-"`
+	UserID         uint                  `gorm:"not null;index"`
+	Title          string                `gorm:"not null"`
+	CoverImageID   uint                  `gorm:"not null;default:0"`
+	Visibility     Visibility            `gorm:"not null;default:'private'"`
+	Watermark      imagesModel.Watermark `gorm:"embedded;embedded_prefix:watermark_"`
+	Proofing       bool                  `gorm:"not null;default:false"`
+	SelectionLimit int                   `gorm:"not null;default:0"`
+	Images         []imagesModel.Image   `gorm:"-"`
+	Cover          *imagesModel.Image    `gorm:"-"`
+	ImageCount     int                   `gorm:"-"`
+	LastUpdated    time.Time             `gorm:"-"`
+}
+
+// VisibleTo reports whether the user with the provided ID can see the
+// gallery. Visitors who aren't logged in have a user ID of zero.
+func (g *Gallery) VisibleTo(userID uint) bool {
+	return (userID != 0 && g.UserID == userID) || g.Visibility == VisibilityPublic
+}
+
+// ProofingFor reports whether the user with the provided ID can pick
+// images from the gallery. Owners can't, since the picks are for them.
+func (g *Gallery) ProofingFor(userID uint) bool {
+	return g.Proofing && g.VisibleTo(userID) && g.UserID != userID
+}
+
+// PickCover sets Cover from the gallery's Images.
+func (g *Gallery) PickCover() {
+	g.Cover = nil
+	for i := range g.Images {
+		if g.Images[i].ID == g.CoverImageID {
+			g.Cover = &g.Images[i]
+			return
+		}
+	}
+	if len(g.Images) > 0 {
+		g.Cover = &g.Images[0]
+	}
+}
+
+// IsCover reports whether the image is the gallery's cover.
+func (g *Gallery) IsCover(image imagesModel.Image) bool {
+	return g.Cover != nil && g.Cover.ID == image.ID
 }
 
+// ImagesSplitN deals the gallery's images into n columns in turn, so that
+// reading the columns across, row by row, follows the saved image order.
 func (g *Gallery) ImagesSplitN(n int) [][]imagesModel.Image {
 	ret := make([][]imagesModel.Image, n)
 	for i := 0; i < n; i++ {
@@ -33,6 +102,8 @@ func (g *Gallery) ImagesSplitN(n int) [][]imagesModel.Image {
 // If the gallery is found, error will be nil
 // If the galler is not found, the error will be set to ErrGalleryNotFound
 type GalleryDB interface {
+	// ByUserID returns the user's galleries with their Cover, ImageCount
+	// and LastUpdated filled in.
 	ByUserID(userID uint) ([]Gallery, error)
 	ByID(id uint) (*Gallery, error)
 	Create(gallery *Gallery) error
@@ -1,8 +1,11 @@
 package galleriesModel
 
 import (
+	"time"
+
 	"lenslocked/models"
 	"lenslocked/models/errorsModel"
+	"lenslocked/models/imagesModel"
 
 	"github.com/jinzhu/gorm"
 )
@@ -52,11 +55,61 @@ func (gg *galleryGorm) Delete(id uint) error {
 }
 
 // Return all galleries that belong to the user for the provided UserID.
+//
+// The image summaries for every gallery are loaded with two queries in
+// total, however many galleries the user has.
 func (gg *galleryGorm) ByUserID(userID uint) ([]Gallery, error) {
 	var galleries []Gallery
 	err := gg.db.Where("user_id = ?", userID).Order("title asc").Find(&galleries).Error
 	if err != nil {
 		return nil, err
 	}
+	if len(galleries) == 0 {
+		return galleries, nil
+	}
+	ids := make([]uint, len(galleries))
+	for i := range galleries {
+		ids[i] = galleries[i].ID
+		galleries[i].LastUpdated = galleries[i].UpdatedAt
+	}
+
+	var stats []struct {
+		GalleryID   uint
+		ImageCount  int
+		LastUpdated time.Time
+	}
+	err = gg.db.Raw(`SELECT gallery_id, COUNT(*) AS image_count, MAX(updated_at) AS last_updated
+		FROM images WHERE deleted_at IS NULL AND gallery_id IN (?)
+		GROUP BY gallery_id`, ids).Scan(&stats).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// The picked cover sorts first if it still exists, then the gallery's
+	// first image.
+	var covers []imagesModel.Image
+	err = gg.db.Raw(`SELECT DISTINCT ON (images.gallery_id) images.*
+		FROM images JOIN galleries ON galleries.id = images.gallery_id
+		WHERE images.deleted_at IS NULL AND images.gallery_id IN (?)
+		ORDER BY images.gallery_id, images.id = galleries.cover_image_id DESC,
+			images.position ASC, images.id ASC`, ids).Scan(&covers).Error
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[uint]*Gallery, len(galleries))
+	for i := range galleries {
+		byID[galleries[i].ID] = &galleries[i]
+	}
+	for _, stat := range stats {
+		gallery := byID[stat.GalleryID]
+		gallery.ImageCount = stat.ImageCount
+		if stat.LastUpdated.After(gallery.LastUpdated) {
+			gallery.LastUpdated = stat.LastUpdated
+		}
+	}
+	for i := range covers {
+		byID[covers[i].GalleryID].Cover = &covers[i]
+	}
 	return galleries, nil
 }
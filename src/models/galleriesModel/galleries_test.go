@@ -0,0 +1,156 @@
+package galleriesModel
+
+import (
+	"strings"
+	"testing"
+
+	"lenslocked/models/errorsModel"
+	"lenslocked/models/imagesModel"
+)
+
+func TestPickCover(t *testing.T) {
+	images := func(ids ...uint) []imagesModel.Image {
+		var images []imagesModel.Image
+		for _, id := range ids {
+			image := imagesModel.Image{}
+			image.ID = id
+			images = append(images, image)
+		}
+		return images
+	}
+	tests := []struct {
+		name    string
+		gallery Gallery
+		want    uint
+	}{
+		{"picked", Gallery{CoverImageID: 3, Images: images(2, 3, 4)}, 3},
+		{"default", Gallery{Images: images(2, 3, 4)}, 2},
+		{"picked image deleted", Gallery{CoverImageID: 9, Images: images(2, 3, 4)}, 2},
+		{"no images", Gallery{CoverImageID: 3}, 0},
+	}
+	for _, test := range tests {
+		test.gallery.PickCover()
+		var have uint
+		if test.gallery.Cover != nil {
+			have = test.gallery.Cover.ID
+		}
+		if have != test.want {
+			t.Errorf("%s: Have: %v, Want: %v", test.name, have, test.want)
+		}
+		for _, image := range test.gallery.Images {
+			if test.gallery.IsCover(image) != (image.ID == test.want) {
+				t.Errorf("%s: IsCover(%d) Have: %v, Want: %v", test.name, image.ID, !(image.ID == test.want), image.ID == test.want)
+			}
+		}
+	}
+}
+
+func TestVisibleTo(t *testing.T) {
+	private := Gallery{UserID: 1, Visibility: VisibilityPrivate}
+	public := Gallery{UserID: 1, Visibility: VisibilityPublic}
+	tests := []struct {
+		name    string
+		gallery Gallery
+		userID  uint
+		want    bool
+	}{
+		{"private to owner", private, 1, true},
+		{"private to another user", private, 2, false},
+		{"private to visitor", private, 0, false},
+		{"public to another user", public, 2, true},
+		{"public to visitor", public, 0, true},
+		{"unowned to visitor", Gallery{}, 0, false},
+	}
+	for _, test := range tests {
+		if have := test.gallery.VisibleTo(test.userID); have != test.want {
+			t.Errorf("%s: Have: %v, Want: %v", test.name, have, test.want)
+		}
+	}
+}
+
+func TestProofingFor(t *testing.T) {
+	proofing := Gallery{UserID: 1, Visibility: VisibilityPublic, Proofing: true}
+	tests := []struct {
+		name    string
+		gallery Gallery
+		userID  uint
+		want    bool
+	}{
+		{"visitor", proofing, 0, true},
+		{"another user", proofing, 2, true},
+		{"owner", proofing, 1, false},
+		{"private", Gallery{UserID: 1, Proofing: true}, 0, false},
+		{"turned off", Gallery{UserID: 1, Visibility: VisibilityPublic}, 0, false},
+	}
+	for _, test := range tests {
+		if have := test.gallery.ProofingFor(test.userID); have != test.want {
+			t.Errorf("%s: Have: %v, Want: %v", test.name, have, test.want)
+		}
+	}
+}
+
+func TestSelectionLimitChecker(t *testing.T) {
+	gv := &galleryValidator{}
+	for limit, want := range map[int]error{
+		0:  nil,
+		25: nil,
+		-1: errorsModel.ErrSelectionLimitInvalid,
+	} {
+		if err := gv.selectionLimitChecker(&Gallery{SelectionLimit: limit}); err != want {
+			t.Errorf("%d: Have: %v, Want: %v", limit, err, want)
+		}
+	}
+}
+
+func TestVisibilityNormalizer(t *testing.T) {
+	gv := &galleryValidator{}
+	for visibility, want := range map[Visibility]Visibility{
+		VisibilityPublic:  VisibilityPublic,
+		VisibilityPrivate: VisibilityPrivate,
+		"":                VisibilityPrivate,
+		"everyone":        VisibilityPrivate,
+	} {
+		gallery := &Gallery{Visibility: visibility}
+		gv.visibilityNormalizer(gallery)
+		if gallery.Visibility != want {
+			t.Errorf("%q: Have: %v, Want: %v", visibility, gallery.Visibility, want)
+		}
+	}
+}
+
+func TestWatermarkNormalizer(t *testing.T) {
+	gv := &galleryValidator{}
+	gallery := &Gallery{Watermark: imagesModel.Watermark{
+		Text:     "  © Jane\n Doe ",
+		Position: "middle",
+		Opacity:  150,
+		Scale:    -5,
+	}}
+	if err := gv.watermarkNormalizer(gallery); err != nil {
+		t.Fatal(err)
+	}
+	want := imagesModel.Watermark{
+		Text:     "© Jane Doe",
+		Position: "bottom-right",
+		Opacity:  imagesModel.DEFAULT_WATERMARK_OPACITY,
+		Scale:    imagesModel.DEFAULT_WATERMARK_SCALE,
+	}
+	if gallery.Watermark != want {
+		t.Errorf("Have: %+v, Want: %+v", gallery.Watermark, want)
+	}
+
+	gallery.Watermark.Opacity = 0
+	if err := gv.watermarkNormalizer(gallery); err != errorsModel.ErrWatermarkOpacityInvalid {
+		t.Errorf("Have: %v, Want: %v", err, errorsModel.ErrWatermarkOpacityInvalid)
+	}
+	// Galleries without a watermark don't need to have chosen an opacity.
+	gallery.Watermark = imagesModel.Watermark{}
+	if err := gv.watermarkNormalizer(gallery); err != nil || gallery.Watermark.Opacity != imagesModel.DEFAULT_WATERMARK_OPACITY {
+		t.Errorf("Have: %v %d, Want: <nil> %d", err, gallery.Watermark.Opacity, imagesModel.DEFAULT_WATERMARK_OPACITY)
+	}
+
+	gallery.Watermark.Text = strings.Repeat("a", imagesModel.MAX_WATERMARK_TEXT_LENGTH+1)
+	if err := gv.watermarkNormalizer(gallery); err != errorsModel.ErrWatermarkTextTooLong {
+		t.Errorf("Have: %v, Want: %v", err, errorsModel.ErrWatermarkTextTooLong)
+	}
+}
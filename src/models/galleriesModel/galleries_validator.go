@@ -1,7 +1,12 @@
 package galleriesModel
 
 import (
+	"strings"
+	"unicode/utf8"
+
+	"lenslocked/imaging"
 	"lenslocked/models/errorsModel"
+	"lenslocked/models/imagesModel"
 )
 
 // galleryValidator is a chained type that performs validation and
@@ -30,6 +35,9 @@ func (gv *galleryValidator) Create(gallery *Gallery) error {
 		gallery,
 		gv.userIdRequirer,
 		gv.titleRequirer,
+		gv.visibilityNormalizer,
+		gv.watermarkNormalizer,
+		gv.selectionLimitChecker,
 	); err != nil {
 		return err
 	}
@@ -45,6 +53,9 @@ func (gv *galleryValidator) Update(gallery *Gallery) error {
 		gallery,
 		gv.userIdRequirer,
 		gv.titleRequirer,
+		gv.visibilityNormalizer,
+		gv.watermarkNormalizer,
+		gv.selectionLimitChecker,
 	); err != nil {
 		return err
 	}
@@ -103,3 +114,52 @@ func (gv *galleryValidator) userIdRequirer(gallery *Gallery) error {
 	}
 	return nil
 }
+
+// visibilityNormalizer makes any visibility other than public private, so
+// that a gallery is never shown to more people than was intended.
+func (gv *galleryValidator) visibilityNormalizer(gallery *Gallery) error {
+	if gallery.Visibility != VisibilityPublic {
+		gallery.Visibility = VisibilityPrivate
+	}
+	return nil
+}
+
+// watermarkNormalizer tidies up the watermark text and makes sure the
+// position, opacity and scale are ones that can be drawn. Anything that
+// isn't is changed to the nearest setting that is, since a slightly
+// different watermark is better than none. The exception is an opacity
+// of zero or less, which would hide the watermark the owner asked for,
+// so it is rejected unless there is no watermark to draw.
+func (gv *galleryValidator) watermarkNormalizer(gallery *Gallery) error {
+	wm := &gallery.Watermark
+	wm.Text = strings.Join(strings.Fields(wm.Text), " ")
+	if utf8.RuneCountInString(wm.Text) > imagesModel.MAX_WATERMARK_TEXT_LENGTH {
+		return errorsModel.ErrWatermarkTextTooLong
+	}
+	valid := false
+	for _, position := range imaging.Positions {
+		valid = valid || wm.Position == string(position)
+	}
+	if !valid {
+		wm.Position = string(imaging.PositionBottomRight)
+	}
+	if wm.Opacity <= 0 && wm.Enabled() {
+		return errorsModel.ErrWatermarkOpacityInvalid
+	}
+	if wm.Opacity <= 0 || wm.Opacity > 100 {
+		wm.Opacity = imagesModel.DEFAULT_WATERMARK_OPACITY
+	}
+	if wm.Scale <= 0 || wm.Scale > 100 {
+		wm.Scale = imagesModel.DEFAULT_WATERMARK_SCALE
+	}
+	return nil
+}
+
+// selectionLimitChecker makes sure the most images a client can pick
+// isn't negative.
+func (gv *galleryValidator) selectionLimitChecker(gallery *Gallery) error {
+	if gallery.SelectionLimit < 0 {
+		return errorsModel.ErrSelectionLimitInvalid
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package imagesModel
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"lenslocked/imaging"
+	"lenslocked/models/errorsModel"
+)
+
+// FAILURES_FILENAME is the name of the file listing the images that
+// couldn't be added to an archive.
+const FAILURES_FILENAME = "failed.txt"
+
+// An Archive writes images into a ZIP file as they are added, so that a
+// download can start straight away and never has to be held in memory.
+type Archive struct {
+	zw   *zip.Writer
+	is   ImageService
+	size Size
+	// watermark is drawn over every image if it is set.
+	watermark *Watermark
+	// names counts how many times each name has been used so that images
+	// uploaded with the same name don't overwrite each other when the
+	// archive is extracted.
+	names map[string]int
+}
+
+// NewArchive starts a ZIP archive of images at the provided size written
+// to w, reading image files from the ImageService.
+func NewArchive(w io.Writer, is ImageService, size Size) *Archive {
+	return &Archive{
+		zw:    zip.NewWriter(w),
+		is:    is,
+		size:  size,
+		names: map[string]int{},
+	}
+}
+
+// SetWatermark draws the watermark over the images added from now on.
+// Originals are never sent with a watermark, so they are sent at SizeFull
+// instead.
+func (a *Archive) SetWatermark(wm Watermark) {
+	if !wm.Enabled() {
+		return
+	}
+	a.watermark = &wm
+	if a.size == SizeOriginal {
+		a.size = SizeFull
+	}
+}
+
+// Add writes the image into the archive under the name it was uploaded
+// with. Images are already compressed, so they are stored as they are.
+func (a *Archive) Add(image *Image) error {
+	f, err := a.is.OpenAs(image, a.size, imaging.FormatJPEG, a.watermark)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w, err := a.zw.CreateHeader(&zip.FileHeader{
+		Name:     a.uniqueName(a.size.Filename(image)),
+		Method:   zip.Store,
+		Modified: image.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// Close finishes the archive. Any failures are listed in a text file in
+// the archive, since by the time they happen the download has started
+// and there is no other way to tell the user about them.
+func (a *Archive) Close(failures errorsModel.ImageErrors) error {
+	if len(failures) > 0 {
+		w, err := a.zw.Create(FAILURES_FILENAME)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, "These images could not be added to the download:")
+		for _, failure := range failures {
+			fmt.Fprintln(w, failure.Public())
+		}
+	}
+	return a.zw.Close()
+}
+
+// uniqueName returns name, or name with a number added before the
+// extension if it has already been used.
+func (a *Archive) uniqueName(name string) string {
+	a.names[name]++
+	n := a.names[name]
+	if n == 1 {
+		return name
+	}
+	ext := filepath.Ext(name)
+	unique := fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), n, ext)
+	if a.names[unique] > 0 {
+		return a.uniqueName(name)
+	}
+	a.names[unique]++
+	return unique
+}
@@ -0,0 +1,72 @@
+package imagesModel
+
+import (
+	"fmt"
+
+	"lenslocked/models/errorsModel"
+)
+
+// BatchResult is the outcome of a batch operation for one image. Image
+// only has its ID set if the image couldn't be found.
+type BatchResult struct {
+	Image Image
+	Err   error
+}
+
+// BatchResults are the outcomes of a batch operation in the order the
+// images were selected.
+type BatchResults []BatchResult
+
+// Succeeded returns the images the operation worked for.
+func (br BatchResults) Succeeded() []Image {
+	var images []Image
+	for _, result := range br {
+		if result.Err == nil {
+			images = append(images, result.Image)
+		}
+	}
+	return images
+}
+
+// Failed returns an error naming each image the operation failed for.
+func (br BatchResults) Failed() errorsModel.ImageErrors {
+	var errs errorsModel.ImageErrors
+	for _, result := range br {
+		if result.Err == nil {
+			continue
+		}
+		name := result.Image.Filename
+		if name == "" {
+			name = fmt.Sprintf("Image %d", result.Image.ID)
+		}
+		errs = append(errs, errorsModel.ImageError{Filename: name, Err: result.Err})
+	}
+	return errs
+}
+
+// Batch looks up each of the selected images and runs op on the ones in
+// the gallery. Images are looked up just before op runs on them, so op
+// always sees the image as it is stored. Selecting an image more than
+// once only runs op on it once.
+func (is *imageService) Batch(galleryID uint, imageIDs []uint, op func(image *Image) error) BatchResults {
+	results := make(BatchResults, 0, len(imageIDs))
+	seen := make(map[uint]bool, len(imageIDs))
+	for _, id := range imageIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		image, err := is.ByID(id)
+		if err == nil && image.GalleryID != galleryID {
+			err = errorsModel.ErrImageNotFound
+		}
+		if err != nil {
+			missing := Image{}
+			missing.ID = id
+			results = append(results, BatchResult{Image: missing, Err: err})
+			continue
+		}
+		results = append(results, BatchResult{Image: *image, Err: op(image)})
+	}
+	return results
+}
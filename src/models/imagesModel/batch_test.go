@@ -0,0 +1,89 @@
+package imagesModel
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"lenslocked/models/errorsModel"
+)
+
+func TestBatchReportsEachImage(t *testing.T) {
+	is, db, _ := testTransfer(t)
+	var ran []uint
+	failing := errors.New("disk on fire")
+	results := is.Batch(1, []uint{2, 4, 99, 1, 2}, func(image *Image) error {
+		ran = append(ran, image.ID)
+		if image.ID == 1 {
+			return failing
+		}
+		return nil
+	})
+	if len(ran) != 2 || ran[0] != 2 || ran[1] != 1 {
+		t.Errorf("Wrong images. Have: %v, Want: [2 1]", ran)
+	}
+	want := []error{nil, errorsModel.ErrImageNotFound, errorsModel.ErrImageNotFound, failing}
+	if len(results) != len(want) {
+		t.Fatalf("Wrong number of results. Have: %d, Want: %d", len(results), len(want))
+	}
+	for i := range want {
+		if results[i].Err != want[i] {
+			t.Errorf("Result %d: Have: %v, Want: %v", i, results[i].Err, want[i])
+		}
+	}
+	if succeeded := results.Succeeded(); len(succeeded) != 1 || succeeded[0].ID != 2 {
+		t.Errorf("Wrong images succeeded. Have: %v", succeeded)
+	}
+	failedMessage := db.images[0].Filename + ": Something went wrong."
+	if have := results.Failed().Public(); !strings.Contains(have, "Image 99: Image does not exist.") || !strings.Contains(have, failedMessage) {
+		t.Errorf("Expected every failure to be named, Have: %q", have)
+	}
+}
+
+func TestArchive(t *testing.T) {
+	is, _, _ := testTransfer(t)
+	var buf bytes.Buffer
+	archive := NewArchive(&buf, is, SizeOriginal)
+	results := is.Batch(1, []uint{1, 2, 3, 99}, archive.Add)
+	if err := archive.Close(results.Failed()); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every image in the test gallery was uploaded as photo.png.
+	want := []string{"photo.png", "photo (2).png", "photo (3).png", FAILURES_FILENAME}
+	if len(zr.File) != len(want) {
+		t.Fatalf("Wrong number of files. Have: %d, Want: %d", len(zr.File), len(want))
+	}
+	for i, f := range zr.File {
+		if f.Name != want[i] {
+			t.Errorf("Have: %q, Want: %q", f.Name, want[i])
+		}
+	}
+	f, _ := zr.File[0].Open()
+	data, _ := io.ReadAll(f)
+	if int64(len(data)) != results[0].Image.Size {
+		t.Errorf("Wrong file size. Have: %d, Want: %d", len(data), results[0].Image.Size)
+	}
+	f, _ = zr.File[3].Open()
+	data, _ = io.ReadAll(f)
+	if !strings.Contains(string(data), "Image 99") {
+		t.Errorf("Expected the failures to be listed, Have: %q", data)
+	}
+}
+
+func TestArchiveUniqueName(t *testing.T) {
+	a := &Archive{names: map[string]int{}}
+	names := []string{"a.jpg", "a.jpg", "a (2).jpg", "a.jpg", "b"}
+	want := []string{"a.jpg", "a (2).jpg", "a (2) (2).jpg", "a (3).jpg", "b"}
+	for i, name := range names {
+		if have := a.uniqueName(name); have != want[i] {
+			t.Errorf("%q: Have: %q, Want: %q", name, have, want[i])
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package imagesModel
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"lenslocked/imaging"
+	"lenslocked/storage"
+)
+
+// DERIVATIVE_QUALITY is the JPEG quality derivatives are encoded with, or
+// the equivalent for other formats. They are made for viewing rather than
+// editing, so it is a little lower than the quality used for the
+// originals.
+const DERIVATIVE_QUALITY = 85
+
+// A Size is a version of an image that can be sent instead of the
+// original. Every size other than SizeOriginal is a derivative with the
+// owner's edits applied, no larger than MaxDimension pixels on its longest
+// side if it is set.
+type Size struct {
+	Name         string
+	MaxDimension int
+}
+
+var (
+	// SizeOriginal is the file as it was uploaded.
+	SizeOriginal = Size{Name: "original"}
+
+	// SizeWeb is large enough to fill most screens while being a fraction
+	// of the size of a camera original.
+	SizeWeb = Size{Name: "web", MaxDimension: 2048}
+
+	// SizeThumb is used to show images in a grid, where they are never
+	// more than a few hundred pixels across.
+	SizeThumb = Size{Name: "thumb", MaxDimension: 800}
+
+	// SizeFull is the whole image with the owner's edits applied. It is
+	// what is shown in place of the original once an image is edited.
+	SizeFull = Size{Name: "full"}
+)
+
+// ParseSize returns the size with the provided name, or false if there is
+// no such size.
+func ParseSize(name string) (Size, bool) {
+	for _, size := range []Size{SizeOriginal, SizeWeb, SizeThumb, SizeFull} {
+		if size.Name == name {
+			return size, true
+		}
+	}
+	return Size{}, false
+}
+
+// Filename is the name to download the image at this size as.
+func (s Size) Filename(image *Image) string {
+	if s == SizeOriginal {
+		return image.Filename
+	}
+	return strings.TrimSuffix(image.Filename, filepath.Ext(image.Filename)) + ".jpg"
+}
+
+// OpenSize returns the image's file at the provided size, with derivatives
+// encoded as JPEGs.
+func (is *imageService) OpenSize(image *Image, size Size) (io.ReadSeekCloser, error) {
+	return is.OpenAs(image, size, imaging.FormatJPEG, nil)
+}
+
+// OpenAs returns the image at the provided size encoded in the format, with
+// the watermark drawn over it if wm is set. SizeOriginal is the stored
+// file, whatever the format, unless there is a watermark. Nobody but the
+// owner can download originals of watermarked images, so they are sent at
+// SizeFull instead.
+//
+// Derivatives are made the first time they are asked for and then kept in
+// storage beside the original, one for each format.
+func (is *imageService) OpenAs(image *Image, size Size, format imaging.Format, wm *Watermark) (io.ReadSeekCloser, error) {
+	if wm != nil && !wm.Enabled() {
+		wm = nil
+	}
+	if size == SizeOriginal {
+		if wm == nil {
+			return is.Open(image)
+		}
+		size = SizeFull
+	}
+	key, err := is.derivativeKey(image, size, format)
+	if err != nil {
+		return nil, err
+	}
+	if wm != nil {
+		ext := "." + format.Extension()
+		key = strings.TrimSuffix(key, ext) + "-wm" + wm.Version() + ext
+	}
+	return is.openDerivative(key, func() ([]byte, error) {
+		var mark *imaging.Watermark
+		if wm != nil {
+			if mark, err = is.watermark(image.GalleryID, *wm); err != nil {
+				return nil, err
+			}
+		}
+		return is.makeDerivative(image, size, format, mark)
+	})
+}
+
+// openDerivative returns the derivative kept under key, or makes it with
+// generate and keeps it if there isn't one yet.
+func (is *imageService) openDerivative(key string, generate func() ([]byte, error)) (io.ReadSeekCloser, error) {
+	f, err := is.storage.Get(key)
+	if err != storage.ErrNotFound {
+		return f, err
+	}
+	data, err := generate()
+	if err != nil {
+		return nil, err
+	}
+	// Failing to keep the derivative only means it is made again next time.
+	is.storage.Put(key, bytes.NewReader(data))
+	return nopCloser{bytes.NewReader(data)}, nil
+}
+
+// makeDerivative applies the image's edits to the original, shrinks it to
+// fit the size and encodes it in the format. The watermark is drawn over
+// the result if there is one.
+//
+// Images stored before placeholders and palettes existed get theirs the
+// first time a thumbnail is made for them, since that happens the first
+// time they are shown in a grid.
+func (is *imageService) makeDerivative(image *Image, size Size, format imaging.Format, watermark *imaging.Watermark) ([]byte, error) {
+	img, err := is.decodeEdited(image)
+	if err != nil {
+		return nil, err
+	}
+	if size == SizeThumb && (image.Placeholder == "" || image.Palette == "") {
+		// Failing to save them only means they are missing this time.
+		if setPlaceholder(image, img) == nil {
+			setPalette(image, img)
+			is.db.Update(image)
+		}
+	}
+	img = imaging.Fit(img, size.MaxDimension)
+	if watermark != nil {
+		img = watermark.Apply(img)
+	}
+	return imaging.Encode(img, format, DERIVATIVE_QUALITY)
+}
+
+// deleteDerivatives removes every derivative made for the image.
+func (is *imageService) deleteDerivatives(image *Image) error {
+	prefix, err := is.derivativePrefix(image)
+	if err != nil {
+		return err
+	}
+	derivatives, err := is.storage.List(prefix)
+	if err != nil {
+		return err
+	}
+	for _, derivative := range derivatives {
+		if err := is.storage.Delete(derivative.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// derivativePrefix is the storage prefix the image's derivatives are kept
+// under. They live in their own folder so they are never mistaken for
+// images in the gallery.
+func (is *imageService) derivativePrefix(image *Image) (string, error) {
+	if _, err := is.storedKey(image); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("derivatives/%d/%s/", image.GalleryID, image.StoredName), nil
+}
+
+// derivativeKey is the storage key for a derivative in a format. The
+// image's version is part of the key, so a derivative is never served for
+// content other than what it was made from.
+func (is *imageService) derivativeKey(image *Image, size Size, format imaging.Format) (string, error) {
+	prefix, err := is.derivativePrefix(image)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%s-%s.%s", prefix, size.Name, image.Version(), format.Extension()), nil
+}
+
+// nopCloser adds a Close method that does nothing to a seekable reader.
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error { return nil }
@@ -0,0 +1,133 @@
+package imagesModel
+
+import (
+	"bytes"
+	"image"
+	"io"
+	"strings"
+	"testing"
+
+	"lenslocked/imaging"
+)
+
+func TestOpenSize(t *testing.T) {
+	is, db, _ := testImageService(t)
+	if err := is.Create(1, io.NopCloser(bytes.NewReader(encodePNG(t, 3000, 60))), "wide.png", DuplicateKeepBoth); err != nil {
+		t.Fatal(err)
+	}
+	image := &db.images[0]
+
+	f, err := is.OpenSize(image, SizeOriginal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	original, _ := io.ReadAll(f)
+	f.Close()
+	if int64(len(original)) != image.Size {
+		t.Errorf("Expected the original file. Have: %d bytes, Want: %d", len(original), image.Size)
+	}
+
+	web := openDerivative(t, is, image)
+	cfg, format, err := imageConfig(web)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "jpeg" || cfg.Width != SizeWeb.MaxDimension || cfg.Height != 41 {
+		t.Errorf("Wrong derivative. Have: %s %dx%d, Want: jpeg %dx41", format, cfg.Width, cfg.Height, SizeWeb.MaxDimension)
+	}
+	key, _ := is.derivativeKey(image, SizeWeb, imaging.FormatJPEG)
+	if _, err := is.storage.Stat(key); err != nil {
+		t.Errorf("Expected the derivative to be kept, Got: %v", err)
+	}
+	if again := openDerivative(t, is, image); !bytes.Equal(again, web) {
+		t.Errorf("Expected the kept derivative to be sent")
+	}
+
+	if err := is.Delete(image); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := is.storage.Stat(key); err == nil {
+		t.Errorf("Expected the derivative to be deleted with the image")
+	}
+}
+
+func TestOpenAsFormat(t *testing.T) {
+	is, db, _ := testImageService(t)
+	if err := is.Create(1, io.NopCloser(bytes.NewReader(encodePNG(t, 1600, 1200))), "photo.png", DuplicateKeepBoth); err != nil {
+		t.Fatal(err)
+	}
+	img := &db.images[0]
+
+	if _, err := is.OpenAs(img, SizeThumb, imaging.FormatWebP, nil); err != imaging.ErrFormatUnsupported {
+		t.Errorf("Expected an unregistered format to fail. Have: %v, Want: %v", err, imaging.ErrFormatUnsupported)
+	}
+	// The fake encoder records the size it was given rather than encoding.
+	imaging.RegisterEncoder(imaging.FormatWebP, imaging.EncoderFunc(func(img image.Image, quality int) ([]byte, error) {
+		return []byte(img.Bounds().Size().String()), nil
+	}))
+	t.Cleanup(func() { imaging.UnregisterEncoder(imaging.FormatWebP) })
+
+	f, err := is.OpenAs(img, SizeThumb, imaging.FormatWebP, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(f)
+	f.Close()
+	if have := string(data); have != "(800,600)" {
+		t.Errorf("Wrong derivative. Have: %s, Want: (800,600)", have)
+	}
+	webp, _ := is.derivativeKey(img, SizeThumb, imaging.FormatWebP)
+	jpeg, _ := is.derivativeKey(img, SizeThumb, imaging.FormatJPEG)
+	if _, err := is.storage.Stat(webp); err != nil {
+		t.Errorf("Expected the WebP derivative to be kept, Got: %v", err)
+	}
+	if _, err := is.storage.Stat(jpeg); err == nil {
+		t.Errorf("Expected each format to be kept separately")
+	}
+}
+
+func TestOpenSizeRAW(t *testing.T) {
+	is, db, _ := testImageService(t)
+	if err := is.Create(1, io.NopCloser(bytes.NewReader(encodeRAF(t, 300, 200))), "DSCF0001.RAF", DuplicateKeepBoth); err != nil {
+		t.Fatal(err)
+	}
+	img := &db.images[0]
+	if !strings.HasSuffix(img.StoredName, ".raf") || img.Viewable() {
+		t.Errorf("Expected the RAW file to be stored as it was uploaded, Got: %s", img.StoredName)
+	}
+	cfg, format, err := imageConfig(openDerivative(t, is, img))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "jpeg" || cfg.Width != 300 || cfg.Height != 200 {
+		t.Errorf("Wrong derivative. Have: %s %dx%d, Want: jpeg 300x200", format, cfg.Width, cfg.Height)
+	}
+}
+
+func TestSizeFilename(t *testing.T) {
+	image := &Image{Filename: "holiday.png"}
+	if have := SizeOriginal.Filename(image); have != "holiday.png" {
+		t.Errorf("Have: %q, Want: %q", have, "holiday.png")
+	}
+	if have := SizeWeb.Filename(image); have != "holiday.jpg" {
+		t.Errorf("Have: %q, Want: %q", have, "holiday.jpg")
+	}
+}
+
+func openDerivative(t *testing.T, is *imageService, img *Image) []byte {
+	t.Helper()
+	f, err := is.OpenSize(img, SizeWeb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func imageConfig(data []byte) (image.Config, string, error) {
+	return image.DecodeConfig(bytes.NewReader(data))
+}
@@ -0,0 +1,63 @@
+package imagesModel
+
+import (
+	"io"
+	"log"
+
+	"lenslocked/imaging"
+)
+
+// DESCRIBE_WORKERS is how many newly stored images can be decoded at once
+// to work out their placeholder, palette and perceptual hash.
+const DESCRIBE_WORKERS = 2
+
+// describeLater works out the details of a newly stored image that need
+// all of its pixels in the background, so that storing it doesn't wait
+// on decoding it, which for some formats means running an external
+// program. At most DESCRIBE_WORKERS images are decoded at once, so a
+// large archive can't start hundreds of decoders. Until it is done the
+// image is shown like one stored before these details existed.
+func (is *imageService) describeLater(id uint) {
+	go func() {
+		is.describing <- struct{}{}
+		defer func() { <-is.describing }()
+		if err := is.describeImage(id); err != nil {
+			log.Println("Could not describe image", id, "-", err)
+		}
+	}()
+}
+
+// describeImage decodes the stored image and saves its perceptual hash,
+// and its size, placeholder and palette as it looks with its edits
+// applied. The image is looked up again, since it may have been edited
+// or deleted since it was stored.
+func (is *imageService) describeImage(id uint) error {
+	image, err := is.db.ByID(id)
+	if err != nil {
+		return err
+	}
+	f, err := is.Open(image)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	transforms, err := ParseTransforms(image.Transforms)
+	if err != nil {
+		return err
+	}
+	img, _, err := imaging.Decode(data)
+	if err != nil {
+		return err
+	}
+	image.PerceptualHash = perceptualHash(img)
+	img = transforms.Apply(img)
+	if err := setPlaceholder(image, img); err != nil {
+		return err
+	}
+	setPalette(image, img)
+	return is.db.Describe(image)
+}
@@ -0,0 +1,31 @@
+package imagesModel
+
+// DuplicatePolicy decides what happens when an uploaded image is
+// byte-for-byte identical to one already in the gallery. Identical
+// content is found by comparing the SHA-256 checksum of the stored file.
+type DuplicatePolicy string
+
+const (
+	// DuplicateSkip leaves the existing image alone and rejects the upload.
+	DuplicateSkip DuplicatePolicy = "skip"
+
+	// DuplicateKeepBoth stores the upload as another copy of the image.
+	DuplicateKeepBoth DuplicatePolicy = "keep"
+
+	// DuplicateReplace gives the image already in the gallery the upload's
+	// filename and EXIF, keeping its place, caption, alt text, edits and
+	// cover status, and deletes any other copies of it.
+	DuplicateReplace DuplicatePolicy = "replace"
+)
+
+// ParseDuplicatePolicy returns the policy with the provided name. Anything
+// that isn't a known policy is treated as DuplicateSkip, since that never
+// changes what is already in the gallery.
+func ParseDuplicatePolicy(name string) DuplicatePolicy {
+	switch policy := DuplicatePolicy(name); policy {
+	case DuplicateKeepBoth, DuplicateReplace:
+		return policy
+	default:
+		return DuplicateSkip
+	}
+}
@@ -0,0 +1,104 @@
+package imagesModel
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"lenslocked/imaging"
+)
+
+// Exif is the shooting information of an image as it is stored, read from
+// the uploaded file before anything else is done with it. Images stored
+// before it was added, and files that didn't have any, leave it empty.
+type Exif struct {
+	Camera       string  `gorm:"not null;default:''"`
+	Lens         string  `gorm:"not null;default:''"`
+	FNumber      float64 `gorm:"not null;default:0"`
+	ExposureTime float64 `gorm:"not null;default:0"`
+	ISO          int     `gorm:"not null;default:0"`
+	FocalLength  float64 `gorm:"not null;default:0"`
+	TakenAt      *time.Time
+}
+
+// newExif keeps the parts of what the camera recorded that are shown with
+// the image.
+func newExif(e imaging.Exif) Exif {
+	exif := Exif{
+		Camera:       e.Model,
+		Lens:         e.Lens,
+		FNumber:      e.FNumber,
+		ExposureTime: e.ExposureTime,
+		ISO:          e.ISO,
+		FocalLength:  e.FocalLength,
+	}
+	// Most cameras already start the model with the make.
+	if e.Make != "" && !strings.HasPrefix(strings.ToLower(e.Model), strings.ToLower(strings.Fields(e.Make)[0])) {
+		exif.Camera = strings.TrimSpace(e.Make + " " + e.Model)
+	}
+	if !e.Taken.IsZero() {
+		taken := e.Taken
+		exif.TakenAt = &taken
+	}
+	return exif
+}
+
+// Empty reports whether there is nothing to show.
+func (e Exif) Empty() bool {
+	return e == Exif{}
+}
+
+// Aperture is the f-number written the way photographers do, such as
+// "f/2.8", or empty if it wasn't recorded.
+func (e Exif) Aperture() string {
+	if e.FNumber <= 0 {
+		return ""
+	}
+	return "f/" + strconv.FormatFloat(e.FNumber, 'f', -1, 64)
+}
+
+// Shutter is the exposure time written the way photographers do, as a
+// fraction of a second for short exposures such as "1/250 s" and in
+// seconds for long ones, or empty if it wasn't recorded.
+func (e Exif) Shutter() string {
+	switch {
+	case e.ExposureTime <= 0:
+		return ""
+	case e.ExposureTime < 0.5:
+		return fmt.Sprintf("1/%d s", int(math.Round(1/e.ExposureTime)))
+	}
+	return strconv.FormatFloat(math.Round(e.ExposureTime*10)/10, 'f', -1, 64) + " s"
+}
+
+// Focal is the focal length in millimetres, such as "50 mm", or empty if
+// it wasn't recorded.
+func (e Exif) Focal() string {
+	if e.FocalLength <= 0 {
+		return ""
+	}
+	return strconv.FormatFloat(math.Round(e.FocalLength*10)/10, 'f', -1, 64) + " mm"
+}
+
+// Summary is everything that was recorded, written out for showing with
+// the image: the camera, lens, aperture, shutter speed, ISO, focal length
+// and when it was taken.
+func (e Exif) Summary() []string {
+	var parts []string
+	for _, part := range []string{e.Camera, e.Lens, e.Aperture(), e.Shutter()} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if e.ISO > 0 {
+		parts = append(parts, fmt.Sprintf("ISO %d", e.ISO))
+	}
+	if focal := e.Focal(); focal != "" {
+		parts = append(parts, focal)
+	}
+	if e.TakenAt != nil {
+		parts = append(parts, e.TakenAt.Format("2 January 2006, 15:04"))
+	}
+	return parts
+}
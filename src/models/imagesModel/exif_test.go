@@ -0,0 +1,65 @@
+package imagesModel
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"lenslocked/imaging"
+)
+
+func TestNewExif(t *testing.T) {
+	tests := []struct {
+		make, model string
+		want        string
+	}{
+		{"Canon", "Canon EOS R5", "Canon EOS R5"},
+		{"NIKON CORPORATION", "NIKON Z 6_2", "NIKON Z 6_2"},
+		{"FUJIFILM", "X-T4", "FUJIFILM X-T4"},
+		{"", "iPhone 15 Pro", "iPhone 15 Pro"},
+	}
+	for _, test := range tests {
+		exif := newExif(imaging.Exif{Make: test.make, Model: test.model})
+		if exif.Camera != test.want {
+			t.Errorf("Have: %q, Want: %q", exif.Camera, test.want)
+		}
+	}
+	if exif := newExif(imaging.Exif{}); !exif.Empty() {
+		t.Errorf("Expected nothing to show, Got: %+v", exif)
+	}
+	taken := time.Date(2024, 6, 1, 14, 30, 0, 0, time.UTC)
+	if exif := newExif(imaging.Exif{Taken: taken}); exif.TakenAt == nil || !exif.TakenAt.Equal(taken) {
+		t.Errorf("Have: %v, Want: %v", exif.TakenAt, taken)
+	}
+}
+
+func TestExifFormatting(t *testing.T) {
+	exif := Exif{FNumber: 2.8, ExposureTime: 0.004, FocalLength: 50}
+	if have := exif.Aperture(); have != "f/2.8" {
+		t.Errorf("Have: %q, Want: %q", have, "f/2.8")
+	}
+	if have := exif.Shutter(); have != "1/250 s" {
+		t.Errorf("Have: %q, Want: %q", have, "1/250 s")
+	}
+	if have := exif.Focal(); have != "50 mm" {
+		t.Errorf("Have: %q, Want: %q", have, "50 mm")
+	}
+	long := Exif{ExposureTime: 2.5}
+	if have := long.Shutter(); have != "2.5 s" {
+		t.Errorf("Have: %q, Want: %q", have, "2.5 s")
+	}
+	var none Exif
+	if none.Aperture() != "" || none.Shutter() != "" || none.Focal() != "" || none.Summary() != nil {
+		t.Errorf("Expected nothing to be shown for missing values")
+	}
+}
+
+func TestExifSummary(t *testing.T) {
+	taken := time.Date(2024, 6, 1, 14, 30, 0, 0, time.UTC)
+	exif := Exif{Camera: "Canon EOS R5", FNumber: 2.8, ISO: 400, TakenAt: &taken}
+	want := []string{"Canon EOS R5", "f/2.8", "ISO 400", "1 June 2024, 14:30"}
+	have := exif.Summary()
+	if strings.Join(have, "|") != strings.Join(want, "|") {
+		t.Errorf("Have: %q, Want: %q", have, want)
+	}
+}
@@ -1,105 +1,597 @@
 package imagesModel
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"image/color"
 	"io"
 	"net/url"
-	"os"
 	"path/filepath"
 	"strings"
+	"time"
+	"unicode"
+
+	"lenslocked/imaging"
+	"lenslocked/models/errorsModel"
+	"lenslocked/rand"
+	"lenslocked/storage"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	// STORED_NAME_BYTES is the number of random bytes used for the name an
+	// image is stored under on disk.
+	STORED_NAME_BYTES = 18
+
+	// MAX_NAME_ATTEMPTS is how many random names are tried before giving up
+	// when a generated name is already taken.
+	MAX_NAME_ATTEMPTS = 5
+
+	// MAX_FILENAME_LENGTH is the longest original filename we keep.
+	MAX_FILENAME_LENGTH = 255
+
+	// VERSION_LENGTH is how many characters of the checksum are used to
+	// version image URLs.
+	VERSION_LENGTH = 16
+
+	// MAX_CAPTION_LENGTH and MAX_ALT_TEXT_LENGTH are the most characters
+	// allowed in an image's caption and alt text. Alt text should be a
+	// short description, so it is kept much shorter.
+	MAX_CAPTION_LENGTH  = 1000
+	MAX_ALT_TEXT_LENGTH = 250
 )
 
-// Image is not stored in the database
+// Image is a photo that belongs to a gallery. The file is stored under a
+// server generated StoredName; Filename is the name it was uploaded with
+// and is only ever used for display and downloads. Size is the size of
+// the stored file in bytes, which counts towards the owner's Usage.
+// PerceptualHash is the hex encoded difference hash used to find
+// near-identical shots.
+//
+// Caption is shown with the image and AltText describes it for people
+// using screen readers. Images in a gallery are shown in ascending
+// Position, which the owner sets by reordering them.
+//
+// Transforms are the edits the owner has made, stored in the form written
+// by Transforms.String. They are applied to everything made from the
+// image but never to the stored file.
+//
+// Width and Height are the size of the image with its edits applied, and
+// Placeholder is a tiny version of it as a data URI to show while it
+// loads. Palette is the PALETTE_SIZE colours the image is mostly made of,
+// written as hex and separated by spaces. They are zero and empty for
+// images stored before they existed until a thumbnail has been made for
+// them, and for new images until they have been worked out after the
+// image is stored.
+//
+// Exif is what the camera recorded about how the photo was taken.
+//
+// URL is filled in by the ImageService with a signed, expiring version of
+// Path, and is what should be rendered into pages. ThumbURL and WebURL are
+// the same for SizeThumb and SizeWeb derivatives, for showing the image in
+// a grid and on a page of its own. Checksum is the hex encoded SHA-256 of
+// the stored file.
 type Image struct {
-	GalleryID uint
-	Filename  string
+	gorm.Model
+	GalleryID  uint   `gorm:"not null;index"`
+	Filename   string `gorm:"not null"`
+	StoredName string `gorm:"not null;unique_index"`
+	Checksum   string `gorm:"not null;default:'';index"`
+	Size       int64  `gorm:"not null;default:0"`
+	// PerceptualHash is empty for images stored before it was added, and
+	// for a moment after an image is stored.
+	PerceptualHash string `gorm:"not null;default:''"`
+	Caption        string `gorm:"not null;default:''"`
+	AltText        string `gorm:"not null;default:''"`
+	Position       int    `gorm:"not null;default:0"`
+	Transforms     string `gorm:"not null;default:''"`
+	Width          int    `gorm:"not null;default:0"`
+	Height         int    `gorm:"not null;default:0"`
+	Placeholder    string `gorm:"type:text;not null;default:''"`
+	Palette        string `gorm:"not null;default:''"`
+	Exif           Exif   `gorm:"embedded;embedded_prefix:exif_"`
+	URL            string `gorm:"-"`
+	ThumbURL       string `gorm:"-"`
+	WebURL         string `gorm:"-"`
+}
+
+// Alt is the text to put in the image's alt attribute. Images that haven't
+// been given alt text fall back to their caption, and then to their file
+// name without the extension, so there is always something to read out.
+func (i *Image) Alt() string {
+	if i.AltText != "" {
+		return i.AltText
+	}
+	if i.Caption != "" {
+		return i.Caption
+	}
+	return strings.TrimSuffix(i.Filename, filepath.Ext(i.Filename))
+}
+
+// Edited reports whether the owner has made any edits to the image.
+func (i *Image) Edited() bool {
+	return i.Transforms != ""
+}
+
+// Viewable reports whether browsers can show the stored file itself.
+// Images in other formats, such as HEIC and RAW files, are only ever shown
+// as derivatives.
+func (i *Image) Viewable() bool {
+	ext := strings.TrimPrefix(filepath.Ext(i.StoredName), ".")
+	for _, format := range imageFormats {
+		if format.web && contains(format.extensions, ext) {
+			return true
+		}
+	}
+	return false
 }
 
 func (i *Image) Path() string {
 	url := url.URL{
-		Path: fmt.Sprintf("/images/galleries/%v/%v", i.GalleryID, i.Filename),
+		Path: fmt.Sprintf("/images/galleries/%v/%v", i.GalleryID, i.StoredName),
 	}
 	return url.String()
 }
 
+// Version identifies the contents of the image. It is added to signed
+// URLs so that they are content-addressed and can be cached forever.
+// Edited images are shown differently from the stored file, so a hash of
+// their edits is added to the version.
+func (i *Image) Version() string {
+	if len(i.Checksum) < VERSION_LENGTH {
+		return ""
+	}
+	if !i.Edited() {
+		return i.Checksum[:VERSION_LENGTH]
+	}
+	sum := sha256.Sum256([]byte(i.Transforms))
+	return i.Checksum[:VERSION_LENGTH] + "-" + hex.EncodeToString(sum[:4])
+}
+
+// SignedPath returns the image's path signed to stop working at expires.
+func (i *Image) SignedPath(signer URLSigner, expires time.Time) string {
+	var params url.Values
+	if v := i.Version(); v != "" {
+		params = url.Values{"v": {v}}
+	}
+	return signer.Sign(i.Path(), params, expires)
+}
+
+// ImageDB is used to interact with the images database.
+//
+// For all single queries:
+// If the image is found, error will be nil
+// If the image is not found, the error will be set to ErrImageNotFound
+type ImageDB interface {
+	ByID(id uint) (*Image, error)
+	ByStoredName(name string) (*Image, error)
+	ByGalleryID(galleryID uint) ([]Image, error)
+	// ByGalleryIDs returns the images in all of the galleries at once.
+	ByGalleryIDs(galleryIDs []uint) ([]Image, error)
+	ByChecksum(galleryID uint, checksum string) ([]Image, error)
+	// Unsized returns the images stored before their size was recorded.
+	Unsized() ([]Image, error)
+	// MaxPosition returns the largest Position of the images in a gallery,
+	// or zero if it has none.
+	MaxPosition(galleryID uint) (int, error)
+	Create(image *Image) error
+	Update(image *Image) error
+	// Describe saves the details worked out from the image's pixels,
+	// leaving the rest of it as it is.
+	Describe(image *Image) error
+	// Reorder gives the images with the provided IDs ascending positions
+	// in the order they are listed, all or nothing.
+	Reorder(galleryID uint, imageIDs []uint) error
+	// SaveAll creates the images without an ID and updates the rest, all
+	// or nothing.
+	SaveAll(images []Image) error
+	Delete(id uint) error
+}
+
+// ImageService stores uploaded images and keeps track of them.
+//
+// Images returned by ByID and ByGalleryID have their URL set to a signed
+// path that is valid for at least DEFAULT_URL_TTL.
 type ImageService interface {
-	Create(galleryID uint, r io.ReadCloser, filename string) error
-	Delete(galleryID uint, filename string) error
+	// Create stores an uploaded image in a gallery. duplicates decides
+	// what happens if the gallery already has an identical image.
+	Create(galleryID uint, r io.ReadCloser, filename string, duplicates DuplicatePolicy) error
+	// Update saves changes to an image's caption and alt text.
+	Update(image *Image) error
+	// Transform replaces the edits made to an image. Derivatives made
+	// with the old edits are thrown away.
+	Transform(image *Image, transforms Transforms) error
+	// Reorder sets the order images are shown in. imageIDs lists images
+	// in the gallery in their new order; any left out keep their order
+	// relative to each other after the listed ones.
+	Reorder(galleryID uint, imageIDs []uint) error
+	// Transfer moves or copies images to the end of another gallery. It
+	// either transfers all of the images or none of them.
+	Transfer(fromGalleryID, toGalleryID uint, imageIDs []uint, mode TransferMode) error
+	Delete(image *Image) error
+	// Batch runs op on each of the selected images that are in the
+	// gallery and reports which ones it worked for.
+	Batch(galleryID uint, imageIDs []uint, op func(image *Image) error) BatchResults
+	// Open returns the stored file for an image. The caller must close it.
+	Open(image *Image) (io.ReadSeekCloser, error)
+	// OpenSize returns the image at the provided size with its edits
+	// applied, or the stored file for SizeOriginal. The caller must close
+	// it.
+	OpenSize(image *Image, size Size) (io.ReadSeekCloser, error)
+	// OpenAs returns the image at the provided size in the format, with
+	// a gallery's watermark drawn over it if wm is set. The caller must
+	// close it.
+	OpenAs(image *Image, size Size, format imaging.Format, wm *Watermark) (io.ReadSeekCloser, error)
+	ByID(id uint) (*Image, error)
+	ByStoredName(name string) (*Image, error)
+	// ByGalleryID returns the images in a gallery in the order the owner
+	// has arranged them.
 	ByGalleryID(galleryID uint) ([]Image, error)
+	// ByColour returns the images in the galleries with a colour close to
+	// c in their palette, the closest matches first.
+	ByColour(galleryIDs []uint, c color.RGBA) ([]Image, error)
+
+	// SignedURL returns a signed path for the image that stops working
+	// once ttl has passed.
+	SignedURL(image *Image, ttl time.Duration) string
+	// VerifyURL checks the signature and expiry of a signed image URL.
+	VerifyURL(u *url.URL) error
+	// SetURL fills in the URLs of an image that was loaded some other way,
+	// such as a gallery's cover.
+	SetURL(image *Image)
+	// SetWatermarkedURL fills in URLs for the image with the watermark
+	// drawn over it, for showing to people other than the owner.
+	SetWatermarkedURL(image *Image, wm Watermark)
+
+	// SaveWatermark stores a PNG to draw as a gallery's watermark and
+	// returns the name to save as the watermark's MarkName.
+	SaveWatermark(galleryID uint, r io.Reader) (string, error)
+	// ReplaceWatermark throws away the files made for a gallery's old
+	// watermark once it has been changed to current.
+	ReplaceWatermark(galleryID uint, old, current Watermark) error
+
+	// Usage returns how much storage the user's images take up and the
+	// limit on it.
+	Usage(userID uint) (*Usage, error)
+	// MaxUploadSize returns the size of the largest file that can be
+	// added to the gallery right now.
+	MaxUploadSize(galleryID uint) (int64, error)
+	// CheckUpload returns a public error if a file of size bytes is too
+	// large to be added to the gallery.
+	CheckUpload(galleryID uint, size int64) error
+	// ReserveUpload holds size bytes of the gallery owner's storage for a
+	// file that is still arriving, returning the same errors as
+	// CheckUpload if there isn't room for it.
+	ReserveUpload(galleryID uint, size int64) error
+	// ReleaseUpload hands back space held by ReserveUpload.
+	ReleaseUpload(galleryID uint, size int64) error
+	// BackfillUsage records the size of images stored before sizes were
+	// tracked and adds them to their owners' usage.
+	BackfillUsage() error
+	// ImportLegacy records the images stored in gallery folders before
+	// images were kept in the database.
+	ImportLegacy() error
+
+	// Similar returns groups of near-identical images in a gallery, such
+	// as bursts or exposure brackets, so the owner can cull them.
+	Similar(galleryID uint) ([][]Image, error)
 }
 
-func NewImageService() ImageService {
-	return &imageService{}
+// NewImageService initializes an ImageService that keeps image files in
+// the provided storage backend, signs image URLs with hmacKey and keeps
+// each user within limits.
+func NewImageService(db *gorm.DB, store storage.Storage, hmacKey string, limits Limits) ImageService {
+	is := &imageService{
+		db:         &imageGorm{db},
+		usage:      &usageGorm{db},
+		limits:     limits,
+		storage:    store,
+		signer:     NewURLSigner(hmacKey),
+		newName:    randomName,
+		now:        time.Now,
+		describing: make(chan struct{}, DESCRIBE_WORKERS),
+	}
+	is.describe = is.describeLater
+	return newImageValidator(is)
 }
 
-type imageService struct{}
+type imageService struct {
+	db      ImageDB
+	usage   UsageDB
+	limits  Limits
+	storage storage.Storage
+	signer  URLSigner
+	// newName generates the name a file is stored under.
+	newName func() (string, error)
+	// now returns the current time and is replaced in tests.
+	now func() time.Time
+	// describe works out the placeholder, palette and perceptual hash of
+	// a newly stored image, and is replaced in tests to do so right away.
+	describe func(id uint)
+	// describing holds a slot for each image being described.
+	describing chan struct{}
+}
 
-func (is *imageService) Create(galleryID uint, r io.ReadCloser, filename string) error {
+// Create stores an uploaded image with the gallery's other images. Phones
+// record the way the camera was held in the EXIF orientation tag rather
+// than rotating the pixels, so that orientation is baked into the stored
+// file. Doing so drops the rest of the EXIF block, so the shooting
+// information is read first.
+//
+// The file is stored under a random name and the sanitized original name
+// is only recorded in the database, so nothing the user sends us ever
+// becomes part of a storage key.
+//
+// The size of the stored file is reserved against the owner's account
+// before it is written, and released again if storing it fails.
+//
+// Only the image's header is read here. The details that need all of its
+// pixels are worked out once it is stored, without holding up the upload.
+//
+// duplicates decides what happens when the gallery already has an image
+// with identical content. New images go after the rest of the gallery,
+// but an image that replaces another keeps its place.
+func (is *imageService) Create(galleryID uint, r io.ReadCloser, filename string, duplicates DuplicatePolicy) error {
 	defer r.Close()
-	galleryPath, err := is.makeImagePath(galleryID)
+	data, err := io.ReadAll(r)
 	if err != nil {
 		return err
 	}
-
-	for is.fileExists(galleryPath + filename) {
-
-		fileSlice := strings.Split(filename, ".")
-		if len(fileSlice) > 1 {
-			// Add the extension to the end of the slice. We will overwrite the old extension with the _copy value
-			fileSlice[len(fileSlice)-2] += "_copy"
-			filename = strings.Join(fileSlice, ".")
+	exif := newExif(imaging.ReadExif(data))
+	data, err = imaging.NormalizeOrientation(data)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+	if duplicates != DuplicateKeepBoth {
+		existing, err := is.db.ByChecksum(galleryID, checksum)
+		if err != nil {
+			return err
+		}
+		if len(existing) > 0 {
+			if duplicates == DuplicateSkip {
+				return errorsModel.ImageError{Filename: filename, Err: errorsModel.ErrImageDuplicate}
+			}
+			return is.replace(existing, filename, exif)
 		}
 	}
-
-	dst, err := os.Create(galleryPath + filename)
+	ext := storedExtension(data, filename)
+	storedName, err := is.unusedName(galleryID, ext)
 	if err != nil {
 		return err
 	}
-	defer dst.Close()
-	_, err = io.Copy(dst, r)
+	position, err := is.db.MaxPosition(galleryID)
 	if err != nil {
 		return err
 	}
+	size := int64(len(data))
+	if err := is.usage.Reserve(galleryID, size, is.limits.MaxAccountSize); err != nil {
+		if err == errorsModel.ErrStorageQuotaExceeded {
+			return errorsModel.ImageError{Filename: filename, Err: err}
+		}
+		return err
+	}
+	key := is.key(galleryID, storedName)
+	if err := is.storage.Put(key, bytes.NewReader(data)); err != nil {
+		is.usage.Release(galleryID, size)
+		return err
+	}
+	image := &Image{
+		GalleryID:  galleryID,
+		Filename:   sanitizeFilename(filename),
+		StoredName: storedName,
+		Checksum:   checksum,
+		Size:       size,
+		Position:   position + 1,
+		Exif:       exif,
+	}
+	if err := is.db.Create(image); err != nil {
+		is.storage.Delete(key)
+		is.usage.Release(galleryID, size)
+		return err
+	}
+	is.describe(image.ID)
+	return nil
+}
+
+// replace swaps an upload in for its duplicates. Their stored files are
+// identical to it, so rather than storing it again the oldest of them
+// takes on the upload's filename and EXIF. It keeps its ID and with it
+// its position, caption, alt text, edits, cover status, picks and
+// comments. Any other copies are deleted.
+func (is *imageService) replace(duplicates []Image, filename string, exif Exif) error {
+	image := &duplicates[0]
+	image.Filename = sanitizeFilename(filename)
+	image.Exif = exif
+	if err := is.db.Update(image); err != nil {
+		return err
+	}
+	for i := 1; i < len(duplicates); i++ {
+		if err := is.Delete(&duplicates[i]); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// unusedName generates a random name that isn't already used in the
+// gallery. With 18 random bytes a collision is all but impossible, but a
+// new name is tried if one happens so another image is never overwritten.
+func (is *imageService) unusedName(galleryID uint, ext string) (string, error) {
+	for i := 0; i < MAX_NAME_ATTEMPTS; i++ {
+		name, err := is.newName()
+		if err != nil {
+			return "", err
+		}
+		name = name + "." + ext
+		_, err = is.storage.Stat(is.key(galleryID, name))
+		if err == storage.ErrNotFound {
+			return name, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("images: no unused file name after %d attempts", MAX_NAME_ATTEMPTS)
+}
+
+// ByID returns the image with the provided ID.
+func (is *imageService) ByID(id uint) (*Image, error) {
+	image, err := is.db.ByID(id)
+	if err != nil {
+		return nil, err
+	}
+	is.SetURL(image)
+	return image, nil
+}
+
+// ByStoredName returns the image stored under the provided name.
+func (is *imageService) ByStoredName(name string) (*Image, error) {
+	image, err := is.db.ByStoredName(name)
+	if err != nil {
+		return nil, err
+	}
+	is.SetURL(image)
+	return image, nil
+}
+
+// ByGalleryID returns all of the images in a gallery in their saved order.
 func (is *imageService) ByGalleryID(galleryID uint) ([]Image, error) {
-	path := is.imagePath(galleryID)
-	names, err := filepath.Glob(path + "*")
+	images, err := is.db.ByGalleryID(galleryID)
 	if err != nil {
 		return nil, err
 	}
-	extensions := []string{"jpg", "jpeg", "png"}
-	names = is.filter(names, extensions)
-	images := is.toImages(galleryID, names)
+	for i := range images {
+		is.SetURL(&images[i])
+	}
 	return images, nil
 }
 
-func (is *imageService) Delete(galleryID uint, filename string) error {
-	path := is.imagePath(galleryID) + filename
-	return os.Remove(path)
+// SignedURL returns a signed path for the image that expires after ttl.
+func (is *imageService) SignedURL(image *Image, ttl time.Duration) string {
+	return image.SignedPath(is.signer, is.now().Add(ttl))
+}
+
+// VerifyURL checks that a request for an image was signed by us and
+// hasn't expired.
+func (is *imageService) VerifyURL(u *url.URL) error {
+	return is.signer.Verify(u, is.now())
 }
 
-func (is *imageService) toImages(galleryID uint, names []string) []Image {
-	var images []Image
-	path := is.imagePath(galleryID)
-	for i := range names {
-		names[i] = strings.Replace(names[i], path, "", 1)
-		image := Image{Filename: names[i], GalleryID: galleryID}
-		images = append(images, image)
+// SetURL signs paths to the image for rendering into a page.
+func (is *imageService) SetURL(image *Image) {
+	is.setURLs(image, nil)
+}
+
+// setURLs fills in the image's URL, ThumbURL and WebURL, with the watermark drawn
+// over both if wm is set.
+func (is *imageService) setURLs(image *Image, wm *Watermark) {
+	expires := is.signer.Window(is.now(), DEFAULT_URL_TTL)
+	params := url.Values{}
+	if v := image.Version(); v != "" {
+		params.Set("v", v)
+	}
+	if wm != nil && wm.Enabled() {
+		params.Set("wm", wm.Version())
 	}
-	return images
+	image.URL = is.signer.Sign(image.Path(), params, expires)
+	params.Set("size", SizeThumb.Name)
+	image.ThumbURL = is.signer.Sign(image.Path(), params, expires)
+	params.Set("size", SizeWeb.Name)
+	image.WebURL = is.signer.Sign(image.Path(), params, expires)
 }
 
-func (is *imageService) filter(names []string, extensions []string) []string {
-	var imageStrings []string
-	for _, fpath := range names {
-		fpathSlice := strings.Split(fpath, ".")
-		if contains(extensions, string(fpathSlice[len(fpathSlice)-1])) {
-			imageStrings = append(imageStrings, fpath)
+// Update saves the image's details. Only the fields the owner can edit
+// are expected to have changed.
+func (is *imageService) Update(image *Image) error {
+	return is.db.Update(image)
+}
+
+// Reorder puts the listed images first in the order given, followed by
+// the rest of the gallery in its current order, so a stale page that
+// doesn't list a newly uploaded image can still be saved.
+func (is *imageService) Reorder(galleryID uint, imageIDs []uint) error {
+	images, err := is.db.ByGalleryID(galleryID)
+	if err != nil {
+		return err
+	}
+	listed := make(map[uint]bool, len(imageIDs))
+	inGallery := make(map[uint]bool, len(images))
+	for _, image := range images {
+		inGallery[image.ID] = true
+	}
+	order := make([]uint, 0, len(images))
+	for _, id := range imageIDs {
+		if !inGallery[id] {
+			return errorsModel.ErrImageNotFound
+		}
+		if listed[id] {
+			continue
 		}
+		listed[id] = true
+		order = append(order, id)
 	}
-	return imageStrings
+	for _, image := range images {
+		if !listed[image.ID] {
+			order = append(order, image.ID)
+		}
+	}
+	return is.db.Reorder(galleryID, order)
+}
+
+// Delete removes an image's derivatives and file and then its database
+// record, and gives the space it used back to the owner.
+func (is *imageService) Delete(image *Image) error {
+	key, err := is.storedKey(image)
+	if err != nil {
+		return err
+	}
+	if err := is.deleteDerivatives(image); err != nil {
+		return err
+	}
+	if err := is.storage.Delete(key); err != nil {
+		return err
+	}
+	if err := is.db.Delete(image.ID); err != nil {
+		return err
+	}
+	return is.usage.Release(image.GalleryID, image.Size)
+}
+
+// Open returns the stored file for the image.
+func (is *imageService) Open(image *Image) (io.ReadSeekCloser, error) {
+	key, err := is.storedKey(image)
+	if err != nil {
+		return nil, err
+	}
+	return is.storage.Get(key)
+}
+
+// storedKey returns the storage key of an image. Stored names are
+// generated by us, but this refuses anything that isn't a plain file
+// name as a last line of defense against path traversal.
+func (is *imageService) storedKey(image *Image) (string, error) {
+	name := image.StoredName
+	if name == "" || strings.ContainsAny(name, "/\\") || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("images: invalid stored name %q", name)
+	}
+	return is.key(image.GalleryID, name), nil
+}
+
+// storedExtension is the extension to store an image with. The upload's own
+// is kept if it is one we accept for the format, since it is the only way
+// to tell many camera RAW formats apart.
+func storedExtension(data []byte, filename string) string {
+	extensions := imageFormats[imaging.Sniff(data)].extensions
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), "."))
+	if contains(extensions, ext) {
+		return ext
+	}
+	return extensions[0]
 }
 
 func contains(okExtensions []string, val string) bool {
@@ -111,25 +603,38 @@ func contains(okExtensions []string, val string) bool {
 	return false
 }
 
-func (is *imageService) imagePath(galleryID uint) string {
-	return fmt.Sprintf("images/galleries/%v/", galleryID)
+// key returns the storage key for a file in a gallery.
+func (is *imageService) key(galleryID uint, name string) string {
+	return fmt.Sprintf("galleries/%d/%s", galleryID, name)
 }
 
-// makeImagePath ensures that a gallery folder is created for the specific gallery
-// to store photos and then returns the string representation of the path.
-func (is *imageService) makeImagePath(galleryID uint) (string, error) {
-	galleryPath := is.imagePath(galleryID)
-	err := os.MkdirAll(galleryPath, 0o755)
-	if err != nil {
-		return "", err
-	}
-	return galleryPath, nil
+// randomName generates a random, URL safe file name without an extension.
+func randomName() (string, error) {
+	return rand.String(STORED_NAME_BYTES)
 }
 
-func (is *imageService) fileExists(filename string) bool {
-	info, err := os.Stat(filename)
-	if os.IsNotExist(err) {
-		return false
+// sanitizeFilename reduces a user supplied file name to something that is
+// safe to display: directories are dropped, control characters removed and
+// the length capped.
+func sanitizeFilename(filename string) string {
+	filename = strings.ReplaceAll(filename, "\\", "/")
+	filename = filename[strings.LastIndex(filename, "/")+1:]
+	filename = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, filename)
+	filename = strings.TrimSpace(filename)
+	if filename == "" || filename == "." || filename == ".." {
+		return "image"
+	}
+	if len(filename) > MAX_FILENAME_LENGTH {
+		ext := filepath.Ext(filename)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		filename = strings.ToValidUTF8(filename[:MAX_FILENAME_LENGTH-len(ext)], "") + ext
 	}
-	return !info.IsDir()
+	return filename
 }
@@ -0,0 +1,152 @@
+package imagesModel
+
+import (
+	"lenslocked/models"
+	"lenslocked/models/errorsModel"
+
+	"github.com/jinzhu/gorm"
+)
+
+type imageGorm struct {
+	db *gorm.DB
+}
+
+var _ ImageDB = &imageGorm{}
+
+// Creates a new image record and backfills data like ID, CreatedAt, and UpdatedAt fields.
+func (ig *imageGorm) Create(image *Image) error {
+	return ig.db.Create(image).Error
+}
+
+// ByID will look up an image with the provided ID.
+// If the image is found, error will be nil.
+// If the image is not found, the error will be set to ErrImageNotFound.
+func (ig *imageGorm) ByID(id uint) (*Image, error) {
+	var image Image
+	db := ig.db.Where("id = ?", id)
+	err := models.First(db, &image)
+	if err == gorm.ErrRecordNotFound {
+		err = errorsModel.ErrImageNotFound
+	}
+	return &image, err
+}
+
+// ByStoredName will look up an image by the name its file is stored under.
+// If the image is not found, the error will be set to ErrImageNotFound.
+func (ig *imageGorm) ByStoredName(name string) (*Image, error) {
+	var image Image
+	db := ig.db.Where("stored_name = ?", name)
+	err := models.First(db, &image)
+	if err == gorm.ErrRecordNotFound {
+		err = errorsModel.ErrImageNotFound
+	}
+	return &image, err
+}
+
+// Return all images that belong to the gallery with the provided ID by
+// position. Images with the same position, such as those stored before
+// images could be reordered, are in the order they were uploaded.
+func (ig *imageGorm) ByGalleryID(galleryID uint) ([]Image, error) {
+	var images []Image
+	err := ig.db.Where("gallery_id = ?", galleryID).Order("position asc, id asc").Find(&images).Error
+	if err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// ByGalleryIDs returns the images in the galleries with the provided IDs
+// in a single query, each gallery's in order.
+func (ig *imageGorm) ByGalleryIDs(galleryIDs []uint) ([]Image, error) {
+	var images []Image
+	err := ig.db.Where("gallery_id IN (?)", galleryIDs).Order("gallery_id asc, position asc, id asc").Find(&images).Error
+	if err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// ByChecksum returns the images in a gallery whose stored file has the
+// provided checksum, which are exact copies of each other.
+func (ig *imageGorm) ByChecksum(galleryID uint, checksum string) ([]Image, error) {
+	var images []Image
+	err := ig.db.Where("gallery_id = ? AND checksum = ?", galleryID, checksum).Order("id asc").Find(&images).Error
+	if err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// Unsized returns the images with no size recorded, oldest first.
+func (ig *imageGorm) Unsized() ([]Image, error) {
+	var images []Image
+	err := ig.db.Where("size = 0").Order("id asc").Find(&images).Error
+	if err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// MaxPosition returns the largest position used in the gallery.
+func (ig *imageGorm) MaxPosition(galleryID uint) (int, error) {
+	var result struct{ Position int }
+	err := ig.db.Model(&Image{}).Select("COALESCE(MAX(position), 0) AS position").
+		Where("gallery_id = ?", galleryID).Scan(&result).Error
+	return result.Position, err
+}
+
+// Reorder updates the positions in a transaction so that a failure part
+// way through leaves the old order in place.
+func (ig *imageGorm) Reorder(galleryID uint, imageIDs []uint) error {
+	tx := ig.db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	for i, id := range imageIDs {
+		err := tx.Model(&Image{}).Where("id = ? AND gallery_id = ?", id, galleryID).
+			UpdateColumn("position", i+1).Error
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit().Error
+}
+
+// SaveAll saves the images in a transaction.
+func (ig *imageGorm) SaveAll(images []Image) error {
+	tx := ig.db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	for i := range images {
+		if err := tx.Save(&images[i]).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit().Error
+}
+
+// Update will save changes to an existing image.
+func (ig *imageGorm) Update(image *Image) error {
+	return ig.db.Save(image).Error
+}
+
+// Describe only updates the columns worked out from the image's pixels,
+// so it can't undo changes made to the image while they were.
+func (ig *imageGorm) Describe(image *Image) error {
+	return ig.db.Model(image).Updates(map[string]interface{}{
+		"perceptual_hash": image.PerceptualHash,
+		"width":           image.Width,
+		"height":          image.Height,
+		"placeholder":     image.Placeholder,
+		"palette":         image.Palette,
+	}).Error
+}
+
+// Delete will delete the image with the provided ID.
+func (ig *imageGorm) Delete(id uint) error {
+	image := Image{Model: gorm.Model{ID: id}}
+	return ig.db.Delete(&image).Error
+}
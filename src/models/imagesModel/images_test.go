@@ -0,0 +1,601 @@
+package imagesModel
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"lenslocked/models/errorsModel"
+	"lenslocked/storage"
+)
+
+// fakeImageDB keeps images in memory so the file handling in imageService
+// can be tested without a database.
+type fakeImageDB struct {
+	images   []Image
+	failSave error
+}
+
+func (db *fakeImageDB) ByID(id uint) (*Image, error) {
+	for i := range db.images {
+		if db.images[i].ID == id {
+			return &db.images[i], nil
+		}
+	}
+	return nil, errorsModel.ErrImageNotFound
+}
+
+func (db *fakeImageDB) ByStoredName(name string) (*Image, error) {
+	for i := range db.images {
+		if db.images[i].StoredName == name {
+			return &db.images[i], nil
+		}
+	}
+	return nil, errorsModel.ErrImageNotFound
+}
+
+func (db *fakeImageDB) ByGalleryID(galleryID uint) ([]Image, error) {
+	var images []Image
+	for _, image := range db.images {
+		if image.GalleryID == galleryID {
+			images = append(images, image)
+		}
+	}
+	sort.SliceStable(images, func(i, j int) bool {
+		return images[i].Position < images[j].Position
+	})
+	return images, nil
+}
+
+func (db *fakeImageDB) ByGalleryIDs(galleryIDs []uint) ([]Image, error) {
+	var images []Image
+	for _, id := range galleryIDs {
+		gallery, _ := db.ByGalleryID(id)
+		images = append(images, gallery...)
+	}
+	return images, nil
+}
+
+func (db *fakeImageDB) MaxPosition(galleryID uint) (int, error) {
+	max := 0
+	for _, image := range db.images {
+		if image.GalleryID == galleryID && image.Position > max {
+			max = image.Position
+		}
+	}
+	return max, nil
+}
+
+func (db *fakeImageDB) Reorder(galleryID uint, imageIDs []uint) error {
+	for position, id := range imageIDs {
+		for i := range db.images {
+			if db.images[i].ID == id && db.images[i].GalleryID == galleryID {
+				db.images[i].Position = position + 1
+			}
+		}
+	}
+	return nil
+}
+
+// SaveAll fails without saving anything if failSave is set.
+func (db *fakeImageDB) SaveAll(images []Image) error {
+	if db.failSave != nil {
+		return db.failSave
+	}
+	for i := range images {
+		if images[i].ID == 0 {
+			db.Create(&images[i])
+		} else {
+			db.Update(&images[i])
+		}
+	}
+	return nil
+}
+
+func (db *fakeImageDB) ByChecksum(galleryID uint, checksum string) ([]Image, error) {
+	var images []Image
+	for _, image := range db.images {
+		if image.GalleryID == galleryID && image.Checksum == checksum {
+			images = append(images, image)
+		}
+	}
+	return images, nil
+}
+
+func (db *fakeImageDB) Unsized() ([]Image, error) {
+	var images []Image
+	for _, image := range db.images {
+		if image.Size == 0 {
+			images = append(images, image)
+		}
+	}
+	return images, nil
+}
+
+func (db *fakeImageDB) Create(image *Image) error {
+	image.ID = uint(len(db.images) + 1)
+	db.images = append(db.images, *image)
+	return nil
+}
+
+func (db *fakeImageDB) Update(image *Image) error {
+	for i := range db.images {
+		if db.images[i].ID == image.ID {
+			db.images[i] = *image
+		}
+	}
+	return nil
+}
+
+func (db *fakeImageDB) Describe(image *Image) error {
+	return db.Update(image)
+}
+
+func (db *fakeImageDB) Delete(id uint) error {
+	for i := range db.images {
+		if db.images[i].ID == id {
+			db.images = append(db.images[:i], db.images[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+// fakeUsageDB keeps usage in memory. Every gallery belongs to user 1.
+type fakeUsageDB struct {
+	bytes map[uint]int64
+}
+
+func (db *fakeUsageDB) ByUserID(userID uint) (*Usage, error) {
+	return &Usage{UserID: userID, Bytes: db.bytes[userID]}, nil
+}
+
+func (db *fakeUsageDB) ByGalleryID(galleryID uint) (*Usage, error) {
+	return db.ByUserID(1)
+}
+
+func (db *fakeUsageDB) Reserve(galleryID uint, size, limit int64) error {
+	if limit > 0 && db.bytes[1]+size > limit {
+		return errorsModel.ErrStorageQuotaExceeded
+	}
+	db.bytes[1] += size
+	return nil
+}
+
+func (db *fakeUsageDB) Release(galleryID uint, size int64) error {
+	db.bytes[1] -= size
+	return nil
+}
+
+// testImageService returns an imageService storing files in a temporary
+// directory that generates its stored names from the provided list. The
+// directory is returned so tests can check what was written to disk.
+func testImageService(t *testing.T, names ...string) (*imageService, *fakeImageDB, string) {
+	t.Helper()
+	db := &fakeImageDB{}
+	dir := t.TempDir()
+	is := &imageService{
+		db:      db,
+		usage:   &fakeUsageDB{bytes: map[uint]int64{}},
+		storage: storage.NewLocal(dir, "/images"),
+		signer:  NewURLSigner("test-key"),
+		now:     time.Now,
+		newName: func() (string, error) {
+			if len(names) == 0 {
+				return randomName()
+			}
+			name := names[0]
+			names = names[1:]
+			return name, nil
+		},
+	}
+	is.describe = func(id uint) {
+		if err := is.describeImage(id); err != nil {
+			t.Error(err)
+		}
+	}
+	return is, db, dir
+}
+
+func TestCreateIgnoresTraversalInFilename(t *testing.T) {
+	filenames := map[string]string{
+		"../../config.json":             "config.json",
+		"..\\..\\config.json":           "config.json",
+		"/etc/passwd":                   "passwd",
+		"photos/../../../../photo.png":  "photo.png",
+		"..":                            "image",
+		"../":                           "image",
+		"  holiday\x00\n.png ":          "holiday.png",
+		"images/galleries/2/other.png":  "other.png",
+		"%2e%2e%2fconfig.json":          "%2e%2e%2fconfig.json",
+		"C:\\Users\\me\\Desktop\\a.png": "a.png",
+	}
+	for filename, want := range filenames {
+		is, db, dir := testImageService(t)
+		err := is.Create(1, io.NopCloser(bytes.NewReader(encodePNG(t, 2, 2))), filename, DuplicateKeepBoth)
+		if err != nil {
+			t.Fatalf("Expected %q to be stored, Got: %s", filename, err)
+		}
+		image := db.images[0]
+		if image.Filename != want {
+			t.Errorf("Wrong display name for %q. Have: %q, Want: %q", filename, image.Filename, want)
+		}
+		if image.StoredName == filename || filepath.Base(image.StoredName) != image.StoredName {
+			t.Errorf("Expected a generated stored name for %q, Have: %q", filename, image.StoredName)
+		}
+		// The only thing written should be the one file in the gallery folder.
+		var files []string
+		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				files = append(files, path)
+			}
+			return nil
+		})
+		wantPath := filepath.Join(dir, "galleries", "1", image.StoredName)
+		if len(files) != 1 || files[0] != wantPath {
+			t.Errorf("Expected only %s to be written for %q, Have: %v", wantPath, filename, files)
+		}
+	}
+}
+
+func TestCreateRetriesNameCollisions(t *testing.T) {
+	is, db, dir := testImageService(t, "taken", "taken", "free")
+	for i := 0; i < 2; i++ {
+		data := encodePNG(t, i+1, 1)
+		if err := is.Create(1, io.NopCloser(bytes.NewReader(data)), "photo.png", DuplicateKeepBoth); err != nil {
+			t.Fatalf("Expected upload %d to be stored, Got: %s", i, err)
+		}
+	}
+	if db.images[0].StoredName != "taken.png" || db.images[1].StoredName != "free.png" {
+		t.Errorf("Expected the colliding name to be replaced. Have: %s and %s", db.images[0].StoredName, db.images[1].StoredName)
+	}
+	// Both uploads keep the same display name without overwriting each other.
+	for i, image := range db.images {
+		data, err := os.ReadFile(filepath.Join(dir, "galleries", "1", image.StoredName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, encodePNG(t, i+1, 1)) {
+			t.Errorf("Image %d was overwritten", i)
+		}
+		if image.Filename != "photo.png" {
+			t.Errorf("Wrong display name. Have: %s, Want: photo.png", image.Filename)
+		}
+	}
+}
+
+func TestCreateGivesUpOnRepeatedCollisions(t *testing.T) {
+	is, db, _ := testImageService(t, "taken", "taken", "taken", "taken", "taken", "taken")
+	data := encodePNG(t, 1, 1)
+	if err := is.Create(1, io.NopCloser(bytes.NewReader(data)), "a.png", DuplicateKeepBoth); err != nil {
+		t.Fatal(err)
+	}
+	if err := is.Create(1, io.NopCloser(bytes.NewReader(data)), "b.png", DuplicateKeepBoth); err == nil {
+		t.Errorf("Expected an error when no unused name can be found")
+	}
+	if len(db.images) != 1 {
+		t.Errorf("Expected only the first image to be recorded. Have: %d", len(db.images))
+	}
+}
+
+func TestDeleteRefusesTraversal(t *testing.T) {
+	is, _, dir := testImageService(t)
+	secret := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(secret, []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"../../config.json", "..", "", ".hidden", "a/b.png"} {
+		image := &Image{GalleryID: 1, StoredName: name}
+		if err := is.Delete(image); err == nil {
+			t.Errorf("Expected deleting %q to fail", name)
+		}
+	}
+	if _, err := os.Stat(secret); err != nil {
+		t.Errorf("Expected %s to still exist, Got: %s", secret, err)
+	}
+}
+
+func TestDeleteRemovesFileAndRecord(t *testing.T) {
+	is, db, dir := testImageService(t)
+	if err := is.Create(1, io.NopCloser(bytes.NewReader(encodePNG(t, 1, 1))), "a.png", DuplicateKeepBoth); err != nil {
+		t.Fatal(err)
+	}
+	image := db.images[0]
+	if err := is.Delete(&image); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "galleries", "1", image.StoredName)); !os.IsNotExist(err) {
+		t.Errorf("Expected the file to be removed, Got: %v", err)
+	}
+	if len(db.images) != 0 {
+		t.Errorf("Expected the record to be removed")
+	}
+}
+
+func TestCreateAndDeleteTrackUsage(t *testing.T) {
+	is, db, _ := testImageService(t)
+	usage := is.usage.(*fakeUsageDB)
+	data := encodePNG(t, 4, 4)
+	is.limits = Limits{MaxAccountSize: int64(len(data)) * 3 / 2}
+	if err := is.Create(1, io.NopCloser(bytes.NewReader(data)), "a.png", DuplicateKeepBoth); err != nil {
+		t.Fatal(err)
+	}
+	if have := usage.bytes[1]; have != int64(len(data)) {
+		t.Errorf("Wrong usage after upload. Have: %d, Want: %d", have, len(data))
+	}
+	if db.images[0].Size != int64(len(data)) {
+		t.Errorf("Wrong image size. Have: %d, Want: %d", db.images[0].Size, len(data))
+	}
+
+	err := is.Create(1, io.NopCloser(bytes.NewReader(data)), "b.png", DuplicateKeepBoth)
+	if imgErr, ok := err.(errorsModel.ImageError); !ok || imgErr.Err != errorsModel.ErrStorageQuotaExceeded {
+		t.Errorf("Have: %v, Want: %v", err, errorsModel.ErrStorageQuotaExceeded)
+	}
+	if len(db.images) != 1 {
+		t.Errorf("Expected the image over quota not to be stored")
+	}
+
+	image := db.images[0]
+	if err := is.Delete(&image); err != nil {
+		t.Fatal(err)
+	}
+	if have := usage.bytes[1]; have != 0 {
+		t.Errorf("Wrong usage after delete. Have: %d, Want: 0", have)
+	}
+}
+
+func TestBackfillUsage(t *testing.T) {
+	is, db, dir := testImageService(t)
+	usage := is.usage.(*fakeUsageDB)
+	if err := os.MkdirAll(filepath.Join(dir, "galleries", "1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "galleries", "1", "old.png"), make([]byte, 300), 0644); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&Image{GalleryID: 1, StoredName: "old.png"})
+	db.Create(&Image{GalleryID: 1, StoredName: "new.png", Size: 200})
+	usage.bytes[1] = 200
+	for i := 0; i < 2; i++ {
+		if err := is.BackfillUsage(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if db.images[0].Size != 300 {
+		t.Errorf("Wrong image size. Have: %d, Want: 300", db.images[0].Size)
+	}
+	if have := usage.bytes[1]; have != 500 {
+		t.Errorf("Wrong usage. Have: %d, Want: 500", have)
+	}
+}
+
+func TestCheckUpload(t *testing.T) {
+	is, _, _ := testImageService(t)
+	is.usage.(*fakeUsageDB).bytes[1] = 900
+	is.limits = Limits{MaxFileSize: 500, MaxAccountSize: 1000}
+	tests := map[int64]error{
+		100: nil,
+		101: errorsModel.ErrStorageQuotaExceeded,
+		501: errorsModel.ErrFileTooLarge,
+	}
+	for size, want := range tests {
+		if err := is.CheckUpload(1, size); err != want {
+			t.Errorf("%d bytes: Have: %v, Want: %v", size, err, want)
+		}
+	}
+	if max, _ := is.MaxUploadSize(1); max != 100 {
+		t.Errorf("Wrong max upload size. Have: %d, Want: 100", max)
+	}
+	is.limits = Limits{}
+	if err := is.CheckUpload(1, 1<<40); err != nil {
+		t.Errorf("Expected no limit, Got: %v", err)
+	}
+}
+
+func TestCreateDuplicates(t *testing.T) {
+	data := encodePNG(t, 3, 3)
+	create := func(is *imageService, filename string, duplicates DuplicatePolicy) error {
+		return is.Create(1, io.NopCloser(bytes.NewReader(data)), filename, duplicates)
+	}
+
+	is, db, _ := testImageService(t)
+	if err := create(is, "first.png", DuplicateSkip); err != nil {
+		t.Fatal(err)
+	}
+	err := create(is, "again.png", DuplicateSkip)
+	if imgErr, ok := err.(errorsModel.ImageError); !ok || imgErr.Err != errorsModel.ErrImageDuplicate {
+		t.Errorf("skip: Have: %v, Want: %v", err, errorsModel.ErrImageDuplicate)
+	}
+	if len(db.images) != 1 {
+		t.Errorf("skip: Wrong number of images. Have: %d, Want: 1", len(db.images))
+	}
+	// The same file in another gallery isn't a duplicate.
+	if err := is.Create(2, io.NopCloser(bytes.NewReader(data)), "other.png", DuplicateSkip); err != nil {
+		t.Errorf("skip: Expected other galleries to be ignored, Got: %v", err)
+	}
+
+	if err := create(is, "copy.png", DuplicateKeepBoth); err != nil {
+		t.Fatal(err)
+	}
+	if have, _ := db.ByGalleryID(1); len(have) != 2 {
+		t.Errorf("keep: Wrong number of images. Have: %d, Want: 2", len(have))
+	}
+
+	usage := is.usage.(*fakeUsageDB)
+	is.limits = Limits{MaxAccountSize: usage.bytes[1]}
+	if err := create(is, "replacement.png", DuplicateReplace); err != nil {
+		t.Fatalf("replace: Expected the space of replaced images to be reused, Got: %v", err)
+	}
+	images, _ := db.ByGalleryID(1)
+	if len(images) != 1 || images[0].Filename != "replacement.png" {
+		t.Errorf("replace: Expected only the new image to be left, Got: %v", images)
+	}
+	if want := 2 * int64(len(data)); usage.bytes[1] != want {
+		t.Errorf("replace: Wrong usage. Have: %d, Want: %d", usage.bytes[1], want)
+	}
+}
+
+func TestCreateReplaceKeepsPlace(t *testing.T) {
+	data := encodePNG(t, 3, 3)
+	is, db, _ := testImageService(t)
+	for _, name := range []string{"first.png", "second.png"} {
+		if err := is.Create(1, io.NopCloser(bytes.NewReader(encodePNG(t, len(name), 2))), name, DuplicateSkip); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := is.Create(1, io.NopCloser(bytes.NewReader(data)), "original.png", DuplicateSkip); err != nil {
+		t.Fatal(err)
+	}
+	original := db.images[2]
+	original.Position = 1
+	original.Caption = "Sunset"
+	original.AltText = "The sun going down over the sea"
+	original.Transforms = "rotate=90"
+	db.Update(&original)
+
+	if err := is.Create(1, io.NopCloser(bytes.NewReader(data)), "replacement.png", DuplicateReplace); err != nil {
+		t.Fatal(err)
+	}
+	if len(db.images) != 3 {
+		t.Fatalf("Wrong number of images. Have: %d, Want: 3", len(db.images))
+	}
+	have := db.images[2]
+	if have.ID != original.ID || have.Filename != "replacement.png" {
+		t.Errorf("Expected the image to be replaced in place. Have: %d %s, Want: %d replacement.png", have.ID, have.Filename, original.ID)
+	}
+	if have.Position != 1 || have.Caption != original.Caption || have.AltText != original.AltText || have.Transforms != original.Transforms {
+		t.Errorf("Have: %+v, Want: %+v", have, original)
+	}
+}
+
+func TestParseDuplicatePolicy(t *testing.T) {
+	tests := map[string]DuplicatePolicy{
+		"skip":    DuplicateSkip,
+		"keep":    DuplicateKeepBoth,
+		"replace": DuplicateReplace,
+		"":        DuplicateSkip,
+		"delete":  DuplicateSkip,
+	}
+	for name, want := range tests {
+		if have := ParseDuplicatePolicy(name); have != want {
+			t.Errorf("%q: Have: %v, Want: %v", name, have, want)
+		}
+	}
+}
+
+func TestCreateAddsImagesAtTheEnd(t *testing.T) {
+	is, db, _ := testImageService(t)
+	db.images = []Image{{GalleryID: 1, Position: 7}, {GalleryID: 2, Position: 20}}
+	if err := is.Create(1, io.NopCloser(bytes.NewReader(encodePNG(t, 2, 2))), "new.png", DuplicateKeepBoth); err != nil {
+		t.Fatal(err)
+	}
+	if have := db.images[2].Position; have != 8 {
+		t.Errorf("Wrong position. Have: %d, Want: %d", have, 8)
+	}
+}
+
+func TestReorder(t *testing.T) {
+	newService := func() (*imageService, *fakeImageDB) {
+		is, db, _ := testImageService(t)
+		for i := 1; i <= 4; i++ {
+			db.images = append(db.images, Image{GalleryID: 1, Position: i})
+			db.images[i-1].ID = uint(i)
+		}
+		db.images = append(db.images, Image{GalleryID: 2, Position: 1})
+		db.images[4].ID = 5
+		return is, db
+	}
+	tests := []struct {
+		name     string
+		imageIDs []uint
+		want     []uint
+		err      error
+	}{
+		{"all", []uint{4, 2, 3, 1}, []uint{4, 2, 3, 1}, nil},
+		{"some", []uint{3, 1}, []uint{3, 1, 2, 4}, nil},
+		{"repeated", []uint{2, 2, 1}, []uint{2, 1, 3, 4}, nil},
+		{"other gallery", []uint{5, 1}, []uint{1, 2, 3, 4}, errorsModel.ErrImageNotFound},
+	}
+	for _, test := range tests {
+		is, db := newService()
+		if err := is.Reorder(1, test.imageIDs); err != test.err {
+			t.Errorf("%s: Have: %v, Want: %v", test.name, err, test.err)
+		}
+		images, _ := db.ByGalleryID(1)
+		var have []uint
+		for _, image := range images {
+			have = append(have, image.ID)
+		}
+		if fmt.Sprint(have) != fmt.Sprint(test.want) {
+			t.Errorf("%s: Have: %v, Want: %v", test.name, have, test.want)
+		}
+	}
+}
+
+func TestImageAlt(t *testing.T) {
+	tests := []struct {
+		image Image
+		want  string
+	}{
+		{Image{Filename: "beach.jpg", Caption: "Our day out", AltText: "Two dogs on a beach"}, "Two dogs on a beach"},
+		{Image{Filename: "beach.jpg", Caption: "Our day out"}, "Our day out"},
+		{Image{Filename: "beach.jpg"}, "beach"},
+	}
+	for _, test := range tests {
+		if have := test.image.Alt(); have != test.want {
+			t.Errorf("Have: %q, Want: %q", have, test.want)
+		}
+	}
+}
+
+func TestImportLegacy(t *testing.T) {
+	is, db, dir := testImageService(t, "new1", "new2")
+	usage := is.usage.(*fakeUsageDB)
+	folder := filepath.Join(dir, "galleries", "1")
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]int{"beach.jpg": 100, "notes.txt": 10, "tracked.png": 50, "Sunset.PNG": 200}
+	for name, size := range files {
+		if err := os.WriteFile(filepath.Join(folder, name), make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Create(&Image{GalleryID: 1, StoredName: "tracked.png", Size: 50, Position: 1})
+	for i := 0; i < 2; i++ {
+		if err := is.ImportLegacy(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []Image{
+		{GalleryID: 1, Filename: "Sunset.PNG", StoredName: "new1.png", Size: 200, Position: 2},
+		{GalleryID: 1, Filename: "beach.jpg", StoredName: "new2.jpg", Size: 100, Position: 3},
+	}
+	if len(db.images) != 3 {
+		t.Fatalf("Wrong number of images. Have: %d, Want: 3", len(db.images))
+	}
+	for i, w := range want {
+		have := db.images[i+1]
+		if have.Filename != w.Filename || have.StoredName != w.StoredName || have.Size != w.Size || have.Position != w.Position {
+			t.Errorf("Have: %+v, Want: %+v", have, w)
+		}
+		if _, err := os.Stat(filepath.Join(folder, w.Filename)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be moved, Got: %v", w.Filename, err)
+		}
+		if _, err := os.Stat(filepath.Join(folder, w.StoredName)); err != nil {
+			t.Errorf("Expected %s to be stored: %v", w.StoredName, err)
+		}
+	}
+	if have := usage.bytes[1]; have != 300 {
+		t.Errorf("Wrong usage. Have: %d, Want: 300", have)
+	}
+	if _, err := os.Stat(filepath.Join(folder, "notes.txt")); err != nil {
+		t.Errorf("Expected other files to be left alone: %v", err)
+	}
+}
@@ -0,0 +1,204 @@
+package imagesModel
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"lenslocked/imaging"
+	"lenslocked/models/errorsModel"
+)
+
+// MAX_IMAGE_PIXELS is the largest number of pixels an uploaded image may
+// decode to. A small, highly compressed file can expand to gigabytes of
+// memory when decoded, so anything larger than this is rejected before
+// the pixel data is ever touched.
+const MAX_IMAGE_PIXELS = 50_000_000
+
+// imageFormat describes one of the image types we accept.
+type imageFormat struct {
+	// extensions are the file extensions allowed for this format. The
+	// first is used when the upload's own can't be kept.
+	extensions []string
+	// web is set for formats every browser can show. Images in any other
+	// format are only ever sent as derivatives.
+	web bool
+}
+
+// imageFormats maps the name imaging.Sniff reports for each accepted
+// format to its imageFormat. Most camera RAW formats are TIFF files with
+// a preview inside, and are shown using the preview.
+var imageFormats = map[string]imageFormat{
+	"jpeg": {extensions: []string{"jpg", "jpeg"}, web: true},
+	"png":  {extensions: []string{"png"}, web: true},
+	"gif":  {extensions: []string{"gif"}, web: true},
+	"webp": {extensions: []string{"webp"}, web: true},
+	"heic": {extensions: []string{"heic", "heif"}},
+	"tiff": {extensions: []string{"tif", "tiff", "dng", "cr2", "nef", "nrw", "arw", "sr2", "orf", "rw2", "pef", "srw", "3fr", "erf", "kdc", "iiq"}},
+	"raf":  {extensions: []string{"raf"}},
+}
+
+// imageValidator is a chained type that validates uploaded image data
+// before it is passed to the final ImageService implementation.
+type imageValidator struct {
+	ImageService
+}
+
+// imageValidationFunction is a function signature given to all image
+// validation functions so that it is easier to iterate over all the
+// image validation functions and call them in a loop.
+type imageValidationFunction func(data []byte, filename string) error
+
+// Creates a new instance of the imageValidator
+func newImageValidator(is ImageService) *imageValidator {
+	return &imageValidator{
+		ImageService: is,
+	}
+}
+
+// Create reads the upload and makes sure it really is an image we support
+// before storing it. Problems with the file itself are returned as an
+// errorsModel.ImageError so the user can tell which file was rejected.
+//
+// Reading stops as soon as the file is larger than the user is allowed to
+// upload, rather than once all of it has arrived.
+func (iv *imageValidator) Create(galleryID uint, r io.ReadCloser, filename string, duplicates DuplicatePolicy) error {
+	defer r.Close()
+	max, err := iv.MaxUploadSize(galleryID)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(io.LimitReader(r, max+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) > max {
+		err := iv.CheckUpload(galleryID, int64(len(data)))
+		if err == nil {
+			err = errorsModel.ErrStorageQuotaExceeded
+		}
+		return errorsModel.ImageError{Filename: filename, Err: err}
+	}
+	if err := iv.runImageValidationFunctions(
+		data,
+		filename,
+		iv.contentTypeSniffer,
+		iv.extensionMatcher,
+		iv.headerDecoder,
+		iv.decoderChecker,
+	); err != nil {
+		return errorsModel.ImageError{Filename: filename, Err: err}
+	}
+	return iv.ImageService.Create(galleryID, io.NopCloser(bytes.NewReader(data)), filename, duplicates)
+}
+
+// Update tidies up the caption and alt text and makes sure they aren't
+// too long before the image is saved.
+func (iv *imageValidator) Update(image *Image) error {
+	image.Caption = strings.TrimSpace(image.Caption)
+	// Alt text is read out as a single line.
+	image.AltText = strings.Join(strings.Fields(image.AltText), " ")
+	if utf8.RuneCountInString(image.Caption) > MAX_CAPTION_LENGTH {
+		return errorsModel.ErrCaptionTooLong
+	}
+	if utf8.RuneCountInString(image.AltText) > MAX_ALT_TEXT_LENGTH {
+		return errorsModel.ErrAltTextTooLong
+	}
+	return iv.ImageService.Update(image)
+}
+
+// Transform makes sure the edits are ones we can apply, and that there
+// aren't too many of them, before they are saved.
+func (iv *imageValidator) Transform(image *Image, transforms Transforms) error {
+	if len(transforms) > MAX_TRANSFORMS {
+		return errorsModel.ErrTooManyTransforms
+	}
+	for _, t := range transforms {
+		if err := t.Validate(); err != nil {
+			return err
+		}
+	}
+	return iv.ImageService.Transform(image, transforms)
+}
+
+// SaveWatermark makes sure an uploaded watermark is a PNG that isn't too
+// large to draw over every image before it is stored.
+func (iv *imageValidator) SaveWatermark(galleryID uint, r io.Reader) (string, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MAX_WATERMARK_SIZE+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > MAX_WATERMARK_SIZE {
+		return "", errorsModel.ErrWatermarkImageTooLarge
+	}
+	cfg, err := png.DecodeConfig(bytes.NewReader(data))
+	if err != nil || cfg.Width <= 0 || cfg.Height <= 0 {
+		return "", errorsModel.ErrWatermarkImageInvalid
+	}
+	if cfg.Width > MAX_WATERMARK_DIMENSION || cfg.Height > MAX_WATERMARK_DIMENSION {
+		return "", errorsModel.ErrWatermarkImageTooLarge
+	}
+	return iv.ImageService.SaveWatermark(galleryID, bytes.NewReader(data))
+}
+
+// runImageValidationFunctions calls each of the validation functions on
+// the uploaded data and returns the first error encountered.
+func (iv *imageValidator) runImageValidationFunctions(data []byte, filename string, fns ...imageValidationFunction) error {
+	for _, fn := range fns {
+		if err := fn(data, filename); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// contentTypeSniffer looks at the magic bytes at the start of the file
+// and rejects anything that isn't one of our image formats. This is what
+// stops an HTML or SVG document renamed to .png from being served as-is.
+func (iv *imageValidator) contentTypeSniffer(data []byte, filename string) error {
+	if _, ok := imageFormats[imaging.Sniff(data)]; !ok {
+		return errorsModel.ErrImageTypeUnsupported
+	}
+	return nil
+}
+
+// extensionMatcher requires the file extension to agree with the sniffed
+// format, since the extension decides how the file is served.
+func (iv *imageValidator) extensionMatcher(data []byte, filename string) error {
+	ext := strings.TrimPrefix(filepath.Ext(filename), ".")
+	if !contains(imageFormats[imaging.Sniff(data)].extensions, ext) {
+		return errorsModel.ErrImageTypeUnsupported
+	}
+	return nil
+}
+
+// headerDecoder fully decodes the image header. Files whose header is
+// corrupt, or whose dimensions would make them a decompression bomb,
+// are rejected here.
+func (iv *imageValidator) headerDecoder(data []byte, filename string) error {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || format != imaging.Sniff(data) {
+		return errorsModel.ErrImageInvalid
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return errorsModel.ErrImageInvalid
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > MAX_IMAGE_PIXELS {
+		return errorsModel.ErrImageTooLarge
+	}
+	return nil
+}
+
+// decoderChecker rejects images in formats that need an external program
+// to decode when the program isn't installed, since nothing could be shown
+// for them.
+func (iv *imageValidator) decoderChecker(data []byte, filename string) error {
+	if !imaging.CanDecode(data) {
+		return errorsModel.ErrImageTypeUnsupported
+	}
+	return nil
+}
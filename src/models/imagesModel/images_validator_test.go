@@ -0,0 +1,236 @@
+package imagesModel
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+
+	"lenslocked/models/errorsModel"
+)
+
+// fakeImageService records the images passed to it by the validator.
+// Files may be up to maxSize bytes, or any size if it is zero.
+type fakeImageService struct {
+	ImageService
+	created []string
+	updated []Image
+	maxSize int64
+}
+
+func (fs *fakeImageService) Update(image *Image) error {
+	fs.updated = append(fs.updated, *image)
+	return nil
+}
+
+func (fs *fakeImageService) MaxUploadSize(galleryID uint) (int64, error) {
+	if fs.maxSize == 0 {
+		return 1 << 30, nil
+	}
+	return fs.maxSize, nil
+}
+
+func (fs *fakeImageService) CheckUpload(galleryID uint, size int64) error {
+	if fs.maxSize > 0 && size > fs.maxSize {
+		return errorsModel.ErrFileTooLarge
+	}
+	return nil
+}
+
+func (fs *fakeImageService) Create(galleryID uint, r io.ReadCloser, filename string, duplicates DuplicatePolicy) error {
+	fs.created = append(fs.created, filename)
+	return r.Close()
+}
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodeJPEG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, w, h)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodeGIF(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := gif.Encode(&buf, image.NewPaletted(image.Rect(0, 0, w, h), color.Palette{color.Black}), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// encodeRAF returns a Fujifilm RAW file with a w by h JPEG preview, which
+// is all of it that is ever read.
+func encodeRAF(t *testing.T, w, h int) []byte {
+	t.Helper()
+	preview := encodeJPEG(t, w, h)
+	header := make([]byte, 100)
+	copy(header, "FUJIFILMCCD-RAW 0201FF383501")
+	binary.BigEndian.PutUint32(header[84:], uint32(len(header)))
+	binary.BigEndian.PutUint32(header[88:], uint32(len(preview)))
+	return append(header, preview...)
+}
+
+// pngBomb returns a PNG whose header claims enormous dimensions. Only the
+// header is valid, which is all the validator should ever look at.
+func pngBomb(t *testing.T) []byte {
+	t.Helper()
+	data := encodePNG(t, 1, 1)
+	// Overwrite the IHDR width and height with 100,000 x 100,000 and fix
+	// up the chunk's CRC so the header still decodes.
+	copy(data[16:24], []byte{0x00, 0x01, 0x86, 0xA0, 0x00, 0x01, 0x86, 0xA0})
+	binary.BigEndian.PutUint32(data[29:33], crc32.ChecksumIEEE(data[12:29]))
+	return data
+}
+
+func TestImageValidatorAcceptsImages(t *testing.T) {
+	fs := &fakeImageService{}
+	iv := newImageValidator(fs)
+	uploads := map[string][]byte{
+		"photo.png":  encodePNG(t, 10, 10),
+		"photo.jpg":  encodeJPEG(t, 10, 10),
+		"photo.JPEG": encodeJPEG(t, 10, 10),
+		"photo.gif":  encodeGIF(t, 10, 10),
+		"photo.raf":  encodeRAF(t, 10, 10),
+	}
+	for name, data := range uploads {
+		if err := iv.Create(1, io.NopCloser(bytes.NewReader(data)), name, DuplicateSkip); err != nil {
+			t.Errorf("Expected %s to be accepted, Got: %s", name, err)
+		}
+	}
+	if len(fs.created) != len(uploads) {
+		t.Errorf("Expected every image to be stored. Have: %d, Want: %d", len(fs.created), len(uploads))
+	}
+}
+
+func TestImageValidatorRejectsBadUploads(t *testing.T) {
+	uploads := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"page.png", []byte("<!DOCTYPE html><html><script>alert(1)</script></html>"), errorsModel.ErrImageTypeUnsupported},
+		{"logo.png", []byte(`<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"></svg>`), errorsModel.ErrImageTypeUnsupported},
+		{"empty.jpg", []byte{}, errorsModel.ErrImageTypeUnsupported},
+		{"photo.html", encodePNG(t, 10, 10), errorsModel.ErrImageTypeUnsupported},
+		{"photo.jpg", encodePNG(t, 10, 10), errorsModel.ErrImageTypeUnsupported},
+		{"noext", encodePNG(t, 10, 10), errorsModel.ErrImageTypeUnsupported},
+		{"truncated.jpg", encodeJPEG(t, 10, 10)[:4], errorsModel.ErrImageInvalid},
+		{"bomb.png", pngBomb(t), errorsModel.ErrImageTooLarge},
+		{"photo.gif", encodeRAF(t, 10, 10), errorsModel.ErrImageTypeUnsupported},
+		// Decoding HEIC needs a program that isn't installed for tests.
+		{"photo.heic", heicHeader(100, 100), errorsModel.ErrImageTypeUnsupported},
+	}
+	for _, u := range uploads {
+		fs := &fakeImageService{}
+		iv := newImageValidator(fs)
+		err := iv.Create(1, io.NopCloser(bytes.NewReader(u.data)), u.name, DuplicateSkip)
+		imgErr, ok := err.(errorsModel.ImageError)
+		if !ok {
+			t.Errorf("Expected an ImageError for %s, Got: %v", u.name, err)
+			continue
+		}
+		if imgErr.Filename != u.name || imgErr.Err != u.want {
+			t.Errorf("Wrong error for %s. Have: %s, Want: %s", u.name, imgErr.Err, u.want)
+		}
+		if len(fs.created) != 0 {
+			t.Errorf("Expected %s not to be stored", u.name)
+		}
+	}
+}
+
+// heicHeader returns the start of a HEIC file that says it is w by h.
+func heicHeader(w, h uint32) []byte {
+	data := []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic\x00\x00\x00\x14ispe\x00\x00\x00\x00")
+	data = binary.BigEndian.AppendUint32(data, w)
+	return binary.BigEndian.AppendUint32(data, h)
+}
+
+func TestImageErrorsArePublic(t *testing.T) {
+	errs := errorsModel.ImageErrors{
+		{Filename: "page.png", Err: errorsModel.ErrImageTypeUnsupported},
+		{Filename: "bomb.png", Err: errorsModel.ErrImageTooLarge},
+	}
+	want := "page.png: File is not a supported image type. bomb.png: Image dimensions are too large."
+	if have := errs.Public(); have != want {
+		t.Errorf("Wrong public message. Have: %s, Want: %s", have, want)
+	}
+}
+
+// countingReader counts how many bytes have been read from it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+func TestImageValidatorStopsReadingOverLimit(t *testing.T) {
+	fs := &fakeImageService{maxSize: 1000}
+	iv := newImageValidator(fs)
+	r := &countingReader{r: bytes.NewReader(make([]byte, 10<<20))}
+	err := iv.Create(1, io.NopCloser(r), "huge.png", DuplicateSkip)
+	if imgErr, ok := err.(errorsModel.ImageError); !ok || imgErr.Err != errorsModel.ErrFileTooLarge {
+		t.Errorf("Have: %v, Want: %v", err, errorsModel.ErrFileTooLarge)
+	}
+	if r.n > 1001 {
+		t.Errorf("Expected reading to stop at the limit, Read: %d bytes", r.n)
+	}
+	if len(fs.created) != 0 {
+		t.Errorf("Expected the file not to be stored")
+	}
+}
+
+func TestImageValidatorUpdate(t *testing.T) {
+	fs := &fakeImageService{}
+	iv := newImageValidator(fs)
+	image := &Image{Caption: "  A day at the beach \n", AltText: " Two dogs\n running  on sand "}
+	if err := iv.Update(image); err != nil {
+		t.Fatal(err)
+	}
+	if want := "A day at the beach"; image.Caption != want {
+		t.Errorf("Have: %q, Want: %q", image.Caption, want)
+	}
+	if want := "Two dogs running on sand"; image.AltText != want {
+		t.Errorf("Have: %q, Want: %q", image.AltText, want)
+	}
+	if len(fs.updated) != 1 {
+		t.Errorf("Expected the image to be saved")
+	}
+
+	tests := []struct {
+		image Image
+		want  error
+	}{
+		{Image{Caption: strings.Repeat("é", MAX_CAPTION_LENGTH)}, nil},
+		{Image{Caption: strings.Repeat("a", MAX_CAPTION_LENGTH+1)}, errorsModel.ErrCaptionTooLong},
+		{Image{AltText: strings.Repeat("é", MAX_ALT_TEXT_LENGTH)}, nil},
+		{Image{AltText: strings.Repeat("a", MAX_ALT_TEXT_LENGTH+1)}, errorsModel.ErrAltTextTooLong},
+	}
+	for _, test := range tests {
+		if err := iv.Update(&test.image); err != test.want {
+			t.Errorf("Have: %v, Want: %v", err, test.want)
+		}
+	}
+}
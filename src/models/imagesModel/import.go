@@ -0,0 +1,131 @@
+package imagesModel
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"lenslocked/models/errorsModel"
+)
+
+const (
+	// MAX_IMPORT_ENTRIES is the most files an imported archive can have.
+	MAX_IMPORT_ENTRIES = 1000
+
+	// MAX_IMPORT_SIZE is the most that the files in an imported archive
+	// can add up to once they are extracted. The same limit applies to the
+	// archive itself. The bit shift converts to GB.
+	MAX_IMPORT_SIZE = 4 << 30
+
+	// MAX_IMPORT_DEPTH is how many folders deep a file in an imported
+	// archive can be.
+	MAX_IMPORT_DEPTH = 8
+)
+
+// ImportArchive stores each image in a ZIP archive in the gallery through
+// the ImageService, so every one of them is validated, checked for
+// duplicates and counted against the owner's storage like any other
+// upload. The result for each file is returned with the file's path in
+// the archive as the image's Filename.
+//
+// The archive is rejected as a whole if it has more than
+// MAX_IMPORT_ENTRIES files or they add up to more than MAX_IMPORT_SIZE.
+// Folders, hidden files and the resource forks macOS adds to archives are
+// skipped without being reported.
+func ImportArchive(is ImageService, galleryID uint, r io.Reader, duplicates DuplicatePolicy) (BatchResults, error) {
+	// Reading a ZIP archive needs random access to it, so it is copied to
+	// a temporary file first.
+	f, err := os.CreateTemp("", "lenslocked-import-*.zip")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	size, err := io.Copy(f, io.LimitReader(r, MAX_IMPORT_SIZE+1))
+	if err != nil {
+		return nil, err
+	}
+	if size > MAX_IMPORT_SIZE {
+		return nil, errorsModel.ErrArchiveTooLarge
+	}
+	zr, err := zip.NewReader(f, size)
+	if err != nil {
+		return nil, errorsModel.ErrArchiveInvalid
+	}
+	if len(zr.File) > MAX_IMPORT_ENTRIES {
+		return nil, errorsModel.ErrArchiveTooManyEntries
+	}
+	// The sizes in the archive are only what it claims. The zip package
+	// stops reading a file once it is larger than its claimed size, so
+	// checking the claimed total is enough.
+	var total uint64
+	for _, entry := range zr.File {
+		total += entry.UncompressedSize64
+		if total > MAX_IMPORT_SIZE {
+			return nil, errorsModel.ErrArchiveTooLarge
+		}
+	}
+
+	var results BatchResults
+	for _, entry := range zr.File {
+		name := strings.ReplaceAll(entry.Name, "\\", "/")
+		if skipEntry(entry, name) {
+			continue
+		}
+		image := Image{Filename: name}
+		if err := checkEntryPath(name); err != nil {
+			results = append(results, BatchResult{Image: image, Err: err})
+			continue
+		}
+		rc, err := entry.Open()
+		if err == nil {
+			// Only the name of the file is kept, without its folders.
+			err = is.Create(galleryID, rc, path.Base(name), duplicates)
+		}
+		if imgErr, ok := err.(errorsModel.ImageError); ok {
+			err = imgErr.Err
+		}
+		results = append(results, BatchResult{Image: image, Err: err})
+	}
+	return results, nil
+}
+
+// skipEntry reports whether an entry in an archive isn't something that
+// could be an image the user meant to import.
+func skipEntry(entry *zip.File, name string) bool {
+	if entry.FileInfo().IsDir() || strings.HasSuffix(name, "/") {
+		return true
+	}
+	for _, segment := range strings.Split(name, "/") {
+		if segment == "__MACOSX" || (strings.HasPrefix(segment, ".") && segment != "." && segment != "..") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkEntryPath rejects paths that would point outside of the archive if
+// it were extracted, which is how zip-slip attacks overwrite files. Files
+// are never written under these names, but they are refused anyway so
+// nothing else can ever be tricked by them.
+func checkEntryPath(name string) error {
+	if name == "" || strings.HasPrefix(name, "/") || strings.ContainsRune(name, 0) {
+		return errorsModel.ErrArchiveEntryUnsafe
+	}
+	// Windows drive letters such as C: make a path absolute too.
+	if len(name) >= 2 && name[1] == ':' {
+		return errorsModel.ErrArchiveEntryUnsafe
+	}
+	segments := strings.Split(name, "/")
+	for _, segment := range segments {
+		if segment == ".." {
+			return errorsModel.ErrArchiveEntryUnsafe
+		}
+	}
+	if len(segments)-1 > MAX_IMPORT_DEPTH {
+		return errorsModel.ErrArchiveEntryTooDeep
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package imagesModel
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+
+	"lenslocked/models/errorsModel"
+)
+
+// zipOf returns a ZIP archive with a file for each of the provided names.
+// Names ending in .png get a small PNG and everything else some text.
+func zipOf(t *testing.T, names ...string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for i, name := range names {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasSuffix(name, "/") {
+			continue
+		}
+		if strings.HasSuffix(name, ".png") {
+			w.Write(encodePNG(t, i+1, 2))
+		} else {
+			w.Write([]byte("not an image"))
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestImportArchive(t *testing.T) {
+	is, db, _ := testImageService(t)
+	archive := zipOf(t,
+		"first.png",
+		"holiday/",
+		"holiday/day one/second.png",
+		"notes.txt",
+		"../../escape.png",
+		"/etc/absolute.png",
+		"C:\\Windows\\drive.png",
+		"a/b/c/d/e/f/g/h/i/deep.png",
+		"__MACOSX/holiday/._second.png",
+		".DS_Store",
+	)
+	results, err := ImportArchive(newImageValidator(is), 1, archive, DuplicateKeepBoth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]error{
+		"first.png":                  nil,
+		"holiday/day one/second.png": nil,
+		"notes.txt":                  errorsModel.ErrImageTypeUnsupported,
+		"../../escape.png":           errorsModel.ErrArchiveEntryUnsafe,
+		"/etc/absolute.png":          errorsModel.ErrArchiveEntryUnsafe,
+		"C:/Windows/drive.png":       errorsModel.ErrArchiveEntryUnsafe,
+		"a/b/c/d/e/f/g/h/i/deep.png": errorsModel.ErrArchiveEntryTooDeep,
+	}
+	if len(results) != len(want) {
+		t.Errorf("Wrong number of results. Have: %d, Want: %d", len(results), len(want))
+	}
+	for _, result := range results {
+		wantErr, ok := want[result.Image.Filename]
+		if !ok {
+			t.Errorf("Unexpected result for %q", result.Image.Filename)
+			continue
+		}
+		if result.Err != wantErr {
+			t.Errorf("%s: Have: %v, Want: %v", result.Image.Filename, result.Err, wantErr)
+		}
+	}
+	if len(db.images) != 2 || db.images[0].Filename != "first.png" || db.images[1].Filename != "second.png" {
+		t.Errorf("Expected the two images to be stored by name, Got: %v", db.images)
+	}
+}
+
+func TestImportArchiveRejects(t *testing.T) {
+	tooMany := make([]string, MAX_IMPORT_ENTRIES+1)
+	for i := range tooMany {
+		tooMany[i] = "folder/"
+	}
+
+	// An archive whose files claim to add up to more than the limit.
+	var tooLarge bytes.Buffer
+	zw := zip.NewWriter(&tooLarge)
+	for i := 0; i < 2; i++ {
+		zw.CreateRaw(&zip.FileHeader{
+			Name:               "huge.png",
+			Method:             zip.Deflate,
+			UncompressedSize64: MAX_IMPORT_SIZE/2 + 1,
+		})
+	}
+	zw.Close()
+
+	tests := []struct {
+		name    string
+		archive *bytes.Buffer
+		want    error
+	}{
+		{"not a zip", bytes.NewBufferString("just some text"), errorsModel.ErrArchiveInvalid},
+		{"too many entries", zipOf(t, tooMany...), errorsModel.ErrArchiveTooManyEntries},
+		{"too large", &tooLarge, errorsModel.ErrArchiveTooLarge},
+	}
+	for _, test := range tests {
+		is, db, _ := testImageService(t)
+		_, err := ImportArchive(newImageValidator(is), 1, test.archive, DuplicateKeepBoth)
+		if err != test.want {
+			t.Errorf("%s: Have: %v, Want: %v", test.name, err, test.want)
+		}
+		if len(db.images) != 0 {
+			t.Errorf("%s: Expected nothing to be stored, Got: %v", test.name, db.images)
+		}
+	}
+}
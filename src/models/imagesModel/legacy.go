@@ -0,0 +1,152 @@
+package imagesModel
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"lenslocked/imaging"
+	"lenslocked/models/errorsModel"
+	"lenslocked/storage"
+)
+
+// legacyExtensions are the files that were shown in a gallery before
+// images were kept in the database.
+var legacyExtensions = []string{"jpg", "jpeg", "png"}
+
+// ImportLegacy gives a record to every image that was stored in a
+// gallery's folder before images were kept in the database, which would
+// otherwise no longer be shown. Like any other upload, each file is moved
+// to a random name, so the names users gave them never stay part of a
+// storage key. Files that already have a record are left alone, so it is
+// safe to run every time the app starts.
+//
+// It carries on past files that can't be imported, so one bad file
+// doesn't stop the rest, and returns the first error encountered.
+func (is *imageService) ImportLegacy() error {
+	objects, err := is.storage.List("galleries/")
+	if err != nil {
+		return err
+	}
+	byGallery := map[uint][]storage.ObjectInfo{}
+	var galleryIDs []uint
+	for _, object := range objects {
+		galleryID, name, ok := legacyKey(object.Key)
+		if !ok || !contains(legacyExtensions, strings.TrimPrefix(filepath.Ext(name), ".")) {
+			continue
+		}
+		if _, seen := byGallery[galleryID]; !seen {
+			galleryIDs = append(galleryIDs, galleryID)
+		}
+		byGallery[galleryID] = append(byGallery[galleryID], object)
+	}
+	var firstErr error
+	for _, galleryID := range galleryIDs {
+		if err := is.importLegacyGallery(galleryID, byGallery[galleryID]); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// importLegacyGallery imports the files in a gallery's folder that no
+// image is stored as, after the gallery's existing images.
+func (is *imageService) importLegacyGallery(galleryID uint, objects []storage.ObjectInfo) error {
+	images, err := is.db.ByGalleryID(galleryID)
+	if err != nil {
+		return err
+	}
+	stored := make(map[string]bool, len(images))
+	for _, image := range images {
+		stored[image.StoredName] = true
+	}
+	position, err := is.db.MaxPosition(galleryID)
+	if err != nil {
+		return err
+	}
+	var firstErr error
+	for _, object := range objects {
+		_, name, _ := legacyKey(object.Key)
+		if stored[name] {
+			continue
+		}
+		imported, err := is.importLegacyFile(galleryID, object.Key, name, position+1)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if imported {
+			position++
+		}
+	}
+	return firstErr
+}
+
+// importLegacyFile copies the file to a random name and records it with
+// the name it was stored under as its filename. Its size is counted
+// towards the owner's usage whatever their limit, since the file is
+// already stored. The old file is only deleted once the image has been
+// recorded, so a failure part of the way through never loses it.
+func (is *imageService) importLegacyFile(galleryID uint, key, name string, position int) (bool, error) {
+	r, err := is.storage.Get(key)
+	if err != nil {
+		return false, err
+	}
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return false, err
+	}
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+	storedName, err := is.unusedName(galleryID, ext)
+	if err != nil {
+		return false, err
+	}
+	size := int64(len(data))
+	if err := is.usage.Reserve(galleryID, size, 0); err != nil {
+		// With no limit, nothing can be reserved only when the gallery
+		// itself is gone, and then there is nowhere to show the file.
+		if err == errorsModel.ErrStorageQuotaExceeded {
+			return false, nil
+		}
+		return false, err
+	}
+	newKey := is.key(galleryID, storedName)
+	if err := is.storage.Put(newKey, bytes.NewReader(data)); err != nil {
+		is.usage.Release(galleryID, size)
+		return false, err
+	}
+	sum := sha256.Sum256(data)
+	image := &Image{
+		GalleryID:  galleryID,
+		Filename:   sanitizeFilename(name),
+		StoredName: storedName,
+		Checksum:   hex.EncodeToString(sum[:]),
+		Size:       size,
+		Position:   position,
+		Exif:       newExif(imaging.ReadExif(data)),
+	}
+	if err := is.db.Create(image); err != nil {
+		is.storage.Delete(newKey)
+		is.usage.Release(galleryID, size)
+		return false, err
+	}
+	return true, is.storage.Delete(key)
+}
+
+// legacyKey splits a key of the form "galleries/<id>/<name>" into the
+// gallery ID and file name.
+func legacyKey(key string) (uint, string, bool) {
+	parts := strings.Split(key, "/")
+	if len(parts) != 3 || parts[0] != "galleries" || parts[2] == "" {
+		return 0, "", false
+	}
+	id, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil || id == 0 {
+		return 0, "", false
+	}
+	return uint(id), parts[2], true
+}
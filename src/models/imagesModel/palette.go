@@ -0,0 +1,113 @@
+package imagesModel
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"sort"
+	"strconv"
+	"strings"
+
+	"lenslocked/imaging"
+)
+
+const (
+	// PALETTE_SIZE is how many colours are kept in each image's palette.
+	PALETTE_SIZE = 5
+
+	// PALETTE_MATCH_DISTANCE is how far a colour in an image's palette can
+	// be from the one being searched for, as an imaging.ColorDistance, for
+	// the image to match. It is wide enough to match shades of a colour
+	// without matching neighbouring colours.
+	PALETTE_MATCH_DISTANCE = 20
+)
+
+// Colours returns the image's palette as hex colours without a leading #,
+// the most common first.
+func (i *Image) Colours() []string {
+	return strings.Fields(i.Palette)
+}
+
+// ParseColour reads a hex colour such as "#3a7bd5" or "3a7bd5", which is
+// how colours are written in palettes and sent by colour pickers.
+func ParseColour(s string) (color.RGBA, bool) {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) != 6 {
+		return color.RGBA{}, false
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return color.RGBA{}, false
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}, true
+}
+
+// FormatColour writes a colour the way ParseColour reads it, without the #.
+func FormatColour(c color.RGBA) string {
+	return fmt.Sprintf("%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// setPalette fills in the image's Palette from img, which is the image as
+// it looks with its edits applied.
+func setPalette(image *Image, img image.Image) {
+	var colours []string
+	for _, c := range imaging.Palette(img, PALETTE_SIZE) {
+		colours = append(colours, FormatColour(c))
+	}
+	image.Palette = strings.Join(colours, " ")
+}
+
+// colourDistance is how far the closest colour in the image's palette is
+// from c, or false if the image doesn't have a palette.
+func colourDistance(image *Image, c color.RGBA) (float64, bool) {
+	best, found := 0.0, false
+	for _, hex := range image.Colours() {
+		colour, ok := ParseColour(hex)
+		if !ok {
+			continue
+		}
+		if d := imaging.ColorDistance(colour, c); !found || d < best {
+			best, found = d, true
+		}
+	}
+	return best, found
+}
+
+// FilterByColour returns the images with a colour in their palette within
+// PALETTE_MATCH_DISTANCE of c, the closest matches first. Images without a
+// palette never match.
+func FilterByColour(images []Image, c color.RGBA) []Image {
+	type match struct {
+		image    Image
+		distance float64
+	}
+	var matches []match
+	for i := range images {
+		if d, ok := colourDistance(&images[i], c); ok && d <= PALETTE_MATCH_DISTANCE {
+			matches = append(matches, match{images[i], d})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].distance < matches[j].distance })
+	filtered := make([]Image, len(matches))
+	for i, m := range matches {
+		filtered[i] = m.image
+	}
+	return filtered
+}
+
+// ByColour returns the images in the galleries that match c, the closest
+// matches first, as FilterByColour does.
+func (is *imageService) ByColour(galleryIDs []uint, c color.RGBA) ([]Image, error) {
+	if len(galleryIDs) == 0 {
+		return nil, nil
+	}
+	images, err := is.db.ByGalleryIDs(galleryIDs)
+	if err != nil {
+		return nil, err
+	}
+	matches := FilterByColour(images, c)
+	for i := range matches {
+		is.SetURL(&matches[i])
+	}
+	return matches, nil
+}
@@ -0,0 +1,84 @@
+package imagesModel
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"io"
+	"testing"
+)
+
+func TestParseColour(t *testing.T) {
+	tests := map[string]bool{
+		"#3a7bd5": true,
+		"3A7BD5":  true,
+		"#3a7bd":  false,
+		"blue":    false,
+		"#3a7bdz": false,
+		"":        false,
+	}
+	for s, want := range tests {
+		if _, have := ParseColour(s); have != want {
+			t.Errorf("%q. Have: %v, Want: %v", s, have, want)
+		}
+	}
+	c, _ := ParseColour("#3a7bd5")
+	if have := FormatColour(c); have != "3a7bd5" {
+		t.Errorf("Have: %q, Want: %q", have, "3a7bd5")
+	}
+}
+
+func TestFilterByColour(t *testing.T) {
+	images := []Image{
+		{Filename: "orange.jpg", Palette: "e07020 ffffff"},
+		{Filename: "navy.jpg", Palette: "ffffff 203070"},
+		{Filename: "blue.jpg", Palette: "3a7bd5 000000"},
+		{Filename: "none.jpg"},
+	}
+	blue := color.RGBA{0x30, 0x70, 0xd0, 0xff}
+	filtered := FilterByColour(images, blue)
+	var have []string
+	for _, image := range filtered {
+		have = append(have, image.Filename)
+	}
+	// Close shades match, the closest first, and other colours don't.
+	if len(have) != 1 || have[0] != "blue.jpg" {
+		t.Errorf("Have: %v, Want: [blue.jpg]", have)
+	}
+	white := FilterByColour(images, color.RGBA{0xf8, 0xf8, 0xf8, 0xff})
+	if len(white) != 2 {
+		t.Errorf("Have: %d images, Want: 2", len(white))
+	}
+}
+
+func TestCreateSetsPalette(t *testing.T) {
+	is, db, _ := testImageService(t)
+	if err := is.Create(1, io.NopCloser(bytes.NewReader(encodeJPEG(t, 40, 30))), "black.jpg", DuplicateKeepBoth); err != nil {
+		t.Fatal(err)
+	}
+	if have := db.images[0].Colours(); len(have) != 1 || have[0] != "000000" {
+		t.Errorf("Have: %v, Want: [000000]", have)
+	}
+}
+
+func TestByColour(t *testing.T) {
+	is, db, _ := testImageService(t)
+	db.Create(&Image{GalleryID: 1, StoredName: "a.jpg", Palette: "3a7bd5"})
+	db.Create(&Image{GalleryID: 2, StoredName: "b.jpg", Palette: "3070d0"})
+	db.Create(&Image{GalleryID: 3, StoredName: "c.jpg", Palette: "3070d0"})
+	db.Create(&Image{GalleryID: 1, StoredName: "d.jpg", Palette: "e07020"})
+	images, err := is.ByColour([]uint{1, 2}, color.RGBA{0x30, 0x70, 0xd0, 0xff})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var have []string
+	for _, image := range images {
+		have = append(have, image.StoredName)
+		if image.URL == "" {
+			t.Errorf("Expected %s to have a URL", image.StoredName)
+		}
+	}
+	if fmt.Sprint(have) != "[b.jpg a.jpg]" {
+		t.Errorf("Have: %v, Want: [b.jpg a.jpg]", have)
+	}
+}
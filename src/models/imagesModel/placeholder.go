@@ -0,0 +1,48 @@
+package imagesModel
+
+import (
+	"encoding/base64"
+	"image"
+	"io"
+
+	"lenslocked/imaging"
+)
+
+// PLACEHOLDER_PREFIX starts every image's Placeholder. It is a data URI,
+// so it can be shown without another request.
+const PLACEHOLDER_PREFIX = "data:image/png;base64,"
+
+// setPlaceholder fills in the image's Width, Height and Placeholder from
+// img, which is the image as it looks with its edits applied.
+func setPlaceholder(image *Image, img image.Image) error {
+	data, err := imaging.Placeholder(img)
+	if err != nil {
+		return err
+	}
+	image.Width = img.Bounds().Dx()
+	image.Height = img.Bounds().Dy()
+	image.Placeholder = PLACEHOLDER_PREFIX + base64.StdEncoding.EncodeToString(data)
+	return nil
+}
+
+// decodeEdited decodes the stored image and applies its edits.
+func (is *imageService) decodeEdited(image *Image) (image.Image, error) {
+	f, err := is.Open(image)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	transforms, err := ParseTransforms(image.Transforms)
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := imaging.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	return transforms.Apply(img), nil
+}
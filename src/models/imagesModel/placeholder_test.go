@@ -0,0 +1,53 @@
+package imagesModel
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+
+	"lenslocked/imaging"
+)
+
+func TestCreateSetsPlaceholder(t *testing.T) {
+	is, db, _ := testImageService(t)
+	if err := is.Create(1, io.NopCloser(bytes.NewReader(encodePNG(t, 400, 100))), "wide.png", DuplicateKeepBoth); err != nil {
+		t.Fatal(err)
+	}
+	img := &db.images[0]
+	if img.Width != 400 || img.Height != 100 {
+		t.Errorf("Have: %dx%d, Want: 400x100", img.Width, img.Height)
+	}
+	if !strings.HasPrefix(img.Placeholder, PLACEHOLDER_PREFIX) {
+		t.Fatalf("Expected a data URI, Got: %q", img.Placeholder)
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(img.Placeholder, PLACEHOLDER_PREFIX))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := png.DecodeConfig(bytes.NewReader(data))
+	if err != nil || cfg.Width != imaging.PLACEHOLDER_SIZE || cfg.Height != 4 {
+		t.Errorf("Wrong placeholder. Have: %v %v, Want: %dx4", cfg, err, imaging.PLACEHOLDER_SIZE)
+	}
+}
+
+func TestThumbnailBackfillsPlaceholder(t *testing.T) {
+	is, db, _ := testImageService(t)
+	if err := is.Create(1, io.NopCloser(bytes.NewReader(encodePNG(t, 100, 300))), "tall.png", DuplicateKeepBoth); err != nil {
+		t.Fatal(err)
+	}
+	// As if it had been stored before placeholders existed.
+	db.images[0].Width, db.images[0].Height, db.images[0].Placeholder = 0, 0, ""
+	img := db.images[0]
+
+	f, err := is.OpenAs(&img, SizeThumb, imaging.FormatJPEG, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if db.images[0].Placeholder == "" || db.images[0].Width != 100 || db.images[0].Height != 300 {
+		t.Errorf("Expected the placeholder to be saved. Have: %dx%d %q", db.images[0].Width, db.images[0].Height, db.images[0].Placeholder)
+	}
+}
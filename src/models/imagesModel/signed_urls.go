@@ -0,0 +1,81 @@
+package imagesModel
+
+import (
+	"crypto/subtle"
+	"net/url"
+	"strconv"
+	"time"
+
+	"lenslocked/hash"
+	"lenslocked/models/errorsModel"
+)
+
+// DEFAULT_URL_TTL is how long the image URLs we render into pages stay
+// valid for. See URLSigner.Window for how it is applied.
+const DEFAULT_URL_TTL = time.Hour
+
+// URLSigner signs image paths with an expiry time so that a link to an
+// image can be handed to a CDN or emailed to a client without needing a
+// session cookie, and stops working once it expires.
+type URLSigner struct {
+	hmac hash.HMAC
+}
+
+// NewURLSigner returns a URLSigner using the provided HMAC key.
+func NewURLSigner(key string) URLSigner {
+	return URLSigner{hmac: hash.NewHMAC(key)}
+}
+
+// Sign returns path with the query params, the expiry and a signature
+// covering all of them added as query params. params may be nil.
+func (s URLSigner) Sign(path string, params url.Values, expires time.Time) string {
+	query := url.Values{}
+	for name, values := range params {
+		query[name] = values
+	}
+	query.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	query.Set("signature", s.signature(path, query))
+	return path + "?" + query.Encode()
+}
+
+// Verify checks that a request URL carries a valid signature for its path
+// and query params, and that it hasn't expired yet.
+func (s URLSigner) Verify(u *url.URL, now time.Time) error {
+	query := u.Query()
+	exp := query.Get("expires")
+	signature := query.Get("signature")
+	want := s.signature(u.Path, query)
+	if exp == "" || subtle.ConstantTimeCompare([]byte(signature), []byte(want)) != 1 {
+		return errorsModel.ErrSignatureInvalid
+	}
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return errorsModel.ErrSignatureInvalid
+	}
+	if !now.Before(time.Unix(unix, 0)) {
+		return errorsModel.ErrURLExpired
+	}
+	return nil
+}
+
+// Window returns the expiry used for URLs rendered into our own pages.
+// Rather than expiring exactly ttl from now, URLs share an expiry for the
+// whole of a ttl long window, so the same image keeps the same URL (and
+// stays in the browser cache) across page views. They remain valid for
+// between ttl and twice ttl.
+func (s URLSigner) Window(now time.Time, ttl time.Duration) time.Time {
+	return now.Truncate(ttl).Add(2 * ttl)
+}
+
+// signature is the HMAC of the path and every query param other than the
+// signature itself, which includes the expiry. The "image" prefix keeps
+// these signatures distinct from anything else hashed with the same key.
+func (s URLSigner) signature(path string, query url.Values) string {
+	signed := url.Values{}
+	for name, values := range query {
+		if name != "signature" {
+			signed[name] = values
+		}
+	}
+	return s.hmac.Hash("image\n" + path + "\n" + signed.Encode())
+}
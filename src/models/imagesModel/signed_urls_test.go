@@ -0,0 +1,95 @@
+package imagesModel
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"lenslocked/models/errorsModel"
+)
+
+func TestSignedURL(t *testing.T) {
+	signer := NewURLSigner("test-key")
+	now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	image := &Image{GalleryID: 3, StoredName: "abc.jpg"}
+	signed := image.SignedPath(signer, now.Add(time.Hour))
+
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Path != "/images/galleries/3/abc.jpg" {
+		t.Errorf("Wrong path. Have: %s, Want: /images/galleries/3/abc.jpg", u.Path)
+	}
+	if err := signer.Verify(u, now); err != nil {
+		t.Errorf("Expected a valid URL, Got: %s", err)
+	}
+	if err := signer.Verify(u, now.Add(59*time.Minute)); err != nil {
+		t.Errorf("Expected the URL to be valid just before expiry, Got: %s", err)
+	}
+	if err := signer.Verify(u, now.Add(time.Hour)); err != errorsModel.ErrURLExpired {
+		t.Errorf("Expected ErrURLExpired, Got: %v", err)
+	}
+}
+
+func TestSignedURLTampering(t *testing.T) {
+	signer := NewURLSigner("test-key")
+	now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	image := &Image{GalleryID: 3, StoredName: "abc.jpg"}
+	signed, _ := url.Parse(image.SignedPath(signer, now.Add(time.Hour)))
+	query := signed.Query()
+
+	tampered := map[string]func(u *url.URL){
+		"other image":   func(u *url.URL) { u.Path = "/images/galleries/3/other.jpg" },
+		"other gallery": func(u *url.URL) { u.Path = "/images/galleries/4/abc.jpg" },
+		"extended expiry": func(u *url.URL) {
+			q := u.Query()
+			q.Set("expires", "9999999999")
+			u.RawQuery = q.Encode()
+		},
+		"missing signature": func(u *url.URL) {
+			q := u.Query()
+			q.Del("signature")
+			u.RawQuery = q.Encode()
+		},
+		"missing expiry": func(u *url.URL) {
+			q := u.Query()
+			q.Del("expires")
+			u.RawQuery = q.Encode()
+		},
+		"no query": func(u *url.URL) { u.RawQuery = "" },
+	}
+	for name, tamper := range tampered {
+		u := *signed
+		u.RawQuery = query.Encode()
+		tamper(&u)
+		if err := signer.Verify(&u, now); err != errorsModel.ErrSignatureInvalid {
+			t.Errorf("Expected %s to be rejected, Got: %v", name, err)
+		}
+	}
+
+	other := NewURLSigner("other-key")
+	if err := other.Verify(signed, now); err != errorsModel.ErrSignatureInvalid {
+		t.Errorf("Expected a URL signed with another key to be rejected, Got: %v", err)
+	}
+}
+
+func TestURLWindow(t *testing.T) {
+	signer := NewURLSigner("test-key")
+	start := time.Date(2023, 1, 2, 3, 0, 0, 0, time.UTC)
+	image := &Image{GalleryID: 3, StoredName: "abc.jpg"}
+	first := image.SignedPath(signer, signer.Window(start, time.Hour))
+	later := image.SignedPath(signer, signer.Window(start.Add(59*time.Minute), time.Hour))
+	if first != later {
+		t.Errorf("Expected the same URL within a window. Have: %s and %s", first, later)
+	}
+	next := image.SignedPath(signer, signer.Window(start.Add(time.Hour), time.Hour))
+	if first == next {
+		t.Errorf("Expected a new URL in the next window")
+	}
+	// A URL handed out at the very end of a window is good for another hour.
+	u, _ := url.Parse(later)
+	if err := signer.Verify(u, start.Add(119*time.Minute)); err != nil {
+		t.Errorf("Expected the URL to still be valid, Got: %s", err)
+	}
+}
@@ -0,0 +1,118 @@
+package imagesModel
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"strconv"
+
+	"lenslocked/imaging"
+)
+
+// SIMILAR_HASH_DISTANCE is the most bits two perceptual hashes can differ
+// by for the images to be grouped as near-identical shots. It is loose
+// enough to catch bursts and exposure brackets of the same scene.
+const SIMILAR_HASH_DISTANCE = 10
+
+// perceptualHash returns the hex encoded difference hash of an image.
+func perceptualHash(img image.Image) string {
+	return fmt.Sprintf("%016x", imaging.DHash(img))
+}
+
+// Similar groups the images in a gallery that look nearly identical.
+// Only groups of two or more images are returned, each in upload order,
+// and the groups are ordered by their first image.
+//
+// Hashes are stored with each image when it is uploaded. Images stored
+// before hashes existed have theirs computed and saved the first time
+// they are looked at here.
+func (is *imageService) Similar(galleryID uint) ([][]Image, error) {
+	images, err := is.ByGalleryID(galleryID)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]uint64, len(images))
+	for i := range images {
+		if images[i].PerceptualHash == "" {
+			if err := is.backfillHash(&images[i]); err != nil {
+				return nil, err
+			}
+		}
+		hashes[i], err = strconv.ParseUint(images[i].PerceptualHash, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return groupSimilar(images, hashes), nil
+}
+
+// backfillHash computes and saves the perceptual hash of a stored image.
+func (is *imageService) backfillHash(image *Image) error {
+	key, err := is.storedKey(image)
+	if err != nil {
+		return err
+	}
+	f, err := is.storage.Get(key)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	img, _, err := imaging.Decode(data)
+	if err != nil {
+		return err
+	}
+	image.PerceptualHash = perceptualHash(img)
+	return is.db.Update(image)
+}
+
+// groupSimilar puts images whose hashes are within SIMILAR_HASH_DISTANCE
+// of each other in the same group. Grouping is transitive, so a burst
+// where each shot is close to the next ends up in one group even if the
+// first and last shots have drifted further apart.
+func groupSimilar(images []Image, hashes []uint64) [][]Image {
+	// parent is a union-find forest over the image indexes.
+	parent := make([]int, len(images))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for i := range images {
+		for j := i + 1; j < len(images); j++ {
+			if imaging.HashDistance(hashes[i], hashes[j]) <= SIMILAR_HASH_DISTANCE {
+				// The lower index becomes the root so groups keep upload order.
+				ri, rj := find(i), find(j)
+				if ri < rj {
+					parent[rj] = ri
+				} else if rj < ri {
+					parent[ri] = rj
+				}
+			}
+		}
+	}
+	members := map[int][]Image{}
+	var roots []int
+	for i := range images {
+		root := find(i)
+		if _, ok := members[root]; !ok {
+			roots = append(roots, root)
+		}
+		members[root] = append(members[root], images[i])
+	}
+	var groups [][]Image
+	for _, root := range roots {
+		if len(members[root]) > 1 {
+			groups = append(groups, members[root])
+		}
+	}
+	return groups
+}
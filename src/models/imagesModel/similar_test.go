@@ -0,0 +1,76 @@
+package imagesModel
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestSimilarGroupsNearIdenticalImages(t *testing.T) {
+	is, db, _ := testImageService(t)
+	hashes := []string{
+		"f0f0f0f0f0f0f0f0", // burst of three, each a few bits from the next
+		"0000000000000000",
+		"f0f0f0f0f0f0f0f1",
+		"ffffffffffffffff",
+		"f0f0f0f0f0f0f0ff",
+		"00000000000000f0", // close to the second image
+	}
+	for i, hash := range hashes {
+		db.images = append(db.images, Image{GalleryID: 1, PerceptualHash: hash})
+		db.images[i].ID = uint(i + 1)
+	}
+	// An identical image in another gallery must not be grouped.
+	db.images = append(db.images, Image{GalleryID: 2, PerceptualHash: hashes[0]})
+
+	groups, err := is.Similar(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]uint{{1, 3, 5}, {2, 6}}
+	if len(groups) != len(want) {
+		t.Fatalf("Wrong number of groups. Have: %v, Want: %v", groups, want)
+	}
+	for i, group := range groups {
+		var ids []uint
+		for _, image := range group {
+			ids = append(ids, image.ID)
+		}
+		if len(ids) != len(want[i]) {
+			t.Errorf("Group %d: Have: %v, Want: %v", i, ids, want[i])
+			continue
+		}
+		for j := range ids {
+			if ids[j] != want[i][j] {
+				t.Errorf("Group %d: Have: %v, Want: %v", i, ids, want[i])
+				break
+			}
+		}
+	}
+}
+
+func TestSimilarBackfillsMissingHashes(t *testing.T) {
+	is, db, _ := testImageService(t)
+	data := encodePNG(t, 16, 16)
+	for _, name := range []string{"a.png", "b.png"} {
+		if err := is.Create(1, io.NopCloser(bytes.NewReader(data)), name, DuplicateKeepBoth); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := db.images[0].PerceptualHash
+	if want == "" {
+		t.Fatal("Expected a perceptual hash to be stored on upload")
+	}
+	db.images[1].PerceptualHash = ""
+
+	groups, err := is.Similar(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 || len(groups[0]) != 2 {
+		t.Errorf("Expected both images in one group, Got: %v", groups)
+	}
+	if have := db.images[1].PerceptualHash; have != want {
+		t.Errorf("Expected the missing hash to be saved. Have: %q, Want: %q", have, want)
+	}
+}
@@ -0,0 +1,146 @@
+package imagesModel
+
+import (
+	"path/filepath"
+	"strings"
+
+	"lenslocked/models/errorsModel"
+
+	"github.com/jinzhu/gorm"
+)
+
+// TransferMode decides whether images transferred to another gallery are
+// taken out of the gallery they came from.
+type TransferMode string
+
+const (
+	// TransferMove takes the images out of their gallery.
+	TransferMove TransferMode = "move"
+
+	// TransferCopy leaves the images where they are and adds copies of
+	// them, which count towards the owner's storage, to the other gallery.
+	TransferCopy TransferMode = "copy"
+)
+
+// ParseTransferMode returns the mode with the provided name, or false if
+// there is no such mode.
+func ParseTransferMode(name string) (TransferMode, bool) {
+	switch mode := TransferMode(name); mode {
+	case TransferMove, TransferCopy:
+		return mode, true
+	default:
+		return "", false
+	}
+}
+
+// Transfer moves or copies images from one gallery to the end of another,
+// along with their captions and alt text. Images that are already in the
+// other gallery are transferred anyway, whatever their checksum.
+//
+// It happens in three steps so that it either completes or leaves both
+// galleries as they were:
+//  1. The files are copied to the other gallery, and the copies deleted
+//     again if any of them can't be.
+//  2. The image records are saved in a single transaction, and the copied
+//     files deleted if that fails.
+//  3. When moving, the original files and their derivatives are deleted.
+//     The records no longer point at them, so failing to delete one only
+//     leaves an unused file.
+//
+// Checking that the owner is allowed to use both galleries is up to the
+// caller.
+func (is *imageService) Transfer(fromGalleryID, toGalleryID uint, imageIDs []uint, mode TransferMode) error {
+	if fromGalleryID == toGalleryID {
+		return errorsModel.ErrTransferSameGallery
+	}
+	if len(imageIDs) == 0 {
+		return errorsModel.ErrNoImagesSelected
+	}
+	images := make([]Image, 0, len(imageIDs))
+	var size int64
+	for _, id := range imageIDs {
+		image, err := is.db.ByID(id)
+		if err != nil {
+			return err
+		}
+		if image.GalleryID != fromGalleryID {
+			return errorsModel.ErrImageNotFound
+		}
+		images = append(images, *image)
+		size += image.Size
+	}
+	position, err := is.db.MaxPosition(toGalleryID)
+	if err != nil {
+		return err
+	}
+
+	if mode == TransferCopy {
+		if err := is.usage.Reserve(toGalleryID, size, is.limits.MaxAccountSize); err != nil {
+			return err
+		}
+	}
+	// rollback undoes the steps taken so far if the transfer fails.
+	var copied []string
+	rollback := func() {
+		for _, key := range copied {
+			is.storage.Delete(key)
+		}
+		if mode == TransferCopy {
+			is.usage.Release(toGalleryID, size)
+		}
+	}
+
+	sources := make([]string, len(images))
+	transferred := make([]Image, len(images))
+	for i := range images {
+		from, err := is.storedKey(&images[i])
+		if err != nil {
+			rollback()
+			return err
+		}
+		sources[i] = from
+		image := images[i]
+		if mode == TransferCopy {
+			// Stored names are unique, so a copy needs a name of its own.
+			ext := strings.TrimPrefix(filepath.Ext(image.StoredName), ".")
+			name, err := is.unusedName(toGalleryID, ext)
+			if err != nil {
+				rollback()
+				return err
+			}
+			image.Model = gorm.Model{}
+			image.StoredName = name
+		}
+		image.GalleryID = toGalleryID
+		image.Position = position + i + 1
+		to := is.key(toGalleryID, image.StoredName)
+		if err := is.copyFile(from, to); err != nil {
+			rollback()
+			return err
+		}
+		copied = append(copied, to)
+		transferred[i] = image
+	}
+
+	if err := is.db.SaveAll(transferred); err != nil {
+		rollback()
+		return err
+	}
+	if mode == TransferMove {
+		for i, key := range sources {
+			is.deleteDerivatives(&images[i])
+			is.storage.Delete(key)
+		}
+	}
+	return nil
+}
+
+// copyFile copies a stored file to another key.
+func (is *imageService) copyFile(from, to string) error {
+	f, err := is.storage.Get(from)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return is.storage.Put(to, f)
+}
@@ -0,0 +1,172 @@
+package imagesModel
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"lenslocked/models/errorsModel"
+	"lenslocked/storage"
+)
+
+// failingStorage fails to store anything once failAfter objects have
+// been stored.
+type failingStorage struct {
+	storage.Storage
+	failAfter int
+}
+
+func (fs *failingStorage) Put(key string, r io.Reader) error {
+	if fs.failAfter == 0 {
+		return errors.New("storage is unavailable")
+	}
+	fs.failAfter--
+	return fs.Storage.Put(key, r)
+}
+
+// testTransfer returns an image service with three images in gallery 1
+// and one in gallery 2.
+func testTransfer(t *testing.T) (*imageService, *fakeImageDB, string) {
+	t.Helper()
+	is, db, dir := testImageService(t)
+	for i, gallery := range []uint{1, 1, 1, 2} {
+		data := encodePNG(t, i+1, 1)
+		if err := is.Create(gallery, io.NopCloser(bytes.NewReader(data)), "photo.png", DuplicateKeepBoth); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.images[0].Caption = "First"
+	db.images[0].AltText = "The first photo"
+	return is, db, dir
+}
+
+// storedFiles returns the names of the files stored for a gallery.
+func storedFiles(t *testing.T, dir string, galleryID string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(filepath.Join(dir, "galleries", galleryID))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), ".") {
+			names = append(names, entry.Name())
+		}
+	}
+	return names
+}
+
+func TestTransferMove(t *testing.T) {
+	is, db, dir := testTransfer(t)
+	used := is.usage.(*fakeUsageDB).bytes[1]
+	if err := is.Transfer(1, 2, []uint{1, 3}, TransferMove); err != nil {
+		t.Fatal(err)
+	}
+	from, _ := db.ByGalleryID(1)
+	to, _ := db.ByGalleryID(2)
+	if len(from) != 1 || len(to) != 3 {
+		t.Fatalf("Wrong number of images. Have: %d and %d, Want: 1 and 3", len(from), len(to))
+	}
+	if to[1].ID != 1 || to[2].ID != 3 {
+		t.Errorf("Expected the images to be added to the end. Have: %d, %d, Want: 1, 3", to[1].ID, to[2].ID)
+	}
+	if to[1].Caption != "First" || to[1].AltText != "The first photo" {
+		t.Errorf("Expected the caption and alt text to be kept, Got: %q, %q", to[1].Caption, to[1].AltText)
+	}
+	if have := storedFiles(t, dir, "1"); len(have) != 1 {
+		t.Errorf("Expected the moved files to be deleted, Have: %v", have)
+	}
+	if have := storedFiles(t, dir, "2"); len(have) != 3 {
+		t.Errorf("Expected the moved files to be stored, Have: %v", have)
+	}
+	if have := is.usage.(*fakeUsageDB).bytes[1]; have != used {
+		t.Errorf("Moving shouldn't change usage. Have: %d, Want: %d", have, used)
+	}
+}
+
+func TestTransferCopy(t *testing.T) {
+	is, db, dir := testTransfer(t)
+	original := db.images[0]
+	used := is.usage.(*fakeUsageDB).bytes[1]
+	if err := is.Transfer(1, 2, []uint{1}, TransferCopy); err != nil {
+		t.Fatal(err)
+	}
+	from, _ := db.ByGalleryID(1)
+	to, _ := db.ByGalleryID(2)
+	if len(from) != 3 || len(to) != 2 {
+		t.Fatalf("Wrong number of images. Have: %d and %d, Want: 3 and 2", len(from), len(to))
+	}
+	copied := to[1]
+	if copied.ID == original.ID || copied.StoredName == original.StoredName {
+		t.Errorf("Expected a new image, Got: %+v", copied)
+	}
+	if copied.Checksum != original.Checksum || copied.Caption != "First" || copied.Filename != original.Filename {
+		t.Errorf("Expected the details to be copied, Got: %+v", copied)
+	}
+	if have := storedFiles(t, dir, "1"); len(have) != 3 {
+		t.Errorf("Expected the original files to be kept, Have: %v", have)
+	}
+	if want := used + original.Size; is.usage.(*fakeUsageDB).bytes[1] != want {
+		t.Errorf("Wrong usage. Have: %d, Want: %d", is.usage.(*fakeUsageDB).bytes[1], want)
+	}
+}
+
+func TestTransferRollsBack(t *testing.T) {
+	for _, mode := range []TransferMode{TransferMove, TransferCopy} {
+		for _, failure := range []string{"storage", "database"} {
+			is, db, dir := testTransfer(t)
+			before := append([]Image(nil), db.images...)
+			used := is.usage.(*fakeUsageDB).bytes[1]
+			if failure == "storage" {
+				// The first file copies and the second fails.
+				is.storage = &failingStorage{Storage: is.storage, failAfter: 1}
+			} else {
+				db.failSave = errors.New("database is unavailable")
+			}
+			if err := is.Transfer(1, 2, []uint{1, 2, 3}, mode); err == nil {
+				t.Errorf("%s, %s failure: Expected an error", mode, failure)
+			}
+			if len(db.images) != len(before) {
+				t.Errorf("%s, %s failure: Wrong number of images. Have: %d, Want: %d", mode, failure, len(db.images), len(before))
+			}
+			for i := range before {
+				if db.images[i].GalleryID != before[i].GalleryID || db.images[i].StoredName != before[i].StoredName {
+					t.Errorf("%s, %s failure: Expected image %d to be unchanged", mode, failure, before[i].ID)
+				}
+			}
+			if have := storedFiles(t, dir, "1"); len(have) != 3 {
+				t.Errorf("%s, %s failure: Expected the original files to be kept, Have: %v", mode, failure, have)
+			}
+			if have := storedFiles(t, dir, "2"); len(have) != 1 {
+				t.Errorf("%s, %s failure: Expected copied files to be deleted, Have: %v", mode, failure, have)
+			}
+			if have := is.usage.(*fakeUsageDB).bytes[1]; have != used {
+				t.Errorf("%s, %s failure: Wrong usage. Have: %d, Want: %d", mode, failure, have, used)
+			}
+		}
+	}
+}
+
+func TestTransferRejects(t *testing.T) {
+	is, _, _ := testTransfer(t)
+	tests := []struct {
+		name     string
+		to       uint
+		imageIDs []uint
+		want     error
+	}{
+		{"same gallery", 1, []uint{1}, errorsModel.ErrTransferSameGallery},
+		{"nothing selected", 2, nil, errorsModel.ErrNoImagesSelected},
+		{"image from another gallery", 2, []uint{1, 4}, errorsModel.ErrImageNotFound},
+		{"missing image", 2, []uint{99}, errorsModel.ErrImageNotFound},
+	}
+	for _, test := range tests {
+		if err := is.Transfer(1, test.to, test.imageIDs, TransferCopy); err != test.want {
+			t.Errorf("%s: Have: %v, Want: %v", test.name, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package imagesModel
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+
+	"lenslocked/imaging"
+	"lenslocked/models/errorsModel"
+)
+
+// MAX_TRANSFORMS is the most edits an image can have. Each one is applied
+// every time a derivative is made, so the list can't grow forever.
+const MAX_TRANSFORMS = 20
+
+// TransformOp is one of the edits an owner can make to an image.
+type TransformOp string
+
+const (
+	TransformRotateClockwise        TransformOp = "cw"
+	TransformRotateCounterClockwise TransformOp = "ccw"
+	TransformFlipHorizontal         TransformOp = "fliph"
+	TransformFlipVertical           TransformOp = "flipv"
+	TransformCrop                   TransformOp = "crop"
+)
+
+// A Transform is a single edit to an image. Edits never change the stored
+// file. They are applied, in order, to the original whenever the image is
+// shown, so the original can always be got back by removing them.
+//
+// X, Y, W and H are only used by TransformCrop. They are the part of the
+// image to keep, as fractions of its width and height, so that the same
+// crop works at every size.
+type Transform struct {
+	Op         TransformOp
+	X, Y, W, H float64
+}
+
+// Transforms are the edits made to an image, in the order they were made.
+type Transforms []Transform
+
+// ParseTransforms reads a list of transforms written by Transforms.String.
+func ParseTransforms(s string) (Transforms, error) {
+	var transforms Transforms
+	for _, field := range strings.Fields(s) {
+		op, args, _ := strings.Cut(field, ":")
+		t := Transform{Op: TransformOp(op)}
+		if t.Op == TransformCrop {
+			var rect [4]float64
+			values := strings.Split(args, ",")
+			if len(values) != len(rect) {
+				return nil, errorsModel.ErrTransformInvalid
+			}
+			for i, value := range values {
+				f, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					return nil, errorsModel.ErrTransformInvalid
+				}
+				rect[i] = f
+			}
+			t.X, t.Y, t.W, t.H = rect[0], rect[1], rect[2], rect[3]
+		}
+		if err := t.Validate(); err != nil {
+			return nil, err
+		}
+		transforms = append(transforms, t)
+	}
+	return transforms, nil
+}
+
+// String writes the transforms in the form they are stored in, which is
+// a space separated list such as "cw crop:0.1,0.1,0.5,0.8".
+func (ts Transforms) String() string {
+	fields := make([]string, len(ts))
+	for i, t := range ts {
+		fields[i] = t.String()
+	}
+	return strings.Join(fields, " ")
+}
+
+// Apply returns the image with every transform applied to it.
+func (ts Transforms) Apply(img image.Image) image.Image {
+	for _, t := range ts {
+		img = t.Apply(img)
+	}
+	return img
+}
+
+// Validate checks that the transform is one we know how to apply and, for
+// crops, that the part to keep is inside the image.
+func (t Transform) Validate() error {
+	switch t.Op {
+	case TransformRotateClockwise, TransformRotateCounterClockwise,
+		TransformFlipHorizontal, TransformFlipVertical:
+		return nil
+	case TransformCrop:
+		for _, f := range []float64{t.X, t.Y, t.W, t.H} {
+			if math.IsNaN(f) || f < 0 || f > 1 {
+				return errorsModel.ErrTransformInvalid
+			}
+		}
+		if t.W == 0 || t.H == 0 || t.X+t.W > 1 || t.Y+t.H > 1 {
+			return errorsModel.ErrTransformInvalid
+		}
+		return nil
+	default:
+		return errorsModel.ErrTransformInvalid
+	}
+}
+
+// String writes the transform in the form it is stored in. Crops are kept
+// to four decimal places, which is finer than a pixel for any image we
+// accept along its shorter side.
+func (t Transform) String() string {
+	if t.Op != TransformCrop {
+		return string(t.Op)
+	}
+	f := func(v float64) string {
+		return strconv.FormatFloat(math.Round(v*1e4)/1e4, 'f', -1, 64)
+	}
+	return fmt.Sprintf("%s:%s,%s,%s,%s", t.Op, f(t.X), f(t.Y), f(t.W), f(t.H))
+}
+
+// Apply returns the image with the transform applied to it.
+func (t Transform) Apply(img image.Image) image.Image {
+	switch t.Op {
+	case TransformRotateClockwise:
+		return imaging.RotateClockwise(img)
+	case TransformRotateCounterClockwise:
+		return imaging.RotateCounterClockwise(img)
+	case TransformFlipHorizontal:
+		return imaging.FlipHorizontal(img)
+	case TransformFlipVertical:
+		return imaging.FlipVertical(img)
+	case TransformCrop:
+		b := img.Bounds()
+		w, h := float64(b.Dx()), float64(b.Dy())
+		r := image.Rect(
+			int(math.Round(t.X*w)),
+			int(math.Round(t.Y*h)),
+			int(math.Round((t.X+t.W)*w)),
+			int(math.Round((t.Y+t.H)*h)),
+		)
+		// A crop of a sliver of a small image still keeps a pixel.
+		if r.Dx() < 1 {
+			r.Max.X = r.Min.X + 1
+		}
+		if r.Dy() < 1 {
+			r.Max.Y = r.Min.Y + 1
+		}
+		return imaging.Crop(img, r)
+	}
+	return img
+}
+
+// Transform saves the image's new edits, along with the size, placeholder
+// and palette they give it. Derivatives are versioned, so the ones made
+// with the old edits would never be served again and are deleted to free
+// up the space.
+func (is *imageService) Transform(image *Image, transforms Transforms) error {
+	image.Transforms = transforms.String()
+	img, err := is.decodeEdited(image)
+	if err != nil {
+		return err
+	}
+	if err := setPlaceholder(image, img); err != nil {
+		return err
+	}
+	setPalette(image, img)
+	if err := is.db.Update(image); err != nil {
+		return err
+	}
+	is.SetURL(image)
+	// Failing to delete them only leaves unused files behind.
+	is.deleteDerivatives(image)
+	return nil
+}
@@ -0,0 +1,111 @@
+package imagesModel
+
+import (
+	"bytes"
+	"image"
+	"io"
+	"testing"
+
+	"lenslocked/imaging"
+	"lenslocked/models/errorsModel"
+)
+
+func TestParseTransforms(t *testing.T) {
+	valid := []string{
+		"",
+		"cw",
+		"ccw fliph flipv",
+		"crop:0.1,0.2,0.5,0.75 cw",
+	}
+	for _, s := range valid {
+		transforms, err := ParseTransforms(s)
+		if err != nil {
+			t.Errorf("%q: Have: %v, Want: <nil>", s, err)
+			continue
+		}
+		if have := transforms.String(); have != s {
+			t.Errorf("Have: %q, Want: %q", have, s)
+		}
+	}
+	invalid := []string{
+		"rotate",
+		"crop",
+		"crop:0.1,0.2,0.5",
+		"crop:a,b,c,d",
+		"crop:0.6,0,0.5,1",
+		"crop:0,0,0,1",
+		"crop:-0.1,0,0.5,0.5",
+		"crop:NaN,0,0.5,0.5",
+	}
+	for _, s := range invalid {
+		if _, err := ParseTransforms(s); err != errorsModel.ErrTransformInvalid {
+			t.Errorf("%q: Have: %v, Want: %v", s, err, errorsModel.ErrTransformInvalid)
+		}
+	}
+}
+
+func TestTransformsApply(t *testing.T) {
+	transforms := Transforms{
+		{Op: TransformCrop, X: 0.25, Y: 0, W: 0.5, H: 0.5},
+		{Op: TransformRotateClockwise},
+		{Op: TransformFlipHorizontal},
+	}
+	b := transforms.Apply(image.NewNRGBA(image.Rect(0, 0, 400, 200))).Bounds()
+	if b.Dx() != 100 || b.Dy() != 200 {
+		t.Errorf("Have: %dx%d, Want: 100x200", b.Dx(), b.Dy())
+	}
+}
+
+func TestTransform(t *testing.T) {
+	is, db, _ := testImageService(t)
+	if err := is.Create(1, io.NopCloser(bytes.NewReader(encodePNG(t, 400, 200))), "wide.png", DuplicateKeepBoth); err != nil {
+		t.Fatal(err)
+	}
+	img := &db.images[0]
+	version := img.Version()
+	openDerivative(t, is, img)
+	oldKey, _ := is.derivativeKey(img, SizeWeb, imaging.FormatJPEG)
+
+	iv := newImageValidator(is)
+	if err := iv.Transform(img, Transforms{{Op: TransformRotateClockwise}}); err != nil {
+		t.Fatal(err)
+	}
+	if db.images[0].Transforms != "cw" {
+		t.Errorf("Have: %q, Want: %q", db.images[0].Transforms, "cw")
+	}
+	if img.Version() == version {
+		t.Errorf("Expected the version to change with the edits")
+	}
+	if db.images[0].Width != 200 || db.images[0].Height != 400 {
+		t.Errorf("Expected the size with the edits. Have: %dx%d, Want: 200x400", db.images[0].Width, db.images[0].Height)
+	}
+	if _, err := is.storage.Stat(oldKey); err == nil {
+		t.Errorf("Expected the old derivative to be deleted")
+	}
+	cfg, _, err := imageConfig(openDerivative(t, is, img))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Width != 200 || cfg.Height != 400 {
+		t.Errorf("Have: %dx%d, Want: 200x400", cfg.Width, cfg.Height)
+	}
+
+	// Removing the edits gets the original back.
+	if err := iv.Transform(img, nil); err != nil {
+		t.Fatal(err)
+	}
+	if img.Edited() || img.Version() != version {
+		t.Errorf("Expected the image to be as it was uploaded, Have: %q", img.Transforms)
+	}
+
+	tooMany := make(Transforms, MAX_TRANSFORMS+1)
+	for i := range tooMany {
+		tooMany[i].Op = TransformFlipVertical
+	}
+	if err := iv.Transform(img, tooMany); err != errorsModel.ErrTooManyTransforms {
+		t.Errorf("Have: %v, Want: %v", err, errorsModel.ErrTooManyTransforms)
+	}
+	if err := iv.Transform(img, Transforms{{Op: "spin"}}); err != errorsModel.ErrTransformInvalid {
+		t.Errorf("Have: %v, Want: %v", err, errorsModel.ErrTransformInvalid)
+	}
+}
@@ -0,0 +1,185 @@
+package imagesModel
+
+import (
+	"fmt"
+	"math"
+
+	"lenslocked/models/errorsModel"
+)
+
+// Limits caps how much users can upload. A limit of zero means there is
+// no limit.
+type Limits struct {
+	// MaxFileSize is the largest file that can be uploaded, in bytes.
+	MaxFileSize int64
+	// MaxAccountSize is the most storage all of a user's images can take
+	// up together, in bytes.
+	MaxAccountSize int64
+}
+
+// Usage is how much storage a user's images take up. It is kept up to
+// date as images are stored and deleted rather than being added up when
+// it is needed.
+type Usage struct {
+	UserID uint  `gorm:"primary_key;auto_increment:false"`
+	Bytes  int64 `gorm:"not null;default:0"`
+	// Limit is the account's Limits.MaxAccountSize, or zero if there is
+	// no limit.
+	Limit int64 `gorm:"-"`
+}
+
+// Percent is how much of the limit has been used, from 0 to 100.
+func (u *Usage) Percent() int {
+	if u.Limit <= 0 {
+		return 0
+	}
+	percent := int(u.Bytes * 100 / u.Limit)
+	if percent > 100 {
+		return 100
+	}
+	return percent
+}
+
+// String describes the usage for display, for example
+// "12.5 MB of 1.0 GB used".
+func (u *Usage) String() string {
+	if u.Limit <= 0 {
+		return FormatBytes(u.Bytes) + " used"
+	}
+	return FormatBytes(u.Bytes) + " of " + FormatBytes(u.Limit) + " used"
+}
+
+// FormatBytes formats a number of bytes using the largest unit that
+// keeps the number at or above one.
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// UsageDB is used to keep track of how much storage each user is using.
+// Images only know which gallery they belong to, so usage is updated by
+// gallery ID and charged to the gallery's owner.
+type UsageDB interface {
+	ByUserID(userID uint) (*Usage, error)
+	ByGalleryID(galleryID uint) (*Usage, error)
+
+	// Reserve adds size bytes to the usage of the gallery's owner, as long
+	// as that doesn't take it over limit. It returns
+	// ErrStorageQuotaExceeded if it would. A limit of zero means no limit.
+	Reserve(galleryID uint, size, limit int64) error
+	// Release takes size bytes off the usage of the gallery's owner.
+	Release(galleryID uint, size int64) error
+}
+
+// Usage returns how much storage the user's images take up.
+func (is *imageService) Usage(userID uint) (*Usage, error) {
+	usage, err := is.usage.ByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	usage.Limit = is.limits.MaxAccountSize
+	return usage, nil
+}
+
+// MaxUploadSize returns the largest file that could currently be added to
+// the gallery: the smaller of the per-file limit and the space left in
+// the owner's account.
+func (is *imageService) MaxUploadSize(galleryID uint) (int64, error) {
+	max := int64(math.MaxInt64 - 1)
+	if is.limits.MaxFileSize > 0 {
+		max = is.limits.MaxFileSize
+	}
+	if is.limits.MaxAccountSize > 0 {
+		usage, err := is.usage.ByGalleryID(galleryID)
+		if err != nil {
+			return 0, err
+		}
+		if remaining := is.limits.MaxAccountSize - usage.Bytes; remaining < max {
+			max = remaining
+		}
+	}
+	if max < 0 {
+		max = 0
+	}
+	return max, nil
+}
+
+// BackfillUsage carries on past images whose file can't be found, so one
+// missing file doesn't stop the rest being counted, and returns the first
+// error encountered. Images that already have a size are left alone, so
+// it is safe to run every time the app starts.
+func (is *imageService) BackfillUsage() error {
+	images, err := is.db.Unsized()
+	if err != nil {
+		return err
+	}
+	var firstErr error
+	for i := range images {
+		if err := is.backfillSize(&images[i]); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// backfillSize records the size of an image's stored file and adds it to
+// the owner's usage, whatever their limit.
+func (is *imageService) backfillSize(image *Image) error {
+	key, err := is.storedKey(image)
+	if err != nil {
+		return err
+	}
+	info, err := is.storage.Stat(key)
+	if err != nil {
+		return err
+	}
+	if err := is.usage.Reserve(image.GalleryID, info.Size, 0); err != nil {
+		return err
+	}
+	image.Size = info.Size
+	if err := is.db.Update(image); err != nil {
+		image.Size = 0
+		is.usage.Release(image.GalleryID, info.Size)
+		return err
+	}
+	return nil
+}
+
+// CheckUpload returns ErrFileTooLarge or ErrStorageQuotaExceeded if a file
+// of size bytes can't be added to the gallery.
+func (is *imageService) CheckUpload(galleryID uint, size int64) error {
+	if is.limits.MaxFileSize > 0 && size > is.limits.MaxFileSize {
+		return errorsModel.ErrFileTooLarge
+	}
+	max, err := is.MaxUploadSize(galleryID)
+	if err != nil {
+		return err
+	}
+	if size > max {
+		return errorsModel.ErrStorageQuotaExceeded
+	}
+	return nil
+}
+
+// ReserveUpload checks the per-file limit up front. The account limit is
+// checked as the space is taken, so two uploads starting at the same time
+// can't both squeeze under it.
+func (is *imageService) ReserveUpload(galleryID uint, size int64) error {
+	if is.limits.MaxFileSize > 0 && size > is.limits.MaxFileSize {
+		return errorsModel.ErrFileTooLarge
+	}
+	return is.usage.Reserve(galleryID, size, is.limits.MaxAccountSize)
+}
+
+// ReleaseUpload takes the space held for an upload off the owner's usage.
+func (is *imageService) ReleaseUpload(galleryID uint, size int64) error {
+	return is.usage.Release(galleryID, size)
+}
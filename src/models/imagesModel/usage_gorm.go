@@ -0,0 +1,69 @@
+package imagesModel
+
+import (
+	"lenslocked/models/errorsModel"
+
+	"github.com/jinzhu/gorm"
+)
+
+type usageGorm struct {
+	db *gorm.DB
+}
+
+var _ UsageDB = &usageGorm{}
+
+// galleryOwner is a subquery for the ID of the user who owns a gallery.
+const galleryOwner = "(SELECT user_id FROM galleries WHERE id = ?)"
+
+// ByUserID returns the usage for a user. A user who hasn't stored
+// anything yet has no row, which is reported as zero bytes used.
+func (ug *usageGorm) ByUserID(userID uint) (*Usage, error) {
+	usage := Usage{UserID: userID}
+	err := ug.db.Where("user_id = ?", userID).First(&usage).Error
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	return &usage, err
+}
+
+// ByGalleryID returns the usage for the owner of a gallery.
+func (ug *usageGorm) ByGalleryID(galleryID uint) (*Usage, error) {
+	var usage Usage
+	err := ug.db.Where("user_id = "+galleryOwner, galleryID).First(&usage).Error
+	if err == gorm.ErrRecordNotFound {
+		err = nil
+	}
+	return &usage, err
+}
+
+// ownerImagesSize is a subquery for the size of all of the images owned by
+// the user galleries.user_id refers to in the outer query.
+const ownerImagesSize = "(SELECT COALESCE(SUM(images.size), 0) FROM images JOIN galleries owned ON owned.id = images.gallery_id " +
+	"WHERE owned.user_id = galleries.user_id AND images.deleted_at IS NULL)"
+
+// Reserve checks the limit and adds to the usage in a single statement so
+// that two uploads finishing at the same time can't both squeeze under
+// the limit. A user's first usage starts from the size of the images they
+// already have.
+func (ug *usageGorm) Reserve(galleryID uint, size, limit int64) error {
+	err := ug.db.Exec("INSERT INTO usages (user_id, bytes) SELECT user_id, "+ownerImagesSize+" FROM galleries WHERE id = ? "+
+		"ON CONFLICT (user_id) DO NOTHING", galleryID).Error
+	if err != nil {
+		return err
+	}
+	db := ug.db.Exec("UPDATE usages SET bytes = bytes + ? WHERE user_id = "+galleryOwner+
+		" AND (? <= 0 OR bytes + ? <= ?)", size, galleryID, limit, size, limit)
+	if db.Error != nil {
+		return db.Error
+	}
+	if db.RowsAffected == 0 {
+		return errorsModel.ErrStorageQuotaExceeded
+	}
+	return nil
+}
+
+// Release never takes the usage below zero.
+func (ug *usageGorm) Release(galleryID uint, size int64) error {
+	return ug.db.Exec("UPDATE usages SET bytes = GREATEST(bytes - ?, 0) WHERE user_id = "+galleryOwner,
+		size, galleryID).Error
+}
@@ -0,0 +1,140 @@
+package imagesModel
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image/png"
+	"io"
+	"strings"
+
+	"lenslocked/imaging"
+	"lenslocked/storage"
+)
+
+const (
+	// MAX_WATERMARK_SIZE is the largest PNG that can be uploaded as a
+	// watermark. The bit shift converts to MB.
+	MAX_WATERMARK_SIZE = 1 << 20
+
+	// MAX_WATERMARK_DIMENSION is the most pixels a watermark PNG can be on
+	// each side.
+	MAX_WATERMARK_DIMENSION = 2000
+
+	// MAX_WATERMARK_TEXT_LENGTH is the most characters of watermark text.
+	MAX_WATERMARK_TEXT_LENGTH = 100
+
+	// DEFAULT_WATERMARK_OPACITY and DEFAULT_WATERMARK_SCALE are the
+	// percentages used for a gallery that hasn't chosen its own.
+	DEFAULT_WATERMARK_OPACITY = 50
+	DEFAULT_WATERMARK_SCALE   = 25
+)
+
+// Watermark is what a gallery's owner has chosen to draw over the images
+// that other people see. Owners always see their images without it, and
+// the stored files are never changed.
+//
+// MarkName is the stored name of an uploaded PNG, which is drawn instead
+// of Text when it is set. Opacity is a percentage from 1 for barely
+// visible to 100 for solid, and Scale is how wide the watermark is as a percentage of
+// the image's width.
+type Watermark struct {
+	Text     string `gorm:"not null;default:''"`
+	MarkName string `gorm:"not null;default:''"`
+	Position string `gorm:"not null;default:'bottom-right'"`
+	Opacity  int    `gorm:"not null;default:50"`
+	Scale    int    `gorm:"not null;default:25"`
+}
+
+// Enabled reports whether there is anything to draw.
+func (wm Watermark) Enabled() bool {
+	return wm.Text != "" || wm.MarkName != ""
+}
+
+// Version identifies the watermark's settings. Watermarked derivatives
+// and URLs include it, so changing the watermark never serves images
+// made with the old one.
+func (wm Watermark) Version() string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%q %q %q %d %d", wm.Text, wm.MarkName, wm.Position, wm.Opacity, wm.Scale)))
+	return hex.EncodeToString(sum[:4])
+}
+
+// SaveWatermark stores an uploaded PNG to use as a gallery's watermark
+// and returns the name to set as its MarkName.
+func (is *imageService) SaveWatermark(galleryID uint, r io.Reader) (string, error) {
+	name, err := is.newName()
+	if err != nil {
+		return "", err
+	}
+	name += ".png"
+	if err := is.storage.Put(watermarkKey(galleryID, name), r); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// ReplaceWatermark throws away what was made with a gallery's old
+// watermark once it has been replaced: every derivative drawn with it,
+// and its PNG if the current watermark doesn't use the same one. Nothing
+// that is left behind is ever served again, so failing to delete a file
+// only leaves it unused.
+func (is *imageService) ReplaceWatermark(galleryID uint, old, current Watermark) error {
+	if old == current {
+		return nil
+	}
+	derivatives, err := is.storage.List(fmt.Sprintf("derivatives/%d/", galleryID))
+	if err != nil {
+		return err
+	}
+	// Derivatives in every format have the version before the extension.
+	marker := "-wm" + old.Version() + "."
+	for _, derivative := range derivatives {
+		if strings.Contains(derivative.Key, marker) {
+			is.storage.Delete(derivative.Key)
+		}
+	}
+	if old.MarkName != "" && old.MarkName != current.MarkName {
+		return is.storage.Delete(watermarkKey(galleryID, old.MarkName))
+	}
+	return nil
+}
+
+// SetWatermarkedURL signs paths to the image with the watermark drawn
+// over it for rendering into a page. The watermark is part of the signed
+// URLs, so it can't be removed to get at the clean image.
+func (is *imageService) SetWatermarkedURL(image *Image, wm Watermark) {
+	is.setURLs(image, &wm)
+}
+
+// watermark loads what is needed to draw a gallery's watermark.
+func (is *imageService) watermark(galleryID uint, wm Watermark) (*imaging.Watermark, error) {
+	mark := &imaging.Watermark{
+		Text:     wm.Text,
+		Position: imaging.Position(wm.Position),
+		Opacity:  float64(wm.Opacity) / 100,
+		Scale:    float64(wm.Scale) / 100,
+	}
+	if wm.MarkName == "" {
+		return mark, nil
+	}
+	f, err := is.storage.Get(watermarkKey(galleryID, wm.MarkName))
+	if err == storage.ErrNotFound {
+		// Fall back to the text rather than fail to show the image at all.
+		return mark, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	mark.Mark, err = png.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+	return mark, nil
+}
+
+// watermarkKey is the storage key of a gallery's watermark PNG. They are
+// kept apart from the gallery's images so they are never listed as one.
+func watermarkKey(galleryID uint, name string) string {
+	return fmt.Sprintf("watermarks/%d/%s", galleryID, name)
+}
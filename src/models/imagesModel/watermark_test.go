@@ -0,0 +1,115 @@
+package imagesModel
+
+import (
+	"bytes"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+
+	"lenslocked/imaging"
+	"lenslocked/models/errorsModel"
+)
+
+func TestOpenAsWatermarked(t *testing.T) {
+	is, db, _ := testImageService(t)
+	if err := is.Create(1, io.NopCloser(bytes.NewReader(encodePNG(t, 400, 200))), "wide.png", DuplicateKeepBoth); err != nil {
+		t.Fatal(err)
+	}
+	img := &db.images[0]
+	name, err := newImageValidator(is).SaveWatermark(1, bytes.NewReader(encodePNG(t, 20, 10)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wm := Watermark{MarkName: name, Position: "center", Opacity: 50, Scale: 25}
+
+	f, err := is.OpenAs(img, SizeOriginal, imaging.FormatJPEG, &wm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(f)
+	f.Close()
+	cfg, format, err := imageConfig(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "jpeg" || cfg.Width != 400 || cfg.Height != 200 {
+		t.Errorf("Expected a full size JPEG instead of the original. Have: %s %dx%d", format, cfg.Width, cfg.Height)
+	}
+	prefix, _ := is.derivativePrefix(img)
+	kept, err := is.storage.List(prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kept) != 1 || !strings.HasSuffix(kept[0].Key, "-wm"+wm.Version()+".jpg") {
+		t.Fatalf("Expected the watermarked derivative to be kept, Got: %v", kept)
+	}
+
+	// Changing the text keeps the PNG but not what was drawn with it.
+	changed := wm
+	changed.Text = "Proof"
+	if err := is.ReplaceWatermark(1, wm, changed); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := is.storage.Stat(kept[0].Key); err == nil {
+		t.Errorf("Expected the old watermarked derivative to be deleted")
+	}
+	if _, err := is.storage.Stat(watermarkKey(1, name)); err != nil {
+		t.Errorf("Expected the watermark PNG to be kept, Got: %v", err)
+	}
+	if err := is.ReplaceWatermark(1, changed, Watermark{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := is.storage.Stat(watermarkKey(1, name)); err == nil {
+		t.Errorf("Expected the watermark PNG to be deleted")
+	}
+}
+
+func TestSaveWatermarkRejects(t *testing.T) {
+	is, _, _ := testImageService(t)
+	iv := newImageValidator(is)
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"jpeg", encodeJPEG(t, 10, 10), errorsModel.ErrWatermarkImageInvalid},
+		{"text", []byte("© Jane Doe"), errorsModel.ErrWatermarkImageInvalid},
+		{"too wide", encodePNG(t, MAX_WATERMARK_DIMENSION+1, 1), errorsModel.ErrWatermarkImageTooLarge},
+		{"too big", make([]byte, MAX_WATERMARK_SIZE+1), errorsModel.ErrWatermarkImageTooLarge},
+	}
+	for _, test := range tests {
+		if _, err := iv.SaveWatermark(1, bytes.NewReader(test.data)); err != test.want {
+			t.Errorf("%s: Have: %v, Want: %v", test.name, err, test.want)
+		}
+	}
+}
+
+func TestSetWatermarkedURL(t *testing.T) {
+	is, _, _ := testImageService(t)
+	img := &Image{GalleryID: 1, StoredName: "abc.png", Checksum: strings.Repeat("a", 64)}
+	wm := Watermark{Text: "Proof", Position: "tile", Opacity: 50, Scale: 25}
+	is.SetWatermarkedURL(img, wm)
+	u, err := url.Parse(img.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have := u.Query().Get("wm"); have != wm.Version() {
+		t.Errorf("Have: %q, Want: %q", have, wm.Version())
+	}
+	if err := is.VerifyURL(u); err != nil {
+		t.Errorf("Expected a valid signature, Got: %v", err)
+	}
+	// Taking the watermark out of the URL breaks the signature.
+	query := u.Query()
+	query.Del("wm")
+	u.RawQuery = query.Encode()
+	if err := is.VerifyURL(u); err != errorsModel.ErrSignatureInvalid {
+		t.Errorf("Have: %v, Want: %v", err, errorsModel.ErrSignatureInvalid)
+	}
+
+	is.SetWatermarkedURL(img, Watermark{})
+	if strings.Contains(img.URL, "wm=") {
+		t.Errorf("Expected no watermark in the URL, Have: %s", img.URL)
+	}
+}
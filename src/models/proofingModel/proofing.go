@@ -0,0 +1,229 @@
+// Package proofingModel keeps track of the images clients pick from a
+// gallery that has been shared with them, so that the owner knows which
+// ones to edit, print or deliver.
+package proofingModel
+
+import (
+	"time"
+
+	"lenslocked/models/errorsModel"
+	"lenslocked/models/imagesModel"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	// MAX_CLIENT_NAME_LENGTH is the longest name a client can give, in
+	// characters.
+	MAX_CLIENT_NAME_LENGTH = 100
+
+	// TOKEN_BYTES is the number of random bytes in a client token.
+	TOKEN_BYTES = 24
+)
+
+// A Client is someone picking images from a gallery. Clients who are
+// logged in are known by their UserID, and everyone else gives a name and
+// is known by Token, which their browser keeps in a cookie.
+//
+// SubmittedAt is set once the client has sent their final selection,
+// after which it can't be changed. Images is the client's selection and
+// is only filled in by the ProofingService.
+type Client struct {
+	gorm.Model
+	GalleryID   uint   `gorm:"not null;index"`
+	UserID      uint   `gorm:"not null;default:0;index"`
+	Name        string `gorm:"not null"`
+	Token       string `gorm:"not null;unique_index"`
+	SubmittedAt *time.Time
+	Images      []imagesModel.Image `gorm:"-"`
+}
+
+// Submitted reports whether the client has sent their final selection.
+func (c *Client) Submitted() bool {
+	return c.SubmittedAt != nil
+}
+
+// Picked reports whether the image is in the client's selection.
+func (c *Client) Picked(imageID uint) bool {
+	for _, image := range c.Images {
+		if image.ID == imageID {
+			return true
+		}
+	}
+	return false
+}
+
+// Filenames are the original names of the images in the client's
+// selection, which is what the owner looks for on their own computer.
+func (c *Client) Filenames() []string {
+	names := make([]string, len(c.Images))
+	for i, image := range c.Images {
+		names[i] = image.Filename
+	}
+	return names
+}
+
+// A Pick is an image a client has added to their selection.
+type Pick struct {
+	gorm.Model
+	ClientID  uint `gorm:"not null;index"`
+	GalleryID uint `gorm:"not null;index"`
+	ImageID   uint `gorm:"not null"`
+}
+
+// ProofingDB is used to interact with the clients and picks database.
+//
+// For all single queries:
+// If the client is found, error will be nil
+// If the client is not found, the error will be set to ErrClientNotFound
+type ProofingDB interface {
+	ClientByToken(token string) (*Client, error)
+	ClientByUser(galleryID, userID uint) (*Client, error)
+	// ClientsByGallery returns the gallery's clients in the order they
+	// started picking images.
+	ClientsByGallery(galleryID uint) ([]Client, error)
+	CreateClient(client *Client) error
+	UpdateClient(client *Client) error
+
+	PicksByClient(clientID uint) ([]Pick, error)
+	PicksByGallery(galleryID uint) ([]Pick, error)
+	// CreatePick adds the pick as long as the client has picked fewer
+	// than limit images, and returns ErrSelectionLimitReached if not. A
+	// limit of zero means no limit.
+	CreatePick(pick *Pick, limit int) error
+	DeletePick(clientID, imageID uint) error
+
+	// DeleteByGallery removes every client of the gallery and everything
+	// they picked.
+	DeleteByGallery(galleryID uint) error
+}
+
+// ProofingService is a set of methods to manipulate and work with the
+// Client and Pick models.
+type ProofingService interface {
+	ProofingDB
+
+	// Selection fills in the client's Images with the images they picked
+	// from images, which are the gallery's images in order.
+	Selection(client *Client, images []imagesModel.Image) error
+
+	// Clients returns the gallery's clients with their Images filled in
+	// from images, as Selection does.
+	Clients(galleryID uint, images []imagesModel.Image) ([]Client, error)
+
+	// Toggle adds the image to the client's selection, or takes it out if
+	// it is already there. The client's Images must already be filled in.
+	// limit is the most images the client can pick, or zero for no limit.
+	Toggle(client *Client, image *imagesModel.Image, limit int) error
+
+	// Submit sends the client's selection to the owner, after which it
+	// can't be changed. The client's Images must already be filled in.
+	Submit(client *Client) error
+}
+
+// NewProofingService initializes a ProofingService instance.
+func NewProofingService(db *gorm.DB) ProofingService {
+	return &proofingService{
+		ProofingDB: newProofingValidator(&proofingGorm{db}),
+		now:        time.Now,
+	}
+}
+
+// proofingService implements the ProofingService interface.
+type proofingService struct {
+	ProofingDB
+	// now returns the current time and is replaced in tests.
+	now func() time.Time
+}
+
+// Selection leaves out picks of images that are no longer in the gallery
+// because they were deleted or moved, so they don't count towards the
+// client's limit either.
+func (ps *proofingService) Selection(client *Client, images []imagesModel.Image) error {
+	picks, err := ps.PicksByClient(client.ID)
+	if err != nil {
+		return err
+	}
+	client.Images = selection(picks, images)
+	return nil
+}
+
+// Clients reads the picks of every client with a single query.
+func (ps *proofingService) Clients(galleryID uint, images []imagesModel.Image) ([]Client, error) {
+	clients, err := ps.ClientsByGallery(galleryID)
+	if err != nil {
+		return nil, err
+	}
+	picks, err := ps.PicksByGallery(galleryID)
+	if err != nil {
+		return nil, err
+	}
+	byClient := map[uint][]Pick{}
+	for _, pick := range picks {
+		byClient[pick.ClientID] = append(byClient[pick.ClientID], pick)
+	}
+	for i := range clients {
+		clients[i].Images = selection(byClient[clients[i].ID], images)
+	}
+	return clients, nil
+}
+
+func (ps *proofingService) Toggle(client *Client, image *imagesModel.Image, limit int) error {
+	if client.Submitted() {
+		return errorsModel.ErrSelectionSubmitted
+	}
+	if image.GalleryID != client.GalleryID {
+		return errorsModel.ErrImageNotFound
+	}
+	if client.Picked(image.ID) {
+		if err := ps.DeletePick(client.ID, image.ID); err != nil {
+			return err
+		}
+		for i := range client.Images {
+			if client.Images[i].ID == image.ID {
+				client.Images = append(client.Images[:i], client.Images[i+1:]...)
+				break
+			}
+		}
+		return nil
+	}
+	// The limit is checked against the saved picks as the pick is added,
+	// since the client may be picking in more than one tab at once.
+	pick := &Pick{ClientID: client.ID, GalleryID: client.GalleryID, ImageID: image.ID}
+	if err := ps.CreatePick(pick, limit); err != nil {
+		return err
+	}
+	client.Images = append(client.Images, *image)
+	return nil
+}
+
+func (ps *proofingService) Submit(client *Client) error {
+	if client.Submitted() {
+		return errorsModel.ErrSelectionSubmitted
+	}
+	if len(client.Images) == 0 {
+		return errorsModel.ErrSelectionEmpty
+	}
+	now := ps.now()
+	client.SubmittedAt = &now
+	if err := ps.UpdateClient(client); err != nil {
+		client.SubmittedAt = nil
+		return err
+	}
+	return nil
+}
+
+// selection returns the images that were picked, in the gallery's order.
+func selection(picks []Pick, images []imagesModel.Image) []imagesModel.Image {
+	picked := map[uint]bool{}
+	for _, pick := range picks {
+		picked[pick.ImageID] = true
+	}
+	var selected []imagesModel.Image
+	for _, image := range images {
+		if picked[image.ID] {
+			selected = append(selected, image)
+		}
+	}
+	return selected
+}
@@ -0,0 +1,141 @@
+package proofingModel
+
+import (
+	"lenslocked/models"
+	"lenslocked/models/errorsModel"
+
+	"github.com/jinzhu/gorm"
+)
+
+type proofingGorm struct {
+	db *gorm.DB
+}
+
+var _ ProofingDB = &proofingGorm{}
+
+// ClientByToken will look up a client by the token kept in their cookie.
+// If the client is not found, the error will be set to ErrClientNotFound.
+func (pg *proofingGorm) ClientByToken(token string) (*Client, error) {
+	var client Client
+	db := pg.db.Where("token = ?", token)
+	err := models.First(db, &client)
+	if err == gorm.ErrRecordNotFound {
+		err = errorsModel.ErrClientNotFound
+	}
+	return &client, err
+}
+
+// ClientByUser will look up the client a logged in user is picking images
+// from the gallery as.
+// If the client is not found, the error will be set to ErrClientNotFound.
+func (pg *proofingGorm) ClientByUser(galleryID, userID uint) (*Client, error) {
+	var client Client
+	db := pg.db.Where("gallery_id = ? AND user_id = ?", galleryID, userID)
+	err := models.First(db, &client)
+	if err == gorm.ErrRecordNotFound {
+		err = errorsModel.ErrClientNotFound
+	}
+	return &client, err
+}
+
+// ClientsByGallery returns every client of the gallery, the first to start
+// picking first.
+func (pg *proofingGorm) ClientsByGallery(galleryID uint) ([]Client, error) {
+	var clients []Client
+	err := pg.db.Where("gallery_id = ?", galleryID).Order("created_at asc, id asc").Find(&clients).Error
+	if err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+// Creates a new client and backfills data like ID, CreatedAt, and UpdatedAt fields.
+func (pg *proofingGorm) CreateClient(client *Client) error {
+	return pg.db.Create(client).Error
+}
+
+// UpdateClient will save the client's name and whether they have sent
+// their selection.
+func (pg *proofingGorm) UpdateClient(client *Client) error {
+	return pg.db.Save(client).Error
+}
+
+// PicksByClient returns every image the client has picked.
+func (pg *proofingGorm) PicksByClient(clientID uint) ([]Pick, error) {
+	var picks []Pick
+	err := pg.db.Where("client_id = ?", clientID).Find(&picks).Error
+	if err != nil {
+		return nil, err
+	}
+	return picks, nil
+}
+
+// PicksByGallery returns every image any client has picked from the
+// gallery.
+func (pg *proofingGorm) PicksByGallery(galleryID uint) ([]Pick, error) {
+	var picks []Pick
+	err := pg.db.Where("gallery_id = ?", galleryID).Find(&picks).Error
+	if err != nil {
+		return nil, err
+	}
+	return picks, nil
+}
+
+// CreatePick locks the client's row while their picks are counted, so two
+// picks made at the same time can't both squeeze under the limit. It
+// backfills data like ID, CreatedAt, and UpdatedAt fields.
+func (pg *proofingGorm) CreatePick(pick *Pick, limit int) error {
+	tx := pg.db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	var client Client
+	err := tx.Set("gorm:query_option", "FOR UPDATE").Where("id = ?", pick.ClientID).First(&client).Error
+	if err != nil {
+		tx.Rollback()
+		if err == gorm.ErrRecordNotFound {
+			err = errorsModel.ErrClientNotFound
+		}
+		return err
+	}
+	if limit > 0 {
+		var count int
+		if err := tx.Model(&Pick{}).Where("client_id = ?", pick.ClientID).Count(&count).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+		if count >= limit {
+			tx.Rollback()
+			return errorsModel.ErrSelectionLimitReached
+		}
+	}
+	if err := tx.Create(pick).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// DeletePick will permanently take the image out of the client's
+// selection.
+func (pg *proofingGorm) DeletePick(clientID, imageID uint) error {
+	return pg.db.Unscoped().Where("client_id = ? AND image_id = ?", clientID, imageID).Delete(&Pick{}).Error
+}
+
+// DeleteByGallery will permanently delete the gallery's clients and their
+// picks, in a transaction so that picks are never left without a client.
+func (pg *proofingGorm) DeleteByGallery(galleryID uint) error {
+	tx := pg.db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if err := tx.Unscoped().Where("gallery_id = ?", galleryID).Delete(&Pick{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Unscoped().Where("gallery_id = ?", galleryID).Delete(&Client{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
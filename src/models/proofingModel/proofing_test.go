@@ -0,0 +1,297 @@
+package proofingModel
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"lenslocked/models/errorsModel"
+	"lenslocked/models/imagesModel"
+)
+
+// fakeProofingDB keeps clients and picks in memory so the service can be
+// tested without a database.
+type fakeProofingDB struct {
+	clients map[uint]Client
+	picks   []Pick
+	nextID  uint
+}
+
+func (fdb *fakeProofingDB) ClientByToken(token string) (*Client, error) {
+	for _, client := range fdb.clients {
+		if client.Token == token {
+			return &client, nil
+		}
+	}
+	return nil, errorsModel.ErrClientNotFound
+}
+
+func (fdb *fakeProofingDB) ClientByUser(galleryID, userID uint) (*Client, error) {
+	for _, client := range fdb.clients {
+		if client.GalleryID == galleryID && client.UserID == userID {
+			return &client, nil
+		}
+	}
+	return nil, errorsModel.ErrClientNotFound
+}
+
+func (fdb *fakeProofingDB) ClientsByGallery(galleryID uint) ([]Client, error) {
+	var clients []Client
+	for id := uint(1); id <= fdb.nextID; id++ {
+		if client, ok := fdb.clients[id]; ok && client.GalleryID == galleryID {
+			clients = append(clients, client)
+		}
+	}
+	return clients, nil
+}
+
+func (fdb *fakeProofingDB) CreateClient(client *Client) error {
+	fdb.nextID++
+	client.ID = fdb.nextID
+	fdb.clients[client.ID] = *client
+	return nil
+}
+
+func (fdb *fakeProofingDB) UpdateClient(client *Client) error {
+	fdb.clients[client.ID] = *client
+	return nil
+}
+
+func (fdb *fakeProofingDB) PicksByClient(clientID uint) ([]Pick, error) {
+	var picks []Pick
+	for _, pick := range fdb.picks {
+		if pick.ClientID == clientID {
+			picks = append(picks, pick)
+		}
+	}
+	return picks, nil
+}
+
+func (fdb *fakeProofingDB) PicksByGallery(galleryID uint) ([]Pick, error) {
+	var picks []Pick
+	for _, pick := range fdb.picks {
+		if pick.GalleryID == galleryID {
+			picks = append(picks, pick)
+		}
+	}
+	return picks, nil
+}
+
+func (fdb *fakeProofingDB) CreatePick(pick *Pick, limit int) error {
+	count := 0
+	for _, p := range fdb.picks {
+		if p.ClientID == pick.ClientID {
+			count++
+		}
+	}
+	if limit > 0 && count >= limit {
+		return errorsModel.ErrSelectionLimitReached
+	}
+	fdb.picks = append(fdb.picks, *pick)
+	return nil
+}
+
+func (fdb *fakeProofingDB) DeletePick(clientID, imageID uint) error {
+	kept := fdb.picks[:0]
+	for _, pick := range fdb.picks {
+		if pick.ClientID != clientID || pick.ImageID != imageID {
+			kept = append(kept, pick)
+		}
+	}
+	fdb.picks = kept
+	return nil
+}
+
+func (fdb *fakeProofingDB) DeleteByGallery(galleryID uint) error {
+	for id, client := range fdb.clients {
+		if client.GalleryID == galleryID {
+			delete(fdb.clients, id)
+		}
+	}
+	kept := fdb.picks[:0]
+	for _, pick := range fdb.picks {
+		if pick.GalleryID != galleryID {
+			kept = append(kept, pick)
+		}
+	}
+	fdb.picks = kept
+	return nil
+}
+
+// testProofingService returns a proofingService backed by fakeProofingDB.
+func testProofingService(t *testing.T) (*proofingService, *fakeProofingDB) {
+	t.Helper()
+	fdb := &fakeProofingDB{clients: map[uint]Client{}}
+	now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	ps := &proofingService{
+		ProofingDB: newProofingValidator(fdb),
+		now:        func() time.Time { return now },
+	}
+	return ps, fdb
+}
+
+// testImages returns a gallery's images named a.jpg, b.jpg and so on.
+func testImages(galleryID uint, n int) []imagesModel.Image {
+	images := make([]imagesModel.Image, n)
+	for i := range images {
+		images[i].ID = uint(i + 1)
+		images[i].GalleryID = galleryID
+		images[i].Filename = string(rune('a'+i)) + ".jpg"
+	}
+	return images
+}
+
+func TestCreateClientValidation(t *testing.T) {
+	ps, _ := testProofingService(t)
+	tests := map[string]struct {
+		client Client
+		want   error
+	}{
+		"no gallery": {Client{Name: "Sam"}, errorsModel.ErrGalleryIdRequired},
+		"no name":    {Client{GalleryID: 1, Name: "  "}, errorsModel.ErrClientNameRequired},
+		"long name":  {Client{GalleryID: 1, Name: strings.Repeat("a", MAX_CLIENT_NAME_LENGTH+1)}, errorsModel.ErrClientNameTooLong},
+		"valid":      {Client{GalleryID: 1, Name: " Sam  and   Alex "}, nil},
+	}
+	for name, test := range tests {
+		client := test.client
+		if err := ps.CreateClient(&client); err != test.want {
+			t.Errorf("%s: Have: %v, Want: %v", name, err, test.want)
+		}
+		if test.want != nil {
+			continue
+		}
+		if client.Name != "Sam and Alex" {
+			t.Errorf("%s: Have: %q, Want: %q", name, client.Name, "Sam and Alex")
+		}
+		if len(client.Token) != 2*TOKEN_BYTES {
+			t.Errorf("%s: Expected a token to be generated, Got: %q", name, client.Token)
+		}
+		if found, err := ps.ClientByToken(client.Token); err != nil || found.ID != client.ID {
+			t.Errorf("%s: Expected to find the client by their token, Got: %v", name, err)
+		}
+	}
+	if _, err := ps.ClientByToken("short"); err != errorsModel.ErrClientNotFound {
+		t.Errorf("Have: %v, Want: %v", err, errorsModel.ErrClientNotFound)
+	}
+}
+
+func TestToggle(t *testing.T) {
+	ps, _ := testProofingService(t)
+	images := testImages(1, 4)
+	client := &Client{GalleryID: 1, Name: "Sam"}
+	if err := ps.CreateClient(client); err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range []int{2, 0} {
+		if err := ps.Toggle(client, &images[i], 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ps.Toggle(client, &images[1], 2); err != errorsModel.ErrSelectionLimitReached {
+		t.Errorf("Have: %v, Want: %v", err, errorsModel.ErrSelectionLimitReached)
+	}
+	// A copy of the client loaded before the picks were made, as in
+	// another tab, can't go over the limit either.
+	stale := &Client{GalleryID: client.GalleryID}
+	stale.ID = client.ID
+	if err := ps.Toggle(stale, &images[1], 2); err != errorsModel.ErrSelectionLimitReached {
+		t.Errorf("Have: %v, Want: %v", err, errorsModel.ErrSelectionLimitReached)
+	}
+	// Unpicking makes room for another.
+	if err := ps.Toggle(client, &images[2], 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.Toggle(client, &images[3], 2); err != nil {
+		t.Fatal(err)
+	}
+
+	// What was saved reads back in the gallery's order.
+	reloaded := &Client{}
+	reloaded.ID, reloaded.GalleryID = client.ID, client.GalleryID
+	if err := ps.Selection(reloaded, images); err != nil {
+		t.Fatal(err)
+	}
+	if have := strings.Join(reloaded.Filenames(), ","); have != "a.jpg,d.jpg" {
+		t.Errorf("Have: %s, Want: a.jpg,d.jpg", have)
+	}
+
+	other := testImages(2, 1)
+	if err := ps.Toggle(client, &other[0], 0); err != errorsModel.ErrImageNotFound {
+		t.Errorf("Have: %v, Want: %v", err, errorsModel.ErrImageNotFound)
+	}
+}
+
+func TestSelectionSkipsMissingImages(t *testing.T) {
+	ps, _ := testProofingService(t)
+	images := testImages(1, 3)
+	client := &Client{GalleryID: 1, Name: "Sam"}
+	if err := ps.CreateClient(client); err != nil {
+		t.Fatal(err)
+	}
+	for i := range images {
+		if err := ps.Toggle(client, &images[i], 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The second image has since been deleted.
+	remaining := []imagesModel.Image{images[0], images[2]}
+	if err := ps.Selection(client, remaining); err != nil {
+		t.Fatal(err)
+	}
+	if have := strings.Join(client.Filenames(), ","); have != "a.jpg,c.jpg" {
+		t.Errorf("Have: %s, Want: a.jpg,c.jpg", have)
+	}
+}
+
+func TestSubmit(t *testing.T) {
+	ps, fdb := testProofingService(t)
+	images := testImages(1, 2)
+	client := &Client{GalleryID: 1, Name: "Sam"}
+	if err := ps.CreateClient(client); err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.Submit(client); err != errorsModel.ErrSelectionEmpty {
+		t.Errorf("Have: %v, Want: %v", err, errorsModel.ErrSelectionEmpty)
+	}
+	if err := ps.Toggle(client, &images[0], 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.Submit(client); err != nil {
+		t.Fatal(err)
+	}
+	if saved := fdb.clients[client.ID]; !saved.Submitted() {
+		t.Errorf("Expected the submission to be saved")
+	}
+	if err := ps.Toggle(client, &images[1], 0); err != errorsModel.ErrSelectionSubmitted {
+		t.Errorf("Have: %v, Want: %v", err, errorsModel.ErrSelectionSubmitted)
+	}
+	if err := ps.Submit(client); err != errorsModel.ErrSelectionSubmitted {
+		t.Errorf("Have: %v, Want: %v", err, errorsModel.ErrSelectionSubmitted)
+	}
+}
+
+func TestClients(t *testing.T) {
+	ps, _ := testProofingService(t)
+	images := testImages(1, 3)
+	for i, name := range []string{"Sam", "Alex"} {
+		client := &Client{GalleryID: 1, Name: name}
+		if err := ps.CreateClient(client); err != nil {
+			t.Fatal(err)
+		}
+		if err := ps.Toggle(client, &images[i], 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	clients, err := ps.Clients(1, images)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clients) != 2 {
+		t.Fatalf("Have: %d clients, Want: 2", len(clients))
+	}
+	for i, want := range []string{"a.jpg", "b.jpg"} {
+		if have := strings.Join(clients[i].Filenames(), ","); have != want {
+			t.Errorf("%s. Have: %s, Want: %s", clients[i].Name, have, want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package proofingModel
+
+import (
+	"encoding/hex"
+	"strings"
+	"unicode/utf8"
+
+	"lenslocked/models/errorsModel"
+	"lenslocked/rand"
+)
+
+// proofingValidator is a chained type that performs validation and
+// normalization of data before being passed to the final ProofingDB implementation
+type proofingValidator struct {
+	ProofingDB
+}
+
+// clientValidationFunction is a function signature given to all client
+// validation functions so that it is easier to iterate over all the
+// client validation functions and call them in a loop.
+type clientValidationFunction func(*Client) error
+
+// Creates a new instance of the proofingValidator
+func newProofingValidator(pdb ProofingDB) *proofingValidator {
+	return &proofingValidator{
+		ProofingDB: pdb,
+	}
+}
+
+// CreateClient ensures that the client belongs to a gallery and has a
+// name, and gives them a token.
+func (pv *proofingValidator) CreateClient(client *Client) error {
+	if err := pv.runClientValidationFunctions(
+		client,
+		pv.galleryIdRequirer,
+		pv.nameNormalizer,
+		pv.tokenGenerator,
+	); err != nil {
+		return err
+	}
+	return pv.ProofingDB.CreateClient(client)
+}
+
+// UpdateClient makes sure the client still has a name.
+func (pv *proofingValidator) UpdateClient(client *Client) error {
+	if err := pv.runClientValidationFunctions(
+		client,
+		pv.idGreaterThan(0),
+		pv.nameNormalizer,
+	); err != nil {
+		return err
+	}
+	return pv.ProofingDB.UpdateClient(client)
+}
+
+// CreatePick ensures that the pick is of an image by a client.
+func (pv *proofingValidator) CreatePick(pick *Pick, limit int) error {
+	if pick.ClientID <= 0 || pick.ImageID <= 0 {
+		return errorsModel.ErrIdInvalid
+	}
+	if pick.GalleryID <= 0 {
+		return errorsModel.ErrGalleryIdRequired
+	}
+	return pv.ProofingDB.CreatePick(pick, limit)
+}
+
+// ClientByToken doesn't bother looking up tokens we could never have
+// given out.
+func (pv *proofingValidator) ClientByToken(token string) (*Client, error) {
+	if len(token) != 2*TOKEN_BYTES {
+		return nil, errorsModel.ErrClientNotFound
+	}
+	return pv.ProofingDB.ClientByToken(token)
+}
+
+// runClientValidationFunctions calls each of the validation functions on
+// the client and returns the first error encountered.
+func (pv *proofingValidator) runClientValidationFunctions(client *Client, fns ...clientValidationFunction) error {
+	for _, fn := range fns {
+		if err := fn(client); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// idGreaterThan checks to see if the client has an ID greater than n.
+func (pv *proofingValidator) idGreaterThan(n uint) clientValidationFunction {
+	return func(client *Client) error {
+		if client.ID <= n {
+			return errorsModel.ErrIdInvalid
+		}
+		return nil
+	}
+}
+
+// galleryIdRequirer requires the client to be picking from a gallery.
+func (pv *proofingValidator) galleryIdRequirer(client *Client) error {
+	if client.GalleryID <= 0 {
+		return errorsModel.ErrGalleryIdRequired
+	}
+	return nil
+}
+
+// nameNormalizer tidies up the spacing in the client's name, which the
+// owner needs to tell clients apart, and makes sure there is one.
+func (pv *proofingValidator) nameNormalizer(client *Client) error {
+	client.Name = strings.Join(strings.Fields(client.Name), " ")
+	if client.Name == "" {
+		return errorsModel.ErrClientNameRequired
+	}
+	if utf8.RuneCountInString(client.Name) > MAX_CLIENT_NAME_LENGTH {
+		return errorsModel.ErrClientNameTooLong
+	}
+	return nil
+}
+
+// tokenGenerator generates the random token kept in the client's cookie.
+func (pv *proofingValidator) tokenGenerator(client *Client) error {
+	b, err := rand.Bytes(TOKEN_BYTES)
+	if err != nil {
+		return err
+	}
+	client.Token = hex.EncodeToString(b)
+	return nil
+}
@@ -1,9 +1,13 @@
 package servicesModel
 
 import (
+	"lenslocked/models/commentsModel"
 	"lenslocked/models/galleriesModel"
 	"lenslocked/models/imagesModel"
+	"lenslocked/models/proofingModel"
+	"lenslocked/models/uploadsModel"
 	"lenslocked/models/usersModel"
+	"lenslocked/storage"
 
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/postgres"
@@ -53,18 +57,52 @@ func WithGallery() ServicesConfig {
 	}
 }
 
-func WithImages() ServicesConfig {
+func WithStorage(store storage.Storage) ServicesConfig {
 	return func(s *Services) error {
-		s.Image = imagesModel.NewImageService()
+		s.Storage = store
+		return nil
+	}
+}
+
+func WithImages(hmacKey string, limits imagesModel.Limits) ServicesConfig {
+	return func(s *Services) error {
+		s.Image = imagesModel.NewImageService(s.db, s.Storage, hmacKey, limits)
+		return nil
+	}
+}
+
+// WithUploads must come after WithImages, since uploads hold space in
+// the images' storage quota.
+func WithUploads() ServicesConfig {
+	return func(s *Services) error {
+		s.Upload = uploadsModel.NewUploadService(s.db, s.Storage, s.Image)
+		return nil
+	}
+}
+
+func WithProofing() ServicesConfig {
+	return func(s *Services) error {
+		s.Proofing = proofingModel.NewProofingService(s.db)
+		return nil
+	}
+}
+
+func WithComments(hmacKey string) ServicesConfig {
+	return func(s *Services) error {
+		s.Comment = commentsModel.NewCommentService(s.db, hmacKey)
 		return nil
 	}
 }
 
 type Services struct {
-	Gallery galleriesModel.GalleryService
-	User    usersModel.UserService
-	Image   imagesModel.ImageService
-	db      *gorm.DB
+	Gallery  galleriesModel.GalleryService
+	User     usersModel.UserService
+	Image    imagesModel.ImageService
+	Upload   uploadsModel.UploadService
+	Proofing proofingModel.ProofingService
+	Comment  commentsModel.CommentService
+	Storage  storage.Storage
+	db       *gorm.DB
 }
 
 // Closes the database connection. It can be deferred if desired.
@@ -74,7 +112,7 @@ func (s *Services) Close() error {
 
 // Destructive Reset drops and automigrates all tables and rebuilds them
 func (s *Services) DestructiveReset() error {
-	err := s.db.DropTableIfExists(&usersModel.User{}, &galleriesModel.Gallery{}).Error
+	err := s.db.DropTableIfExists(&usersModel.User{}, &galleriesModel.Gallery{}, &imagesModel.Image{}, &imagesModel.Usage{}, &uploadsModel.Upload{}, &proofingModel.Client{}, &proofingModel.Pick{}, &commentsModel.Comment{}, &commentsModel.Block{}).Error
 	if err != nil {
 		return err
 	}
@@ -83,5 +121,5 @@ func (s *Services) DestructiveReset() error {
 
 // Runs an automigration for all tables in the database.
 func (s *Services) AutoMigrate() error {
-	return s.db.AutoMigrate(&usersModel.User{}, &galleriesModel.Gallery{}).Error
+	return s.db.AutoMigrate(&usersModel.User{}, &galleriesModel.Gallery{}, &imagesModel.Image{}, &imagesModel.Usage{}, &uploadsModel.Upload{}, &proofingModel.Client{}, &proofingModel.Pick{}, &commentsModel.Comment{}, &commentsModel.Block{}).Error
 }
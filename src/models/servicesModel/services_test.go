@@ -1,14 +1,17 @@
 package servicesModel
 
 import (
+	"os"
 	"strings"
 	"testing"
 	"time"
 
 	"lenslocked/config"
 	"lenslocked/models/errorsModel"
+	"lenslocked/models/imagesModel"
 	"lenslocked/models/usersModel"
 	"lenslocked/rand"
+	"lenslocked/storage"
 )
 
 func mockServices(causeDbError bool) (*Services, error) {
@@ -21,7 +24,11 @@ func mockServices(causeDbError bool) (*Services, error) {
 		WithGorm(dbCfg.Dialect(), psqlInfo),
 		WithUser(config.DefaultHashKeyConfig()),
 		WithGallery(),
-		WithImages(),
+		WithStorage(storage.NewLocal(os.TempDir(), "/images")),
+		WithImages(config.DefaultHashKeyConfig(), imagesModel.Limits{}),
+		WithUploads(),
+		WithProofing(),
+		WithComments(config.DefaultHashKeyConfig()),
 		WithLogMode(false),
 	)
 	if err != nil {
@@ -0,0 +1,345 @@
+// Package uploadsModel keeps track of resumable uploads. The data for an
+// upload arrives in any number of chunks, possibly across several
+// connections, and is kept in storage until the whole file has been
+// received and can be handed to the ImageService.
+package uploadsModel
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"lenslocked/models/errorsModel"
+	"lenslocked/rand"
+	"lenslocked/storage"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	// MAX_UPLOAD_SIZE is the largest file that can be sent as a resumable
+	// upload. The bit shift converts to MB.
+	MAX_UPLOAD_SIZE = 100 << 20
+
+	// UPLOAD_TTL is how long an upload can go without receiving any data
+	// before it is considered abandoned and removed.
+	UPLOAD_TTL = 24 * time.Hour
+
+	// EXPIRY_INTERVAL is how often abandoned uploads are looked for.
+	EXPIRY_INTERVAL = time.Hour
+
+	// TOKEN_BYTES is the number of random bytes in an upload token.
+	TOKEN_BYTES = 24
+
+	// PART_BYTES is the number of random bytes in a chunk's storage key.
+	PART_BYTES = 8
+)
+
+// An Upload is a file that is part of the way through being uploaded.
+type Upload struct {
+	gorm.Model
+	// Token identifies the upload in its URL.
+	Token     string `gorm:"not null;unique_index"`
+	UserID    uint   `gorm:"not null;index"`
+	GalleryID uint   `gorm:"not null"`
+	Filename  string `gorm:"not null"`
+	// Duplicates is the imagesModel.DuplicatePolicy to store the file with.
+	Duplicates string `gorm:"not null;default:'skip'"`
+	// Length is the size of the complete file and Offset is how much of
+	// it has been received so far.
+	Length int64 `gorm:"not null"`
+	Offset int64 `gorm:"not null;default:0"`
+	// Parts is the storage keys of the chunks received so far, in order
+	// and separated by spaces.
+	Parts string `gorm:"type:text;not null;default:''"`
+	// Reserved is whether space for the whole file is being held in the
+	// owner's storage. It is held from when the upload is created until
+	// the file is added to the gallery or the upload is removed.
+	Reserved  bool      `gorm:"not null;default:false"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+}
+
+// Complete reports whether all of the file has been received.
+func (u *Upload) Complete() bool {
+	return u.Offset == u.Length
+}
+
+// UploadDB is used to interact with the uploads database.
+//
+// For all single queries:
+// If the upload is found, error will be nil
+// If the upload is not found, the error will be set to ErrUploadNotFound
+type UploadDB interface {
+	ByToken(token string) (*Upload, error)
+	Expired(now time.Time) ([]Upload, error)
+	Create(upload *Upload) error
+	// Advance records the n bytes stored under part as the next chunk of
+	// the upload and pushes the expiry out to expiresAt. If another
+	// request has moved the offset on since upload was read, nothing is
+	// recorded and ErrUploadConflict is returned.
+	Advance(upload *Upload, n int64, part string, expiresAt time.Time) error
+	// Unreserve marks the upload as no longer holding space for its file,
+	// and reports whether it was holding any.
+	Unreserve(id uint) (bool, error)
+	Delete(id uint) error
+}
+
+// A Quota holds space in the owner's storage for files that are still
+// arriving, so unfinished uploads count against the limit.
+type Quota interface {
+	ReserveUpload(galleryID uint, size int64) error
+	ReleaseUpload(galleryID uint, size int64) error
+}
+
+// UploadService is a set of methods to manipulate and work with the
+// Upload model and the data that has been received for it.
+type UploadService interface {
+	UploadDB
+
+	// Write appends the data in r to the upload and returns how many bytes
+	// were added. If r fails partway through, the data received before the
+	// failure is kept and the error is returned along with its length.
+	Write(upload *Upload, r io.Reader) (int64, error)
+
+	// Open returns a reader for all of the data received for the upload.
+	Open(upload *Upload) (io.ReadCloser, error)
+
+	// Release hands back the space held for the upload's file. The file
+	// reserves its own space once it is added to the gallery, so this is
+	// done first to keep it from being counted twice. Releasing an upload
+	// more than once only hands the space back once.
+	Release(upload *Upload) error
+
+	// Remove deletes the upload along with any data received for it and
+	// releases the space held for it.
+	Remove(upload *Upload) error
+
+	// RemoveExpired removes every upload that has gone UPLOAD_TTL without
+	// receiving data and returns how many were removed.
+	RemoveExpired() (int, error)
+}
+
+// NewUploadService initializes an UploadService instance that holds
+// space for each upload in quota.
+func NewUploadService(db *gorm.DB, store storage.Storage, quota Quota) UploadService {
+	return &uploadService{
+		UploadDB: newUploadValidator(&uploadGorm{db}),
+		storage:  store,
+		quota:    quota,
+		now:      time.Now,
+	}
+}
+
+// uploadService implements the UploadService interface.
+type uploadService struct {
+	UploadDB
+	storage storage.Storage
+	quota   Quota
+	// now returns the current time and is replaced in tests.
+	now func() time.Time
+}
+
+// Create starts a new upload that will expire if no data is received for
+// it within UPLOAD_TTL. The upload is validated before any space is held
+// for it, and is deleted again if there isn't room for the file.
+func (us *uploadService) Create(upload *Upload) error {
+	upload.Offset = 0
+	upload.Reserved = true
+	upload.ExpiresAt = us.now().Add(UPLOAD_TTL)
+	if err := us.UploadDB.Create(upload); err != nil {
+		return err
+	}
+	if err := us.quota.ReserveUpload(upload.GalleryID, upload.Length); err != nil {
+		us.Delete(upload.ID)
+		return err
+	}
+	return nil
+}
+
+// Write stores each chunk as its own object, since storage backends can't
+// append to an existing object. Every chunk gets a key of its own, so two
+// requests sending data from the same offset can't overwrite each other's
+// chunks, and the chunk is stored before the offset is moved on so that
+// no lock is held while the data arrives. Only the request that moves the
+// offset on has its chunk recorded, and the other's is deleted.
+func (us *uploadService) Write(upload *Upload, r io.Reader) (int64, error) {
+	remaining := upload.Length - upload.Offset
+	// Read one byte more than is allowed so that too much data is noticed.
+	pr := &partialReader{r: io.LimitReader(r, remaining+1)}
+	key, err := us.partKey(upload, upload.Offset)
+	if err != nil {
+		return 0, err
+	}
+	if err := us.storage.Put(key, pr); err != nil {
+		return 0, err
+	}
+	if pr.n > remaining {
+		us.storage.Delete(key)
+		return 0, errorsModel.ErrUploadTooLarge
+	}
+	if pr.n == 0 {
+		us.storage.Delete(key)
+		return 0, pr.err
+	}
+	if err := us.Advance(upload, pr.n, key, us.now().Add(UPLOAD_TTL)); err != nil {
+		us.storage.Delete(key)
+		return 0, err
+	}
+	return pr.n, pr.err
+}
+
+// Open returns the recorded chunks of the upload joined back together.
+// Chunks that were stored but never recorded are ignored.
+func (us *uploadService) Open(upload *Upload) (io.ReadCloser, error) {
+	stored, err := us.storage.List(us.prefix(upload))
+	if err != nil {
+		return nil, err
+	}
+	sizes := make(map[string]int64, len(stored))
+	for _, part := range stored {
+		sizes[part.Key] = part.Size
+	}
+	keys := strings.Fields(upload.Parts)
+	var offset int64
+	for _, key := range keys {
+		size, ok := sizes[key]
+		if !ok {
+			return nil, errorsModel.ErrUploadIncomplete
+		}
+		offset += size
+	}
+	if offset != upload.Offset {
+		return nil, errorsModel.ErrUploadIncomplete
+	}
+	return &partsReader{storage: us.storage, keys: keys}, nil
+}
+
+// Release clears the upload's reservation before handing the space back,
+// so two requests releasing the same upload can't both hand it back.
+func (us *uploadService) Release(upload *Upload) error {
+	released, err := us.Unreserve(upload.ID)
+	if err != nil || !released {
+		return err
+	}
+	upload.Reserved = false
+	return us.quota.ReleaseUpload(upload.GalleryID, upload.Length)
+}
+
+// Remove deletes the data for the upload before its record so that data
+// is never left behind without a record pointing to it.
+func (us *uploadService) Remove(upload *Upload) error {
+	parts, err := us.storage.List(us.prefix(upload))
+	if err != nil {
+		return err
+	}
+	for _, part := range parts {
+		if err := us.storage.Delete(part.Key); err != nil && err != storage.ErrNotFound {
+			return err
+		}
+	}
+	if err := us.Release(upload); err != nil {
+		return err
+	}
+	return us.Delete(upload.ID)
+}
+
+// RemoveExpired carries on past uploads that fail to be removed so one bad
+// upload can't stop the rest from being cleaned up, and returns the first
+// error encountered.
+func (us *uploadService) RemoveExpired() (int, error) {
+	uploads, err := us.Expired(us.now())
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	var firstErr error
+	for i := range uploads {
+		if err := us.Remove(&uploads[i]); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		removed++
+	}
+	return removed, firstErr
+}
+
+// prefix is the storage prefix all of the chunks for an upload live under.
+func (us *uploadService) prefix(upload *Upload) string {
+	return fmt.Sprintf("uploads/%s/", upload.Token)
+}
+
+// partKey is a new storage key for a chunk starting at offset. The random
+// suffix keeps it apart from any other request's chunk at the same offset.
+func (us *uploadService) partKey(upload *Upload, offset int64) (string, error) {
+	b, err := rand.Bytes(PART_BYTES)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%020d-%s", us.prefix(upload), offset, hex.EncodeToString(b)), nil
+}
+
+// partialReader counts the bytes read through it. A read error other than
+// io.EOF is recorded and reported as io.EOF instead, so that the bytes
+// received before a dropped connection are still stored.
+type partialReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (pr *partialReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	pr.n += int64(n)
+	if err != nil && err != io.EOF {
+		pr.err = err
+		return n, io.EOF
+	}
+	return n, err
+}
+
+// partsReader reads each of the stored chunks in turn, only opening a
+// chunk once the one before it has been read.
+type partsReader struct {
+	storage storage.Storage
+	keys    []string
+	current io.ReadCloser
+}
+
+func (pr *partsReader) Read(p []byte) (int, error) {
+	for {
+		if pr.current == nil {
+			if len(pr.keys) == 0 {
+				return 0, io.EOF
+			}
+			part, err := pr.storage.Get(pr.keys[0])
+			if err != nil {
+				return 0, err
+			}
+			pr.current = part
+			pr.keys = pr.keys[1:]
+		}
+		n, err := pr.current.Read(p)
+		if err == io.EOF {
+			pr.current.Close()
+			pr.current = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (pr *partsReader) Close() error {
+	if pr.current == nil {
+		return nil
+	}
+	err := pr.current.Close()
+	pr.current = nil
+	return err
+}
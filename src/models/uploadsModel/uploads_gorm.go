@@ -0,0 +1,81 @@
+package uploadsModel
+
+import (
+	"strings"
+	"time"
+
+	"lenslocked/models"
+	"lenslocked/models/errorsModel"
+
+	"github.com/jinzhu/gorm"
+)
+
+type uploadGorm struct {
+	db *gorm.DB
+}
+
+var _ UploadDB = &uploadGorm{}
+
+// Creates a new upload record and backfills data like ID, CreatedAt, and UpdatedAt fields.
+func (ug *uploadGorm) Create(upload *Upload) error {
+	return ug.db.Create(upload).Error
+}
+
+// ByToken will look up an upload by the token in its URL.
+// If the upload is not found, the error will be set to ErrUploadNotFound.
+func (ug *uploadGorm) ByToken(token string) (*Upload, error) {
+	var upload Upload
+	db := ug.db.Where("token = ?", token)
+	err := models.First(db, &upload)
+	if err == gorm.ErrRecordNotFound {
+		err = errorsModel.ErrUploadNotFound
+	}
+	return &upload, err
+}
+
+// Expired returns every upload that was due to expire before now.
+func (ug *uploadGorm) Expired(now time.Time) ([]Upload, error) {
+	var uploads []Upload
+	err := ug.db.Where("expires_at < ?", now).Find(&uploads).Error
+	if err != nil {
+		return nil, err
+	}
+	return uploads, nil
+}
+
+// Advance only moves the offset on if it still matches the one the chunk
+// was stored from, so of two requests sending the same chunk only one is
+// recorded. The offset only ever grows, so matching it also means the
+// recorded parts haven't changed.
+func (ug *uploadGorm) Advance(upload *Upload, n int64, part string, expiresAt time.Time) error {
+	parts := strings.TrimSpace(upload.Parts + " " + part)
+	db := ug.db.Model(&Upload{}).Where(`id = ? AND "offset" = ?`, upload.ID, upload.Offset).
+		Updates(map[string]interface{}{"offset": upload.Offset + n, "parts": parts, "expires_at": expiresAt})
+	if db.Error != nil {
+		return db.Error
+	}
+	if db.RowsAffected == 0 {
+		return errorsModel.ErrUploadConflict
+	}
+	upload.Offset += n
+	upload.Parts = parts
+	upload.ExpiresAt = expiresAt
+	return nil
+}
+
+// Unreserve only reports the reservation as released to the request
+// that actually cleared it.
+func (ug *uploadGorm) Unreserve(id uint) (bool, error) {
+	db := ug.db.Model(&Upload{}).Where("id = ? AND reserved", id).Update("reserved", false)
+	if db.Error != nil {
+		return false, db.Error
+	}
+	return db.RowsAffected > 0, nil
+}
+
+// Delete will permanently delete the upload with the provided ID. There is
+// nothing worth keeping about an upload once it is finished or abandoned.
+func (ug *uploadGorm) Delete(id uint) error {
+	upload := Upload{Model: gorm.Model{ID: id}}
+	return ug.db.Unscoped().Delete(&upload).Error
+}
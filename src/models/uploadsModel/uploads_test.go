@@ -0,0 +1,359 @@
+package uploadsModel
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"lenslocked/models/errorsModel"
+	"lenslocked/storage"
+)
+
+// fakeUploadDB keeps uploads in memory so the service can be tested
+// without a database.
+type fakeUploadDB struct {
+	uploads map[uint]Upload
+	nextID  uint
+}
+
+func (fdb *fakeUploadDB) ByToken(token string) (*Upload, error) {
+	for _, upload := range fdb.uploads {
+		if upload.Token == token {
+			return &upload, nil
+		}
+	}
+	return nil, errorsModel.ErrUploadNotFound
+}
+
+func (fdb *fakeUploadDB) Expired(now time.Time) ([]Upload, error) {
+	var uploads []Upload
+	for _, upload := range fdb.uploads {
+		if upload.ExpiresAt.Before(now) {
+			uploads = append(uploads, upload)
+		}
+	}
+	return uploads, nil
+}
+
+func (fdb *fakeUploadDB) Create(upload *Upload) error {
+	fdb.nextID++
+	upload.ID = fdb.nextID
+	fdb.uploads[upload.ID] = *upload
+	return nil
+}
+
+func (fdb *fakeUploadDB) Advance(upload *Upload, n int64, part string, expiresAt time.Time) error {
+	stored := fdb.uploads[upload.ID]
+	if stored.Offset != upload.Offset {
+		return errorsModel.ErrUploadConflict
+	}
+	upload.Offset += n
+	upload.Parts = strings.TrimSpace(upload.Parts + " " + part)
+	upload.ExpiresAt = expiresAt
+	fdb.uploads[upload.ID] = *upload
+	return nil
+}
+
+func (fdb *fakeUploadDB) Unreserve(id uint) (bool, error) {
+	stored, ok := fdb.uploads[id]
+	if !ok || !stored.Reserved {
+		return false, nil
+	}
+	stored.Reserved = false
+	fdb.uploads[id] = stored
+	return true, nil
+}
+
+func (fdb *fakeUploadDB) Delete(id uint) error {
+	delete(fdb.uploads, id)
+	return nil
+}
+
+// fakeQuota has room for limit bytes across all galleries, or any number
+// if limit is zero.
+type fakeQuota struct {
+	limit int64
+	used  int64
+}
+
+func (fq *fakeQuota) ReserveUpload(galleryID uint, size int64) error {
+	if fq.limit > 0 && fq.used+size > fq.limit {
+		return errorsModel.ErrStorageQuotaExceeded
+	}
+	fq.used += size
+	return nil
+}
+
+func (fq *fakeQuota) ReleaseUpload(galleryID uint, size int64) error {
+	fq.used -= size
+	return nil
+}
+
+// testUploadService returns an uploadService backed by fakeUploadDB,
+// fakeQuota and local storage in a temporary directory.
+func testUploadService(t *testing.T) (*uploadService, *fakeUploadDB, storage.Storage) {
+	t.Helper()
+	fdb := &fakeUploadDB{uploads: map[uint]Upload{}}
+	store := storage.NewLocal(t.TempDir(), "/images")
+	now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	us := &uploadService{
+		UploadDB: newUploadValidator(fdb),
+		storage:  store,
+		quota:    &fakeQuota{},
+		now:      func() time.Time { return now },
+	}
+	return us, fdb, store
+}
+
+func newUpload(t *testing.T, us *uploadService, length int64) *Upload {
+	t.Helper()
+	upload := &Upload{UserID: 1, GalleryID: 2, Filename: "photo.jpg", Length: length}
+	if err := us.Create(upload); err != nil {
+		t.Fatal(err)
+	}
+	return upload
+}
+
+// failingReader returns its data and then fails as if the connection
+// had dropped.
+type failingReader struct {
+	r io.Reader
+}
+
+var errDropped = errors.New("connection reset")
+
+func (fr failingReader) Read(p []byte) (int, error) {
+	n, err := fr.r.Read(p)
+	if err == io.EOF {
+		return n, errDropped
+	}
+	return n, err
+}
+
+func readAll(t *testing.T, us *uploadService, upload *Upload) string {
+	t.Helper()
+	r, err := us.Open(upload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestUploadCreateValidation(t *testing.T) {
+	us, _, _ := testUploadService(t)
+	tests := map[string]struct {
+		upload Upload
+		want   error
+	}{
+		"no length":    {Upload{UserID: 1, GalleryID: 2, Filename: "a.jpg"}, errorsModel.ErrUploadLengthInvalid},
+		"too large":    {Upload{UserID: 1, GalleryID: 2, Filename: "a.jpg", Length: MAX_UPLOAD_SIZE + 1}, errorsModel.ErrUploadTooLarge},
+		"no filename":  {Upload{UserID: 1, GalleryID: 2, Length: 10}, errorsModel.ErrFilenameRequired},
+		"no gallery":   {Upload{UserID: 1, Filename: "a.jpg", Length: 10}, errorsModel.ErrGalleryIdRequired},
+		"no user":      {Upload{GalleryID: 2, Filename: "a.jpg", Length: 10}, errorsModel.ErrUserIdRequired},
+		"largest file": {Upload{UserID: 1, GalleryID: 2, Filename: "a.jpg", Length: MAX_UPLOAD_SIZE}, nil},
+	}
+	for name, test := range tests {
+		upload := test.upload
+		if err := us.Create(&upload); err != test.want {
+			t.Errorf("%s: Have: %v, Want: %v", name, err, test.want)
+		}
+		if test.want == nil && len(upload.Token) != 2*TOKEN_BYTES {
+			t.Errorf("%s: Expected a token to be generated, Got: %q", name, upload.Token)
+		}
+	}
+}
+
+func TestUploadReservesLength(t *testing.T) {
+	us, fdb, _ := testUploadService(t)
+	quota := us.quota.(*fakeQuota)
+	quota.limit = 100
+	first := newUpload(t, us, 60)
+	if quota.used != 60 {
+		t.Errorf("Have: %d, Want: %d", quota.used, 60)
+	}
+	// The first upload hasn't sent any data, but still leaves no room.
+	second := &Upload{UserID: 1, GalleryID: 2, Filename: "b.jpg", Length: 60}
+	if err := us.Create(second); err != errorsModel.ErrStorageQuotaExceeded {
+		t.Errorf("Have: %v, Want: %v", err, errorsModel.ErrStorageQuotaExceeded)
+	}
+	if len(fdb.uploads) != 1 {
+		t.Errorf("Expected the rejected upload not to be kept, Got: %d uploads", len(fdb.uploads))
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := us.Release(first); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if quota.used != 0 {
+		t.Errorf("Expected the space to be handed back once. Have: %d, Want: %d", quota.used, 0)
+	}
+	if err := us.Remove(first); err != nil {
+		t.Fatal(err)
+	}
+	if quota.used != 0 {
+		t.Errorf("Expected removing a released upload to hand back nothing. Have: %d, Want: %d", quota.used, 0)
+	}
+
+	abandoned := newUpload(t, us, 40)
+	if err := us.Remove(abandoned); err != nil {
+		t.Fatal(err)
+	}
+	if quota.used != 0 {
+		t.Errorf("Expected removing the upload to hand back its space. Have: %d, Want: %d", quota.used, 0)
+	}
+}
+
+func TestUploadWriteInChunks(t *testing.T) {
+	us, fdb, _ := testUploadService(t)
+	upload := newUpload(t, us, 11)
+	for _, chunk := range []string{"hello", " ", "world"} {
+		n, err := us.Write(upload, strings.NewReader(chunk))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != int64(len(chunk)) {
+			t.Errorf("Wrong number of bytes written. Have: %d, Want: %d", n, len(chunk))
+		}
+	}
+	if !upload.Complete() {
+		t.Errorf("Expected the upload to be complete at offset %d", upload.Offset)
+	}
+	if have := fdb.uploads[upload.ID].Offset; have != 11 {
+		t.Errorf("Offset not saved. Have: %d, Want: 11", have)
+	}
+	if have := readAll(t, us, upload); have != "hello world" {
+		t.Errorf("Have: %q, Want: %q", have, "hello world")
+	}
+}
+
+func TestUploadWriteKeepsPartialChunk(t *testing.T) {
+	us, _, _ := testUploadService(t)
+	upload := newUpload(t, us, 11)
+	n, err := us.Write(upload, failingReader{strings.NewReader("hello w")})
+	if err != errDropped {
+		t.Errorf("Expected the read error to be returned, Got: %v", err)
+	}
+	if n != 7 || upload.Offset != 7 {
+		t.Errorf("Expected the received bytes to be kept. Have: %d at offset %d, Want: 7", n, upload.Offset)
+	}
+	if _, err := us.Write(upload, strings.NewReader("orld")); err != nil {
+		t.Fatal(err)
+	}
+	if have := readAll(t, us, upload); have != "hello world" {
+		t.Errorf("Have: %q, Want: %q", have, "hello world")
+	}
+}
+
+func TestUploadWriteRejectsExtraData(t *testing.T) {
+	us, _, store := testUploadService(t)
+	upload := newUpload(t, us, 5)
+	if _, err := us.Write(upload, strings.NewReader("too long")); err != errorsModel.ErrUploadTooLarge {
+		t.Errorf("Have: %v, Want: %v", err, errorsModel.ErrUploadTooLarge)
+	}
+	if upload.Offset != 0 {
+		t.Errorf("Expected the offset to be unchanged, Got: %d", upload.Offset)
+	}
+	if parts, _ := store.List(us.prefix(upload)); len(parts) != 0 {
+		t.Errorf("Expected the rejected chunk to be deleted, Got: %v", parts)
+	}
+}
+
+func TestUploadWriteConflict(t *testing.T) {
+	us, _, store := testUploadService(t)
+	upload := newUpload(t, us, 10)
+	// A second request for the same upload that read it before the first
+	// one finished.
+	stale := *upload
+	if _, err := us.Write(upload, strings.NewReader("abc")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := us.Write(&stale, strings.NewReader("xyz")); err != errorsModel.ErrUploadConflict {
+		t.Errorf("Have: %v, Want: %v", err, errorsModel.ErrUploadConflict)
+	}
+	if stale.Offset != 0 {
+		t.Errorf("Expected the stale offset to be unchanged, Got: %d", stale.Offset)
+	}
+	if have := readAll(t, us, upload); have != "abc" {
+		t.Errorf("Have: %q, Want: %q", have, "abc")
+	}
+	// The losing request's chunk isn't left behind.
+	parts, err := store.List(us.prefix(upload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) != 1 {
+		t.Errorf("Have: %d chunks, Want: %d", len(parts), 1)
+	}
+}
+
+func TestUploadOpenIgnoresUnconfirmedChunks(t *testing.T) {
+	us, _, store := testUploadService(t)
+	upload := newUpload(t, us, 10)
+	if _, err := us.Write(upload, strings.NewReader("abc")); err != nil {
+		t.Fatal(err)
+	}
+	// A chunk stored before a crash, but never recorded in the database.
+	orphan, err := us.partKey(upload, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(orphan, strings.NewReader("zzz")); err != nil {
+		t.Fatal(err)
+	}
+	if have := readAll(t, us, upload); have != "abc" {
+		t.Errorf("Have: %q, Want: %q", have, "abc")
+	}
+	// Retrying the chunk is recorded in its place.
+	if _, err := us.Write(upload, strings.NewReader("defg")); err != nil {
+		t.Fatal(err)
+	}
+	if have := readAll(t, us, upload); have != "abcdefg" {
+		t.Errorf("Have: %q, Want: %q", have, "abcdefg")
+	}
+
+	// A missing chunk is noticed rather than silently skipped.
+	if err := store.Delete(strings.Fields(upload.Parts)[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := us.Open(upload); err != errorsModel.ErrUploadIncomplete {
+		t.Errorf("Have: %v, Want: %v", err, errorsModel.ErrUploadIncomplete)
+	}
+}
+
+func TestUploadRemoveExpired(t *testing.T) {
+	us, fdb, store := testUploadService(t)
+	abandoned := newUpload(t, us, 10)
+	if _, err := us.Write(abandoned, bytes.NewReader([]byte("abc"))); err != nil {
+		t.Fatal(err)
+	}
+	start := us.now()
+	us.now = func() time.Time { return start.Add(UPLOAD_TTL / 2) }
+	active := newUpload(t, us, 10)
+
+	us.now = func() time.Time { return start.Add(UPLOAD_TTL + time.Minute) }
+	removed, err := us.RemoveExpired()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Errorf("Wrong number removed. Have: %d, Want: 1", removed)
+	}
+	if _, ok := fdb.uploads[abandoned.ID]; ok {
+		t.Errorf("Expected the abandoned upload to be removed")
+	}
+	if _, ok := fdb.uploads[active.ID]; !ok {
+		t.Errorf("Expected the active upload to be kept")
+	}
+	if parts, _ := store.List(us.prefix(abandoned)); len(parts) != 0 {
+		t.Errorf("Expected the abandoned data to be deleted, Got: %v", parts)
+	}
+}
@@ -0,0 +1,163 @@
+package uploadsModel
+
+import (
+	"encoding/hex"
+	"time"
+
+	"lenslocked/models/errorsModel"
+	"lenslocked/rand"
+)
+
+// uploadValidator is a chained type that performs validation and
+// normalization of data before being passed to the final UploadDB implementation
+type uploadValidator struct {
+	UploadDB
+}
+
+// uploadValidationFunction is a function signature given to all upload
+// validation functions so that it is easier to iterate over all the
+// upload validation functions and call them in a loop.
+type uploadValidationFunction func(*Upload) error
+
+// Creates a new instance of the uploadValidator
+func newUploadValidator(udb UploadDB) *uploadValidator {
+	return &uploadValidator{
+		UploadDB: udb,
+	}
+}
+
+// Create ensures that the upload belongs to a user and gallery, has a
+// filename and a size we are willing to accept, and gives it a token.
+func (uv *uploadValidator) Create(upload *Upload) error {
+	if err := uv.runUploadValidationFunctions(
+		upload,
+		uv.userIdRequirer,
+		uv.galleryIdRequirer,
+		uv.filenameRequirer,
+		uv.lengthChecker,
+		uv.tokenGenerator,
+	); err != nil {
+		return err
+	}
+	return uv.UploadDB.Create(upload)
+}
+
+// Advance makes sure the offset never runs past the end of the file.
+func (uv *uploadValidator) Advance(upload *Upload, n int64, part string, expiresAt time.Time) error {
+	if err := uv.runUploadValidationFunctions(
+		upload,
+		uv.idGreaterThan(0),
+		uv.offsetChecker,
+	); err != nil {
+		return err
+	}
+	if upload.Offset+n > upload.Length {
+		return errorsModel.ErrUploadTooLarge
+	}
+	return uv.UploadDB.Advance(upload, n, part, expiresAt)
+}
+
+// Unreserve validates an upload id and then calls the underlying UploadDB
+// Unreserve method.
+func (uv *uploadValidator) Unreserve(id uint) (bool, error) {
+	var upload Upload
+	upload.ID = id
+	if err := uv.runUploadValidationFunctions(
+		&upload,
+		uv.idGreaterThan(0),
+	); err != nil {
+		return false, err
+	}
+	return uv.UploadDB.Unreserve(id)
+}
+
+// Delete validates an upload id and then calls the underlying UploadDB Delete method.
+func (uv *uploadValidator) Delete(id uint) error {
+	var upload Upload
+	upload.ID = id
+	if err := uv.runUploadValidationFunctions(
+		&upload,
+		uv.idGreaterThan(0),
+	); err != nil {
+		return err
+	}
+	return uv.UploadDB.Delete(id)
+}
+
+// runUploadValidationFunctions calls each of the validation functions on
+// the upload and returns the first error encountered.
+func (uv *uploadValidator) runUploadValidationFunctions(upload *Upload, fns ...uploadValidationFunction) error {
+	for _, fn := range fns {
+		if err := fn(upload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// idGreaterThan checks to see if the upload has an ID greater than n.
+func (uv *uploadValidator) idGreaterThan(n uint) uploadValidationFunction {
+	return func(upload *Upload) error {
+		if upload.ID <= n {
+			return errorsModel.ErrIdInvalid
+		}
+		return nil
+	}
+}
+
+// userIdRequirer requires the upload to belong to a user.
+func (uv *uploadValidator) userIdRequirer(upload *Upload) error {
+	if upload.UserID <= 0 {
+		return errorsModel.ErrUserIdRequired
+	}
+	return nil
+}
+
+// galleryIdRequirer requires the upload to be headed for a gallery.
+func (uv *uploadValidator) galleryIdRequirer(upload *Upload) error {
+	if upload.GalleryID <= 0 {
+		return errorsModel.ErrGalleryIdRequired
+	}
+	return nil
+}
+
+// filenameRequirer requires the name of the file being uploaded, which is
+// needed to store it once it is complete.
+func (uv *uploadValidator) filenameRequirer(upload *Upload) error {
+	if upload.Filename == "" {
+		return errorsModel.ErrFilenameRequired
+	}
+	return nil
+}
+
+// lengthChecker requires the size of the file up front and rejects files
+// larger than MAX_UPLOAD_SIZE before any of the data is sent.
+func (uv *uploadValidator) lengthChecker(upload *Upload) error {
+	if upload.Length <= 0 {
+		return errorsModel.ErrUploadLengthInvalid
+	}
+	if upload.Length > MAX_UPLOAD_SIZE {
+		return errorsModel.ErrUploadTooLarge
+	}
+	return nil
+}
+
+// offsetChecker makes sure no more data is recorded than the upload said
+// it would have.
+func (uv *uploadValidator) offsetChecker(upload *Upload) error {
+	if upload.Offset < 0 || upload.Offset > upload.Length {
+		return errorsModel.ErrUploadTooLarge
+	}
+	return nil
+}
+
+// tokenGenerator generates the random token used in the upload's URL. It
+// is hex encoded so that it is also safe to use as a storage key.
+func (uv *uploadValidator) tokenGenerator(upload *Upload) error {
+	b, err := rand.Bytes(TOKEN_BYTES)
+	if err != nil {
+		return err
+	}
+	upload.Token = hex.EncodeToString(b)
+	return nil
+}
@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testStorage exercises the behavior every Storage implementation shares.
+func testStorage(t *testing.T, s Storage) {
+	t.Helper()
+	objects := map[string]string{
+		"galleries/1/a.jpg":   "first image",
+		"galleries/1/b.png":   "second image",
+		"galleries/12/c.jpg":  "another gallery",
+		"uploads/tmp/partial": "not an image",
+	}
+	for key, body := range objects {
+		if err := s.Put(key, strings.NewReader(body)); err != nil {
+			t.Fatalf("Put %s failed: %s", key, err)
+		}
+	}
+
+	r, err := s.Get("galleries/1/a.jpg")
+	if err != nil {
+		t.Fatalf("Get failed: %s", err)
+	}
+	body, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || string(body) != "first image" {
+		t.Errorf("Wrong contents. Have: %q, Want: %q", body, "first image")
+	}
+
+	// Objects can be read from any offset, which is how ranges are served.
+	r, err = s.Get("galleries/1/b.png")
+	if err != nil {
+		t.Fatalf("Get failed: %s", err)
+	}
+	if size, err := r.Seek(0, io.SeekEnd); err != nil || size != int64(len("second image")) {
+		t.Errorf("Wrong size from seeking to the end. Have: %d (%v)", size, err)
+	}
+	if _, err := r.Seek(7, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	part := make([]byte, 3)
+	if _, err := io.ReadFull(r, part); err != nil || string(part) != "ima" {
+		t.Errorf("Wrong bytes after seeking. Have: %q (%v), Want: %q", part, err, "ima")
+	}
+	if _, err := r.Seek(-2, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	rest, err := io.ReadAll(r)
+	if err != nil || string(rest) != "ge" {
+		t.Errorf("Wrong bytes at the end. Have: %q (%v), Want: %q", rest, err, "ge")
+	}
+	r.Close()
+
+	info, err := s.Stat("galleries/1/b.png")
+	if err != nil {
+		t.Fatalf("Stat failed: %s", err)
+	}
+	if info.Key != "galleries/1/b.png" || info.Size != int64(len("second image")) {
+		t.Errorf("Wrong object info. Have: %+v", info)
+	}
+
+	list, err := s.List("galleries/1/")
+	if err != nil {
+		t.Fatalf("List failed: %s", err)
+	}
+	if len(list) != 2 || list[0].Key != "galleries/1/a.jpg" || list[1].Key != "galleries/1/b.png" {
+		t.Errorf("Wrong listing for galleries/1/. Have: %+v", list)
+	}
+	list, err = s.List("galleries/1")
+	if err != nil {
+		t.Fatalf("List failed: %s", err)
+	}
+	if len(list) != 3 {
+		t.Errorf("Expected galleries/1 to also match galleries/12. Have: %+v", list)
+	}
+
+	// Replacing an object overwrites it.
+	if err := s.Put("galleries/1/a.jpg", strings.NewReader("replaced")); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := s.Stat("galleries/1/a.jpg"); info.Size != int64(len("replaced")) {
+		t.Errorf("Expected the object to be replaced. Have: %+v", info)
+	}
+
+	if err := s.Delete("galleries/1/a.jpg"); err != nil {
+		t.Fatalf("Delete failed: %s", err)
+	}
+	if _, err := s.Get("galleries/1/a.jpg"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound after delete, Got: %v", err)
+	}
+	if _, err := s.Stat("galleries/1/a.jpg"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound after delete, Got: %v", err)
+	}
+	if err := s.Delete("galleries/1/a.jpg"); err != nil {
+		t.Errorf("Expected deleting a missing object to succeed, Got: %s", err)
+	}
+	if list, _ := s.List("nothing/"); len(list) != 0 {
+		t.Errorf("Expected an empty listing, Have: %+v", list)
+	}
+
+	for _, key := range []string{"", "/etc/passwd", "../config.json", "galleries/../../x", "galleries//a", "a\\b", "galleries/1/."} {
+		if err := s.Put(key, strings.NewReader("x")); err != ErrInvalidKey {
+			t.Errorf("Expected Put %q to be refused, Got: %v", key, err)
+		}
+		if _, err := s.Get(key); err != ErrInvalidKey {
+			t.Errorf("Expected Get %q to be refused, Got: %v", key, err)
+		}
+		if err := s.Delete(key); err != ErrInvalidKey {
+			t.Errorf("Expected Delete %q to be refused, Got: %v", key, err)
+		}
+	}
+}
+
+func TestLocal(t *testing.T) {
+	root := t.TempDir()
+	testStorage(t, NewLocal(root, "/images"))
+	// Nothing should have been written outside of the root.
+	if _, err := os.Stat(filepath.Join(filepath.Dir(root), "config.json")); !os.IsNotExist(err) {
+		t.Errorf("Expected no file outside the root, Got: %v", err)
+	}
+}
+
+func TestLocalURL(t *testing.T) {
+	s := NewLocal(t.TempDir(), "/images/")
+	if have := s.URL("galleries/1/a.jpg"); have != "/images/galleries/1/a.jpg" {
+		t.Errorf("Wrong URL. Have: %s, Want: /images/galleries/1/a.jpg", have)
+	}
+}
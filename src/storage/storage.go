@@ -0,0 +1,59 @@
+// Package storage is used to keep files, such as gallery images, in a
+// backend that may or may not be the local disk. Keys are slash separated
+// paths like "galleries/12/abc.jpg" regardless of the backend.
+package storage
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when no object is stored under a key.
+	ErrNotFound = errors.New("storage: object not found")
+
+	// ErrInvalidKey is returned for keys that are empty or that could
+	// escape the storage root, such as keys containing "..".
+	ErrInvalidKey = errors.New("storage: invalid key")
+)
+
+// Storage is implemented by every storage backend.
+type Storage interface {
+	// Put stores the contents of r under key, replacing any existing object.
+	Put(key string, r io.Reader) error
+	// Get opens the object stored under key. The caller must close it.
+	// Objects are seekable so that byte ranges can be served from them.
+	Get(key string) (io.ReadSeekCloser, error)
+	// Delete removes the object stored under key. Deleting a key that
+	// doesn't exist is not an error.
+	Delete(key string) error
+	// List returns every object whose key starts with prefix, sorted by key.
+	List(prefix string) ([]ObjectInfo, error)
+	// Stat returns information about the object stored under key.
+	Stat(key string) (ObjectInfo, error)
+	// URL returns the address the object can be fetched from.
+	URL(key string) string
+}
+
+// ObjectInfo describes a stored object.
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// validateKey makes sure a key is a relative, slash separated path that
+// stays inside the storage root.
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.ContainsAny(key, "\\\x00") {
+		return ErrInvalidKey
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
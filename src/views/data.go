@@ -36,10 +36,13 @@ type Alert struct {
 // Data contains data to be rendered on the template. If an alert exists
 // then it will be set in the Alert property. Any other payload data to
 // be rendered on the page will be housed in the Payload property.
+// PendingComments is how many comments are waiting for the user's
+// approval, shown in the navbar.
 type Data struct {
-	Alert   *Alert
-	User    *usersModel.User
-	Payload interface{}
+	Alert           *Alert
+	User            *usersModel.User
+	PendingComments int
+	Payload         interface{}
 }
 
 // setAlert takes any error, both public and private, and sets an alert
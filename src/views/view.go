@@ -11,6 +11,7 @@ import (
 	"log"
 	"net/http"
 	"path/filepath"
+	"strings"
 
 	"lenslocked/context"
 )
@@ -23,6 +24,7 @@ func NewView(layout string, files ...string) *View {
 		"csrfField": func() (template.HTML, error) {
 			return "", errors.New("CSRF NOT IMPLEMENTED")
 		},
+		"placeholder": placeholderStyle,
 	}).ParseFiles(files...)
 	if err != nil {
 		panic(err)
@@ -33,6 +35,19 @@ func NewView(layout string, files ...string) *View {
 	}
 }
 
+// placeholderStyle returns the CSS that shows an image's placeholder behind
+// it until it has loaded. The result is trusted as CSS, so anything other
+// than a base64 encoded PNG data URI is left out.
+func placeholderStyle(uri string) template.CSS {
+	const prefix = "data:image/png;base64,"
+	const base64Chars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/="
+	data := strings.TrimPrefix(uri, prefix)
+	if len(data) == len(uri) || data == "" || strings.Trim(data, base64Chars) != "" {
+		return ""
+	}
+	return template.CSS("background: url(" + uri + ") center / cover no-repeat")
+}
+
 // The processViewNames function prepends common directory information
 // to the front of the filename and appends the extensions on the end.
 func processViewNames(files []string) {
@@ -67,6 +82,7 @@ func (v *View) Render(w http.ResponseWriter, r *http.Request, data interface{})
 		clearAlert(w)
 	}
 	vd.User = context.User(r.Context())
+	vd.PendingComments = context.PendingComments(r.Context())
 	var buf bytes.Buffer
 	csrfCookie, err := r.Cookie("_csrf")
 	if err != nil {